@@ -1,52 +1,481 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"github.com/saiset-co/sai-interx-manager/logger"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/saiset-co/sai-service/service"
+	"github.com/spf13/cast"
 	"go.uber.org/zap"
-	"time"
 
+	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-interx-manager/types"
 )
 
+var (
+	btcBlockRegex   = regexp.MustCompile(`^/blocks/([0-9a-fA-F]{64}|[0-9]+)$`)
+	btcTxRegex      = regexp.MustCompile(`^/transactions/([0-9a-fA-F]{64})$`)
+	btcAddressRegex = regexp.MustCompile(`^/addresses/([^/]+)/utxos$`)
+)
+
+// bitcoin address characters, an address is checked against them before it is put in a descriptor
+const (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	bech32Charset  = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// defaultScanTimeout bounds a UTXO scan when no scan timeout is configured
+const defaultScanTimeout = 5 * time.Minute
+
 type BitcoinGateway struct {
 	*BaseGateway
-	url string
+	// scanClient has no timeout of its own, a UTXO scan is bounded by scanTimeout instead
+	scanClient  *http.Client
+	scanTimeout time.Duration
+	nodes       []bitcoinNode
+	current     int
+	requestID   uint64
+	mutex       sync.RWMutex
+}
+
+type bitcoinNode struct {
+	url      string
+	user     string
+	password string
+}
+
+// BitcoinRPCError is an error answered by bitcoind itself, so trying another node would not help
+type BitcoinRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *BitcoinRPCError) Error() string {
+	return fmt.Sprintf("bitcoin rpc error %d: %s", e.Code, e.Message)
+}
+
+// bitcoinNodeError is a node that could not be reached or failed with a 5xx status without an RPC error,
+// the request is sent to the next node and retried
+type bitcoinNodeError struct {
+	err error
+}
+
+func (e *bitcoinNodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *bitcoinNodeError) Unwrap() error {
+	return e.err
+}
+
+func isBitcoinNodeError(err error) bool {
+	var nodeErr *bitcoinNodeError
+	return errors.As(err, &nodeErr)
 }
 
 var _ types.Gateway = (*BitcoinGateway)(nil)
 
-func NewBitcoinGateway(ctx *service.Context, url string, retryAttempts int, retryDelay time.Duration, rateLimit int) (*BitcoinGateway, error) {
+// NewBitcoinGateway creates a gateway to bitcoind JSON-RPC nodes, tried in order until one answers.
+// Credentials in a node URL take precedence over the shared user and password. scanTimeout bounds
+// a UTXO scan, which takes minutes on mainnet.
+func NewBitcoinGateway(ctx *service.Context, nodeURLs []string, user, password string, retryAttempts int, retryDelay time.Duration, rateLimit int, scanTimeout time.Duration) (*BitcoinGateway, error) {
+	var nodes []bitcoinNode
+
+	for _, nodeURL := range nodeURLs {
+		nodeURL = strings.TrimSpace(nodeURL)
+		if nodeURL == "" {
+			continue
+		}
+
+		parsed, err := url.Parse(nodeURL)
+		if err != nil {
+			logger.Logger.Error("NewBitcoinGateway", zap.Error(err))
+			return nil, err
+		}
+
+		node := bitcoinNode{user: user, password: password}
+		if parsed.User != nil {
+			node.user = parsed.User.Username()
+			node.password, _ = parsed.User.Password()
+			parsed.User = nil
+		}
+		node.url = parsed.String()
+
+		nodes = append(nodes, node)
+	}
+
+	if scanTimeout <= 0 {
+		scanTimeout = defaultScanTimeout
+	}
+
 	return &BitcoinGateway{
 		BaseGateway: NewBaseGateway(ctx, retryAttempts, retryDelay, rateLimit),
-		url:         url,
+		scanClient:  &http.Client{},
+		scanTimeout: scanTimeout,
+		nodes:       nodes,
 	}, nil
 }
 
-func (g *BitcoinGateway) Handle(data []byte) (interface{}, error) {
-	var req struct {
-		Method   string      `json:"method"`
-		Data     interface{} `json:"data"`
-		Metadata struct {
-			Token string `json:"token"`
-		} `json:"metadata"`
-	}
+func (g *BitcoinGateway) Handle(ctx context.Context, data []byte) (interface{}, error) {
+	var req types.InboundRequest
 
 	if err := json.Unmarshal(data, &req); err != nil {
-		logger.Logger.Error("CosmosGateway - Handle", zap.Error(err))
+		tracing.Logger(ctx).Error("BitcoinGateway - Handle", zap.Error(err))
+		return nil, err
+	}
+
+	path := strings.TrimPrefix(req.Path, "/bitcoin")
+
+	var handle func(ctx context.Context) (interface{}, error)
+
+	switch {
+	case path == "/status":
+		handle = g.status
+	case path == "/fees":
+		handle = func(ctx context.Context) (interface{}, error) {
+			return g.estimateFee(ctx, cast.ToInt(req.Payload["blocks"]), cast.ToString(req.Payload["mode"]))
+		}
+	case btcBlockRegex.MatchString(path):
+		blockID := btcBlockRegex.FindStringSubmatch(path)[1]
+		handle = func(ctx context.Context) (interface{}, error) {
+			return g.block(ctx, blockID, req.Payload["verbosity"])
+		}
+	case btcTxRegex.MatchString(path):
+		txID := btcTxRegex.FindStringSubmatch(path)[1]
+		handle = func(ctx context.Context) (interface{}, error) {
+			return g.transaction(ctx, txID, cast.ToString(req.Payload["block_hash"]))
+		}
+	case btcAddressRegex.MatchString(path):
+		address := btcAddressRegex.FindStringSubmatch(path)[1]
+		handle = func(ctx context.Context) (interface{}, error) {
+			return g.utxos(ctx, address)
+		}
+	default:
+		err := fmt.Errorf("unknown bitcoin endpoint: %s", req.Path)
+		tracing.Logger(ctx).Error("BitcoinGateway - Handle", zap.Error(err))
 		return nil, err
 	}
 
-	return g.retry.Do(func() (interface{}, error) {
-		if err := g.rateLimit.Wait(g.context.Context); err != nil {
-			logger.Logger.Error("CosmosGateway - Handle", zap.Error(err))
+	return g.retry.DoIf(func() (interface{}, error) {
+		if err := g.rateLimit.Wait(ctx); err != nil {
+			tracing.Logger(ctx).Error("BitcoinGateway - Handle", zap.Error(err))
 			return nil, err
 		}
-		return g.makeSaiRequest(g.context.Context, g.url, req)
-	})
+		return handle(ctx)
+	}, isBitcoinNodeError)
 }
 
 func (g *BitcoinGateway) Close() {
 
 }
+
+func (g *BitcoinGateway) status(ctx context.Context) (interface{}, error) {
+	var response = types.BTCStatus{}
+
+	var chainInfo struct {
+		Chain                string  `json:"chain"`
+		Blocks               uint64  `json:"blocks"`
+		BestBlockHash        string  `json:"bestblockhash"`
+		VerificationProgress float64 `json:"verificationprogress"`
+		InitialBlockDownload bool    `json:"initialblockdownload"`
+		Pruned               bool    `json:"pruned"`
+		PruneHeight          uint64  `json:"pruneheight"`
+	}
+	if err := g.callInto(ctx, &chainInfo, "getblockchaininfo"); err != nil {
+		return nil, err
+	}
+
+	response.NodeInfo.Network = chainInfo.Chain
+	response.NodeInfo.RPCAddress = g.currentNode().url
+	response.SyncInfo.CatchingUp = chainInfo.InitialBlockDownload
+	response.SyncInfo.VerificationProgress = chainInfo.VerificationProgress
+
+	var networkInfo struct {
+		Version         int64  `json:"version"`
+		SubVersion      string `json:"subversion"`
+		ProtocolVersion int64  `json:"protocolversion"`
+		Connections     int64  `json:"connections"`
+	}
+	if err := g.callInto(ctx, &networkInfo, "getnetworkinfo"); err != nil {
+		return nil, err
+	}
+
+	response.NodeInfo.Version.Node = networkInfo.Version
+	response.NodeInfo.Version.SubVersion = networkInfo.SubVersion
+	response.NodeInfo.Version.Protocol = networkInfo.ProtocolVersion
+	response.NodeInfo.Connections = networkInfo.Connections
+
+	latestTime, err := g.blockTime(ctx, chainInfo.BestBlockHash)
+	if err != nil {
+		return nil, err
+	}
+	response.SyncInfo.LatestBlockHash = chainInfo.BestBlockHash
+	response.SyncInfo.LatestBlockHeight = chainInfo.Blocks
+	response.SyncInfo.LatestBlockTime = latestTime
+
+	var earliestHeight uint64
+	if chainInfo.Pruned {
+		earliestHeight = chainInfo.PruneHeight
+	}
+
+	var earliestHash string
+	if err := g.callInto(ctx, &earliestHash, "getblockhash", earliestHeight); err != nil {
+		return nil, err
+	}
+
+	earliestTime, err := g.blockTime(ctx, earliestHash)
+	if err != nil {
+		return nil, err
+	}
+	response.SyncInfo.EarliestBlockHash = earliestHash
+	response.SyncInfo.EarliestBlockHeight = earliestHeight
+	response.SyncInfo.EarliestBlockTime = earliestTime
+
+	var fee struct {
+		FeeRate float64 `json:"feerate"`
+	}
+	if err := g.callInto(ctx, &fee, "estimatesmartfee", 6); err != nil {
+		return nil, err
+	}
+	if fee.FeeRate > 0 {
+		response.FeeRate = strconv.FormatFloat(fee.FeeRate, 'f', 8, 64)
+	}
+
+	return response, nil
+}
+
+func (g *BitcoinGateway) blockTime(ctx context.Context, blockHash string) (uint64, error) {
+	var header struct {
+		Time uint64 `json:"time"`
+	}
+	if err := g.callInto(ctx, &header, "getblockheader", blockHash); err != nil {
+		return 0, err
+	}
+	return header.Time, nil
+}
+
+// block returns a block by hash or height. Verbosity 0 is the raw hex, 1 lists transaction IDs, 2 decodes the transactions.
+func (g *BitcoinGateway) block(ctx context.Context, blockID string, verbosity interface{}) (interface{}, error) {
+	level := 1
+	if verbosity != nil {
+		level = cast.ToInt(verbosity)
+	}
+
+	blockHash := blockID
+	if len(blockID) != 64 {
+		height, err := strconv.ParseUint(blockID, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := g.callInto(ctx, &blockHash, "getblockhash", height); err != nil {
+			return nil, err
+		}
+	}
+
+	return g.call(ctx, "getblock", blockHash, level)
+}
+
+// transaction looks a transaction up in the mempool and the tx index, or in the given block on nodes without -txindex
+func (g *BitcoinGateway) transaction(ctx context.Context, txID, blockHash string) (interface{}, error) {
+	if blockHash != "" {
+		return g.call(ctx, "getrawtransaction", txID, true, blockHash)
+	}
+	return g.call(ctx, "getrawtransaction", txID, true)
+}
+
+// utxos scans the UTXO set for the outputs of an address. The scan takes a while on mainnet and bitcoind runs
+// one at a time, so a scan that runs out of time is not started over on another node or retried.
+func (g *BitcoinGateway) utxos(ctx context.Context, address string) (interface{}, error) {
+	if !isBitcoinAddress(address) {
+		return nil, fmt.Errorf("invalid bitcoin address %q", address)
+	}
+
+	scanCtx, cancel := context.WithTimeout(ctx, g.scanTimeout)
+	defer cancel()
+
+	result, err := g.callWith(scanCtx, g.scanClient, "scantxoutset", "start", []string{"addr(" + address + ")"})
+	if err != nil && scanCtx.Err() != nil {
+		return nil, fmt.Errorf("the utxo scan did not finish in %s: %w", g.scanTimeout, scanCtx.Err())
+	}
+
+	return result, err
+}
+
+// isBitcoinAddress reports whether the address is made of base58 or bech32 characters only, so that it cannot
+// change the descriptor it is put in. Whether it is a valid address is left to the node.
+func isBitcoinAddress(address string) bool {
+	if len(address) < 14 || len(address) > 90 {
+		return false
+	}
+
+	if strings.Trim(address, base58Alphabet) == "" {
+		return true
+	}
+
+	// bech32 is either all lower or all upper case, the human readable part is followed by 1 and the data
+	lower := strings.ToLower(address)
+	if address != lower && address != strings.ToUpper(address) {
+		return false
+	}
+
+	separator := strings.LastIndex(lower, "1")
+	if separator < 1 || len(lower)-separator-1 < 6 {
+		return false
+	}
+
+	return strings.Trim(lower[:separator], "abcdefghijklmnopqrstuvwxyz") == "" &&
+		strings.Trim(lower[separator+1:], bech32Charset) == ""
+}
+
+func (g *BitcoinGateway) estimateFee(ctx context.Context, blocks int, mode string) (interface{}, error) {
+	if blocks <= 0 {
+		blocks = 6
+	}
+
+	if mode != "" {
+		return g.call(ctx, "estimatesmartfee", blocks, strings.ToUpper(mode))
+	}
+	return g.call(ctx, "estimatesmartfee", blocks)
+}
+
+func (g *BitcoinGateway) callInto(ctx context.Context, target interface{}, method string, params ...interface{}) error {
+	result, err := g.call(ctx, method, params...)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(result, target); err != nil {
+		logger.Logger.Error("BitcoinGateway - callInto", zap.String("method", method), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (g *BitcoinGateway) call(ctx context.Context, method string, params ...interface{}) (json.RawMessage, error) {
+	return g.callWith(ctx, g.client, method, params...)
+}
+
+// callWith sends the request to the node that answered last and fails over to the next ones when a node is
+// unreachable or fails with a 5xx status. RPC errors and rejected requests are returned at once.
+func (g *BitcoinGateway) callWith(ctx context.Context, client *http.Client, method string, params ...interface{}) (json.RawMessage, error) {
+	if len(g.nodes) == 0 {
+		return nil, errors.New("no bitcoin nodes configured")
+	}
+
+	g.mutex.RLock()
+	start := g.current
+	g.mutex.RUnlock()
+
+	var lastErr error
+
+	for i := 0; i < len(g.nodes); i++ {
+		index := (start + i) % len(g.nodes)
+
+		result, err := g.callNode(ctx, client, g.nodes[index], method, params)
+		if err == nil {
+			g.setCurrent(index)
+			return result, nil
+		}
+
+		if !isBitcoinNodeError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		logger.Logger.Warn("BitcoinGateway - node failed",
+			zap.String("node", g.nodes[index].url),
+			zap.String("method", method),
+			zap.Error(err))
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("all bitcoin nodes failed: %w", lastErr)
+}
+
+func (g *BitcoinGateway) callNode(ctx context.Context, client *http.Client, node bitcoinNode, method string, params []interface{}) (json.RawMessage, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      atomic.AddUint64(&g.requestID, 1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, node.url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if node.user != "" || node.password != "" {
+		req.SetBasicAuth(node.user, node.password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &bitcoinNodeError{err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &bitcoinNodeError{err: err}
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, errors.New("bitcoin node rejected the credentials: " + resp.Status)
+	}
+
+	// bitcoind answers RPC errors with a non-200 status and the error in the body
+	var response struct {
+		Result json.RawMessage  `json:"result"`
+		Error  *BitcoinRPCError `json:"error"`
+	}
+	decodeErr := json.Unmarshal(body, &response)
+	if decodeErr == nil && response.Error != nil {
+		return nil, response.Error
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, &bitcoinNodeError{err: errors.New("non-200 status code: " + resp.Status)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("non-200 status code: " + resp.Status)
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return response.Result, nil
+}
+
+func (g *BitcoinGateway) currentNode() bitcoinNode {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.nodes[g.current]
+}
+
+func (g *BitcoinGateway) setCurrent(index int) {
+	g.mutex.Lock()
+	g.current = index
+	g.mutex.Unlock()
+}
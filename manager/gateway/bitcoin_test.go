@@ -0,0 +1,340 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/saiset-co/sai-service/service"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/types"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+// fixtureRPC serves responses recorded from a regtest bitcoind, keyed by "method params"
+func fixtureRPC(t *testing.T, user, password string) (*httptest.Server, *int) {
+	data, err := os.ReadFile("testdata/bitcoin_rpc.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fixtures map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		if u, p, ok := r.BasicAuth(); !ok || u != user || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			ID     interface{}     `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		result, ok := fixtures[req.Method+" "+string(req.Params)]
+		if !ok {
+			result, ok = fixtures[req.Method]
+		}
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": nil,
+				"error":  map[string]interface{}{"code": -5, "message": "No such mempool or blockchain transaction"},
+				"id":     req.ID,
+			})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": nil, "id": req.ID})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func handle(g *BitcoinGateway, path string, payload map[string]interface{}) (interface{}, error) {
+	data, _ := json.Marshal(types.InboundRequest{Method: "GET", Path: path, Payload: payload})
+	return g.Handle(context.Background(), data)
+}
+
+func decode(t *testing.T, result interface{}, target interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBitcoinStatusFailsOver(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(down.Close)
+
+	node, _ := fixtureRPC(t, "rpc", "secret")
+	nodeURL := strings.Replace(node.URL, "http://", "http://rpc:secret@", 1)
+
+	g, err := NewBitcoinGateway(service.NewContext(), []string{down.URL, nodeURL}, "", "", 1, time.Millisecond, 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := handle(g, "/bitcoin/status", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := result.(types.BTCStatus)
+	if status.NodeInfo.Network != "regtest" || status.NodeInfo.RPCAddress != node.URL {
+		t.Fatalf("unexpected node info %+v", status.NodeInfo)
+	}
+	if status.SyncInfo.LatestBlockHeight != 101 || status.SyncInfo.LatestBlockTime != 1729330600 || status.SyncInfo.EarliestBlockTime != 1296688602 {
+		t.Fatalf("unexpected sync info %+v", status.SyncInfo)
+	}
+	if status.NodeInfo.Version.SubVersion != "/Satoshi:27.0.0/" || status.FeeRate != "" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestBitcoinEndpoints(t *testing.T) {
+	node, calls := fixtureRPC(t, "rpc", "secret")
+
+	g, err := NewBitcoinGateway(service.NewContext(), []string{node.URL}, "rpc", "secret", 1, time.Millisecond, 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var block struct {
+		Height int64    `json:"height"`
+		Tx     []string `json:"tx"`
+	}
+	result, err := handle(g, "/bitcoin/blocks/101", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(t, result, &block)
+	if block.Height != 101 || len(block.Tx) != 1 {
+		t.Fatalf("unexpected block %+v", block)
+	}
+
+	var tx struct {
+		TxID string `json:"txid"`
+	}
+	result, err = handle(g, "/bitcoin/transactions/"+block.Tx[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(t, result, &tx)
+	if tx.TxID != block.Tx[0] {
+		t.Fatalf("unexpected transaction %+v", tx)
+	}
+
+	var utxos struct {
+		Unspents    []interface{} `json:"unspents"`
+		TotalAmount float64       `json:"total_amount"`
+	}
+	result, err = handle(g, "/bitcoin/addresses/bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080/utxos", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(t, result, &utxos)
+	if len(utxos.Unspents) != 1 || utxos.TotalAmount != 50 {
+		t.Fatalf("unexpected utxos %+v", utxos)
+	}
+
+	var fee struct {
+		FeeRate float64 `json:"feerate"`
+	}
+	result, err = handle(g, "/bitcoin/fees", map[string]interface{}{"blocks": 2, "mode": "economical"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(t, result, &fee)
+	if fee.FeeRate != 0.0001 {
+		t.Fatalf("unexpected fee estimate %+v", fee)
+	}
+
+	before := *calls
+	_, err = handle(g, "/bitcoin/transactions/"+strings.Repeat("f", 64), nil)
+	if rpcErr, ok := err.(*BitcoinRPCError); !ok || rpcErr.Code != -5 {
+		t.Fatalf("expected the node's RPC error, got %v", err)
+	}
+	if *calls-before != 1 {
+		t.Fatalf("expected an RPC error not to be retried on other nodes, got %d calls", *calls-before)
+	}
+
+	if _, err := handle(g, "/bitcoin/unknown", nil); err == nil {
+		t.Fatal("expected an unknown endpoint to be rejected")
+	}
+}
+
+func TestBitcoinRetriesOnlyUnavailableNodes(t *testing.T) {
+	failures := 0
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failures++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(flaky.Close)
+
+	node, calls := fixtureRPC(t, "rpc", "secret")
+
+	g, err := NewBitcoinGateway(service.NewContext(), []string{flaky.URL, node.URL}, "rpc", "secret", 3, time.Millisecond, 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := handle(g, "/bitcoin/blocks/101", nil); err != nil {
+		t.Fatal(err)
+	}
+	if failures != 1 {
+		t.Fatalf("expected the 5xx node to be failed over once, got %d calls", failures)
+	}
+
+	before := *calls
+	_, err = handle(g, "/bitcoin/transactions/"+strings.Repeat("f", 64), nil)
+	if rpcErr, ok := err.(*BitcoinRPCError); !ok || rpcErr.Code != -5 {
+		t.Fatalf("expected the node's RPC error, got %v", err)
+	}
+	if *calls-before != 1 || failures != 1 {
+		t.Fatalf("expected an RPC error to be returned without retries, got %d calls", *calls-before)
+	}
+
+	unauthorized, err := NewBitcoinGateway(service.NewContext(), []string{node.URL, flaky.URL}, "rpc", "wrong", 3, time.Millisecond, 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before = *calls
+	if _, err := handle(unauthorized, "/bitcoin/status", nil); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Fatalf("expected the rejected credentials to be returned, got %v", err)
+	}
+	if *calls-before != 1 || failures != 1 {
+		t.Fatalf("expected rejected credentials not to be retried, got %d calls", *calls-before)
+	}
+
+	down, err := NewBitcoinGateway(service.NewContext(), []string{flaky.URL}, "rpc", "secret", 3, time.Millisecond, 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := handle(down, "/bitcoin/status", nil); err == nil {
+		t.Fatal("expected an unavailable node to fail")
+	}
+	if failures != 4 {
+		t.Fatalf("expected an unavailable node to be retried 3 times, got %d calls", failures-1)
+	}
+}
+
+func TestBitcoinStopsWhenTheRequestIsCancelled(t *testing.T) {
+	var calls int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	g, err := NewBitcoinGateway(service.NewContext(), []string{slow.URL, slow.URL}, "rpc", "secret", 3, time.Millisecond, 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	data, _ := json.Marshal(types.InboundRequest{Method: "GET", Path: "/bitcoin/status"})
+	if _, err := g.Handle(ctx, data); err == nil {
+		t.Fatal("expected the cancelled request to fail")
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Fatalf("expected the cancelled request not to be sent to other nodes, got %d calls", calls)
+	}
+}
+
+func TestBitcoinUTXOScanTimeoutIsNotRetried(t *testing.T) {
+	var calls int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	g, err := NewBitcoinGateway(service.NewContext(), []string{slow.URL, slow.URL}, "rpc", "secret", 3, time.Millisecond, 1000, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := handle(g, "/bitcoin/addresses/bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4/utxos", nil); err == nil {
+		t.Fatal("expected the scan to run out of time")
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Fatalf("expected a scan that ran out of time not to start over, got %d scans", calls)
+	}
+}
+
+func TestBitcoinAddressesCannotChangeTheDescriptor(t *testing.T) {
+	valid := []string{
+		"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa",
+		"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4",
+		"bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+		"bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080",
+	}
+	for _, address := range valid {
+		if !isBitcoinAddress(address) {
+			t.Fatalf("expected %s to be accepted", address)
+		}
+	}
+
+	invalid := []string{
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4),addr(1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa",
+		"1A1zP1eP5QGefi2DMPTfTL5SLmv7Divf)",
+		"raw(6a)#checksum12345",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3tB",
+		"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfN0",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3bo",
+		"bc1",
+		"",
+	}
+	for _, address := range invalid {
+		if isBitcoinAddress(address) {
+			t.Fatalf("expected %q to be refused", address)
+		}
+	}
+
+	node, calls := fixtureRPC(t, "rpc", "secret")
+	g, err := NewBitcoinGateway(service.NewContext(), []string{node.URL}, "rpc", "secret", 1, time.Millisecond, 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handle(g, "/bitcoin/addresses/"+invalid[0]+"/utxos", nil); err == nil || *calls != 0 {
+		t.Fatalf("expected the address to be refused before calling the node, got %v after %d calls", err, *calls)
+	}
+}
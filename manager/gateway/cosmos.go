@@ -42,6 +42,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-interx-manager/types"
 	"github.com/saiset-co/sai-service/service"
 	"go.uber.org/zap"
@@ -268,16 +269,14 @@ func NewCosmosGateway(ctx *service.Context, storage types.Storage, cosmosConfig
 	}, nil
 }
 
-func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(g.config.GWTimeout)*time.Second)
+func (g *CosmosGateway) Handle(ctx context.Context, data []byte) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(g.config.GWTimeout)*time.Second)
 	defer cancel()
 
-	g.context.Context = ctx
-
 	var req types.InboundRequest
 
 	if err := json.Unmarshal(data, &req); err != nil {
-		logger.Logger.Error("CosmosGateway - Handle - Unmarshal request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("CosmosGateway - Handle - Unmarshal request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -287,12 +286,12 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		accountID := matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
 
-			return g.account(accountID)
+			return g.account(ctx, accountID)
 		})
 	}
 
@@ -302,11 +301,11 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		accountID := matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
-			return g.balances(req, accountID)
+			return g.balances(ctx, req, accountID)
 		})
 	}
 
@@ -316,11 +315,11 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		address := matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
-			return g.identityRecords(address)
+			return g.identityRecords(ctx, address)
 		})
 	}
 
@@ -330,11 +329,11 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		approver := matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
-			return g.identityVerifyRequestsByApprover(req, approver)
+			return g.identityVerifyRequestsByApprover(ctx, req, approver)
 		})
 	}
 
@@ -344,11 +343,11 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		approver := matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
-			return g.identityVerifyRequestsByRequester(req, approver)
+			return g.identityVerifyRequestsByRequester(ctx, req, approver)
 		})
 	}
 
@@ -358,11 +357,11 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		hash := matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
-			return g.txByHash(hash)
+			return g.txByHash(ctx, hash)
 		})
 	}
 
@@ -372,11 +371,11 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		blockID := matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
-			return g.txByBlock(req, blockID)
+			return g.txByBlock(ctx, req, blockID)
 		})
 	}
 
@@ -386,11 +385,11 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		blockID := matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
-			return g.blockById(req, blockID)
+			return g.blockById(ctx, req, blockID)
 		})
 	}
 
@@ -400,14 +399,14 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		proposalId := matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
 
 			req.Path = "/kira/gov/proposals/" + proposalId
 
-			return g.proxy(req)
+			return g.proxy(ctx, req)
 		})
 	}
 
@@ -417,12 +416,12 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 		req.Path = "/" + matches[1]
 
 		return g.retry.Do(func() (interface{}, error) {
-			if err := g.rateLimit.Wait(g.context.Context); err != nil {
-				logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 				return nil, err
 			}
 
-			return g.tendermint(req)
+			return g.tendermint(ctx, req)
 		})
 	}
 
@@ -430,183 +429,217 @@ func (g *CosmosGateway) Handle(data []byte) (interface{}, error) {
 	case "/dashboard":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.dashboard()
+				return g.dashboard(ctx)
 			})
 		}
 	case "/status":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.statusAPI()
+				return g.statusAPI(ctx)
 			})
 		}
 	case "/valopers":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
+					return nil, err
+				}
+				return g.validators(ctx, req)
+			})
+		}
+	case "/valopers/history":
+		{
+			return g.retry.Do(func() (interface{}, error) {
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
+					return nil, err
+				}
+				return g.validatorHistory(ctx, req)
+			})
+		}
+	case "/valopers/updates":
+		{
+			return g.retry.Do(func() (interface{}, error) {
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
+					return nil, err
+				}
+				return g.validatorUpdates(ctx, req)
+			})
+		}
+	case "/kira/gov/outcomes":
+		{
+			return g.retry.Do(func() (interface{}, error) {
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.validators(req)
+				return g.proposalOutcomes(ctx, req)
 			})
 		}
 	case "/kira/txs":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.txs(req)
+				// GET lists the indexed transactions like /transactions, other methods broadcast one
+				if req.Method == http.MethodGet {
+					return g.transactions(ctx, req)
+				}
+				return g.txs(ctx, req)
 			})
 		}
 	case "/kira/delegations":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.delegations(req)
+				return g.delegations(ctx, req)
 			})
 		}
 	case "/kira/gov/execution_fee":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.executionFee(req)
+				return g.executionFee(ctx, req)
 			})
 		}
 	case "/kira/gov/network_properties":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.networkProperties()
+				return g.networkProperties(ctx)
 			})
 		}
 	case "/kira/staking-pool":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.stakingPool(req)
+				return g.stakingPool(ctx, req)
 			})
 		}
 	case "/kira/undelegations":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.undelegations(req)
+				return g.undelegations(ctx, req)
 			})
 		}
 	case "/transactions":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.transactions(req)
+				return g.transactions(ctx, req)
 			})
 		}
 	case "/blocks":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.blocks(req)
+				return g.blocks(ctx, req)
 			})
 		}
 	case "/kira/status":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.status()
+				return g.status(ctx)
 			})
 		}
 	case "/kira/tokens/rates":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.tokenRates()
+				return g.tokenRates(ctx)
 			})
 		}
 	case "/kira/gov/proposals":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.proposals(req)
+				return g.proposals(ctx, req)
 			})
 		}
 	case "/kira/tokens/aliases":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.tokenAliases(req)
+				return g.tokenAliases(ctx, req)
 			})
 		}
 	case "/kira/faucet":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.faucet(req)
+				return g.faucet(ctx, req)
 			})
 		}
 
 	case "/tendermint":
 		{
 			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", g.context.Context))
+				if err := g.rateLimit.Wait(ctx); err != nil {
+					tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err), zap.Any("ctx", ctx))
 					return nil, err
 				}
-				return g.tendermint(req)
+				return g.tendermint(ctx, req)
 			})
 		}
 	}
 
 	return g.retry.Do(func() (interface{}, error) {
-		if err := g.rateLimit.Wait(g.context.Context); err != nil {
-			logger.Logger.Error("CosmosGateway - Handle - Rate limit exceeded", zap.Error(err))
+		if err := g.rateLimit.Wait(ctx); err != nil {
+			tracing.Logger(ctx).Error("CosmosGateway - Handle - Rate limit exceeded", zap.Error(err))
 			return nil, err
 		}
 
-		return g.proxy(req)
+		return g.proxy(ctx, req)
 	})
 }
 
@@ -621,14 +654,14 @@ func (g *CosmosGateway) makeTendermintRPCRequest(ctx context.Context, url string
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
-		logger.Logger.Error("MakeTendermintRPCRequest - [rpc-call] Unable to connect to server", zap.Error(err))
+		tracing.Logger(ctx).Error("MakeTendermintRPCRequest - [rpc-call] Unable to connect to server", zap.Error(err))
 		return nil, err
 	}
 
 	httpClient := &http.Client{}
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		logger.Logger.Error("MakeTendermintRPCRequest - [rpc-call] Unable to connect to server", zap.Error(err))
+		tracing.Logger(ctx).Error("MakeTendermintRPCRequest - [rpc-call] Unable to connect to server", zap.Error(err))
 		return nil, err
 	}
 	defer resp.Body.Close()
@@ -636,7 +669,7 @@ func (g *CosmosGateway) makeTendermintRPCRequest(ctx context.Context, url string
 	response := new(types.RPCResponse)
 	err = json.NewDecoder(resp.Body).Decode(response)
 	if err != nil {
-		logger.Logger.Debug("MakeTendermintRPCRequest - [rpc-call] Unable to decode response",
+		tracing.Logger(ctx).Debug("MakeTendermintRPCRequest - [rpc-call] Unable to decode response",
 			zap.Any("body", resp.Body), zap.Any("endpoint", endpoint), zap.Error(err))
 		return nil, err
 	}
@@ -648,23 +681,23 @@ func (g *CosmosGateway) makeTendermintRPCRequest(ctx context.Context, url string
 	return response.Result, nil
 }
 
-func (g *CosmosGateway) proxy(req types.InboundRequest) ([]byte, error) {
+func (g *CosmosGateway) proxy(ctx context.Context, req types.InboundRequest) ([]byte, error) {
 	dataBytes, err := json.Marshal(req.Payload)
 	if err != nil {
-		logger.Logger.Error("[query-proxy] Marshal payload failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-proxy] Marshal payload failed", zap.Error(err))
 		return nil, err
 	}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, req.Method, req.Path, strings.NewReader(string(dataBytes)))
+	gatewayReq, err := http.NewRequestWithContext(ctx, req.Method, req.Path, strings.NewReader(string(dataBytes)))
 	if err != nil {
-		logger.Logger.Error("[query-proxy] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-proxy] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	gatewayReq = g.encodeQuery(gatewayReq, req)
 	grpcBytes, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-proxy] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-proxy] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -672,16 +705,16 @@ func (g *CosmosGateway) proxy(req types.InboundRequest) ([]byte, error) {
 	//
 	//err = json.Unmarshal(grpcBytes, &result)
 	//if err != nil {
-	//	logger.Logger.Error("CosmosGateway - validators - Unmarshal response failed", zap.Error(err))
+	//	tracing.Logger(ctx).Error("CosmosGateway - validators - Unmarshal response failed", zap.Error(err))
 	//	return nil, err
 	//}
 
 	return grpcBytes, nil
 }
 
-func (g *CosmosGateway) tendermint(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) tendermint(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	query := mapToQuery(req.Payload)
-	return g.makeTendermintRPCRequest(g.context.Context, req.Path, query.Encode())
+	return g.makeTendermintRPCRequest(ctx, req.Path, query.Encode())
 }
 
 func (g *CosmosGateway) filterAndPaginateValidators(response *types.ValidatorsResponse, payload map[string]interface{}) (*types.ValidatorsResponse, error) {
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -15,19 +16,19 @@ import (
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	"go.uber.org/zap"
 
-	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-interx-manager/types"
 )
 
-func (g *CosmosGateway) allValidators() (*types.ValidatorsResponse, error) {
+func (g *CosmosGateway) allValidators(ctx context.Context) (*types.ValidatorsResponse, error) {
 	validators := new(types.ValidatorsResponse)
 	limit := sekaitypes.PageIterationLimit - 1
 	offset := 0
 
 	for {
-		gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/staking/validators", nil)
+		gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/staking/validators", nil)
 		if err != nil {
-			logger.Logger.Error("[query-validators] Create request failed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-validators] Create request failed", zap.Error(err))
 			return nil, err
 		}
 
@@ -38,14 +39,14 @@ func (g *CosmosGateway) allValidators() (*types.ValidatorsResponse, error) {
 
 		respBody, err := g.grpcProxy.ServeGRPC(gatewayReq)
 		if err != nil {
-			logger.Logger.Error("[query-validators] Serve request failed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-validators] Serve request failed", zap.Error(err))
 			return nil, err
 		}
 
 		subResult := new(types.ValidatorsResponse)
 		err = json.Unmarshal(respBody, subResult)
 		if err != nil {
-			logger.Logger.Error("[query-validators] Unmarshal response failed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-validators] Unmarshal response failed", zap.Error(err))
 			return nil, err
 		}
 
@@ -61,49 +62,49 @@ func (g *CosmosGateway) allValidators() (*types.ValidatorsResponse, error) {
 	return validators, nil
 }
 
-func (g *CosmosGateway) supply() (*types.TokenSupplyResponse, error) {
+func (g *CosmosGateway) supply(ctx context.Context) (*types.TokenSupplyResponse, error) {
 	var tokenSupplyResponse = new(types.TokenSupplyResponse)
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/cosmos/bank/v1beta1/supply", nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/cosmos/bank/v1beta1/supply", nil)
 	if err != nil {
-		logger.Logger.Error("[query-supply] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-supply] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	respBody, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-supply] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-supply] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(respBody, tokenSupplyResponse)
 	if err != nil {
-		logger.Logger.Error("[query-supply] Unmarshal response failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-supply] Unmarshal response failed", zap.Error(err))
 		return nil, err
 	}
 
 	return tokenSupplyResponse, nil
 }
 
-func (g *CosmosGateway) tokens() ([]string, error) {
+func (g *CosmosGateway) tokens(ctx context.Context) ([]string, error) {
 	tokenRatesResponse := types.TokenAliasesGRPCResponse{}
 	poolTokens := make([]string, 0)
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/tokens/infos", nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/tokens/infos", nil)
 	if err != nil {
-		logger.Logger.Error("[query-tokens] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-tokens] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	respBody, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-tokens] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-tokens] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(respBody, &tokenRatesResponse)
 	if err != nil {
-		logger.Logger.Error("[query-tokens] Unmarshal response failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-tokens] Unmarshal response failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -114,15 +115,15 @@ func (g *CosmosGateway) tokens() ([]string, error) {
 	return poolTokens, nil
 }
 
-func (g *CosmosGateway) signingInfos() (*types.ValidatorInfoResponse, error) {
+func (g *CosmosGateway) signingInfos(ctx context.Context) (*types.ValidatorInfoResponse, error) {
 	validatorInfosResponse := new(types.ValidatorInfoResponse)
 	limit := sekaitypes.PageIterationLimit - 1
 	offset := 0
 
 	for {
-		gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/slashing/v1beta1/signing_infos", nil)
+		gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/slashing/v1beta1/signing_infos", nil)
 		if err != nil {
-			logger.Logger.Error("[query-signing-infos] Create request failed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-signing-infos] Create request failed", zap.Error(err))
 			return nil, err
 		}
 
@@ -133,14 +134,14 @@ func (g *CosmosGateway) signingInfos() (*types.ValidatorInfoResponse, error) {
 
 		respBody, err := g.grpcProxy.ServeGRPC(gatewayReq)
 		if err != nil {
-			logger.Logger.Error("[query-signing-infos] Serve request failed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-signing-infos] Serve request failed", zap.Error(err))
 			return nil, err
 		}
 
 		subResult := new(types.ValidatorInfoResponse)
 		err = json.Unmarshal(respBody, subResult)
 		if err != nil {
-			logger.Logger.Error("[query-signing-infos] Unmarshal response failed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-signing-infos] Unmarshal response failed", zap.Error(err))
 			return nil, err
 		}
 
@@ -155,7 +156,7 @@ func (g *CosmosGateway) signingInfos() (*types.ValidatorInfoResponse, error) {
 	return validatorInfosResponse, nil
 }
 
-func (g *CosmosGateway) validatorsPool() (*types.AllPools, error) {
+func (g *CosmosGateway) validatorsPool(ctx context.Context) (*types.AllPools, error) {
 	type ValidatorPoolsResponse struct {
 		Pools []types.ValidatorPool `json:"pools,omitempty"`
 	}
@@ -167,21 +168,21 @@ func (g *CosmosGateway) validatorsPool() (*types.AllPools, error) {
 		IdToPool:  make(map[int64]types.ValidatorPool),
 	}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/multistaking/v1beta1/staking_pools", nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/multistaking/v1beta1/staking_pools", nil)
 	if err != nil {
-		logger.Logger.Error("[query-validators-pool] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-validators-pool] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	respBody, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-validators-pool] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-validators-pool] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(respBody, &pools)
 	if err != nil {
-		logger.Logger.Error("[query-validators-pool] Unmarshal response failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-validators-pool] Unmarshal response failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -193,34 +194,34 @@ func (g *CosmosGateway) validatorsPool() (*types.AllPools, error) {
 	return allPools, nil
 }
 
-func (g *CosmosGateway) dashboard() (*types.AllValidators, error) {
+func (g *CosmosGateway) dashboard(ctx context.Context) (*types.AllValidators, error) {
 	allValidators := &types.AllValidators{
 		AddrToValidator: make(map[string]string),
 		PoolToValidator: make(map[int64]types.QueryValidator),
 		PoolTokens:      make([]string, 0),
 	}
 
-	validatorsData, err := g.allValidators()
+	validatorsData, err := g.allValidators(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-dashboard] validators", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-dashboard] validators", zap.Error(err))
 		return nil, err
 	}
 
-	tokens, err := g.tokens()
+	tokens, err := g.tokens(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-dashboard] failed to get tokens", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-dashboard] failed to get tokens", zap.Error(err))
 		return nil, err
 	}
 
-	signingInfos, err := g.signingInfos()
+	signingInfos, err := g.signingInfos(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-dashboard] failed to get signingInfos", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-dashboard] failed to get signingInfos", zap.Error(err))
 		return nil, err
 	}
 
-	validatorsPool, err := g.validatorsPool()
+	validatorsPool, err := g.validatorsPool(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-dashboard] failed to get validatorsPool", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-dashboard] failed to get validatorsPool", zap.Error(err))
 		return nil, err
 	}
 
@@ -330,7 +331,7 @@ func (g *CosmosGateway) dashboard() (*types.AllValidators, error) {
 	return allValidators, nil
 }
 
-func (g *CosmosGateway) txs(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) txs(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	type PostTxReq struct {
 		Tx   string `json:"tx"`
 		Mode string `json:"mode"`
@@ -340,13 +341,13 @@ func (g *CosmosGateway) txs(req types.InboundRequest) (interface{}, error) {
 
 	reqParams, err := json.Marshal(req.Payload)
 	if err != nil {
-		logger.Logger.Error("txs", zap.Error(err))
+		tracing.Logger(ctx).Error("txs", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(reqParams, &request)
 	if err != nil {
-		logger.Logger.Error("txs", zap.Error(err))
+		tracing.Logger(ctx).Error("txs", zap.Error(err))
 		return nil, err
 	}
 
@@ -368,33 +369,33 @@ func (g *CosmosGateway) txs(req types.InboundRequest) (interface{}, error) {
 
 	txBytes, err := base64.StdEncoding.DecodeString(request.Tx)
 	if err != nil {
-		logger.Logger.Error("txs", zap.Error(err))
+		tracing.Logger(ctx).Error("txs", zap.Error(err))
 		return nil, err
 	}
 
-	return g.makeTendermintRPCRequest(g.context.Context, _url, fmt.Sprintf("tx=0x%X", txBytes))
+	return g.makeTendermintRPCRequest(ctx, _url, fmt.Sprintf("tx=0x%X", txBytes))
 }
 
-func (g *CosmosGateway) validators(req types.InboundRequest) (*types.ValidatorsResponse, error) {
-	validatorsResponse, err := g.allValidators()
+func (g *CosmosGateway) validators(ctx context.Context, req types.InboundRequest) (*types.ValidatorsResponse, error) {
+	validatorsResponse, err := g.allValidators(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-validators] allValidators failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-validators] allValidators failed", zap.Error(err))
 		return nil, err
 	}
 
 	return g.filterAndPaginateValidators(validatorsResponse, req.Payload)
 }
 
-func (g *CosmosGateway) account(address string) (*types.AccountResponse, error) {
+func (g *CosmosGateway) account(ctx context.Context, address string) (*types.AccountResponse, error) {
 	accountReq := types.InboundRequest{
 		Method:  "GET",
 		Path:    "/cosmos/auth/v1beta1/accounts/" + address,
 		Payload: map[string]interface{}{},
 	}
 
-	accountInfoBytes, err := g.proxy(accountReq)
+	accountInfoBytes, err := g.proxy(ctx, accountReq)
 	if err != nil {
-		logger.Logger.Error("[query-account] Failed getting account info", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-account] Failed getting account info", zap.Error(err))
 		return nil, err
 	}
 
@@ -402,7 +403,7 @@ func (g *CosmosGateway) account(address string) (*types.AccountResponse, error)
 
 	err = json.Unmarshal(accountInfoBytes, accountResponse)
 	if err != nil {
-		logger.Logger.Error("[query-account] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-account] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
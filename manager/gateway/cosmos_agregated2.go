@@ -1,11 +1,11 @@
 package gateway
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"github.com/saiset-co/sai-storage-mongo/external/adapter"
 	"math"
 	"net/http"
 	"strconv"
@@ -18,28 +18,29 @@ import (
 	"github.com/spf13/cast"
 	"go.uber.org/zap"
 
-	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-interx-manager/types"
 	"github.com/saiset-co/sai-interx-manager/utils"
 )
 
-func (g *CosmosGateway) statusAPI() (interface{}, error) {
+func (g *CosmosGateway) statusAPI(ctx context.Context) (interface{}, error) {
 	result := types.InterxStatus{
 		ID: cast.ToString(g.context.GetConfig("p2p.id", "")),
 	}
 
-	genesis, err := g.genesis()
+	genesis, err := g.genesis(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-status] Failed to query genesis", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-status] Failed to query genesis", zap.Error(err))
 		return nil, err
 	}
 
 	result.InterxInfo.ChainID = genesis.GenesisDoc.ChainID
 	result.InterxInfo.GenesisChecksum = fmt.Sprintf("%x", sha256.Sum256(genesis.GenesisData))
 
-	sentryStatus, err := g.status()
+	sentryStatus, err := g.status(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-status] Failed to query status", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-status] Failed to query status", zap.Error(err))
 		return nil, err
 	}
 
@@ -60,10 +61,10 @@ func (g *CosmosGateway) statusAPI() (interface{}, error) {
 	return result, nil
 }
 
-func (g *CosmosGateway) status() (*types.KiraStatus, error) {
-	success, err := g.makeTendermintRPCRequest(g.context.Context, "/status", "")
+func (g *CosmosGateway) status(ctx context.Context) (*types.KiraStatus, error) {
+	success, err := g.makeTendermintRPCRequest(ctx, "/status", "")
 	if err != nil {
-		logger.Logger.Error("[kira-status] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[kira-status] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
@@ -71,59 +72,79 @@ func (g *CosmosGateway) status() (*types.KiraStatus, error) {
 
 	byteData, err := json.Marshal(success)
 	if err != nil {
-		logger.Logger.Error("[kira-status] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[kira-status] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(byteData, result)
 	if err != nil {
-		logger.Logger.Error("[kira-status] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[kira-status] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-func (g *CosmosGateway) genesisChunked(chunk int) (*types.GenesisChunkedResponse, error) {
-	data, _ := g.makeTendermintRPCRequest(g.context.Context, "/genesis_chunked", fmt.Sprintf("chunk=%d", chunk))
+// ChainState reports the chain id, latest block height and sync flag of the sekai node
+func (g *CosmosGateway) ChainState(ctx context.Context) (p2p.ChainState, error) {
+	status, err := g.status(ctx)
+	if err != nil {
+		return p2p.ChainState{}, err
+	}
+
+	height, err := strconv.ParseInt(status.SyncInfo.LatestBlockHeight, 10, 64)
+	if err != nil {
+		tracing.Logger(ctx).Error("[chain-state] Invalid block height", zap.Error(err))
+		return p2p.ChainState{}, err
+	}
+
+	return p2p.ChainState{
+		ChainID:           status.NodeInfo.Network,
+		LatestBlockHeight: height,
+		CatchingUp:        status.SyncInfo.CatchingUp,
+	}, nil
+}
+
+func (g *CosmosGateway) genesisChunked(ctx context.Context, chunk int) (*types.GenesisChunkedResponse, error) {
+	data, _ := g.makeTendermintRPCRequest(ctx, "/genesis_chunked", fmt.Sprintf("chunk=%d", chunk))
 
 	genesis := new(types.GenesisChunkedResponse)
 	byteData, err := json.Marshal(data)
 	if err != nil {
-		logger.Logger.Error("[genesis-chunked] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[genesis-chunked] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(byteData, genesis)
 	if err != nil {
-		logger.Logger.Error("[genesis-chunked] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[genesis-chunked] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	return genesis, nil
 }
 
-func (g *CosmosGateway) genesis() (*types.GenesisInfo, error) {
+func (g *CosmosGateway) genesis(ctx context.Context) (*types.GenesisInfo, error) {
 	gInfo := new(types.GenesisInfo)
 	gInfo.GenesisDoc = new(types2.GenesisDoc)
 
-	genesisData, err := g.genesisChunked(0)
+	genesisData, err := g.genesisChunked(ctx, 0)
 	if err != nil {
-		logger.Logger.Error("[query-genesis] Failed to get genesis part", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-genesis] Failed to get genesis part", zap.Error(err))
 		return nil, err
 	}
 
 	total, err := strconv.Atoi(genesisData.Total)
 	if err != nil {
-		logger.Logger.Error("[query-genesis] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-genesis] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	if total > 1 {
 		for i := 1; i < total; i++ {
-			nextData, err := g.genesisChunked(i)
+			nextData, err := g.genesisChunked(ctx, i)
 			if err != nil {
-				logger.Logger.Error("[query-genesis] Failed to get genesis part", zap.Error(err))
+				tracing.Logger(ctx).Error("[query-genesis] Failed to get genesis part", zap.Error(err))
 				return nil, err
 			}
 
@@ -135,20 +156,20 @@ func (g *CosmosGateway) genesis() (*types.GenesisInfo, error) {
 
 	err = tmjson.Unmarshal(genesisData.Data, gInfo.GenesisDoc)
 	if err != nil {
-		logger.Logger.Error("[query-genesis] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-genesis] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	err = gInfo.GenesisDoc.ValidateAndComplete()
 	if err != nil {
-		logger.Logger.Error("[query-genesis] Genesis not valid", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-genesis] Genesis not valid", zap.Error(err))
 		return nil, err
 	}
 
 	return gInfo, nil
 }
 
-func (g *CosmosGateway) blocks(req types.InboundRequest) (*types.BlocksResultResponse, error) {
+func (g *CosmosGateway) blocks(ctx context.Context, req types.InboundRequest) (*types.BlocksResultResponse, error) {
 	var result types.BlocksResultResponse
 	var criteria = map[string]interface{}{}
 
@@ -158,6 +179,8 @@ func (g *CosmosGateway) blocks(req types.InboundRequest) (*types.BlocksResultRes
 		Offset int    `json:"offset,string,omitempty"`
 		HasTxs int    `json:"has_txs,string,omitempty"`
 		Order  string `json:"order_by,omitempty"`
+		Cursor string `json:"cursor,omitempty"`
+		Count  string `json:"count_total,omitempty"`
 	}
 
 	request := BlocksRequest{
@@ -169,20 +192,21 @@ func (g *CosmosGateway) blocks(req types.InboundRequest) (*types.BlocksResultRes
 
 	jsonData, err := json.Marshal(req.Payload)
 	if err != nil {
-		logger.Logger.Error("[query-blocks] Invalid request format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-blocks] Invalid request format", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(jsonData, &request)
 	if err != nil {
-		logger.Logger.Error("[query-blocks] Invalid request format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-blocks] Invalid request format", zap.Error(err))
 		return nil, err
 	}
 
-	options := &adapter.Options{
-		Count: 1,
-		Limit: int64(request.Limit),
-		Skip:  int64(request.Offset),
+	options := pageOptions(request.Limit, request.Offset, request.Cursor, request.Count)
+
+	// heights are stored as strings, blocks are indexed in height order so _id follows them
+	if request.Order == "desc" {
+		options.Sort = []interface{}{map[string]interface{}{"_id": -1}}
 	}
 
 	if request.Height != "" {
@@ -195,19 +219,19 @@ func (g *CosmosGateway) blocks(req types.InboundRequest) (*types.BlocksResultRes
 		}
 	}
 
-	blocksResponse, err := g.storage.Read("cosmos_blocks", criteria, options, []string{})
+	blocksResponse, err := g.storage.ReadPage(ctx, "cosmos_blocks", criteria, options, []string{})
 	if err != nil {
-		logger.Logger.Error("[query-blocks] Failed to get blocks", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-blocks] Failed to get blocks", zap.Error(err))
 		return nil, err
 	}
 
 	result.Blocks = blocksResponse.Result
-	result.Pagination.Total = blocksResponse.Count
+	result.Pagination = types.Pagination{NextKey: blocksResponse.Cursor, Total: blocksResponse.Count, TotalEstimated: blocksResponse.CountEstimated}
 
 	return &result, nil
 }
 
-func (g *CosmosGateway) balances(req types.InboundRequest, accountID string) ([]sdk.Coin, error) {
+func (g *CosmosGateway) balances(ctx context.Context, req types.InboundRequest, accountID string) ([]sdk.Coin, error) {
 	type BalancesRequest struct {
 		Limit      int `json:"limit,string,omitempty"`
 		Offset     int `json:"offset,string,omitempty"`
@@ -230,9 +254,9 @@ func (g *CosmosGateway) balances(req types.InboundRequest, accountID string) ([]
 		return nil, err
 	}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/cosmos/bank/v1beta1/balances/"+accountID, nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/cosmos/bank/v1beta1/balances/"+accountID, nil)
 	if err != nil {
-		logger.Logger.Error("[query-balances] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-balances] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -246,7 +270,7 @@ func (g *CosmosGateway) balances(req types.InboundRequest, accountID string) ([]
 
 	grpcBytes, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-balances] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-balances] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -254,14 +278,14 @@ func (g *CosmosGateway) balances(req types.InboundRequest, accountID string) ([]
 
 	err = json.Unmarshal(grpcBytes, &result)
 	if err != nil {
-		logger.Logger.Error("[query-balances] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-balances] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	return result.Balances, nil
 }
 
-func (g *CosmosGateway) delegations(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) delegations(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	var response = new(types.QueryDelegationsResult)
 
 	type DelegationsRequest struct {
@@ -292,33 +316,33 @@ func (g *CosmosGateway) delegations(req types.InboundRequest) (interface{}, erro
 		req.Path = "/cosmos/bank/v1beta1/balances/" + request.Account
 	}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", req.Path, nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", req.Path, nil)
 	if err != nil {
-		logger.Logger.Error("[query-delegations] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-delegations] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	success, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-delegations] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-delegations] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
-	allPools, err := g.validatorsPool()
+	allPools, err := g.validatorsPool(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-delegations] Error getting validators pool", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-delegations] Error getting validators pool", zap.Error(err))
 		return nil, err
 	}
 
-	tokens, err := g.tokens()
+	tokens, err := g.tokens(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-delegations] Error getting tokens", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-delegations] Error getting tokens", zap.Error(err))
 		return nil, err
 	}
 
-	validators, err := g.dashboard()
+	validators, err := g.dashboard(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-delegations] Error getting validators", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-delegations] Error getting validators", zap.Error(err))
 		return nil, err
 	}
 
@@ -326,7 +350,7 @@ func (g *CosmosGateway) delegations(req types.InboundRequest) (interface{}, erro
 
 	err = json.Unmarshal(success, &result)
 	if err != nil {
-		logger.Logger.Error("[query-delegations] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-delegations] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
@@ -387,18 +411,18 @@ func (g *CosmosGateway) delegations(req types.InboundRequest) (interface{}, erro
 	return response, nil
 }
 
-func (g *CosmosGateway) identityRecords(address string) (interface{}, error) {
+func (g *CosmosGateway) identityRecords(ctx context.Context, address string) (interface{}, error) {
 	accAddr, _ := sdk.AccAddressFromBech32(address)
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/gov/identity_records/"+base64.URLEncoding.EncodeToString(accAddr.Bytes()), nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/gov/identity_records/"+base64.URLEncoding.EncodeToString(accAddr.Bytes()), nil)
 	if err != nil {
-		logger.Logger.Error("[query-identity-records] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-identity-records] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	grpcBytes, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-identity-records] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-identity-records] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -406,14 +430,14 @@ func (g *CosmosGateway) identityRecords(address string) (interface{}, error) {
 
 	err = json.Unmarshal(grpcBytes, &result)
 	if err != nil {
-		logger.Logger.Error("[query-identity-records] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-identity-records] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-func (g *CosmosGateway) identityVerifyRequestsByApprover(req types.InboundRequest, approver string) (interface{}, error) {
+func (g *CosmosGateway) identityVerifyRequestsByApprover(ctx context.Context, req types.InboundRequest, approver string) (interface{}, error) {
 	type IdentityVerifyRequestsByApproverRequest struct {
 		Key        int `json:"key,string,omitempty"`
 		Limit      int `json:"limit,string,omitempty"`
@@ -439,9 +463,9 @@ func (g *CosmosGateway) identityVerifyRequestsByApprover(req types.InboundReques
 	}
 
 	accAddr, _ := sdk.AccAddressFromBech32(approver)
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/gov/identity_verify_requests_by_approver/"+base64.URLEncoding.EncodeToString(accAddr.Bytes()), nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/gov/identity_verify_requests_by_approver/"+base64.URLEncoding.EncodeToString(accAddr.Bytes()), nil)
 	if err != nil {
-		logger.Logger.Error("[query-identity-record-verify-requests-by-approver] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-identity-record-verify-requests-by-approver] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -457,7 +481,7 @@ func (g *CosmosGateway) identityVerifyRequestsByApprover(req types.InboundReques
 	gatewayReq.URL.RawQuery = q.Encode()
 	response, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-identity-record-verify-requests-by-approver] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-identity-record-verify-requests-by-approver] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -465,14 +489,14 @@ func (g *CosmosGateway) identityVerifyRequestsByApprover(req types.InboundReques
 
 	err = json.Unmarshal(response, &res)
 	if err != nil {
-		logger.Logger.Error("[query-identity-record-verify-requests-by-approver] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-identity-record-verify-requests-by-approver] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	for idx, record := range res.VerifyRecords {
-		coin, err := g.parseCoinString(record.Tip)
+		coin, err := g.parseCoinString(ctx, record.Tip)
 		if err != nil {
-			logger.Logger.Error("[query-identity-record-verify-requests-by-approver] Coin can not be parsed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-identity-record-verify-requests-by-approver] Coin can not be parsed", zap.Error(err))
 			return nil, err
 		}
 
@@ -482,7 +506,7 @@ func (g *CosmosGateway) identityVerifyRequestsByApprover(req types.InboundReques
 	return res, nil
 }
 
-func (g *CosmosGateway) identityVerifyRequestsByRequester(req types.InboundRequest, requester string) (interface{}, error) {
+func (g *CosmosGateway) identityVerifyRequestsByRequester(ctx context.Context, req types.InboundRequest, requester string) (interface{}, error) {
 	type IdentityVerifyRequestsByRequesterRequest struct {
 		Key        int `json:"key,string,omitempty"`
 		Limit      int `json:"limit,string,omitempty"`
@@ -508,9 +532,9 @@ func (g *CosmosGateway) identityVerifyRequestsByRequester(req types.InboundReque
 	}
 
 	accAddr, _ := sdk.AccAddressFromBech32(requester)
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/gov/identity_verify_requests_by_requester/"+base64.URLEncoding.EncodeToString(accAddr.Bytes()), nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/gov/identity_verify_requests_by_requester/"+base64.URLEncoding.EncodeToString(accAddr.Bytes()), nil)
 	if err != nil {
-		logger.Logger.Error("[query-identity-record-verify-requests-by-requester] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-identity-record-verify-requests-by-requester] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -527,21 +551,21 @@ func (g *CosmosGateway) identityVerifyRequestsByRequester(req types.InboundReque
 	gatewayReq.URL.RawQuery = q.Encode()
 	response, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-identity-record-verify-requests-by-requester] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-identity-record-verify-requests-by-requester] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
 	res := types.IdVerifyResponse{}
 	err = json.Unmarshal(response, &res)
 	if err != nil {
-		logger.Logger.Error("[query-identity-record-verify-requests-by-requester] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-identity-record-verify-requests-by-requester] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	for idx, record := range res.VerifyRecords {
-		coin, err := g.parseCoinString(record.Tip)
+		coin, err := g.parseCoinString(ctx, record.Tip)
 		if err != nil {
-			logger.Logger.Error("[query-identity-record-verify-requests-by-approver] Coin can not be parsed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-identity-record-verify-requests-by-approver] Coin can not be parsed", zap.Error(err))
 			continue
 		}
 
@@ -1,12 +1,12 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	sekaitypes "github.com/KiraCore/sekai/types"
 	sdk "github.com/cosmos/cosmos-sdk/types"
-	"github.com/saiset-co/sai-storage-mongo/external/adapter"
 	"go.uber.org/zap"
 	"math"
 	"net/http"
@@ -14,51 +14,51 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-interx-manager/types"
 	"github.com/saiset-co/sai-interx-manager/utils"
 )
 
-func (g *CosmosGateway) txByHash(hash string) (interface{}, error) {
+func (g *CosmosGateway) txByHash(ctx context.Context, hash string) (interface{}, error) {
 	req := types.InboundRequest{
 		Payload: map[string]interface{}{
 			"hash": hash,
 		},
 	}
 
-	return g.transactions(req)
+	return g.transactions(ctx, req)
 }
 
-func (g *CosmosGateway) blockById(req types.InboundRequest, blockID string) (interface{}, error) {
+func (g *CosmosGateway) blockById(ctx context.Context, req types.InboundRequest, blockID string) (interface{}, error) {
 	req.Payload["height"] = blockID
 
-	result, err := g.blocks(req)
+	result, err := g.blocks(ctx, req)
 	if err != nil {
-		logger.Logger.Error("[query-block-by-id] Failed to get blocks", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-block-by-id] Failed to get blocks", zap.Error(err))
 		return nil, err
 	}
 
 	if len(result.Blocks) < 1 {
 		err = errors.New(fmt.Sprintf("Block %s not found", blockID))
-		logger.Logger.Error("[query-block-by-id] Block not found", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-block-by-id] Block not found", zap.Error(err))
 		return nil, err
 	}
 
 	return result.Blocks[0], nil
 }
 
-func (g *CosmosGateway) txByBlock(req types.InboundRequest, blockID string) (interface{}, error) {
+func (g *CosmosGateway) txByBlock(ctx context.Context, req types.InboundRequest, blockID string) (interface{}, error) {
 	req.Payload["height"] = blockID
-	return g.transactions(req)
+	return g.transactions(ctx, req)
 }
 
-func (g *CosmosGateway) parseCoinString(input string) (*sdk.Coin, error) {
+func (g *CosmosGateway) parseCoinString(ctx context.Context, input string) (*sdk.Coin, error) {
 	denom := ""
 	amount := 0
 
-	tokens, err := g.tokens()
+	tokens, err := g.tokens(ctx)
 	if err != nil {
-		logger.Logger.Error("[parse-coin-string] Failed to get tokens", zap.Error(err))
+		tracing.Logger(ctx).Error("[parse-coin-string] Failed to get tokens", zap.Error(err))
 		return nil, err
 	}
 
@@ -78,7 +78,7 @@ func (g *CosmosGateway) parseCoinString(input string) (*sdk.Coin, error) {
 	}, nil
 }
 
-func (g *CosmosGateway) executionFee(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) executionFee(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	type ExecutionFeeRequest struct {
 		Message string `json:"message,omitempty"`
 	}
@@ -95,15 +95,15 @@ func (g *CosmosGateway) executionFee(req types.InboundRequest) (interface{}, err
 		return nil, err
 	}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/gov/execution_fee/"+request.Message, nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/gov/execution_fee/"+request.Message, nil)
 	if err != nil {
-		logger.Logger.Error("[execution-fee] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[execution-fee] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	grpcBytes, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[execution-fee] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[execution-fee] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -111,36 +111,36 @@ func (g *CosmosGateway) executionFee(req types.InboundRequest) (interface{}, err
 
 	err = json.Unmarshal(grpcBytes, &result)
 	if err != nil {
-		logger.Logger.Error("[execution-fee] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[execution-fee] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-func (g *CosmosGateway) networkProperties() (interface{}, error) {
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/gov/network_properties", nil)
+func (g *CosmosGateway) networkProperties(ctx context.Context) (interface{}, error) {
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/gov/network_properties", nil)
 	if err != nil {
-		logger.Logger.Error("[query-network-properties] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-network-properties] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	response, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-network-properties] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-network-properties] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
 	result, err := utils.QueryNetworkPropertiesFromGrpcResult(response)
 	if err != nil {
-		logger.Logger.Error("[query-network-properties] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-network-properties] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-func (g *CosmosGateway) stakingPool(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) stakingPool(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	type StakingPoolRequest struct {
 		Account string `json:"validatorAddress,omitempty"`
 	}
@@ -157,15 +157,15 @@ func (g *CosmosGateway) stakingPool(req types.InboundRequest) (interface{}, erro
 		return nil, err
 	}
 
-	tokens, err := g.tokens()
+	tokens, err := g.tokens(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-staking-pool] Getting tokens failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-staking-pool] Getting tokens failed", zap.Error(err))
 		return nil, err
 	}
 
-	validators, err := g.dashboard()
+	validators, err := g.dashboard(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-staking-pool] Getting validators failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-staking-pool] Getting validators failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -180,15 +180,15 @@ func (g *CosmosGateway) stakingPool(req types.InboundRequest) (interface{}, erro
 		return nil, err
 	}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/multistaking/v1beta1/staking_pool_delegators/"+valAddr, nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/multistaking/v1beta1/staking_pool_delegators/"+valAddr, nil)
 	if err != nil {
-		logger.Logger.Error("[query-staking-pool] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-staking-pool] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	response, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-staking-pool] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-staking-pool] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -196,7 +196,7 @@ func (g *CosmosGateway) stakingPool(req types.InboundRequest) (interface{}, erro
 
 	err = json.Unmarshal(response, &responseResult)
 	if err != nil {
-		logger.Logger.Error("[query-staking-pool] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-staking-pool] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
@@ -207,9 +207,9 @@ func (g *CosmosGateway) stakingPool(req types.InboundRequest) (interface{}, erro
 
 	newResponse.VotingPower = []sdk.Coin{}
 	for _, coinStr := range responseResult.Pool.TotalStakingTokens {
-		coin, err := g.parseCoinString(coinStr)
+		coin, err := g.parseCoinString(ctx, coinStr)
 		if err != nil {
-			logger.Logger.Error("[query-staking-pool] Coin can not be parsed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-staking-pool] Coin can not be parsed", zap.Error(err))
 			continue
 		}
 		newResponse.VotingPower = append(newResponse.VotingPower, *coin)
@@ -222,7 +222,7 @@ func (g *CosmosGateway) stakingPool(req types.InboundRequest) (interface{}, erro
 	return newResponse, nil
 }
 
-func (g *CosmosGateway) undelegations(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) undelegations(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	type Undelegation struct {
 		ID            int `json:"id,omitempty"`
 		ValidatorInfo struct {
@@ -267,9 +267,9 @@ func (g *CosmosGateway) undelegations(req types.InboundRequest) (interface{}, er
 		return nil, err
 	}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/multistaking/v1beta1/undelegations", nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/multistaking/v1beta1/undelegations", nil)
 	if err != nil {
-		logger.Logger.Error("[query-undelegations] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-undelegations] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -279,13 +279,13 @@ func (g *CosmosGateway) undelegations(req types.InboundRequest) (interface{}, er
 
 	success, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-undelegations] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-undelegations] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
-	validators, err := g.allValidators()
+	validators, err := g.allValidators(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-undelegations] Getting validators failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-undelegations] Getting validators failed", zap.Error(err))
 		return nil, err
 	}
 
@@ -293,7 +293,7 @@ func (g *CosmosGateway) undelegations(req types.InboundRequest) (interface{}, er
 
 	err = json.Unmarshal(success, &result)
 	if err != nil {
-		logger.Logger.Error("[query-undelegations] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-undelegations] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
@@ -321,9 +321,9 @@ func (g *CosmosGateway) undelegations(req types.InboundRequest) (interface{}, er
 		undelegationData.Expiry = undelegation.Expiry
 
 		for _, token := range undelegation.Amount {
-			coin, err := g.parseCoinString(token)
+			coin, err := g.parseCoinString(ctx, token)
 			if err != nil {
-				logger.Logger.Error("[query-undelegations] Parsing coin failed", zap.Error(err))
+				tracing.Logger(ctx).Error("[query-undelegations] Parsing coin failed", zap.Error(err))
 				continue
 			}
 			undelegationData.Tokens = append(undelegationData.Tokens, *coin)
@@ -349,7 +349,7 @@ func (g *CosmosGateway) undelegations(req types.InboundRequest) (interface{}, er
 	return response, nil
 }
 
-func (g *CosmosGateway) transactions(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) transactions(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	var result types.TxsResultResponse
 	var criteria = map[string]interface{}{}
 	var includeConfirmed = true
@@ -362,21 +362,17 @@ func (g *CosmosGateway) transactions(req types.InboundRequest) (interface{}, err
 
 	jsonData, err := json.Marshal(req.Payload)
 	if err != nil {
-		logger.Logger.Error("[query-transactions] Invalid request format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-transactions] Invalid request format", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(jsonData, &request)
 	if err != nil {
-		logger.Logger.Error("[query-transactions] Invalid request format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-transactions] Invalid request format", zap.Error(err))
 		return nil, err
 	}
 
-	options := &adapter.Options{
-		Count: 1,
-		Limit: int64(request.Limit),
-		Skip:  int64(request.Offset),
-	}
+	options := pageOptions(request.Limit, request.Offset, request.Cursor, request.CountTotal)
 
 	if request.Hash != "" {
 		criteria["hash"] = request.Hash
@@ -388,6 +384,27 @@ func (g *CosmosGateway) transactions(req types.InboundRequest) (interface{}, err
 		criteria["_id"] = map[string]interface{}{"$ne": nil}
 	}
 
+	// the indexer lists every address a tx involves, the txs an address signed are outbound
+	if request.Address != "" {
+		criteria["addresses"] = request.Address
+
+		var inbound, outbound bool
+		for _, direction := range request.Directions {
+			switch direction {
+			case "inbound":
+				inbound = true
+			case "outbound":
+				outbound = true
+			}
+		}
+
+		if outbound && !inbound {
+			criteria["signers"] = request.Address
+		} else if inbound && !outbound {
+			criteria["signers"] = map[string]interface{}{"$ne": request.Address}
+		}
+	}
+
 	if len(request.Types) > 0 {
 		criteria["messages"] = map[string]interface{}{
 			"typeUrl": map[string]interface{}{
@@ -431,14 +448,35 @@ func (g *CosmosGateway) transactions(req types.InboundRequest) (interface{}, err
 		criteria["tx_result.code"] = map[string]interface{}{"$gt": 0}
 	}
 
-	txsResponse, err := g.storage.Read("cosmos_txs", criteria, options, []string{})
+	txsResponse, err := g.storage.ReadPage(ctx, "cosmos_txs", criteria, options, []string{})
 	if err != nil {
-		logger.Logger.Error("[query-transactions] Failed to get transactions", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-transactions] Failed to get transactions", zap.Error(err))
 		return nil, err
 	}
 
 	result.Transactions = txsResponse.Result
-	result.Pagination.Total = txsResponse.Count
+	result.Pagination = types.Pagination{NextKey: txsResponse.Cursor, Total: txsResponse.Count, TotalEstimated: txsResponse.CountEstimated}
 
 	return result, nil
 }
+
+// pageOptions reads a page of a list endpoint. Pages after a cursor skip nothing and are not counted again,
+// the first page is counted exactly with count_total "exact", not at all with "none" and estimated otherwise.
+func pageOptions(limit, offset int, cursor string, countTotal string) *types.PageOptions {
+	options := &types.PageOptions{Limit: int64(limit), Cursor: cursor}
+	if cursor != "" {
+		return options
+	}
+
+	options.Skip = int64(offset)
+
+	switch countTotal {
+	case "exact":
+		options.Count = types.CountExact
+	case "none":
+	default:
+		options.Count = types.CountEstimated
+	}
+
+	return options
+}
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,13 +18,13 @@ import (
 	bank "github.com/cosmos/cosmos-sdk/x/bank/types"
 	"go.uber.org/zap"
 
-	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-interx-manager/types"
 	"github.com/saiset-co/sai-interx-manager/utils"
 	"github.com/saiset-co/sai-storage-mongo/external/adapter"
 )
 
-func (g *CosmosGateway) tokenRates() (interface{}, error) {
+func (g *CosmosGateway) tokenRates(ctx context.Context) (interface{}, error) {
 	tokenAliasGRPCResponse := types.TokenAliasesGRPCResponse{}
 
 	type TokenRatesResponse struct {
@@ -31,21 +32,21 @@ func (g *CosmosGateway) tokenRates() (interface{}, error) {
 	}
 	result := TokenRatesResponse{}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/tokens/infos", nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/tokens/infos", nil)
 	if err != nil {
-		logger.Logger.Error("[query-token-rates] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-token-rates] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	respBody, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-token-rates] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-token-rates] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(respBody, &tokenAliasGRPCResponse)
 	if err != nil {
-		logger.Logger.Error("[query-token-rates] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-token-rates] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
@@ -60,31 +61,31 @@ func (g *CosmosGateway) tokenRates() (interface{}, error) {
 	return result, nil
 }
 
-func (g *CosmosGateway) customPrefixes() (*types.CustomPrefixesResponse, error) {
+func (g *CosmosGateway) customPrefixes(ctx context.Context) (*types.CustomPrefixesResponse, error) {
 	var customPrefixesResponse = new(types.CustomPrefixesResponse)
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/gov/custom_prefixes", nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/gov/custom_prefixes", nil)
 	if err != nil {
-		logger.Logger.Error("[query-custom-prefixes] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-custom-prefixes] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	respBody, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-custom-prefixes] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-custom-prefixes] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(respBody, &customPrefixesResponse)
 	if err != nil {
-		logger.Logger.Error("[query-custom-prefixes] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-custom-prefixes] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
 	return customPrefixesResponse, nil
 }
 
-func (g *CosmosGateway) tokenAliases(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) tokenAliases(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	tokenAliasGRPCResponse := types.TokenAliasesGRPCResponse{}
 	tokenAliasResponse := types.TokenAliasesResponse{}
 
@@ -111,27 +112,27 @@ func (g *CosmosGateway) tokenAliases(req types.InboundRequest) (interface{}, err
 		return nil, err
 	}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/tokens/infos", nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/tokens/infos", nil)
 	if err != nil {
-		logger.Logger.Error("[query-token-aliases] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-token-aliases] Create request failed", zap.Error(err))
 		return nil, err
 	}
 
 	respBody, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[query-token-aliases] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-token-aliases] Serve request failed", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(respBody, &tokenAliasGRPCResponse)
 	if err != nil {
-		logger.Logger.Error("[query-token-aliases] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-token-aliases] Invalid response format", zap.Error(err))
 		return nil, err
 	}
 
-	prefixes, err := g.customPrefixes()
+	prefixes, err := g.customPrefixes(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-token-aliases] Failed to get custom prefixes", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-token-aliases] Failed to get custom prefixes", zap.Error(err))
 		return nil, err
 	}
 
@@ -159,7 +160,7 @@ func (g *CosmosGateway) tokenAliases(req types.InboundRequest) (interface{}, err
 	return tokenAliasResponse, nil
 }
 
-func (g *CosmosGateway) proposalsCount() (int, error) {
+func (g *CosmosGateway) proposalsCount(ctx context.Context) (int, error) {
 	var totalCount = 0
 	var response struct {
 		Pagination struct {
@@ -167,9 +168,9 @@ func (g *CosmosGateway) proposalsCount() (int, error) {
 		} `json:"pagination"`
 	}
 
-	gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/gov/proposals", nil)
+	gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/gov/proposals", nil)
 	if err != nil {
-		logger.Logger.Error("[query-proposals-count] Create request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-proposals-count] Create request failed", zap.Error(err))
 		return totalCount, err
 	}
 
@@ -181,12 +182,12 @@ func (g *CosmosGateway) proposalsCount() (int, error) {
 
 	success, err := g.grpcProxy.ServeGRPC(gatewayReq)
 	if err != nil {
-		logger.Logger.Error("[[query-proposals-count] Serve request failed", zap.Error(err))
+		tracing.Logger(ctx).Error("[[query-proposals-count] Serve request failed", zap.Error(err))
 		return totalCount, err
 	}
 
 	if err := json.Unmarshal(success, &response); err != nil {
-		logger.Logger.Error("[query-proposals-count] Invalid response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-proposals-count] Invalid response format", zap.Error(err))
 		return totalCount, err
 	}
 
@@ -197,15 +198,15 @@ func (g *CosmosGateway) proposalsCount() (int, error) {
 	return totalCount, nil
 }
 
-func (g *CosmosGateway) getProposals(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) getProposals(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	proposals := new(types.ProposalsResponse)
 	limit := sekaitypes.PageIterationLimit - 1
 	offset := 0
 
 	for {
-		gatewayReq, err := http.NewRequestWithContext(g.context.Context, "GET", "/kira/gov/proposals", nil)
+		gatewayReq, err := http.NewRequestWithContext(ctx, "GET", "/kira/gov/proposals", nil)
 		if err != nil {
-			logger.Logger.Error("[query-proposals] Create request failed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-proposals] Create request failed", zap.Error(err))
 			return nil, err
 		}
 
@@ -216,14 +217,14 @@ func (g *CosmosGateway) getProposals(req types.InboundRequest) (interface{}, err
 
 		respBody, err := g.grpcProxy.ServeGRPC(gatewayReq)
 		if err != nil {
-			logger.Logger.Error("[query-proposals] Serve request failed", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-proposals] Serve request failed", zap.Error(err))
 			return nil, err
 		}
 
 		subResult := new(types.ProposalsResponse)
 		err = json.Unmarshal(respBody, subResult)
 		if err != nil {
-			logger.Logger.Error("[query-proposals] Invalid response format", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-proposals] Invalid response format", zap.Error(err))
 			return nil, err
 		}
 
@@ -247,7 +248,7 @@ func (g *CosmosGateway) getProposals(req types.InboundRequest) (interface{}, err
 	return proposals, nil
 }
 
-func (g *CosmosGateway) proposals(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) proposals(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	var lastId = "0"
 
 	var proposalsResponse = types.ProposalsResponse{
@@ -268,15 +269,15 @@ func (g *CosmosGateway) proposals(req types.InboundRequest) (interface{}, error)
 		"proposalId": -1,
 	}
 
-	cachedTotal, err := g.storage.Read("proposals_cache", criteria, &adapter.Options{Limit: 1, Count: 1, Sort: sortBy}, []string{})
+	cachedTotal, err := g.storage.Read(ctx, "proposals_cache", criteria, &adapter.Options{Limit: 1, Count: 1, Sort: sortBy}, []string{})
 	if err != nil {
-		logger.Logger.Error("[query-proposals] Failed to get cached proposals count", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-proposals] Failed to get cached proposals count", zap.Error(err))
 		return proposalsResponse, err
 	}
 
-	count, err := g.proposalsCount()
+	count, err := g.proposalsCount(ctx)
 	if err != nil {
-		logger.Logger.Error("[query-proposals] Failed to count proposals", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-proposals] Failed to count proposals", zap.Error(err))
 		return proposalsResponse, err
 	}
 
@@ -294,15 +295,15 @@ func (g *CosmosGateway) proposals(req types.InboundRequest) (interface{}, error)
 
 	if count > cachedTotal.Count {
 		req.Payload["afterProposalId"] = lastId
-		newProposals, err := g.getProposals(req)
+		newProposals, err := g.getProposals(ctx, req)
 		if err != nil {
-			logger.Logger.Error("[query-proposals] Failed to get new proposals", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-proposals] Failed to get new proposals", zap.Error(err))
 			return proposalsResponse, err
 		}
 
-		_, err = g.storage.Create("proposals_cache", newProposals)
+		_, err = g.storage.Create(ctx, "proposals_cache", newProposals)
 		if err != nil {
-			logger.Logger.Error("[query-proposals] Failed to save proposals cache", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-proposals] Failed to save proposals cache", zap.Error(err))
 			return proposalsResponse, err
 		}
 	}
@@ -361,9 +362,9 @@ func (g *CosmosGateway) proposals(req types.InboundRequest) (interface{}, error)
 		criteria["voter"] = request.Voter
 	}
 
-	response, err := g.storage.Read("proposals_cache", criteria, options, []string{})
+	response, err := g.storage.Read(ctx, "proposals_cache", criteria, options, []string{})
 	if err != nil {
-		logger.Logger.Error("[query-proposals] Failed to get proposal from cache", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-proposals] Failed to get proposal from cache", zap.Error(err))
 		return proposalsResponse, err
 	}
 
@@ -387,27 +388,27 @@ func (g *CosmosGateway) proposals(req types.InboundRequest) (interface{}, error)
 	return proposals, nil
 }
 
-func (g *CosmosGateway) faucet(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) faucet(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	request := types.FaucetRequest{}
 
 	jsonData, err := json.Marshal(req.Payload)
 	if err != nil {
-		logger.Logger.Error("[query-faucet] Invalid request format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-faucet] Invalid request format", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(jsonData, &request)
 	if err != nil {
-		logger.Logger.Error("[query-faucet] Invalid request format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-faucet] Invalid request format", zap.Error(err))
 		return nil, err
 	}
 
 	if request.Claim == "" && request.Token == "" {
 		faucetAddress := sdk.AccAddress(g.PubKey.Address().Bytes()).String()
 
-		balances, err := g.balances(req, faucetAddress)
+		balances, err := g.balances(ctx, req, faucetAddress)
 		if err != nil {
-			logger.Logger.Error("[query-faucet] Failed to get faucet balance", zap.Error(err))
+			tracing.Logger(ctx).Error("[query-faucet] Failed to get faucet balance", zap.Error(err))
 			return nil, err
 		}
 
@@ -418,7 +419,7 @@ func (g *CosmosGateway) faucet(req types.InboundRequest) (interface{}, error) {
 
 		return info, nil
 	} else if request.Claim != "" && request.Token != "" {
-		return g.processFaucet(req)
+		return g.processFaucet(ctx, req)
 	} else {
 		err = errors.New("[query-faucet] both claim and token parameters are required")
 	}
@@ -426,24 +427,24 @@ func (g *CosmosGateway) faucet(req types.InboundRequest) (interface{}, error) {
 	return nil, nil
 }
 
-func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, error) {
+func (g *CosmosGateway) processFaucet(ctx context.Context, req types.InboundRequest) (interface{}, error) {
 	request := types.FaucetRequest{}
 
 	jsonData, err := json.Marshal(req.Payload)
 	if err != nil {
-		logger.Logger.Error("[query-faucet] Invalid request format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-faucet] Invalid request format", zap.Error(err))
 		return nil, err
 	}
 
 	err = json.Unmarshal(jsonData, &request)
 	if err != nil {
-		logger.Logger.Error("[query-faucet] Invalid request format", zap.Error(err))
+		tracing.Logger(ctx).Error("[query-faucet] Invalid request format", zap.Error(err))
 		return nil, err
 	}
 
-	result, err := g.storage.Read("cosmos_faucet", map[string]interface{}{"address": request.Claim}, &adapter.Options{Sort: map[string]interface{}{"timestamp": -1}}, []string{})
+	result, err := g.storage.Read(ctx, "cosmos_faucet", map[string]interface{}{"address": request.Claim}, &adapter.Options{Sort: map[string]interface{}{"timestamp": -1}}, []string{})
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to get faucet history", zap.Any("CAddress", request.Claim), zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to get faucet history", zap.Any("CAddress", request.Claim), zap.Error(err))
 		return nil, err
 	}
 
@@ -451,36 +452,49 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 		lastTimeFloat, ok := result.Result[0]["timestamp"]
 		if !ok {
 			err = errors.New("[faucet] Invalid faucet history response")
-			logger.Logger.Error("[faucet] Invalid faucet history response", zap.Any("Address", request.Claim))
+			tracing.Logger(ctx).Error("[faucet] Invalid faucet history response", zap.Any("Address", request.Claim))
 			return nil, err
 		}
 
 		lastTime, ok := lastTimeFloat.(float64)
 		if !ok {
 			err = errors.New("[faucet] Invalid faucet history response")
-			logger.Logger.Error("[faucet] Invalid faucet history response", zap.Any("Address", request.Claim))
+			tracing.Logger(ctx).Error("[faucet] Invalid faucet history response", zap.Any("Address", request.Claim))
 			return nil, err
 		}
 
 		left := (int64(lastTime) + g.config.Faucet.TimeLimit) - time.Now().UTC().Unix()
 		if left > 0 {
 			err = errors.New(fmt.Sprintf("[faucet] Claim time left: %d", left))
-			logger.Logger.Error("[faucet] Claim time left", zap.Any("Address", request.Claim), zap.Any("Time left", left))
+			tracing.Logger(ctx).Error("[faucet] Claim time left", zap.Any("Address", request.Claim), zap.Any("Time left", left))
 			return nil, err
 		}
 	}
 
+	if left := g.claimFaucet(request.Claim); left > 0 {
+		err = errors.New(fmt.Sprintf("[faucet] Claim time left: %d", left))
+		tracing.Logger(ctx).Error("[faucet] Claim already made in the cluster, not recorded yet", zap.Any("Address", request.Claim), zap.Any("Time left", left))
+		return nil, err
+	}
+
+	sent := false
+	defer func() {
+		if !sent {
+			g.releaseFaucet(request.Claim)
+		}
+	}()
+
 	faucetAddress := sdk.AccAddress(g.PubKey.Address().Bytes()).String()
 
-	faucetBalances, err := g.balances(req, faucetAddress)
+	faucetBalances, err := g.balances(ctx, req, faucetAddress)
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to get faucet balance", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to get faucet balance", zap.Error(err))
 		return nil, err
 	}
 
-	claimBalances, err := g.balances(req, request.Claim)
+	claimBalances, err := g.balances(ctx, req, request.Claim)
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to get faucet balance", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to get faucet balance", zap.Error(err))
 		return nil, err
 	}
 
@@ -505,7 +519,7 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 	faucetAmountInt64, ok := g.config.Faucet.FaucetAmounts[request.Token]
 	if !ok {
 		err = errors.New("[faucet] Failed to get faucet amount from the configuration")
-		logger.Logger.Error("[faucet] Failed to get faucet amount from the configuration")
+		tracing.Logger(ctx).Error("[faucet] Failed to get faucet amount from the configuration")
 		return nil, err
 	}
 	faucetAmount.SetInt64(faucetAmountInt64)
@@ -514,7 +528,7 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 	faucetMinimumAmountInt64, ok := g.config.Faucet.FaucetMinimumAmounts[request.Token]
 	if !ok {
 		err = errors.New("[faucet] Failed to get faucet minimum amount from the configuration")
-		logger.Logger.Error("[faucet] Failed to get faucet minimum amount from the configuration")
+		tracing.Logger(ctx).Error("[faucet] Failed to get faucet minimum amount from the configuration")
 		return nil, err
 	}
 	faucetMinimumAmount.SetInt64(faucetMinimumAmountInt64)
@@ -522,13 +536,13 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 	feeInt64, ok := g.config.Faucet.FeeAmounts[request.Token]
 	if !ok {
 		err = errors.New("[faucet] Failed to get fee amount from the configuration")
-		logger.Logger.Error("[faucet] Failed to get fee amount from the configuration")
+		tracing.Logger(ctx).Error("[faucet] Failed to get fee amount from the configuration")
 		return nil, err
 	}
 
 	if faucetAmount.Cmp(claimAmount) <= 0 {
 		err = errors.New("[faucet] No need to send tokens: faucetAmount <= claimAmount")
-		logger.Logger.Error("[faucet] No need to send tokens: faucetAmount <= claimAmount")
+		tracing.Logger(ctx).Error("[faucet] No need to send tokens: faucetAmount <= claimAmount")
 		return nil, err
 	}
 
@@ -537,7 +551,7 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 	claimingAmount = claimingAmount.Sub(faucetAmount, claimAmount)
 	if claimingAmount.Cmp(faucetMinimumAmount) <= 0 {
 		err = errors.New("[faucet] No need to send tokens: faucetAmount <= claimAmount")
-		logger.Logger.Error("[faucet] No need to send tokens: faucetAmount <= claimAmount")
+		tracing.Logger(ctx).Error("[faucet] No need to send tokens: faucetAmount <= claimAmount")
 		return nil, err
 	}
 
@@ -546,31 +560,31 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 	remainingAmount = remainingAmount.Sub(availableAmount, faucetMinimumAmount)
 	if claimingAmount.Cmp(remainingAmount) > 0 {
 		err = errors.New("[faucet] Not enough tokens: faucetAmount-claimAmount > availableAmount-faucetMininumAmount")
-		logger.Logger.Error("[faucet] Not enough tokens: faucetAmount-claimAmount > availableAmount-faucetMininumAmount")
+		tracing.Logger(ctx).Error("[faucet] Not enough tokens: faucetAmount-claimAmount > availableAmount-faucetMininumAmount")
 		return nil, err
 	}
 
-	accountInfo, err := g.account(faucetAddress)
+	accountInfo, err := g.account(ctx, faucetAddress)
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to get account info", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to get account info", zap.Error(err))
 		return nil, err
 	}
 
 	accountNumber, err := strconv.ParseUint(accountInfo.Account.AccountNumber, 10, 64)
 	if err != nil {
-		logger.Logger.Error("[faucet] Invalid account response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Invalid account response format", zap.Error(err))
 		return nil, err
 	}
 
 	sequence, err := strconv.ParseUint(accountInfo.Account.Sequence, 10, 64)
 	if err != nil {
-		logger.Logger.Error("[faucet] Invalid account response format", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Invalid account response format", zap.Error(err))
 		return nil, err
 	}
 
-	status, err := g.status()
+	status, err := g.status(ctx)
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to get node status", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to get node status", zap.Error(err))
 		return nil, err
 	}
 
@@ -584,7 +598,7 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 
 	err = txBuilder.SetMsgs(msgSend)
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to set tx msgs", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to set tx msgs", zap.Error(err))
 		return nil, err
 	}
 
@@ -608,13 +622,13 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 		txBuilder.GetTx(),
 	)
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to get sign bytes", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to get sign bytes", zap.Error(err))
 		return nil, err
 	}
 
 	sig, _, err := g.kRing.Sign(g.kName, signBytes)
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to sign transaction", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to sign transaction", zap.Error(err))
 		return nil, err
 	}
 
@@ -631,17 +645,17 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 
 	err = txBuilder.SetSignatures(sigV2)
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to set signatures", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to set signatures", zap.Error(err))
 		return nil, err
 	}
 
 	txBytes, err := g.txConfig.TxEncoder()(txBuilder.GetTx())
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to encode transaction", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to encode transaction", zap.Error(err))
 		return nil, err
 	}
 
-	tHash, err := g.txs(types.InboundRequest{
+	tHash, err := g.txs(ctx, types.InboundRequest{
 		Method: "POST",
 		Payload: map[string]interface{}{
 			"tx":   txBytes,
@@ -649,19 +663,56 @@ func (g *CosmosGateway) processFaucet(req types.InboundRequest) (interface{}, er
 		},
 	})
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to write faucet claim to database", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to write faucet claim to database", zap.Error(err))
 		return tHash, err
 	}
+	sent = true
 
-	_, err = g.storage.Create("cosmos_faucet", []interface{}{map[string]interface{}{
+	claimedAt := time.Now().UTC().Unix()
+	_, err = g.storage.Create(ctx, "cosmos_faucet", []interface{}{map[string]interface{}{
 		"address":   request.Claim,
-		"timestamp": time.Now().UTC().Unix(),
+		"timestamp": claimedAt,
 		"amount":    claimingAmount.String(),
 		"token":     request.Token,
 	}})
 	if err != nil {
-		logger.Logger.Error("[faucet] Failed to write faucet claim to database", zap.Error(err))
+		tracing.Logger(ctx).Error("[faucet] Failed to write faucet claim to database", zap.Error(err))
+		return tHash, nil
+	}
+
+	// the claims expire on the date of claimed_at, json carries no date so the storage sets it
+	_, err = g.storage.Update(ctx, "cosmos_faucet", map[string]interface{}{"address": request.Claim, "timestamp": claimedAt},
+		map[string]interface{}{"$currentDate": map[string]interface{}{"claimed_at": true}})
+	if err != nil {
+		tracing.Logger(ctx).Error("[faucet] Failed to set the expiry of the faucet claim", zap.Error(err))
 	}
 
 	return tHash, nil
 }
+
+// claimFaucet records the claim in the state shared by the manager cluster, so a client cannot
+// collect from several managers before the claim reaches the database. It returns the seconds
+// left when a claim for the address is held already, by this node or another one.
+func (g *CosmosGateway) claimFaucet(address string) int64 {
+	if g.shared == nil {
+		return 0
+	}
+
+	key := "faucet:" + address
+	if value, exists := g.shared.Get(key); exists {
+		claimedAt, _ := strconv.ParseInt(value, 10, 64)
+		if left := claimedAt + g.config.Faucet.TimeLimit - time.Now().UTC().Unix(); left > 0 {
+			return left
+		}
+	}
+
+	g.shared.Put(key, strconv.FormatInt(time.Now().UTC().Unix(), 10), time.Duration(g.config.Faucet.TimeLimit)*time.Second)
+	return 0
+}
+
+// releaseFaucet drops a claim whose transaction was never sent
+func (g *CosmosGateway) releaseFaucet(address string) {
+	if g.shared != nil {
+		g.shared.Delete("faucet:" + address)
+	}
+}
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	sekaitypes "github.com/KiraCore/sekai/types"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/tracing"
+	"github.com/saiset-co/sai-interx-manager/types"
+)
+
+// the events of the gov module when a proposal passes its vote and when it is enacted, a rejected proposal has none
+var proposalOutcomeEvents = []string{"add_to_enactments", "remove_from_enactments"}
+
+type blockEventsRequest struct {
+	Address    string   `json:"address,omitempty"`
+	ProposalID string   `json:"proposal_id,omitempty"`
+	Types      []string `json:"types,omitempty"`
+	Limit      int      `json:"limit,string,omitempty"`
+	Offset     int      `json:"offset,string,omitempty"`
+	Cursor     string   `json:"cursor,omitempty"`
+	CountTotal string   `json:"count_total,omitempty"`
+}
+
+func (g *CosmosGateway) readBlockEventsRequest(req types.InboundRequest) (blockEventsRequest, error) {
+	request := blockEventsRequest{
+		Limit: sekaitypes.PageIterationLimit - 1,
+	}
+
+	jsonData, err := json.Marshal(req.Payload)
+	if err != nil {
+		return request, err
+	}
+
+	err = json.Unmarshal(jsonData, &request)
+
+	return request, err
+}
+
+// newestFirst pages a collection of the indexer by descending block height
+func newestFirst(request blockEventsRequest) *types.PageOptions {
+	options := pageOptions(request.Limit, request.Offset, request.Cursor, request.CountTotal)
+	options.Sort = []interface{}{map[string]interface{}{"block_height": -1}}
+
+	return options
+}
+
+// validatorHistory lists the begin and end block events involving a validator, newest first. The slashing module
+// reports the consensus address of a validator, the rewards the validator address.
+func (g *CosmosGateway) validatorHistory(ctx context.Context, req types.InboundRequest) (interface{}, error) {
+	var result types.BlockEventsResultResponse
+
+	request, err := g.readBlockEventsRequest(req)
+	if err != nil {
+		tracing.Logger(ctx).Error("[query-validator-history] Invalid request format", zap.Error(err))
+		return nil, err
+	}
+
+	if request.Address == "" {
+		return nil, errors.New("address is required")
+	}
+
+	criteria := map[string]interface{}{"addresses": request.Address}
+	if len(request.Types) > 0 {
+		criteria["type"] = map[string]interface{}{"$in": request.Types}
+	}
+
+	eventsResponse, err := g.storage.ReadPage(ctx, "cosmos_block_events", criteria, newestFirst(request), []string{})
+	if err != nil {
+		tracing.Logger(ctx).Error("[query-validator-history] Failed to get block events", zap.Error(err))
+		return nil, err
+	}
+
+	result.Events = eventsResponse.Result
+	result.Pagination = types.Pagination{NextKey: eventsResponse.Cursor, Total: eventsResponse.Count, TotalEstimated: eventsResponse.CountEstimated}
+
+	return result, nil
+}
+
+// validatorUpdates lists the changes of the validator set, newest first
+func (g *CosmosGateway) validatorUpdates(ctx context.Context, req types.InboundRequest) (interface{}, error) {
+	var result types.ValidatorUpdatesResultResponse
+
+	request, err := g.readBlockEventsRequest(req)
+	if err != nil {
+		tracing.Logger(ctx).Error("[query-validator-updates] Invalid request format", zap.Error(err))
+		return nil, err
+	}
+
+	updatesResponse, err := g.storage.ReadPage(ctx, "cosmos_validator_updates", map[string]interface{}{}, newestFirst(request), []string{})
+	if err != nil {
+		tracing.Logger(ctx).Error("[query-validator-updates] Failed to get validator updates", zap.Error(err))
+		return nil, err
+	}
+
+	result.Updates = updatesResponse.Result
+	result.Pagination = types.Pagination{NextKey: updatesResponse.Cursor, Total: updatesResponse.Count, TotalEstimated: updatesResponse.CountEstimated}
+
+	return result, nil
+}
+
+// proposalOutcomes lists when proposals passed their vote and when they were enacted, newest first
+func (g *CosmosGateway) proposalOutcomes(ctx context.Context, req types.InboundRequest) (interface{}, error) {
+	var result types.BlockEventsResultResponse
+
+	request, err := g.readBlockEventsRequest(req)
+	if err != nil {
+		tracing.Logger(ctx).Error("[query-proposal-outcomes] Invalid request format", zap.Error(err))
+		return nil, err
+	}
+
+	criteria := map[string]interface{}{
+		"type": map[string]interface{}{"$in": proposalOutcomeEvents},
+	}
+	if request.ProposalID != "" {
+		criteria["attributes"] = map[string]interface{}{
+			"$elemMatch": map[string]interface{}{"key": "proposal_id", "value": request.ProposalID},
+		}
+	}
+
+	eventsResponse, err := g.storage.ReadPage(ctx, "cosmos_block_events", criteria, newestFirst(request), []string{})
+	if err != nil {
+		tracing.Logger(ctx).Error("[query-proposal-outcomes] Failed to get block events", zap.Error(err))
+		return nil, err
+	}
+
+	result.Events = eventsResponse.Result
+	result.Pagination = types.Pagination{NextKey: eventsResponse.Cursor, Total: eventsResponse.Count, TotalEstimated: eventsResponse.CountEstimated}
+
+	return result, nil
+}
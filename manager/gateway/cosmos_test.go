@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/saiset-co/sai-service/service"
+
+	"github.com/saiset-co/sai-interx-manager/types"
+)
+
+// storageRead is the select and the options of a read sent to the storage
+type storageRead struct {
+	Select  map[string]interface{} `json:"select"`
+	Options map[string]interface{} `json:"options"`
+}
+
+// pagedStorage serves cosmos_txs as a storage worker would, two documents per page, recording the reads
+func pagedStorage(t *testing.T) (*httptest.Server, *[]storageRead) {
+	var reads []storageRead
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string      `json:"method"`
+			Data   storageRead `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+			return
+		}
+		reads = append(reads, request.Data)
+
+		response := map[string]interface{}{"Status": "OK"}
+		switch request.Data.Options["cursor"] {
+		case nil:
+			response["result"] = []map[string]interface{}{{"hash": "A"}, {"hash": "B"}}
+			response["count"] = 3
+			response["count_estimated"] = true
+			response["cursor"] = "after-B"
+		case "after-B":
+			response["result"] = []map[string]interface{}{{"hash": "C"}}
+		default:
+			response = map[string]interface{}{"Status": "NOK", "Error": "invalid cursor"}
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+
+	return server, &reads
+}
+
+func TestTransactionsCursor(t *testing.T) {
+	server, reads := pagedStorage(t)
+	defer server.Close()
+
+	g := &CosmosGateway{
+		BaseGateway: NewBaseGateway(service.NewContext(), 1, time.Millisecond, 1000),
+		storage:     types.NewStorage(server.URL, "token"),
+	}
+
+	result, err := g.transactions(context.Background(), types.InboundRequest{Payload: map[string]interface{}{"limit": "2", "offset": "4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := result.(types.TxsResultResponse)
+	if len(page.Transactions) != 2 || page.Pagination.NextKey != "after-B" || page.Pagination.Total != 3 || !page.Pagination.TotalEstimated {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	if first := (*reads)[0].Options; first["count"] != float64(types.CountEstimated) || first["skip"] != float64(4) {
+		t.Fatalf("first page read with %v", first)
+	}
+
+	result, err = g.transactions(context.Background(), types.InboundRequest{Payload: map[string]interface{}{"limit": "2", "offset": "4", "cursor": page.Pagination.NextKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page = result.(types.TxsResultResponse)
+	if len(page.Transactions) != 1 || page.Pagination.NextKey != "" {
+		t.Fatalf("unexpected last page %+v", page)
+	}
+	if next := (*reads)[1].Options; next["count"] != nil || next["skip"] != nil {
+		t.Fatalf("cursor page read with %v", next)
+	}
+
+	if _, err = g.transactions(context.Background(), types.InboundRequest{Payload: map[string]interface{}{"cursor": "stale"}}); err == nil {
+		t.Fatal("a rejected cursor must fail the request")
+	}
+}
+
+func TestBlocksOrder(t *testing.T) {
+	server, reads := pagedStorage(t)
+	defer server.Close()
+
+	g := &CosmosGateway{
+		BaseGateway: NewBaseGateway(service.NewContext(), 1, time.Millisecond, 1000),
+		storage:     types.NewStorage(server.URL, "token"),
+	}
+
+	if _, err := g.blocks(context.Background(), types.InboundRequest{Payload: map[string]interface{}{"order_by": "desc", "count_total": "exact"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	options := (*reads)[0].Options
+	if sort, _ := json.Marshal(options["sort"]); string(sort) != `[{"_id":-1}]` || options["count"] != float64(types.CountExact) {
+		t.Fatalf("blocks read with %v", options)
+	}
+}
+
+func TestTransactionsAddress(t *testing.T) {
+	server, reads := pagedStorage(t)
+	defer server.Close()
+
+	g := &CosmosGateway{
+		BaseGateway: NewBaseGateway(service.NewContext(), 1, time.Millisecond, 1000),
+		storage:     types.NewStorage(server.URL, "token"),
+	}
+
+	const address = "kira1address"
+	directions := map[string]interface{}{
+		"":         nil,
+		"outbound": address,
+		"inbound":  map[string]interface{}{"$ne": address},
+	}
+
+	for direction, signers := range directions {
+		payload := map[string]interface{}{"address": address}
+		if direction != "" {
+			payload["directions"] = []string{direction}
+		}
+
+		if _, err := g.transactions(context.Background(), types.InboundRequest{Payload: payload}); err != nil {
+			t.Fatal(err)
+		}
+
+		selector := (*reads)[len(*reads)-1].Select
+		if selector["addresses"] != address {
+			t.Fatalf("%q read with %v", direction, selector)
+		}
+		if got, _ := json.Marshal(selector["signers"]); string(got) != mustJSON(t, signers) {
+			t.Fatalf("%q read with signers %s", direction, got)
+		}
+	}
+}
+
+func mustJSON(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestProposalOutcomes(t *testing.T) {
+	server, reads := pagedStorage(t)
+	defer server.Close()
+
+	g := &CosmosGateway{
+		BaseGateway: NewBaseGateway(service.NewContext(), 1, time.Millisecond, 1000),
+		storage:     types.NewStorage(server.URL, "token"),
+	}
+
+	if _, err := g.proposalOutcomes(context.Background(), types.InboundRequest{Payload: map[string]interface{}{"proposal_id": "7"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	read := (*reads)[0]
+	expected := `{"attributes":{"$elemMatch":{"key":"proposal_id","value":"7"}},"type":{"$in":["add_to_enactments","remove_from_enactments"]}}`
+	if got := mustJSON(t, read.Select); got != expected {
+		t.Fatalf("outcomes read with %s", got)
+	}
+	if sort := mustJSON(t, read.Options["sort"]); sort != `[{"block_height":-1}]` {
+		t.Fatalf("outcomes sorted by %s", sort)
+	}
+
+	if _, err := g.validatorHistory(context.Background(), types.InboundRequest{Payload: map[string]interface{}{}}); err == nil {
+		t.Fatal("the validator history needs an address")
+	}
+}
@@ -1,117 +1,350 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"github.com/saiset-co/sai-service/service"
-	"github.com/spf13/cast"
+	"fmt"
 	"math/big"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	jsonrpc2 "github.com/KeisukeYamashita/go-jsonrpc"
+	"github.com/saiset-co/sai-service/service"
 	"go.uber.org/zap"
 
 	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-interx-manager/types"
 )
 
 type EthereumGateway struct {
 	*BaseGateway
-	storage    types.Storage
-	rpcProxies map[string]*jsonrpc2.RPCClient
+	storage        types.Storage
+	chains         map[string]*ethereumChain
+	archiveMethods []string
+	probeInterval  time.Duration
+	rpcConfig      EthereumRPCConfig
+	cache          *resultCache
+	limiters       map[string]*RateLimiter
+	limitersMutex  sync.Mutex
+	sharedWindow   time.Duration
+	stop           chan struct{}
+	closeOnce      sync.Once
+}
+
+// ethereumRequest is the inbound request with the payload kept raw, a JSON-RPC batch is not an object
+type ethereumRequest struct {
+	Method  string          `json:"method"`
+	Path    string          `json:"path"`
+	Payload json.RawMessage `json:"payload"`
 }
 
 var _ types.Gateway = (*EthereumGateway)(nil)
 
-func newJsonRPCClients(chains map[string]string) map[string]*jsonrpc2.RPCClient {
-	proxies := map[string]*jsonrpc2.RPCClient{}
+// NewEthereumGateway creates a gateway to the RPC endpoints of every configured chain. Endpoints are probed
+// every probeInterval and calls go to the healthiest one first, failing over to the others.
+// Methods starting with one of archiveMethods are only sent to archive endpoints when a chain has any.
+func NewEthereumGateway(ctx *service.Context, chains map[string][]EthereumNode, storage types.Storage, retryAttempts int, retryDelay time.Duration, rateLimit int, probeInterval time.Duration, maxHeadLag uint64, archiveMethods []string, rpcConfig EthereumRPCConfig) (*EthereumGateway, error) {
+	g := &EthereumGateway{
+		BaseGateway:    NewBaseGateway(ctx, retryAttempts, retryDelay, rateLimit),
+		storage:        storage,
+		chains:         map[string]*ethereumChain{},
+		archiveMethods: archiveMethods,
+		probeInterval:  probeInterval,
+		rpcConfig:      rpcConfig,
+		cache:          newResultCache(rpcConfig.CacheSize),
+		limiters:       map[string]*RateLimiter{},
+		stop:           make(chan struct{}),
+	}
 
-	for chainId, url := range chains {
-		proxies[chainId] = jsonrpc2.NewRPCClient(url)
+	for chainId, nodes := range chains {
+		if len(nodes) == 0 {
+			return nil, fmt.Errorf("no nodes configured for ethereum chain %s", chainId)
+		}
+
+		chain := &ethereumChain{maxHeadLag: maxHeadLag}
+		for _, node := range nodes {
+			client := jsonrpc2.NewRPCClient(node.URL)
+			client.SetHTTPClient(g.client)
+			chain.endpoints = append(chain.endpoints, &ethereumEndpoint{node: node, client: client})
+		}
+		g.chains[chainId] = chain
 	}
 
-	return proxies
-}
+	if probeInterval > 0 {
+		go g.probe()
+	}
 
-func NewEthereumGateway(ctx *service.Context, chains map[string]string, storage types.Storage, retryAttempts int, retryDelay time.Duration, rateLimit int) (*EthereumGateway, error) {
-	return &EthereumGateway{
-		BaseGateway: NewBaseGateway(ctx, retryAttempts, retryDelay, rateLimit),
-		rpcProxies:  newJsonRPCClients(chains),
-		storage:     storage,
-	}, nil
+	return g, nil
 }
 
-func (g *EthereumGateway) Handle(data []byte) (interface{}, error) {
-	var req types.InboundRequest
+// Handle serves /{chain}/{method} with the payload as the call params, and /{chain} with a JSON-RPC 2.0
+// request object or batch as the payload
+func (g *EthereumGateway) Handle(ctx context.Context, data []byte) (interface{}, error) {
+	var req ethereumRequest
 
 	if err := json.Unmarshal(data, &req); err != nil {
-		logger.Logger.Error("EthereumGateway - Handle", zap.Error(err))
+		tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err))
 		return nil, err
 	}
 
 	chainId, method, err := g.convert(req.Path)
 	if err != nil {
-		logger.Logger.Error("EthereumGateway - Handle", zap.Error(err))
+		tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err))
 		return nil, err
 	}
 
-	client, ok := g.rpcProxies[chainId]
+	chain, ok := g.chains[chainId]
 	if !ok {
 		err = errors.New("chain not found")
-		logger.Logger.Error("EthereumGateway - Handle", zap.Error(err))
+		tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err))
+		return nil, err
+	}
+
+	switch method {
+	case "":
+		return g.handleRPC(ctx, chainId, chain, req.Payload)
+	case "status":
+		return g.retry.DoIf(func() (interface{}, error) {
+			if err := g.rateLimit.Wait(ctx); err != nil {
+				tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err))
+				return nil, err
+			}
+			return g.status(chain)
+		}, func(error) bool {
+			return ctx.Err() == nil
+		})
+	}
+
+	params, err := pathParams(req.Payload)
+	if err != nil {
+		tracing.Logger(ctx).Error("EthereumGateway - Handle", zap.Error(err))
 		return nil, err
 	}
 
-	switch req.Path {
-	case "/status":
-		{
-			return g.retry.Do(func() (interface{}, error) {
-				if err := g.rateLimit.Wait(g.context.Context); err != nil {
-					logger.Logger.Error("EthereumGateway - Handle", zap.Error(err))
-					return nil, err
-				}
-				return g.status(client, chainId)
-			})
+	response, err := g.execute(ctx, chainId, chain, method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// shareState also makes the per-method rate limits cluster-wide
+func (g *EthereumGateway) shareState(shared p2p.SharedState, name string, window time.Duration) {
+	g.BaseGateway.shareState(shared, name, window)
+
+	g.limitersMutex.Lock()
+	g.sharedWindow = window
+	g.limitersMutex.Unlock()
+}
+
+func (g *EthereumGateway) Close() {
+	g.closeOnce.Do(func() {
+		close(g.stop)
+	})
+}
+
+// convert splits /{chain}/{method} or /{chain}, with or without the /ethereum prefix, into its parts
+func (g *EthereumGateway) convert(originalPath string) (chainId, method string, err error) {
+	paths := strings.Split(strings.TrimPrefix(originalPath, "/"), "/")
+	if len(paths) > 1 && paths[0] == "ethereum" {
+		paths = paths[1:]
+	}
+
+	switch {
+	case len(paths) == 1 && paths[0] != "":
+		return paths[0], "", nil
+	case len(paths) == 2 && paths[0] != "" && paths[1] != "":
+		return paths[0], paths[1], nil
+	}
+
+	return "", "", fmt.Errorf("invalid ethereum path %q, expected /{chain} or /{chain}/{method}", originalPath)
+}
+
+// pathParams takes the call params from the "params" field of the payload when it has one.
+// Otherwise the payload itself is the only param, and an empty payload means no params.
+func pathParams(payload json.RawMessage) (interface{}, error) {
+	params, err := decodeParams(payload)
+	if err != nil || params == nil {
+		return nil, err
+	}
+
+	fields, ok := params.(map[string]interface{})
+	if !ok {
+		return params, nil
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	if inner, ok := fields["params"]; ok {
+		switch inner.(type) {
+		case []interface{}, map[string]interface{}:
+			return inner, nil
 		}
 	}
 
-	return g.retry.Do(func() (interface{}, error) {
-		if err := g.rateLimit.Wait(g.context.Context); err != nil {
-			logger.Logger.Error("EthereumGateway - Handle", zap.Error(err))
-			return nil, err
+	return []interface{}{fields}, nil
+}
+
+func (g *EthereumGateway) isArchiveMethod(method string) bool {
+	for _, prefix := range g.archiveMethods {
+		if strings.HasPrefix(method, prefix) {
+			return true
 		}
-		return client.Call(method, req.Payload)
-	})
+	}
+	return false
 }
 
-func (g *EthereumGateway) Close() {
+// call sends the request to the endpoints of the chain in order of health until one answers. An error answered
+// by the node is returned as is, unless a pruned node lacks the requested state and an archive node can be asked.
+func (g *EthereumGateway) call(chain *ethereumChain, method string, params interface{}) (*jsonrpc2.RPCResponse, error) {
+	endpoints := chain.ordered(g.isArchiveMethod(method))
+	tried := map[*ethereumEndpoint]bool{}
+
+	var lastErr error
+
+	for len(endpoints) > 0 {
+		endpoint := endpoints[0]
+		endpoints = endpoints[1:]
+		if tried[endpoint] {
+			continue
+		}
+		tried[endpoint] = true
+
+		start := time.Now()
+		response, err := callEndpoint(endpoint.client, method, params)
+		endpoint.record(time.Since(start), err)
+
+		if err != nil {
+			logger.Logger.Warn("EthereumGateway - endpoint failed",
+				zap.String("endpoint", endpoint.node.URL),
+				zap.String("method", method),
+				zap.Error(err))
+			lastErr = err
+			continue
+		}
 
+		if response.Error != nil && !endpoint.node.Archive && isPrunedStateError(response.Error) {
+			if archive := chain.archiveEndpoints(); len(archive) > 0 {
+				endpoints = append(archive, endpoints...)
+				continue
+			}
+		}
+
+		return response, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no endpoints available")
+	}
+
+	return nil, fmt.Errorf("all ethereum endpoints failed: %w", lastErr)
 }
 
-func (g *EthereumGateway) convert(originalPath string) (chainId, method string, err error) {
-	paths := strings.Split(originalPath, "/")
-	if len(paths) < 3 {
-		return "", "", err
+// callEndpoint sends by-position params as a list and by-name params as an object
+func callEndpoint(client *jsonrpc2.RPCClient, method string, params interface{}) (*jsonrpc2.RPCResponse, error) {
+	switch p := params.(type) {
+	case nil:
+		return client.Call(method)
+	case []interface{}:
+		return client.Call(method, p...)
+	case map[string]interface{}:
+		return client.CallNamed(method, p)
+	default:
+		return client.Call(method, p)
+	}
+}
+
+// probe keeps the head and health of every endpoint current
+func (g *EthereumGateway) probe() {
+	ticker := time.NewTicker(g.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+		for _, chain := range g.chains {
+			for _, endpoint := range chain.endpoints {
+				wg.Add(1)
+				go func(endpoint *ethereumEndpoint) {
+					defer wg.Done()
+					g.probeEndpoint(endpoint)
+				}(endpoint)
+			}
+		}
+		wg.Wait()
+
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *EthereumGateway) probeEndpoint(endpoint *ethereumEndpoint) {
+	start := time.Now()
+	response, err := endpoint.client.Call("eth_blockNumber")
+	if err == nil && response.Error != nil {
+		err = response.Error
+	}
+
+	var head string
+	if err == nil {
+		head, err = response.GetString()
+	}
+
+	endpoint.record(time.Since(start), err)
+	if err != nil {
+		logger.Logger.Debug("EthereumGateway - probe failed", zap.String("endpoint", endpoint.node.URL), zap.Error(err))
+		endpoint.setUnreachable()
+		return
 	}
 
-	return paths[2], paths[3], nil
+	endpoint.setHead(parseHexUint(head))
 }
 
-func (g *EthereumGateway) status(client *jsonrpc2.RPCClient, chainId string) (interface{}, error) {
-	chains := cast.ToStringMapString(g.context.GetConfig("ethereum.nodes", map[string]string{}))
+// status reports the node state from the healthiest endpoint that answers, along with the health of all of them
+func (g *EthereumGateway) status(chain *ethereumChain) (interface{}, error) {
+	var lastErr error
+
+	for _, endpoint := range chain.ordered(false) {
+		start := time.Now()
+		response, err := g.endpointStatus(endpoint.client)
+		endpoint.record(time.Since(start), err)
+		if err != nil {
+			logger.Logger.Warn("EthereumGateway - status failed", zap.String("endpoint", endpoint.node.URL), zap.Error(err))
+			lastErr = err
+			continue
+		}
 
-	var response = types.EVMStatus{}
+		endpoint.setHead(response.SyncInfo.LatestBlockHeight)
+		response.NodeInfo.RPCAddress = endpoint.node.URL
+		response.Endpoints = chain.Health()
+		return response, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no endpoints available")
+	}
 
-	response.NodeInfo.RPCAddress = chains[chainId]
+	return nil, fmt.Errorf("all ethereum endpoints failed: %w", lastErr)
+}
+
+func (g *EthereumGateway) endpointStatus(client *jsonrpc2.RPCClient) (*types.EVMStatus, error) {
+	var response = types.EVMStatus{}
 
 	data, err := client.Call("eth_chainId")
 	if err != nil {
 		return nil, err
 	}
-
-	response.NodeInfo.Network, _ = strconv.ParseUint((chainId)[2:], 16, 64)
+	chainId, _ := data.GetString()
+	response.NodeInfo.Network = parseHexUint(chainId)
 
 	data, err = client.Call("web3_clientVersion")
 	if err != nil {
@@ -167,8 +400,8 @@ func (g *EthereumGateway) status(client *jsonrpc2.RPCClient, chainId string) (in
 		return nil, err
 	}
 	response.SyncInfo.LatestBlockHash = latestBlock.Hash
-	response.SyncInfo.LatestBlockHeight, _ = strconv.ParseUint((latestBlock.Number)[2:], 16, 64)
-	response.SyncInfo.LatestBlockTime, _ = strconv.ParseUint((latestBlock.Timestamp)[2:], 16, 64)
+	response.SyncInfo.LatestBlockHeight = parseHexUint(latestBlock.Number)
+	response.SyncInfo.LatestBlockTime = parseHexUint(latestBlock.Timestamp)
 
 	earliestBlock := new(struct {
 		Hash      string `json:"hash"`
@@ -184,8 +417,8 @@ func (g *EthereumGateway) status(client *jsonrpc2.RPCClient, chainId string) (in
 		return nil, err
 	}
 	response.SyncInfo.EarliestBlockHash = earliestBlock.Hash
-	response.SyncInfo.EarliestBlockHeight, _ = strconv.ParseUint((earliestBlock.Number)[2:], 16, 64)
-	response.SyncInfo.EarliestBlockTime, _ = strconv.ParseUint((earliestBlock.Timestamp)[2:], 16, 64)
+	response.SyncInfo.EarliestBlockHeight = parseHexUint(earliestBlock.Number)
+	response.SyncInfo.EarliestBlockTime = parseHexUint(earliestBlock.Timestamp)
 
 	data, err = client.Call("eth_gasPrice")
 	if err != nil {
@@ -196,8 +429,8 @@ func (g *EthereumGateway) status(client *jsonrpc2.RPCClient, chainId string) (in
 		return nil, err
 	}
 	gasPriceBig := *new(big.Int)
-	gasPriceBig.SetString((gasPrice)[2:], 16)
+	gasPriceBig.SetString(strings.TrimPrefix(gasPrice, "0x"), 16)
 	response.GasPrice = gasPriceBig.String()
 
-	return response, nil
+	return &response, nil
 }
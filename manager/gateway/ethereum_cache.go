@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"container/list"
+	"sync"
+)
+
+// resultCache keeps the most recently used results up to a fixed number of entries
+type resultCache struct {
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	mutex   sync.Mutex
+}
+
+type cacheEntry struct {
+	key    string
+	result interface{}
+}
+
+func newResultCache(size int) *resultCache {
+	return &resultCache{
+		size:    size,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (c *resultCache) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).result, true
+}
+
+func (c *resultCache) Add(key string, result interface{}) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).result = result
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: result})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *resultCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len()
+}
@@ -0,0 +1,254 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsonrpc2 "github.com/KeisukeYamashita/go-jsonrpc"
+	"github.com/spf13/cast"
+
+	"github.com/saiset-co/sai-interx-manager/types"
+)
+
+const (
+	// healthSmoothing is the weight of the newest sample in the latency and error rate averages
+	healthSmoothing = 0.3
+	// maxErrorRate is the smoothed error rate above which an endpoint is no longer preferred
+	maxErrorRate = 0.5
+)
+
+// prunedStateErrors are answered by full nodes for state they no longer keep, an archive node can serve it
+var prunedStateErrors = []string{
+	"missing trie node",
+	"header not found",
+	"historical state",
+	"state is not available",
+	"pruned",
+}
+
+// EthereumNode is one RPC endpoint of a chain, WS is its websocket address for subscriptions if it has one
+type EthereumNode struct {
+	URL     string `json:"url"`
+	WS      string `json:"ws"`
+	Archive bool   `json:"archive"`
+}
+
+// ParseEthereumNodes reads the ethereum.nodes config. Each chain maps to a single URL, a list of URLs
+// or a list of {url, ws, archive} objects.
+func ParseEthereumNodes(raw interface{}) (map[string][]EthereumNode, error) {
+	chains := map[string][]EthereumNode{}
+
+	for chainId, value := range cast.ToStringMap(raw) {
+		var entries []interface{}
+		switch v := value.(type) {
+		case string:
+			entries = []interface{}{v}
+		case []interface{}:
+			entries = v
+		case []string:
+			for _, url := range v {
+				entries = append(entries, url)
+			}
+		default:
+			return nil, fmt.Errorf("invalid nodes for ethereum chain %s", chainId)
+		}
+
+		for _, entry := range entries {
+			var node EthereumNode
+			switch e := entry.(type) {
+			case string:
+				node.URL = e
+			default:
+				fields := cast.ToStringMap(e)
+				node.URL = cast.ToString(fields["url"])
+				node.Archive = cast.ToBool(fields["archive"])
+				node.WS = strings.TrimSpace(cast.ToString(fields["ws"]))
+			}
+
+			node.URL = strings.TrimSpace(node.URL)
+			if node.URL == "" {
+				return nil, fmt.Errorf("empty node url for ethereum chain %s", chainId)
+			}
+
+			chains[chainId] = append(chains[chainId], node)
+		}
+	}
+
+	return chains, nil
+}
+
+type ethereumEndpoint struct {
+	node   EthereumNode
+	client *jsonrpc2.RPCClient
+
+	mutex     sync.RWMutex
+	head      uint64
+	latency   time.Duration
+	errorRate float64
+	lastError string
+	checkedAt time.Time
+	// unreachable is set while the latest probe failed
+	unreachable bool
+}
+
+func (e *ethereumEndpoint) record(latency time.Duration, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	failed := 0.0
+	if err != nil {
+		failed = 1
+		e.lastError = err.Error()
+	} else if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(healthSmoothing*float64(latency) + (1-healthSmoothing)*float64(e.latency))
+	}
+
+	e.errorRate = healthSmoothing*failed + (1-healthSmoothing)*e.errorRate
+}
+
+func (e *ethereumEndpoint) setHead(head uint64) {
+	e.mutex.Lock()
+	e.head = head
+	e.checkedAt = time.Now()
+	e.unreachable = false
+	e.mutex.Unlock()
+}
+
+func (e *ethereumEndpoint) setUnreachable() {
+	e.mutex.Lock()
+	e.unreachable = true
+	e.mutex.Unlock()
+}
+
+// ethereumChain holds the endpoints of one chain in the order they were configured
+type ethereumChain struct {
+	endpoints  []*ethereumEndpoint
+	maxHeadLag uint64
+}
+
+// bestHead is the highest block any endpoint of the chain has reported
+func (c *ethereumChain) bestHead() uint64 {
+	var best uint64
+	for _, endpoint := range c.endpoints {
+		endpoint.mutex.RLock()
+		if endpoint.head > best {
+			best = endpoint.head
+		}
+		endpoint.mutex.RUnlock()
+	}
+	return best
+}
+
+func (c *ethereumChain) health(endpoint *ethereumEndpoint, bestHead uint64) types.EVMEndpointHealth {
+	endpoint.mutex.RLock()
+	defer endpoint.mutex.RUnlock()
+
+	health := types.EVMEndpointHealth{
+		URL:       endpoint.node.URL,
+		Archive:   endpoint.node.Archive,
+		Head:      endpoint.head,
+		LatencyMs: endpoint.latency.Milliseconds(),
+		ErrorRate: endpoint.errorRate,
+		LastError: endpoint.lastError,
+	}
+	if bestHead > endpoint.head {
+		health.HeadLag = bestHead - endpoint.head
+	}
+	if !endpoint.checkedAt.IsZero() {
+		health.CheckedAt = endpoint.checkedAt.Unix()
+	}
+
+	// an endpoint that has not been probed yet gets the benefit of the doubt
+	health.Healthy = !endpoint.unreachable && health.ErrorRate < maxErrorRate &&
+		(endpoint.checkedAt.IsZero() || health.HeadLag <= c.maxHeadLag)
+
+	return health
+}
+
+// Health reports every endpoint of the chain in configuration order
+func (c *ethereumChain) Health() []types.EVMEndpointHealth {
+	bestHead := c.bestHead()
+
+	result := make([]types.EVMEndpointHealth, 0, len(c.endpoints))
+	for _, endpoint := range c.endpoints {
+		result = append(result, c.health(endpoint, bestHead))
+	}
+	return result
+}
+
+// ordered returns the endpoints to try for a call: healthy ones by latency first, then the rest by error rate.
+// Archive calls only go to archive endpoints when the chain has any.
+func (c *ethereumChain) ordered(archive bool) []*ethereumEndpoint {
+	bestHead := c.bestHead()
+
+	type candidate struct {
+		endpoint *ethereumEndpoint
+		health   types.EVMEndpointHealth
+	}
+
+	var candidates []candidate
+	for _, endpoint := range c.endpoints {
+		if archive && !endpoint.node.Archive && c.hasArchive() {
+			continue
+		}
+		candidates = append(candidates, candidate{endpoint: endpoint, health: c.health(endpoint, bestHead)})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].health, candidates[j].health
+		if a.Healthy != b.Healthy {
+			return a.Healthy
+		}
+		if !a.Healthy {
+			return a.ErrorRate < b.ErrorRate
+		}
+		return a.LatencyMs < b.LatencyMs
+	})
+
+	result := make([]*ethereumEndpoint, 0, len(candidates))
+	for _, candidate := range candidates {
+		result = append(result, candidate.endpoint)
+	}
+	return result
+}
+
+func (c *ethereumChain) hasArchive() bool {
+	for _, endpoint := range c.endpoints {
+		if endpoint.node.Archive {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ethereumChain) archiveEndpoints() []*ethereumEndpoint {
+	var result []*ethereumEndpoint
+	for _, endpoint := range c.ordered(true) {
+		if endpoint.node.Archive {
+			result = append(result, endpoint)
+		}
+	}
+	return result
+}
+
+func isPrunedStateError(err *jsonrpc2.RPCError) bool {
+	message := strings.ToLower(err.Message)
+	for _, pruned := range prunedStateErrors {
+		if strings.Contains(message, pruned) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHexUint reads a 0x-prefixed quantity, returning 0 for anything else
+func parseHexUint(value string) uint64 {
+	result, _ := strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 64)
+	return result
+}
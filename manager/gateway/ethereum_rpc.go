@@ -0,0 +1,373 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	jsonrpc2 "github.com/KeisukeYamashita/go-jsonrpc"
+)
+
+// JSON-RPC 2.0 error codes answered by the gateway itself
+const (
+	rpcParseError       = -32700
+	rpcInvalidRequest   = -32600
+	rpcMethodNotAllowed = -32601
+	rpcInternalError    = -32603
+	rpcLimitExceeded    = -32005
+)
+
+// defaultDeniedMethods keep accounts, signing and node administration on the node when no policy is configured
+var defaultDeniedMethods = []string{
+	"eth_sendTransaction",
+	"eth_sign*",
+	"eth_accounts",
+	"personal_*",
+	"admin_*",
+	"debug_*",
+	"miner_*",
+	"txpool_*",
+}
+
+// batchParallelism is how many calls of a batch are sent upstream at the same time
+const batchParallelism = 8
+
+// defaultMethodPolicy is the policy of chains without one in ethereum.methods
+const defaultMethodPolicy = "default"
+
+// EthereumMethodPolicy restricts the methods callable on a chain. A method must match allow, when it is not
+// empty, and must not match deny. Patterns ending in * match by prefix. RateLimits caps calls per second per method.
+type EthereumMethodPolicy struct {
+	Allow      []string       `json:"allow"`
+	Deny       []string       `json:"deny"`
+	RateLimits map[string]int `json:"rate_limits"`
+}
+
+// EthereumRPCConfig configures what the ethereum gateway accepts and caches
+type EthereumRPCConfig struct {
+	// Methods holds the policy of every chain, with the "default" entry applying to chains not listed
+	Methods map[string]EthereumMethodPolicy
+	// MaxBatchSize is the largest JSON-RPC batch accepted
+	MaxBatchSize int
+	// CacheSize is the number of immutable results kept in memory
+	CacheSize int
+	// FinalityDepth is how many blocks behind the head a receipt or block is no longer expected to change
+	FinalityDepth uint64
+}
+
+type ethereumRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// notification reports whether the request is valid and expects no response
+func (r ethereumRPCRequest) notification() bool {
+	return r.ID == nil && r.JSONRPC == "2.0" && r.Method != ""
+}
+
+type ethereumRPCResponse struct {
+	ID     json.RawMessage
+	Result interface{}
+	Error  *jsonrpc2.RPCError
+}
+
+// MarshalJSON writes either the result, even when null, or the error as JSON-RPC 2.0 requires
+func (r ethereumRPCResponse) MarshalJSON() ([]byte, error) {
+	id := r.ID
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if r.Error != nil {
+		response["error"] = r.Error
+	} else {
+		response["result"] = r.Result
+	}
+
+	return json.Marshal(response)
+}
+
+func rpcError(code int, format string, args ...interface{}) *jsonrpc2.RPCError {
+	return &jsonrpc2.RPCError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func matchMethod(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(method, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+		if pattern == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p EthereumMethodPolicy) allows(method string) bool {
+	if matchMethod(p.Deny, method) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchMethod(p.Allow, method)
+}
+
+// policy returns the method policy of the chain
+func (g *EthereumGateway) policy(chainId string) EthereumMethodPolicy {
+	if policy, ok := g.rpcConfig.Methods[chainId]; ok {
+		return policy
+	}
+	return g.rpcConfig.Methods[defaultMethodPolicy]
+}
+
+// methodLimiter returns the rate limiter of the method on the chain, or nil when the method is not limited
+func (g *EthereumGateway) methodLimiter(chainId, method string) *RateLimiter {
+	g.limitersMutex.Lock()
+	defer g.limitersMutex.Unlock()
+
+	key := chainId + ":" + method
+	if limiter, ok := g.limiters[key]; ok {
+		return limiter
+	}
+
+	rps, ok := g.policy(chainId).RateLimits[method]
+	if !ok || rps <= 0 {
+		return nil
+	}
+
+	limiter := NewRateLimiter(rps)
+	// a batch may carry several calls of the same method, allow a second's worth at once
+	limiter.limiter.SetBurst(rps)
+	if g.shared != nil {
+		limiter.Share(g.shared, "rate_limit:ethereum:"+key, g.sharedWindow)
+	}
+	g.limiters[key] = limiter
+
+	return limiter
+}
+
+// execute runs one call through the method policy, the per-method rate limit and the result cache.
+// Calls the gateway refuses are answered with a JSON-RPC error rather than failing the request.
+// The per-method limit is taken once per call, the retries of a failed call do not count against it again.
+func (g *EthereumGateway) execute(ctx context.Context, chainId string, chain *ethereumChain, method string, params interface{}) (*jsonrpc2.RPCResponse, error) {
+	if !g.policy(chainId).allows(method) {
+		return &jsonrpc2.RPCResponse{JSONRPC: "2.0", Error: rpcError(rpcMethodNotAllowed, "method %s is not allowed", method)}, nil
+	}
+
+	key := cacheKey(chainId, method, params)
+	if key != "" {
+		if result, ok := g.cache.Get(key); ok {
+			return &jsonrpc2.RPCResponse{JSONRPC: "2.0", Result: result}, nil
+		}
+	}
+
+	if limiter := g.methodLimiter(chainId, method); limiter != nil && !limiter.Allow() {
+		return &jsonrpc2.RPCResponse{JSONRPC: "2.0", Error: rpcError(rpcLimitExceeded, "rate limit exceeded for %s", method)}, nil
+	}
+
+	result, err := g.retry.DoIf(func() (interface{}, error) {
+		if err := g.rateLimit.Wait(ctx); err != nil {
+			return nil, err
+		}
+		return g.call(chain, method, params)
+	}, func(error) bool {
+		return ctx.Err() == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := result.(*jsonrpc2.RPCResponse)
+	if key != "" && response.Error == nil && g.immutable(chain, method, response.Result) {
+		g.cache.Add(key, response.Result)
+	}
+
+	return response, nil
+}
+
+// cacheKey returns the key of a call whose result can no longer change once it is final, "" for any other call.
+// Blocks are only cached when asked for by number or hash, tags such as latest or finalized move with the chain.
+func cacheKey(chainId, method string, params interface{}) string {
+	switch method {
+	case "eth_getBlockByHash", "eth_getBlockByNumber", "eth_getTransactionReceipt":
+	default:
+		return ""
+	}
+
+	list, ok := params.([]interface{})
+	if !ok || len(list) == 0 || !isHexParam(list[0]) {
+		return ""
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+
+	return chainId + ":" + method + ":" + strings.ToLower(string(data))
+}
+
+// isHexParam reports whether the param is a 0x prefixed hex quantity or hash
+func isHexParam(param interface{}) bool {
+	value, ok := param.(string)
+	if !ok || len(value) < 3 || (value[:2] != "0x" && value[:2] != "0X") {
+		return false
+	}
+
+	for _, c := range value[2:] {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// immutable reports whether a result may be cached: blocks by hash always, blocks by number
+// and receipts once their block is at least FinalityDepth behind the best known head
+func (g *EthereumGateway) immutable(chain *ethereumChain, method string, result interface{}) bool {
+	fields, ok := result.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	var number string
+	switch method {
+	case "eth_getBlockByHash":
+		return true
+	case "eth_getBlockByNumber":
+		number, _ = fields["number"].(string)
+	case "eth_getTransactionReceipt":
+		number, _ = fields["blockNumber"].(string)
+	}
+
+	head := chain.bestHead()
+	if number == "" || head < g.rpcConfig.FinalityDepth {
+		return false
+	}
+
+	return parseHexUint(number) <= head-g.rpcConfig.FinalityDepth
+}
+
+// handleRPC serves a JSON-RPC 2.0 request object or batch, answering with the matching response object or batch
+func (g *EthereumGateway) handleRPC(ctx context.Context, chainId string, chain *ethereumChain, payload json.RawMessage) (interface{}, error) {
+	payload = bytes.TrimSpace(payload)
+
+	// the proxy passes bodies not sent as application/json on as a string
+	if len(payload) > 0 && payload[0] == '"' {
+		var body string
+		if err := json.Unmarshal(payload, &body); err == nil {
+			payload = bytes.TrimSpace([]byte(body))
+		}
+	}
+
+	if len(payload) == 0 || payload[0] != '[' {
+		var request ethereumRPCRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return ethereumRPCResponse{Error: rpcError(rpcParseError, "parse error: %s", err)}, nil
+		}
+
+		response := g.executeRPC(ctx, chainId, chain, request)
+		if request.notification() {
+			return nil, nil
+		}
+		return response, nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(payload, &batch); err != nil {
+		return ethereumRPCResponse{Error: rpcError(rpcParseError, "parse error: %s", err)}, nil
+	}
+
+	// an entry that is not a request object is left empty and answered as an invalid request
+	requests := make([]ethereumRPCRequest, len(batch))
+	for i, entry := range batch {
+		_ = json.Unmarshal(entry, &requests[i])
+	}
+
+	if len(requests) == 0 {
+		return ethereumRPCResponse{Error: rpcError(rpcInvalidRequest, "empty batch")}, nil
+	}
+	if g.rpcConfig.MaxBatchSize > 0 && len(requests) > g.rpcConfig.MaxBatchSize {
+		return ethereumRPCResponse{Error: rpcError(rpcInvalidRequest, "batch of %d calls exceeds the limit of %d", len(requests), g.rpcConfig.MaxBatchSize)}, nil
+	}
+
+	responses := make([]ethereumRPCResponse, len(requests))
+	slots := make(chan struct{}, batchParallelism)
+
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, request ethereumRPCRequest) {
+			defer wg.Done()
+			responses[i] = g.executeRPC(ctx, chainId, chain, request)
+			<-slots
+		}(i, request)
+	}
+	wg.Wait()
+
+	// notifications get no response, a batch of only notifications gets nothing at all
+	result := make([]ethereumRPCResponse, 0, len(responses))
+	for i, response := range responses {
+		if !requests[i].notification() {
+			result = append(result, response)
+		}
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	return result, nil
+}
+
+func (g *EthereumGateway) executeRPC(ctx context.Context, chainId string, chain *ethereumChain, request ethereumRPCRequest) ethereumRPCResponse {
+	response := ethereumRPCResponse{ID: request.ID}
+
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		response.Error = rpcError(rpcInvalidRequest, "invalid request")
+		return response
+	}
+
+	params, err := decodeParams(request.Params)
+	if err != nil {
+		response.Error = rpcError(rpcInvalidRequest, "invalid params: %s", err)
+		return response
+	}
+
+	upstream, err := g.execute(ctx, chainId, chain, request.Method, params)
+	if err != nil {
+		response.Error = rpcError(rpcInternalError, "%s", err)
+		return response
+	}
+
+	response.Result, response.Error = upstream.Result, upstream.Error
+
+	return response
+}
+
+// decodeParams reads by-position params as a list and by-name params as a map, keeping numbers exact
+func decodeParams(raw json.RawMessage) (interface{}, error) {
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var params interface{}
+	if err := decoder.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	switch params.(type) {
+	case []interface{}, map[string]interface{}:
+		return params, nil
+	default:
+		return nil, fmt.Errorf("params must be an array or an object")
+	}
+}
@@ -0,0 +1,320 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jsonrpc2 "github.com/KeisukeYamashita/go-jsonrpc"
+	"github.com/saiset-co/sai-service/service"
+
+	"github.com/saiset-co/sai-interx-manager/types"
+)
+
+// evmNode answers eth_blockNumber with head and every other method with its result, or the error when set
+func evmNode(t *testing.T, head string, results map[string]interface{}, rpcErr *jsonrpc2.RPCError) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req jsonrpc2.RPCRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		response := jsonrpc2.RPCResponse{JSONRPC: "2.0", ID: req.ID}
+		switch {
+		case req.Method == "eth_blockNumber":
+			response.Result = head
+		case rpcErr != nil:
+			atomic.AddInt32(&calls, 1)
+			response.Error = rpcErr
+		default:
+			atomic.AddInt32(&calls, 1)
+			response.Result = results[req.Method]
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func ethereumHandle(g *EthereumGateway, path string) (interface{}, error) {
+	data, _ := json.Marshal(types.InboundRequest{Method: "POST", Path: path})
+	return g.Handle(context.Background(), data)
+}
+
+func ethereumRPC(t *testing.T, g *EthereumGateway, payload string) []map[string]interface{} {
+	data, _ := json.Marshal(map[string]interface{}{"method": "POST", "path": "/chain1", "payload": json.RawMessage(payload)})
+
+	result, err := g.Handle(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []map[string]interface{}
+	decode(t, result, &responses)
+	return responses
+}
+
+func TestEthereumConvertRejectsShortPaths(t *testing.T) {
+	g := &EthereumGateway{}
+
+	for _, path := range []string{"", "/", "/chain1/", "/ethereum/chain1/", "/a/b/c/d"} {
+		if _, _, err := g.convert(path); err == nil {
+			t.Fatalf("expected %q to be rejected", path)
+		}
+	}
+
+	for _, path := range []string{"/chain1/eth_call", "/ethereum/chain1/eth_call"} {
+		chainId, method, err := g.convert(path)
+		if err != nil || chainId != "chain1" || method != "eth_call" {
+			t.Fatalf("unexpected split of %q: %s %s %v", path, chainId, method, err)
+		}
+	}
+
+	if chainId, method, err := g.convert("/ethereum/chain1"); err != nil || chainId != "chain1" || method != "" {
+		t.Fatalf("expected a JSON-RPC path, got %s %s %v", chainId, method, err)
+	}
+}
+
+func TestEthereumFailsOverAndRoutesArchiveCalls(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(down.Close)
+
+	lagging, laggingCalls := evmNode(t, "0x10", map[string]interface{}{"eth_call": "lagging"}, nil)
+	full, _ := evmNode(t, "0x64", nil, &jsonrpc2.RPCError{Code: -32000, Message: "missing trie node abc"})
+	archive, archiveCalls := evmNode(t, "0x64", map[string]interface{}{"eth_call": "archive", "debug_traceTransaction": "trace"}, nil)
+
+	g, err := NewEthereumGateway(service.NewContext(), map[string][]EthereumNode{
+		"chain1": {{URL: down.URL}, {URL: lagging.URL}, {URL: full.URL}, {URL: archive.URL, Archive: true}},
+	}, nil, 1, time.Millisecond, 1000, 0, 5, []string{"debug_"}, EthereumRPCConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := g.chains["chain1"]
+	for _, endpoint := range chain.endpoints {
+		g.probeEndpoint(endpoint)
+	}
+
+	health := chain.Health()
+	if health[0].Healthy || health[1].Healthy || health[1].HeadLag != 0x64-0x10 || !health[2].Healthy || !health[3].Healthy {
+		t.Fatalf("unexpected health %+v", health)
+	}
+
+	// the full node is tried first but lacks the state, the archive node answers
+	result, err := ethereumHandle(g, "/chain1/eth_call")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := result.(*jsonrpc2.RPCResponse); response.Error != nil || response.Result != "archive" {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	if atomic.LoadInt32(laggingCalls) != 0 {
+		t.Fatal("expected the lagging endpoint not to be used while healthy ones answer")
+	}
+
+	before := atomic.LoadInt32(archiveCalls)
+	result, err = ethereumHandle(g, "/chain1/debug_traceTransaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := result.(*jsonrpc2.RPCResponse); response.Result != "trace" || atomic.LoadInt32(archiveCalls) != before+1 {
+		t.Fatalf("expected the archive call on the archive endpoint, got %+v", response)
+	}
+
+	result, err = ethereumHandle(g, "/chain1")
+	if response, ok := result.(ethereumRPCResponse); err != nil || !ok || response.Error.Code != rpcInvalidRequest {
+		t.Fatalf("expected a JSON-RPC path without a request to be rejected, got %+v %v", result, err)
+	}
+	if _, err := ethereumHandle(g, "/chain2/eth_call"); err == nil {
+		t.Fatal("expected an unknown chain to be rejected")
+	}
+}
+
+func TestParseEthereumNodes(t *testing.T) {
+	chains, err := ParseEthereumNodes(map[string]interface{}{
+		"single": "http://a",
+		"list":   []interface{}{"http://b", "http://c"},
+		"objects": []interface{}{
+			map[string]interface{}{"url": "http://d"},
+			map[interface{}]interface{}{"url": "http://e", "archive": true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chains["single"]) != 1 || len(chains["list"]) != 2 || chains["list"][1].URL != "http://c" {
+		t.Fatalf("unexpected chains %+v", chains)
+	}
+	if objects := chains["objects"]; len(objects) != 2 || objects[0].Archive || !objects[1].Archive || objects[1].URL != "http://e" {
+		t.Fatalf("unexpected chains %+v", chains)
+	}
+
+	if _, err := ParseEthereumNodes(map[string]interface{}{"chain": []interface{}{map[string]interface{}{}}}); err == nil {
+		t.Fatal("expected a node without url to be rejected")
+	}
+}
+
+func TestEthereumBatchPolicyAndCache(t *testing.T) {
+	node, calls := evmNode(t, "0x64", map[string]interface{}{
+		"eth_getBlockByHash":        map[string]interface{}{"number": "0x63", "hash": "0xabc"},
+		"eth_getBlockByNumber":      map[string]interface{}{"number": "0x63"},
+		"eth_getTransactionReceipt": map[string]interface{}{"blockNumber": "0x10"},
+		"eth_getLogs":               []interface{}{},
+	}, nil)
+
+	g, err := NewEthereumGateway(service.NewContext(), map[string][]EthereumNode{"chain1": {{URL: node.URL}}},
+		nil, 1, time.Millisecond, 1000, 0, 5, nil, EthereumRPCConfig{
+			Methods: map[string]EthereumMethodPolicy{
+				defaultMethodPolicy: {Deny: []string{"eth_getLogs"}},
+				"chain1": {
+					Allow:      []string{"eth_*"},
+					Deny:       []string{"eth_sign*"},
+					RateLimits: map[string]int{"eth_getLogs": 1},
+				},
+			},
+			MaxBatchSize:  10,
+			CacheSize:     10,
+			FinalityDepth: 10,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.probeEndpoint(g.chains["chain1"].endpoints[0])
+
+	responses := ethereumRPC(t, g, `[
+		{"jsonrpc": "2.0", "id": 1, "method": "eth_getBlockByHash", "params": ["0xABC", false]},
+		{"jsonrpc": "2.0", "id": "two", "method": "admin_peers"},
+		{"jsonrpc": "2.0", "id": 3, "method": "eth_signTransaction", "params": [{}]},
+		{"jsonrpc": "2.0", "id": 4, "method": "eth_getLogs", "params": [{}]},
+		{"jsonrpc": "2.0", "method": "eth_getLogs", "params": [{}]},
+		{"jsonrpc": "2.0", "id": 6, "method": "eth_getTransactionReceipt", "params": ["0x01"]},
+		{"jsonrpc": "2.0", "id": 7, "method": "eth_getBlockByNumber", "params": ["0x63", false]},
+		5
+	]`)
+
+	if len(responses) != 7 {
+		t.Fatalf("expected a response for every request but the notification, got %+v", responses)
+	}
+	if responses[0]["id"] != float64(1) || responses[0]["result"].(map[string]interface{})["hash"] != "0xabc" {
+		t.Fatalf("unexpected block response %+v", responses[0])
+	}
+	for _, i := range []int{1, 2} {
+		if code := responses[i]["error"].(map[string]interface{})["code"]; code != float64(rpcMethodNotAllowed) {
+			t.Fatalf("expected method %d to be refused, got %+v", i, responses[i])
+		}
+	}
+	if responses[1]["id"] != "two" || responses[6]["id"] != nil {
+		t.Fatalf("expected the request ids to be echoed, got %+v %+v", responses[1], responses[6])
+	}
+	if code := responses[6]["error"].(map[string]interface{})["code"]; code != float64(rpcInvalidRequest) {
+		t.Fatalf("expected an invalid request error, got %+v", responses[6])
+	}
+
+	// the two eth_getLogs calls share a limit of one per second, one of them is turned away
+	limited := 0
+	for _, response := range responses {
+		if response["error"] != nil && response["error"].(map[string]interface{})["code"] == float64(rpcLimitExceeded) {
+			limited++
+		}
+	}
+	if atomic.LoadInt32(calls) != 4 || limited > 1 {
+		t.Fatalf("expected 4 upstream calls and at most one limited call, got %d and %d", atomic.LoadInt32(calls), limited)
+	}
+
+	// the block by hash and the finalized receipt are cached, the block 1 below the head is not final yet
+	before := atomic.LoadInt32(calls)
+	responses = ethereumRPC(t, g, `[
+		{"jsonrpc": "2.0", "id": 1, "method": "eth_getBlockByHash", "params": ["0xabc", false]},
+		{"jsonrpc": "2.0", "id": 2, "method": "eth_getTransactionReceipt", "params": ["0x01"]},
+		{"jsonrpc": "2.0", "id": 3, "method": "eth_getBlockByNumber", "params": ["0x63", false]}
+	]`)
+	if len(responses) != 3 || atomic.LoadInt32(calls)-before != 1 || g.cache.Len() != 2 {
+		t.Fatalf("expected one uncached call, got %d calls, %d cached", atomic.LoadInt32(calls)-before, g.cache.Len())
+	}
+
+	var single map[string]interface{}
+	data, _ := json.Marshal(map[string]interface{}{"method": "POST", "path": "/chain1", "payload": `{"jsonrpc":"2.0","id":9,"method":"eth_getBlockByHash","params":["0xabc",false]}`})
+	result, err := g.Handle(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(t, result, &single)
+	if single["id"] != float64(9) || single["result"] == nil {
+		t.Fatalf("expected a request passed on as a string to be served, got %+v", single)
+	}
+
+	batch := `[` + strings.Repeat(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},`, 10) + `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}]`
+	data, _ = json.Marshal(map[string]interface{}{"method": "POST", "path": "/chain1", "payload": json.RawMessage(batch)})
+	result, err = g.Handle(context.Background(), data)
+	if response, ok := result.(ethereumRPCResponse); err != nil || !ok || response.Error.Code != rpcInvalidRequest {
+		t.Fatalf("expected an oversized batch to be refused as a whole, got %+v %v", result, err)
+	}
+}
+
+func TestEthereumCachesOnlyBlocksAskedByNumberOrHash(t *testing.T) {
+	// the node answers any block request with a block well behind its head, as it does for finalized
+	node, calls := evmNode(t, "0x64", map[string]interface{}{
+		"eth_getBlockByNumber": map[string]interface{}{"number": "0x10"},
+	}, nil)
+
+	g, err := NewEthereumGateway(service.NewContext(), map[string][]EthereumNode{"chain1": {{URL: node.URL}}},
+		nil, 1, time.Millisecond, 1000, 0, 5, nil, EthereumRPCConfig{CacheSize: 10, FinalityDepth: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.probeEndpoint(g.chains["chain1"].endpoints[0])
+
+	for _, tag := range []string{"latest", "pending", "safe", "finalized", "earliest"} {
+		for i := 0; i < 2; i++ {
+			ethereumRPC(t, g, `[{"jsonrpc": "2.0", "id": 1, "method": "eth_getBlockByNumber", "params": ["`+tag+`", false]}]`)
+		}
+	}
+	if atomic.LoadInt32(calls) != 10 || g.cache.Len() != 0 {
+		t.Fatalf("expected blocks asked by tag never to be cached, got %d calls and %d cached", atomic.LoadInt32(calls), g.cache.Len())
+	}
+
+	for i := 0; i < 2; i++ {
+		ethereumRPC(t, g, `[{"jsonrpc": "2.0", "id": 1, "method": "eth_getBlockByNumber", "params": ["0x10", false]}]`)
+	}
+	if atomic.LoadInt32(calls) != 11 || g.cache.Len() != 1 {
+		t.Fatalf("expected a final block asked by number to be cached, got %d calls and %d cached", atomic.LoadInt32(calls), g.cache.Len())
+	}
+}
+
+func TestEthereumRetriesDoNotTakeMethodLimitAgain(t *testing.T) {
+	var calls int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(down.Close)
+
+	g, err := NewEthereumGateway(service.NewContext(), map[string][]EthereumNode{"chain1": {{URL: down.URL}}},
+		nil, 3, time.Millisecond, 1000, 0, 5, nil, EthereumRPCConfig{
+			Methods: map[string]EthereumMethodPolicy{"chain1": {RateLimits: map[string]int{"eth_call": 1}}},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responses := ethereumRPC(t, g, `[{"jsonrpc": "2.0", "id": 1, "method": "eth_call", "params": [{}]}]`)
+	if code := responses[0]["error"].(map[string]interface{})["code"]; code != float64(rpcInternalError) || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expected the call to be tried 3 times on one limit token, got %d calls and %+v", atomic.LoadInt32(&calls), responses[0])
+	}
+
+	// a cancelled request is not retried
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data, _ := json.Marshal(types.InboundRequest{Method: "POST", Path: "/chain1/eth_chainId"})
+	if _, err := g.Handle(ctx, data); err == nil || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expected a cancelled request to fail without upstream calls, got %d calls and %v", atomic.LoadInt32(&calls), err)
+	}
+}
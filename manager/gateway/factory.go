@@ -10,32 +10,71 @@ import (
 	saiService "github.com/saiset-co/sai-service/service"
 	"github.com/spf13/cast"
 
+	"github.com/saiset-co/sai-interx-manager/p2p"
 	"github.com/saiset-co/sai-interx-manager/types"
 )
 
 type GatewayFactory struct {
 	context *saiService.Context
 	storage types.Storage
+	shared  p2p.SharedState
 }
 
-func NewGatewayFactory(context *saiService.Context, storage types.Storage) *GatewayFactory {
+func NewGatewayFactory(context *saiService.Context, storage types.Storage, shared p2p.SharedState) *GatewayFactory {
 	return &GatewayFactory{
 		context: context,
 		storage: storage,
+		shared:  shared,
 	}
 }
 
 func (f *GatewayFactory) CreateGateway(gatewayType string) (types.Gateway, error) {
 	switch gatewayType {
 	case "ethereum":
-		return NewEthereumGateway(
+		chains, err := ParseEthereumNodes(f.context.GetConfig("ethereum.nodes", map[string]interface{}{}))
+		if err != nil {
+			logger.Logger.Error("Invalid ethereum nodes configuration", zap.Error(err))
+			return nil, err
+		}
+
+		methods := map[string]EthereumMethodPolicy{}
+
+		methodsBytes, err := json.Marshal(f.context.GetConfig("ethereum.methods", map[string]interface{}{}))
+		if err == nil {
+			err = json.Unmarshal(methodsBytes, &methods)
+		}
+		if err != nil {
+			logger.Logger.Error("Invalid ethereum methods configuration", zap.Error(err))
+			return nil, err
+		}
+
+		if _, ok := methods[defaultMethodPolicy]; !ok {
+			methods[defaultMethodPolicy] = EthereumMethodPolicy{Deny: defaultDeniedMethods}
+		}
+
+		gateway, err := NewEthereumGateway(
 			f.context,
-			cast.ToStringMapString(f.context.GetConfig("ethereum.nodes", map[string]string{})),
+			chains,
 			f.storage,
 			cast.ToInt(f.context.GetConfig("ethereum.retries", 1)),
 			time.Duration(cast.ToInt64(f.context.GetConfig("ethereum.retry_delay", 10))),
 			cast.ToInt(f.context.GetConfig("ethereum.rate_limit", 10)),
+			time.Duration(cast.ToInt(f.context.GetConfig("ethereum.probe_interval", 15)))*time.Second,
+			cast.ToUint64(f.context.GetConfig("ethereum.max_head_lag", 5)),
+			cast.ToStringSlice(f.context.GetConfig("ethereum.archive_methods", []string{"debug_", "trace_", "eth_getProof"})),
+			EthereumRPCConfig{
+				Methods:       methods,
+				MaxBatchSize:  cast.ToInt(f.context.GetConfig("ethereum.max_batch_size", 100)),
+				CacheSize:     cast.ToInt(f.context.GetConfig("ethereum.cache_size", 10000)),
+				FinalityDepth: cast.ToUint64(f.context.GetConfig("ethereum.finality_depth", 64)),
+			},
 		)
+		if err != nil {
+			return nil, err
+		}
+
+		gateway.shareState(f.shared, gatewayType, f.rateWindow())
+		return gateway, nil
 	case "cosmos":
 		var cosmosConfig types.CosmosConfig
 
@@ -51,27 +90,53 @@ func (f *GatewayFactory) CreateGateway(gatewayType string) (types.Gateway, error
 			return nil, err
 		}
 
-		return NewCosmosGateway(
+		gateway, err := NewCosmosGateway(
 			f.context,
 			f.storage,
 			cosmosConfig,
 		)
+		if err != nil {
+			return nil, err
+		}
+
+		gateway.shareState(f.shared, gatewayType, f.rateWindow())
+		return gateway, nil
 	case "bitcoin":
-		return NewBitcoinGateway(
+		nodes := cast.ToStringSlice(f.context.GetConfig("bitcoin.nodes", []string{}))
+		if url := cast.ToString(f.context.GetConfig("bitcoin.url", "")); url != "" {
+			nodes = append(nodes, url)
+		}
+
+		gateway, err := NewBitcoinGateway(
 			f.context,
-			cast.ToString(f.context.GetConfig("bitcoin.url", "")),
+			nodes,
+			cast.ToString(f.context.GetConfig("bitcoin.rpc_user", "")),
+			cast.ToString(f.context.GetConfig("bitcoin.rpc_password", "")),
 			cast.ToInt(f.context.GetConfig("bitcoin.retries", 1)),
 			time.Duration(cast.ToInt64(f.context.GetConfig("bitcoin.retry_delay", 10))),
 			cast.ToInt(f.context.GetConfig("bitcoin.rate_limit", 10)),
+			time.Duration(cast.ToInt64(f.context.GetConfig("bitcoin.scan_timeout", 300)))*time.Second,
 		)
+		if err != nil {
+			return nil, err
+		}
+
+		gateway.shareState(f.shared, gatewayType, f.rateWindow())
+		return gateway, nil
 	case "storage":
-		return NewStorageGateway(
+		gateway, err := NewStorageGateway(
 			f.context,
 			f.storage,
 			cast.ToInt(f.context.GetConfig("storage.retries", 1)),
 			time.Duration(cast.ToInt64(f.context.GetConfig("storage.retry_delay", 10))),
 			cast.ToInt(f.context.GetConfig("storage.rate_limit", 10)),
 		)
+		if err != nil {
+			return nil, err
+		}
+
+		gateway.shareState(f.shared, gatewayType, f.rateWindow())
+		return gateway, nil
 	default:
 		err := fmt.Errorf("unknown gateway type: %s", gatewayType)
 		logger.Logger.Error("GatewayFactory - CreateGateway", zap.Error(err))
@@ -79,3 +144,8 @@ func (f *GatewayFactory) CreateGateway(gatewayType string) (types.Gateway, error
 		return nil, err
 	}
 }
+
+// rateWindow is the period over which requests are counted against the cluster-wide rate limits
+func (f *GatewayFactory) rateWindow() time.Duration {
+	return time.Duration(cast.ToInt(f.context.GetConfig("shared_state.rate_window", 10))) * time.Second
+}
@@ -5,8 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/tracing"
+	"github.com/saiset-co/sai-interx-manager/types"
 	"github.com/saiset-co/sai-service/service"
+	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
@@ -18,6 +24,7 @@ type BaseGateway struct {
 	client    *http.Client
 	rateLimit *RateLimiter
 	retry     *Retrier
+	shared    p2p.SharedState
 }
 
 func NewBaseGateway(ctx *service.Context, retryAttempts int, retryDelay time.Duration, rateLimit int) *BaseGateway {
@@ -31,42 +38,67 @@ func NewBaseGateway(ctx *service.Context, retryAttempts int, retryDelay time.Dur
 	}
 }
 
+// shareState gives the gateway the state replicated across the manager cluster and makes its rate limit cluster-wide
+func (g *BaseGateway) shareState(shared p2p.SharedState, name string, window time.Duration) {
+	if shared == nil {
+		return
+	}
+
+	g.shared = shared
+	g.rateLimit.Share(shared, "rate_limit:"+name, window)
+}
+
+// makeSaiRequest sends a request to another sai service, continuing the trace of ctx in its metadata
 func (g *BaseGateway) makeSaiRequest(ctx context.Context, url string, payload interface{}) (interface{}, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "sai request", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("http.url", url)))
+	defer span.End()
+
+	if request, ok := payload.(types.SaiRequest); ok {
+		metadata := cast.ToStringMap(request.Metadata)
+		tracing.InjectMetadata(ctx, metadata)
+		request.Metadata = metadata
+		payload = request
+	}
+
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	tracing.InjectHeader(ctx, req.Header)
 
 	resp, err := g.client.Do(req)
 	if err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		err = errors.New("non-200 status code: " + resp.Status)
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
 
 	var result interface{}
 	if err := json.Unmarshal(body, &result); err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
 
@@ -74,40 +106,47 @@ func (g *BaseGateway) makeSaiRequest(ctx context.Context, url string, payload in
 }
 
 func (g *BaseGateway) makeRequest(ctx context.Context, method, url string, payload interface{}) (interface{}, error) {
+	ctx, span := tracing.Tracer().Start(ctx, method+" request", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("http.url", url)))
+	defer span.End()
+
 	payloadData, err := json.Marshal(payload)
 	if err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(payloadData))
 	if err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
+	tracing.InjectHeader(ctx, req.Header)
 
 	resp, err := g.client.Do(req)
 	if err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		err = errors.New("non-200 status code: " + resp.Status)
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
 
 	var result interface{}
 	if err := json.Unmarshal(body, &result); err != nil {
-		logger.Logger.Error("BaseGateway - makeRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("BaseGateway - makeRequest", zap.Error(err))
 		return nil, err
 	}
 
@@ -2,19 +2,106 @@ package gateway
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
+
 	"golang.org/x/time/rate"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
 )
 
 type RateLimiter struct {
-	limiter *rate.Limiter
+	limiter           *rate.Limiter
+	requestsPerSecond int
+	shared            p2p.SharedState
+	key               string
+	window            time.Duration
+	mutex             sync.RWMutex
 }
 
 func NewRateLimiter(requestsPerSecond int) *RateLimiter {
 	return &RateLimiter{
-		limiter: rate.NewLimiter(rate.Limit(requestsPerSecond), 1),
+		limiter:           rate.NewLimiter(rate.Limit(requestsPerSecond), 1),
+		requestsPerSecond: requestsPerSecond,
 	}
 }
 
+// Share makes the limit apply to the whole cluster. Requests are counted per window in a
+// replicated counter; while the mesh is partitioned each side only sees its own requests.
+func (r *RateLimiter) Share(shared p2p.SharedState, key string, window time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.shared = shared
+	r.key = key
+	r.window = window
+}
+
 func (r *RateLimiter) Wait(ctx context.Context) error {
+	if err := r.waitShared(ctx); err != nil {
+		return err
+	}
+
 	return r.limiter.Wait(ctx)
 }
+
+// Allow takes a request if one is available right now, without waiting for the next one. The local
+// token is given back when the cluster-wide window is full, so a rejected request costs nothing.
+func (r *RateLimiter) Allow() bool {
+	now := time.Now()
+
+	reservation := r.limiter.ReserveN(now, 1)
+	if !reservation.OK() || reservation.DelayFrom(now) > 0 {
+		reservation.CancelAt(now)
+		return false
+	}
+
+	if ok, _ := r.takeShared(now); !ok {
+		reservation.CancelAt(now)
+		return false
+	}
+
+	return true
+}
+
+func (r *RateLimiter) waitShared(ctx context.Context) error {
+	for {
+		now := time.Now()
+
+		ok, next := r.takeShared(now)
+		if ok {
+			return nil
+		}
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// takeShared counts a request in the cluster-wide window, or returns when the next window starts if it is full
+func (r *RateLimiter) takeShared(now time.Time) (bool, time.Time) {
+	r.mutex.RLock()
+	shared, key, window := r.shared, r.key, r.window
+	r.mutex.RUnlock()
+
+	if shared == nil || window <= 0 || r.requestsPerSecond <= 0 {
+		return true, now
+	}
+
+	limit := uint64(float64(r.requestsPerSecond) * window.Seconds())
+	slot := now.UnixNano() / int64(window)
+	slotKey := fmt.Sprintf("%s:%d", key, slot)
+
+	if shared.Counter(slotKey) < limit {
+		shared.Increment(slotKey, 1, 2*window)
+		return true, now
+	}
+
+	return false, time.Unix(0, (slot+1)*int64(window))
+}
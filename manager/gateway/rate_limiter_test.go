@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/saiset-co/sai-interx-manager/p2p/state"
+)
+
+func TestRateLimiterAllowGivesBackTheLocalToken(t *testing.T) {
+	limiter := NewRateLimiter(1)
+
+	// one request per second over a window of 100ms leaves no request to the cluster
+	limiter.Share(state.NewStore("node-a"), "limit", 100*time.Millisecond)
+	if limiter.Allow() {
+		t.Fatal("expected the request to be rejected while the cluster window is full")
+	}
+
+	limiter.Share(nil, "", 0)
+	if !limiter.Allow() {
+		t.Fatal("expected the local token of the rejected request to be given back")
+	}
+	if limiter.Allow() {
+		t.Fatal("expected the local limit to apply")
+	}
+}
+
+func TestRateLimiterAllowCountsInTheCluster(t *testing.T) {
+	store := state.NewStore("node-a")
+	limiter := NewRateLimiter(10)
+	limiter.Share(store, "limit", time.Hour)
+
+	slotKey := func() string { return fmt.Sprintf("limit:%d", time.Now().UnixNano()/int64(time.Hour)) }
+
+	if !limiter.Allow() {
+		t.Fatal("expected the first request to be allowed")
+	}
+	if counter := store.Counter(slotKey()); counter != 1 {
+		t.Fatalf("expected the request to be counted in the cluster, got %d", counter)
+	}
+
+	// the local limiter refuses the next one right away, before it is counted
+	if limiter.Allow() {
+		t.Fatal("expected the local limit to apply")
+	}
+	if counter := store.Counter(slotKey()); counter != 1 {
+		t.Fatalf("expected a locally rejected request not to be counted, got %d", counter)
+	}
+}
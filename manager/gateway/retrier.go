@@ -21,6 +21,11 @@ func NewRetrier(attempts int, delay time.Duration) *Retrier {
 }
 
 func (r *Retrier) Do(fn RetryFunc) (interface{}, error) {
+	return r.DoIf(fn, func(error) bool { return true })
+}
+
+// DoIf retries fn while it fails with an error the retryable func accepts, other errors are returned at once
+func (r *Retrier) DoIf(fn RetryFunc, retryable func(error) bool) (interface{}, error) {
 	var lastError error
 
 	for i := 0; i < r.attempts; i++ {
@@ -31,6 +36,10 @@ func (r *Retrier) Do(fn RetryFunc) (interface{}, error) {
 			lastError = err
 		}
 
+		if !retryable(err) {
+			return nil, err
+		}
+
 		if i < r.attempts-1 {
 			time.Sleep(r.delay)
 		}
@@ -0,0 +1,615 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sekaitypes "github.com/KiraCore/sekai/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/tracing"
+	"github.com/saiset-co/sai-interx-manager/types"
+)
+
+const (
+	RosettaBlockchain = "KIRA"
+	RosettaVersion    = "1.4.13"
+
+	OperationTransfer = "transfer"
+	OperationMint     = "mint"
+	OperationBurn     = "burn"
+
+	OperationSuccess = "success"
+)
+
+var (
+	ErrRosettaInvalidRequest      = types.RosettaError{Code: 1, Message: "Invalid request"}
+	ErrRosettaNetwork             = types.RosettaError{Code: 2, Message: "Network is not supported"}
+	ErrRosettaHistoricalBalance   = types.RosettaError{Code: 3, Message: "Historical balance lookup is not supported"}
+	ErrRosettaBlockNotFound       = types.RosettaError{Code: 4, Message: "Block not found", Retriable: true}
+	ErrRosettaBlockNotIndexed     = types.RosettaError{Code: 5, Message: "Block transactions are not indexed yet", Retriable: true}
+	ErrRosettaTxNotFound          = types.RosettaError{Code: 6, Message: "Transaction not found", Retriable: true}
+	ErrRosettaNodeUnavailable     = types.RosettaError{Code: 7, Message: "Node is unavailable", Retriable: true}
+	ErrRosettaUnsupportedEndpoint = types.RosettaError{Code: 8, Message: "Endpoint is not supported"}
+)
+
+var rosettaErrors = []types.RosettaError{
+	ErrRosettaInvalidRequest,
+	ErrRosettaNetwork,
+	ErrRosettaHistoricalBalance,
+	ErrRosettaBlockNotFound,
+	ErrRosettaBlockNotIndexed,
+	ErrRosettaTxNotFound,
+	ErrRosettaNodeUnavailable,
+	ErrRosettaUnsupportedEndpoint,
+}
+
+// RosettaGateway serves the Rosetta Data API for the KIRA chain from the sekai node queried by the
+// cosmos gateway and the transactions indexed in cosmos_txs. Amounts are in base denominations.
+type RosettaGateway struct {
+	cosmos *CosmosGateway
+}
+
+var _ types.Gateway = (*RosettaGateway)(nil)
+
+func NewRosettaGateway(cosmos *CosmosGateway) *RosettaGateway {
+	return &RosettaGateway{cosmos: cosmos}
+}
+
+type tendermintBlock struct {
+	BlockID struct {
+		Hash string `json:"hash"`
+	} `json:"block_id"`
+	Block struct {
+		Header struct {
+			Height      string    `json:"height"`
+			Time        time.Time `json:"time"`
+			LastBlockID struct {
+				Hash string `json:"hash"`
+			} `json:"last_block_id"`
+		} `json:"header"`
+		Data struct {
+			Txs []string `json:"txs"`
+		} `json:"data"`
+	} `json:"block"`
+}
+
+type indexedTx struct {
+	Hash     string `json:"hash"`
+	Height   string `json:"height"`
+	TxResult struct {
+		Code      int    `json:"code"`
+		Codespace string `json:"codespace"`
+		GasWanted string `json:"gas_wanted"`
+		GasUsed   string `json:"gas_used"`
+		Events    []struct {
+			Type       string `json:"type"`
+			Attributes []struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			} `json:"attributes"`
+		} `json:"events"`
+	} `json:"tx_result"`
+}
+
+func (g *RosettaGateway) Handle(ctx context.Context, data []byte) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(g.cosmos.config.GWTimeout)*time.Second)
+	defer cancel()
+
+	var req types.InboundRequest
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		tracing.Logger(ctx).Error("RosettaGateway - Handle", zap.Error(err))
+		return nil, ErrRosettaInvalidRequest.WithDetails(err)
+	}
+
+	var request types.RosettaRequest
+
+	payload, err := json.Marshal(req.Payload)
+	if err == nil {
+		err = json.Unmarshal(payload, &request)
+	}
+	if err != nil {
+		tracing.Logger(ctx).Error("RosettaGateway - Handle", zap.Error(err))
+		return nil, ErrRosettaInvalidRequest.WithDetails(err)
+	}
+
+	var handle func(ctx context.Context) (interface{}, error)
+
+	switch strings.TrimPrefix(req.Path, "/rosetta") {
+	case "/network/list":
+		handle = g.networkList
+	case "/network/options":
+		handle = func(ctx context.Context) (interface{}, error) { return g.withNetwork(ctx, request, g.networkOptions) }
+	case "/network/status":
+		handle = func(ctx context.Context) (interface{}, error) { return g.withNetwork(ctx, request, g.networkStatus) }
+	case "/account/balance":
+		handle = func(ctx context.Context) (interface{}, error) {
+			return g.withNetwork(ctx, request, func(ctx context.Context) (interface{}, error) { return g.accountBalance(ctx, request) })
+		}
+	case "/block":
+		handle = func(ctx context.Context) (interface{}, error) {
+			return g.withNetwork(ctx, request, func(ctx context.Context) (interface{}, error) { return g.block(ctx, request) })
+		}
+	case "/block/transaction":
+		handle = func(ctx context.Context) (interface{}, error) {
+			return g.withNetwork(ctx, request, func(ctx context.Context) (interface{}, error) { return g.blockTransaction(ctx, request) })
+		}
+	case "/mempool":
+		handle = func(ctx context.Context) (interface{}, error) { return g.withNetwork(ctx, request, g.mempool) }
+	default:
+		return nil, ErrRosettaUnsupportedEndpoint.WithDetails(fmt.Errorf("unknown path %s", req.Path))
+	}
+
+	return g.cosmos.retry.DoIf(func() (interface{}, error) {
+		if err := g.cosmos.rateLimit.Wait(ctx); err != nil {
+			tracing.Logger(ctx).Error("RosettaGateway - Handle", zap.Error(err))
+			return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+		}
+		return handle(ctx)
+	}, func(err error) bool { return ctx.Err() == nil && retriable(err) })
+}
+
+// retriable reports whether a failed request may succeed when it is sent again, only the Rosetta errors
+// marked retriable are
+func retriable(err error) bool {
+	var rosettaErr *types.RosettaError
+	if errors.As(err, &rosettaErr) {
+		return rosettaErr.Retriable
+	}
+	return true
+}
+
+func (g *RosettaGateway) Close() {
+
+}
+
+func (g *RosettaGateway) networkList(ctx context.Context) (interface{}, error) {
+	status, err := g.cosmos.status(ctx)
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	return types.RosettaNetworkListResponse{
+		NetworkIdentifiers: []types.RosettaNetworkIdentifier{{
+			Blockchain: RosettaBlockchain,
+			Network:    status.NodeInfo.Network,
+		}},
+	}, nil
+}
+
+// withNetwork rejects requests for any network other than the chain of the sekai node
+func (g *RosettaGateway) withNetwork(ctx context.Context, request types.RosettaRequest, next func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	status, err := g.cosmos.status(ctx)
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	if request.NetworkIdentifier.Blockchain != RosettaBlockchain || request.NetworkIdentifier.Network != status.NodeInfo.Network {
+		return nil, ErrRosettaNetwork.WithDetails(fmt.Errorf("expected %s/%s", RosettaBlockchain, status.NodeInfo.Network))
+	}
+
+	return next(ctx)
+}
+
+func (g *RosettaGateway) networkOptions(ctx context.Context) (interface{}, error) {
+	status, err := g.cosmos.status(ctx)
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	var response types.RosettaNetworkOptionsResponse
+
+	response.Version.RosettaVersion = RosettaVersion
+	response.Version.NodeVersion = status.NodeInfo.Version
+	response.Allow.OperationStatuses = []types.RosettaOperationStatus{{Status: OperationSuccess, Successful: true}}
+	response.Allow.OperationTypes = []string{OperationTransfer, OperationMint, OperationBurn}
+	response.Allow.Errors = rosettaErrors
+	response.Allow.CallMethods = []string{}
+	response.Allow.BalanceExemptions = []interface{}{}
+
+	return response, nil
+}
+
+func (g *RosettaGateway) networkStatus(ctx context.Context) (interface{}, error) {
+	status, err := g.cosmos.status(ctx)
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	latestHeight, _ := strconv.ParseInt(status.SyncInfo.LatestBlockHeight, 10, 64)
+	earliestHeight, _ := strconv.ParseInt(status.SyncInfo.EarliestBlockHeight, 10, 64)
+	latestTime, _ := time.Parse(time.RFC3339Nano, status.SyncInfo.LatestBlockTime)
+
+	response := types.RosettaNetworkStatusResponse{
+		CurrentBlockIdentifier: types.RosettaBlockIdentifier{Index: latestHeight, Hash: status.SyncInfo.LatestBlockHash},
+		CurrentBlockTimestamp:  latestTime.UnixMilli(),
+		OldestBlockIdentifier:  types.RosettaBlockIdentifier{Index: earliestHeight, Hash: status.SyncInfo.EarliestBlockHash},
+		SyncStatus: types.RosettaSyncStatus{
+			CurrentIndex: latestHeight,
+			Synced:       !status.SyncInfo.CatchingUp,
+		},
+		Peers: []types.RosettaPeer{},
+	}
+
+	// pruned nodes no longer have the first block, the oldest one is the best that can be reported then
+	response.GenesisBlockIdentifier = response.OldestBlockIdentifier
+	if earliestHeight > 1 {
+		if genesis, err := g.tendermintBlock(ctx, "height=1"); err == nil {
+			response.GenesisBlockIdentifier = types.RosettaBlockIdentifier{Index: 1, Hash: genesis.BlockID.Hash}
+		}
+	}
+
+	netInfo, err := g.cosmos.makeTendermintRPCRequest(ctx, "/net_info", "")
+	if err == nil {
+		var peers struct {
+			Peers []struct {
+				NodeInfo struct {
+					ID string `json:"id"`
+				} `json:"node_info"`
+			} `json:"peers"`
+		}
+		if convert(netInfo, &peers) == nil {
+			for _, peer := range peers.Peers {
+				response.Peers = append(response.Peers, types.RosettaPeer{PeerID: peer.NodeInfo.ID})
+			}
+		}
+	}
+
+	return response, nil
+}
+
+func (g *RosettaGateway) accountBalance(ctx context.Context, request types.RosettaRequest) (interface{}, error) {
+	if request.AccountIdentifier == nil || request.AccountIdentifier.Address == "" {
+		return nil, ErrRosettaInvalidRequest.WithDetails(errors.New("account_identifier is required"))
+	}
+
+	if request.BlockIdentifier != nil && (request.BlockIdentifier.Index != nil || request.BlockIdentifier.Hash != "") {
+		return nil, &ErrRosettaHistoricalBalance
+	}
+
+	status, err := g.cosmos.status(ctx)
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	coins, err := g.cosmos.balances(ctx, types.InboundRequest{Payload: map[string]interface{}{
+		"limit": strconv.Itoa(sekaitypes.PageIterationLimit - 1),
+	}}, request.AccountIdentifier.Address)
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	amounts := map[string]string{}
+	for _, coin := range coins {
+		amounts[coin.Denom] = coin.Amount.String()
+	}
+
+	latestHeight, _ := strconv.ParseInt(status.SyncInfo.LatestBlockHeight, 10, 64)
+	response := types.RosettaAccountBalanceResponse{
+		BlockIdentifier: types.RosettaBlockIdentifier{Index: latestHeight, Hash: status.SyncInfo.LatestBlockHash},
+		Balances:        []types.RosettaAmount{},
+	}
+
+	if len(request.Currencies) > 0 {
+		for _, currency := range request.Currencies {
+			value, ok := amounts[currency.Symbol]
+			if !ok {
+				value = "0"
+			}
+			response.Balances = append(response.Balances, types.RosettaAmount{Value: value, Currency: currency})
+		}
+		return response, nil
+	}
+
+	for _, coin := range coins {
+		response.Balances = append(response.Balances, amount(coin, false))
+	}
+
+	return response, nil
+}
+
+func (g *RosettaGateway) block(ctx context.Context, request types.RosettaRequest) (interface{}, error) {
+	block, err := g.findBlock(ctx, request.BlockIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	height, _ := strconv.ParseInt(block.Block.Header.Height, 10, 64)
+
+	indexed, err := g.indexed(ctx, height)
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+	if !indexed {
+		return nil, ErrRosettaBlockNotIndexed.WithDetails(fmt.Errorf("height %d is not indexed yet", height))
+	}
+
+	txs, err := g.blockTxs(ctx, block.Block.Header.Height)
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	response := types.RosettaBlockResponse{
+		Block: types.RosettaBlock{
+			BlockIdentifier: types.RosettaBlockIdentifier{Index: height, Hash: block.BlockID.Hash},
+			Timestamp:       block.Block.Header.Time.UnixMilli(),
+			Transactions:    make([]types.RosettaTransaction, 0, len(txs)),
+		},
+	}
+
+	response.Block.ParentBlockIdentifier = types.RosettaBlockIdentifier{Index: height - 1, Hash: block.Block.Header.LastBlockID.Hash}
+	if block.Block.Header.LastBlockID.Hash == "" {
+		response.Block.ParentBlockIdentifier = response.Block.BlockIdentifier
+	}
+
+	for _, tx := range txs {
+		response.Block.Transactions = append(response.Block.Transactions, transaction(tx))
+	}
+
+	return response, nil
+}
+
+func (g *RosettaGateway) blockTransaction(ctx context.Context, request types.RosettaRequest) (interface{}, error) {
+	if request.TransactionIdentifier == nil || request.TransactionIdentifier.Hash == "" {
+		return nil, ErrRosettaInvalidRequest.WithDetails(errors.New("transaction_identifier is required"))
+	}
+
+	if request.BlockIdentifier == nil || request.BlockIdentifier.Index == nil {
+		return nil, ErrRosettaInvalidRequest.WithDetails(errors.New("block_identifier.index is required"))
+	}
+
+	hash := strings.ToUpper(strings.TrimPrefix(request.TransactionIdentifier.Hash, "0x"))
+
+	result, err := g.cosmos.transactions(ctx, types.InboundRequest{Payload: map[string]interface{}{
+		"hash":     hash,
+		"height":   strconv.FormatInt(*request.BlockIdentifier.Index, 10),
+		"statuses": []string{"success", "failed"},
+	}})
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	var txs []indexedTx
+	if err := convert(result.(types.TxsResultResponse).Transactions, &txs); err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	if len(txs) == 0 {
+		return nil, ErrRosettaTxNotFound.WithDetails(fmt.Errorf("%s at height %d", hash, *request.BlockIdentifier.Index))
+	}
+
+	return types.RosettaBlockTransactionResponse{Transaction: transaction(txs[0])}, nil
+}
+
+func (g *RosettaGateway) mempool(ctx context.Context) (interface{}, error) {
+	result, err := g.cosmos.makeTendermintRPCRequest(ctx, "/unconfirmed_txs", "limit=100")
+	if err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	var unconfirmed struct {
+		Txs []string `json:"txs"`
+	}
+	if err := convert(result, &unconfirmed); err != nil {
+		return nil, ErrRosettaNodeUnavailable.WithDetails(err)
+	}
+
+	response := types.RosettaMempoolResponse{TransactionIdentifiers: []types.RosettaTransactionIdentifier{}}
+	for _, tx := range unconfirmed.Txs {
+		txBytes, err := base64.StdEncoding.DecodeString(tx)
+		if err != nil {
+			continue
+		}
+
+		hash := sha256.Sum256(txBytes)
+		response.TransactionIdentifiers = append(response.TransactionIdentifiers, types.RosettaTransactionIdentifier{
+			Hash: strings.ToUpper(hex.EncodeToString(hash[:])),
+		})
+	}
+
+	return response, nil
+}
+
+// findBlock looks the block up by hash or height, or returns the latest block when neither is given
+func (g *RosettaGateway) findBlock(ctx context.Context, identifier *types.RosettaPartialBlockIdentifier) (*tendermintBlock, error) {
+	var (
+		block *tendermintBlock
+		err   error
+	)
+
+	switch {
+	case identifier != nil && identifier.Hash != "":
+		block, err = g.tendermintBlock(ctx, "hash=0x"+strings.TrimPrefix(identifier.Hash, "0x"))
+	case identifier != nil && identifier.Index != nil:
+		block, err = g.tendermintBlock(ctx, fmt.Sprintf("height=%d", *identifier.Index))
+	default:
+		block, err = g.tendermintBlock(ctx, "")
+	}
+	if err != nil {
+		return nil, ErrRosettaBlockNotFound.WithDetails(err)
+	}
+
+	if identifier != nil && identifier.Index != nil && identifier.Hash != "" && block.Block.Header.Height != strconv.FormatInt(*identifier.Index, 10) {
+		return nil, ErrRosettaBlockNotFound.WithDetails(fmt.Errorf("block %s is not at height %d", identifier.Hash, *identifier.Index))
+	}
+
+	return block, nil
+}
+
+func (g *RosettaGateway) tendermintBlock(ctx context.Context, query string) (*tendermintBlock, error) {
+	path := "/block"
+	if strings.HasPrefix(query, "hash=") {
+		path = "/block_by_hash"
+	}
+
+	result, err := g.cosmos.makeTendermintRPCRequest(ctx, path, query)
+	if err != nil {
+		return nil, err
+	}
+
+	block := new(tendermintBlock)
+	if err := convert(result, block); err != nil {
+		return nil, err
+	}
+
+	if block.BlockID.Hash == "" {
+		return nil, errors.New("empty block")
+	}
+
+	return block, nil
+}
+
+// blockTxs reads every indexed transaction of the block, successful or not
+func (g *RosettaGateway) blockTxs(ctx context.Context, height string) ([]indexedTx, error) {
+	limit := sekaitypes.PageIterationLimit - 1
+
+	var txs []indexedTx
+	for offset := 0; ; offset += limit {
+		result, err := g.cosmos.transactions(ctx, types.InboundRequest{Payload: map[string]interface{}{
+			"height":   height,
+			"statuses": []string{"success", "failed"},
+			"offset":   strconv.Itoa(offset),
+			"limit":    strconv.Itoa(limit),
+		}})
+		if err != nil {
+			return nil, err
+		}
+
+		var page []indexedTx
+		if err := convert(result.(types.TxsResultResponse).Transactions, &page); err != nil {
+			return nil, err
+		}
+
+		txs = append(txs, page...)
+		if len(page) < limit {
+			return txs, nil
+		}
+	}
+}
+
+// indexed reports whether the indexer has stored the transactions of a height. The transactions cannot be
+// counted against the block, the indexer skips those without events and may skip the failed ones, so the
+// height is compared with the checkpoints of the indexer: the head has passed it and a running backfill,
+// which indexes the heights after its own up to its target, is not still to reach it.
+func (g *RosettaGateway) indexed(ctx context.Context, height int64) (bool, error) {
+	result, err := g.cosmos.storage.Read(ctx, "cosmos_txs_checkpoints", map[string]interface{}{
+		"name": map[string]interface{}{"$in": []string{"head", "backfill"}},
+	}, nil, []string{"name", "height", "target"})
+	if err != nil {
+		return false, err
+	}
+
+	var checkpoints []struct {
+		Name   string `json:"name"`
+		Height int64  `json:"height"`
+		Target int64  `json:"target"`
+	}
+	if err := convert(result.Result, &checkpoints); err != nil {
+		return false, err
+	}
+
+	indexed := false
+	for _, checkpoint := range checkpoints {
+		switch checkpoint.Name {
+		case "head":
+			indexed = indexed || height <= checkpoint.Height
+		case "backfill":
+			if height > checkpoint.Height && height <= checkpoint.Target {
+				return false, nil
+			}
+		}
+	}
+
+	return indexed, nil
+}
+
+// transaction turns the balance-changing events of an indexed transaction into Rosetta operations.
+// Events are only emitted for state changes that were committed, so a failed transaction still
+// reports the fee it paid.
+func transaction(tx indexedTx) types.RosettaTransaction {
+	result := types.RosettaTransaction{
+		TransactionIdentifier: types.RosettaTransactionIdentifier{Hash: tx.Hash},
+		Operations:            []types.RosettaOperation{},
+		Metadata: map[string]interface{}{
+			"code":       tx.TxResult.Code,
+			"codespace":  tx.TxResult.Codespace,
+			"gas_wanted": tx.TxResult.GasWanted,
+			"gas_used":   tx.TxResult.GasUsed,
+		},
+	}
+
+	addOperation := func(opType, address string, coin sdk.Coin, negative bool, related *int64) int64 {
+		index := int64(len(result.Operations))
+		amount := amount(coin, negative)
+
+		operation := types.RosettaOperation{
+			OperationIdentifier: types.RosettaOperationIdentifier{Index: index},
+			Type:                opType,
+			Status:              OperationSuccess,
+			Account:             &types.RosettaAccountIdentifier{Address: address},
+			Amount:              &amount,
+		}
+		if related != nil {
+			operation.RelatedOperations = []types.RosettaOperationIdentifier{{Index: *related}}
+		}
+
+		result.Operations = append(result.Operations, operation)
+		return index
+	}
+
+	for _, event := range tx.TxResult.Events {
+		attributes := map[string]string{}
+		for _, attribute := range event.Attributes {
+			attributes[attribute.Key] = attribute.Value
+		}
+
+		coins, err := sdk.ParseCoinsNormalized(attributes["amount"])
+		if err != nil {
+			continue
+		}
+
+		for _, coin := range coins {
+			switch event.Type {
+			case "transfer":
+				sent := addOperation(OperationTransfer, attributes["sender"], coin, true, nil)
+				addOperation(OperationTransfer, attributes["recipient"], coin, false, &sent)
+			case "coinbase":
+				addOperation(OperationMint, attributes["minter"], coin, false, nil)
+			case "burn":
+				addOperation(OperationBurn, attributes["burner"], coin, true, nil)
+			}
+		}
+	}
+
+	return result
+}
+
+func amount(coin sdk.Coin, negative bool) types.RosettaAmount {
+	value := coin.Amount.String()
+	if negative && !coin.Amount.IsZero() {
+		value = "-" + value
+	}
+
+	return types.RosettaAmount{
+		Value:    value,
+		Currency: types.RosettaCurrency{Symbol: coin.Denom},
+	}
+}
+
+func convert(source interface{}, target interface{}) error {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/saiset-co/sai-service/service"
+
+	"github.com/saiset-co/sai-interx-manager/types"
+)
+
+func TestRosettaOperationsFromEvents(t *testing.T) {
+	var tx indexedTx
+	err := json.Unmarshal([]byte(`{
+		"hash": "A1B2",
+		"height": "42",
+		"tx_result": {
+			"code": 0,
+			"gas_used": "81000",
+			"events": [
+				{"type": "message", "attributes": [{"key": "action", "value": "/cosmos.bank.v1beta1.MsgSend"}]},
+				{"type": "transfer", "attributes": [
+					{"key": "recipient", "value": "kira1fee"},
+					{"key": "sender", "value": "kira1alice"},
+					{"key": "amount", "value": "100ukex"}
+				]},
+				{"type": "transfer", "attributes": [
+					{"key": "recipient", "value": "kira1bob"},
+					{"key": "sender", "value": "kira1alice"},
+					{"key": "amount", "value": "5samolean,7ukex"}
+				]},
+				{"type": "burn", "attributes": [{"key": "burner", "value": "kira1alice"}, {"key": "amount", "value": "3ukex"}]}
+			]
+		}
+	}`), &tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := transaction(tx)
+
+	if result.TransactionIdentifier.Hash != "A1B2" || len(result.Operations) != 7 {
+		t.Fatalf("unexpected transaction %+v", result)
+	}
+
+	expected := []struct {
+		opType, address, value, denom string
+	}{
+		{OperationTransfer, "kira1alice", "-100", "ukex"},
+		{OperationTransfer, "kira1fee", "100", "ukex"},
+		{OperationTransfer, "kira1alice", "-5", "samolean"},
+		{OperationTransfer, "kira1bob", "5", "samolean"},
+		{OperationTransfer, "kira1alice", "-7", "ukex"},
+		{OperationTransfer, "kira1bob", "7", "ukex"},
+		{OperationBurn, "kira1alice", "-3", "ukex"},
+	}
+
+	for i, operation := range result.Operations {
+		want := expected[i]
+		if operation.OperationIdentifier.Index != int64(i) || operation.Type != want.opType || operation.Account.Address != want.address ||
+			operation.Amount.Value != want.value || operation.Amount.Currency.Symbol != want.denom {
+			t.Fatalf("unexpected operation %d: %+v %+v", i, operation, operation.Amount)
+		}
+	}
+
+	if related := result.Operations[3].RelatedOperations; len(related) != 1 || related[0].Index != 2 {
+		t.Fatalf("expected the credit to point at its debit, got %+v", related)
+	}
+}
+
+func TestRosettaIndexedFollowsCheckpoints(t *testing.T) {
+	var checkpoints []map[string]interface{}
+	var collection string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Data struct {
+				Collection string `json:"collection"`
+			} `json:"data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		collection = request.Data.Collection
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"Status": "OK", "result": checkpoints})
+	}))
+	defer server.Close()
+
+	g := &RosettaGateway{cosmos: &CosmosGateway{
+		BaseGateway: NewBaseGateway(service.NewContext(), 1, time.Millisecond, 1000),
+		storage:     types.NewStorage(server.URL, "token"),
+	}}
+
+	head := map[string]interface{}{"name": "head", "height": 100}
+	backfill := map[string]interface{}{"name": "backfill", "height": 20, "target": 50}
+
+	cases := []struct {
+		name        string
+		checkpoints []map[string]interface{}
+		height      int64
+		indexed     bool
+	}{
+		{"nothing indexed", nil, 1, false},
+		{"below the head", []map[string]interface{}{head}, 100, true},
+		{"above the head", []map[string]interface{}{head}, 101, false},
+		{"backfilled", []map[string]interface{}{head, backfill}, 20, true},
+		{"still to backfill", []map[string]interface{}{backfill, head}, 21, false},
+		{"backfill target", []map[string]interface{}{head, backfill}, 50, false},
+		{"after the backfill", []map[string]interface{}{head, backfill}, 51, true},
+	}
+
+	for _, c := range cases {
+		checkpoints = c.checkpoints
+
+		indexed, err := g.indexed(context.Background(), c.height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indexed != c.indexed {
+			t.Errorf("%s: expected indexed %v at height %d, got %v", c.name, c.indexed, c.height, indexed)
+		}
+	}
+
+	if collection != "cosmos_txs_checkpoints" {
+		t.Fatalf("expected the checkpoints of the indexer to be read, got %q", collection)
+	}
+}
+
+func TestRosettaRetriesRetriableErrorsOnly(t *testing.T) {
+	cases := []struct {
+		err       error
+		retriable bool
+	}{
+		{ErrRosettaNodeUnavailable.WithDetails(errors.New("connection refused")), true},
+		{ErrRosettaBlockNotIndexed.WithDetails(errors.New("height 5")), true},
+		{ErrRosettaNetwork.WithDetails(errors.New("testnet")), false},
+		{ErrRosettaInvalidRequest.WithDetails(errors.New("no block")), false},
+		{errors.New("unexpected"), true},
+	}
+
+	for _, c := range cases {
+		if retriable(c.err) != c.retriable {
+			t.Errorf("expected retriable %v for %v", c.retriable, c.err)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-service/service"
 	"github.com/spf13/cast"
 	"go.uber.org/zap"
@@ -26,14 +27,14 @@ func NewStorageGateway(ctx *service.Context, storage types.Storage, retryAttempt
 	}, nil
 }
 
-func (g *StorageGateway) Handle(data []byte) (interface{}, error) {
+func (g *StorageGateway) Handle(ctx context.Context, data []byte) (interface{}, error) {
 	var req struct {
 		Method string                 `json:"method"`
 		Params map[string]interface{} `json:"params"`
 	}
 
 	if err := json.Unmarshal(data, &req); err != nil {
-		logger.Logger.Error("StorageGateway - Handle", zap.Error(err))
+		tracing.Logger(ctx).Error("StorageGateway - Handle", zap.Error(err))
 		return nil, err
 	}
 
@@ -43,32 +44,32 @@ func (g *StorageGateway) Handle(data []byte) (interface{}, error) {
 		}
 		switch req.Method {
 		case "create":
-			return g.storage.Create(cast.ToString(req.Params["collection"]), req.Params["data"])
+			return g.storage.Create(ctx, cast.ToString(req.Params["collection"]), req.Params["data"])
 		case "read":
 			criteria, err := cast.ToStringMapE(req.Params["select"])
 			if err != nil {
-				logger.Logger.Error("StorageGateway - Handle", zap.Error(err))
+				tracing.Logger(ctx).Error("StorageGateway - Handle", zap.Error(err))
 				return nil, err
 			}
-			return g.storage.Read(cast.ToString(req.Params["collection"]), criteria, nil, []string{})
+			return g.storage.Read(ctx, cast.ToString(req.Params["collection"]), criteria, nil, []string{})
 		case "update":
 			criteria, err := cast.ToStringMapE(req.Params["select"])
 			if err != nil {
-				logger.Logger.Error("StorageGateway - Handle", zap.Error(err))
+				tracing.Logger(ctx).Error("StorageGateway - Handle", zap.Error(err))
 				return nil, err
 			}
-			return g.storage.Update(cast.ToString(req.Params["collection"]), criteria, req.Params["data"])
+			return g.storage.Update(ctx, cast.ToString(req.Params["collection"]), criteria, req.Params["data"])
 		case "delete":
 			criteria, err := cast.ToStringMapE(req.Params["select"])
 			if err != nil {
-				logger.Logger.Error("StorageGateway - Handle", zap.Error(err))
+				tracing.Logger(ctx).Error("StorageGateway - Handle", zap.Error(err))
 				return nil, err
 			}
-			return g.storage.Delete(cast.ToString(req.Params["collection"]), criteria)
+			return g.storage.Delete(ctx, cast.ToString(req.Params["collection"]), criteria)
 		}
 
 		err := errors.New("method not found")
-		logger.Logger.Error("StorageGateway - Handle", zap.Error(err))
+		tracing.Logger(ctx).Error("StorageGateway - Handle", zap.Error(err))
 
 		return nil, err
 	})
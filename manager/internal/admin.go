@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-service/service"
+)
+
+// adminHandlers expose the p2p mesh to operators. They are served by the local node only and
+// require the common.token of the manager in the "token" field of the request metadata.
+func (is *InternalService) adminHandlers() service.Handler {
+	middlewares := []service.Middleware{is.adminAuth}
+
+	return service.Handler{
+		"admin_peers": service.HandlerElement{
+			Name:        "AdminPeers",
+			Description: "List active and passive peers with their scores, RTT and last message times",
+			Function: func(data, meta interface{}) (interface{}, int, error) {
+				return is.p2pServer.PeerManager().Peers(), http.StatusOK, nil
+			},
+			Middlewares: middlewares,
+		},
+		"admin_add_peer": service.HandlerElement{
+			Name:        "AdminAddPeer",
+			Description: "Connect to a peer by its p2p address",
+			Function: func(data, meta interface{}) (interface{}, int, error) {
+				params := cast.ToStringMap(data)
+				address := cast.ToString(params["address"])
+				if address == "" {
+					return nil, http.StatusBadRequest, errors.New("address is required")
+				}
+
+				peer, err := is.p2pServer.PeerManager().AddPeer(address, cast.ToBool(params["remote"]))
+				if err != nil {
+					logger.Logger.Error("AdminAddPeer", zap.String("address", address), zap.Error(err))
+					return nil, http.StatusBadGateway, err
+				}
+
+				return map[string]interface{}{"node_id": peer.ID(), "address": peer.Address()}, http.StatusOK, nil
+			},
+			Middlewares: middlewares,
+		},
+		"admin_remove_peer": service.HandlerElement{
+			Name:        "AdminRemovePeer",
+			Description: "Disconnect a peer and drop it from the peer book",
+			Function: func(data, meta interface{}) (interface{}, int, error) {
+				nodeID, err := nodeIDParam(data)
+				if err != nil {
+					return nil, http.StatusBadRequest, err
+				}
+
+				is.p2pServer.PeerManager().ForgetPeer(nodeID)
+				return map[string]interface{}{"node_id": nodeID, "removed": true}, http.StatusOK, nil
+			},
+			Middlewares: middlewares,
+		},
+		"admin_ban_peer": service.HandlerElement{
+			Name:        "AdminBanPeer",
+			Description: "Ban a node ID for duration seconds, or for good when the duration is 0; unban with \"unban\": true",
+			Function: func(data, meta interface{}) (interface{}, int, error) {
+				nodeID, err := nodeIDParam(data)
+				if err != nil {
+					return nil, http.StatusBadRequest, err
+				}
+
+				params := cast.ToStringMap(data)
+				if cast.ToBool(params["unban"]) {
+					is.p2pServer.PeerManager().UnbanPeer(nodeID)
+					return map[string]interface{}{"node_id": nodeID, "banned": false}, http.StatusOK, nil
+				}
+
+				duration := time.Duration(cast.ToInt64(params["duration"])) * time.Second
+				is.p2pServer.PeerManager().BanPeer(nodeID, duration)
+				logger.Logger.Info("AdminBanPeer", zap.Any("nodeID", nodeID), zap.Duration("duration", duration))
+
+				return map[string]interface{}{"node_id": nodeID, "banned": true}, http.StatusOK, nil
+			},
+			Middlewares: middlewares,
+		},
+		"admin_drain": service.HandlerElement{
+			Name:        "AdminDrain",
+			Description: "Stop or resume routing requests to the local node",
+			Function: func(data, meta interface{}) (interface{}, int, error) {
+				enabled := cast.ToBool(cast.ToStringMap(data)["enabled"])
+				is.p2pServer.LoadBalancer().SetDraining(enabled)
+				logger.Logger.Info("AdminDrain", zap.Bool("draining", enabled))
+
+				return map[string]interface{}{"draining": enabled}, http.StatusOK, nil
+			},
+			Middlewares: middlewares,
+		},
+		"admin_balancer": service.HandlerElement{
+			Name:        "AdminBalancer",
+			Description: "Show the balancer decision table",
+			Function: func(data, meta interface{}) (interface{}, int, error) {
+				return is.p2pServer.LoadBalancer().DecisionTable(), http.StatusOK, nil
+			},
+			Middlewares: middlewares,
+		},
+	}
+}
+
+// adminAuth rejects requests unless their metadata token matches common.token. Without a configured token the admin API is disabled.
+func (is *InternalService) adminAuth(next service.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+	token := cast.ToString(is.Context.GetConfig("common.token", ""))
+	if token == "" {
+		return nil, http.StatusForbidden, errors.New("admin API is disabled, common.token is not configured")
+	}
+
+	provided := cast.ToString(cast.ToStringMap(metadata)["token"])
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		return nil, http.StatusUnauthorized, errors.New("wrong token")
+	}
+
+	return next(data, metadata)
+}
+
+func nodeIDParam(data interface{}) (p2p.NodeID, error) {
+	nodeID := cast.ToString(cast.ToStringMap(data)["node_id"])
+	if nodeID == "" {
+		return "", errors.New("node_id is required")
+	}
+	return p2p.NodeID(nodeID), nil
+}
@@ -2,16 +2,19 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
 
 	"go.uber.org/zap"
 
-	"github.com/saiset-co/sai-interx-manager/logger"
 	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/balancer"
+	"github.com/saiset-co/sai-interx-manager/tracing"
+	"github.com/saiset-co/sai-interx-manager/types"
 	"github.com/saiset-co/sai-service/service"
 )
 
 func (is *InternalService) NewHandler() service.Handler {
-	return service.Handler{
+	handler := service.Handler{
 		"metrics": service.HandlerElement{
 			Name:        "Metrics",
 			Description: "Test endpoint for the balancer",
@@ -28,75 +31,118 @@ func (is *InternalService) NewHandler() service.Handler {
 			},
 			Middlewares: []service.Middleware{
 				is.p2pServer.MetricsCollector().CreateMetricsMiddleware("metrics"),
-				is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("metrics"),
+				is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("metrics", is.strategy("metrics", balancer.StrategyScore)),
 			},
 		},
 		"ethereum": service.HandlerElement{
 			Name:        "EthereumAPI",
 			Description: "Proxy api endpoint for an ethereum network",
 			Function: func(data, meta interface{}) (interface{}, int, error) {
+				ctx := tracing.FromMetadata(meta)
+
 				dataBytes, err := json.Marshal(data)
 				if err != nil {
-					logger.Logger.Error("EthereumAPI", zap.Error(err))
+					tracing.Logger(ctx).Error("EthereumAPI", zap.Error(err))
 					return nil, 500, err
 				}
 
-				result, err := is.ethereumGateway.Handle(dataBytes)
+				result, err := is.ethereumGateway.Handle(ctx, dataBytes)
 				if err != nil {
-					logger.Logger.Error("EthereumAPI", zap.Error(err))
+					tracing.Logger(ctx).Error("EthereumAPI", zap.Error(err))
 					return nil, 500, err
 				}
 
 				return result, 200, nil
 			},
 			Middlewares: []service.Middleware{
-				is.p2pServer.MetricsCollector().CreateMetricsMiddleware("metrics"),
-				is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("metrics"),
+				is.p2pServer.MetricsCollector().CreateMetricsMiddleware("ethereum"),
+				is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("ethereum", is.strategy("ethereum", balancer.StrategyPowerOfTwo)),
 			},
 		},
 		"cosmos": service.HandlerElement{
 			Name:        "CosmosAPI",
 			Description: "Proxy api endpoint for a cosmos network",
 			Function: func(data, meta interface{}) (interface{}, int, error) {
+				ctx := tracing.FromMetadata(meta)
+
 				dataBytes, err := json.Marshal(data)
 				if err != nil {
-					logger.Logger.Error("CosmosAPI", zap.Error(err))
+					tracing.Logger(ctx).Error("CosmosAPI", zap.Error(err))
 					return nil, 500, err
 				}
 
-				result, err := is.cosmosGateway.Handle(dataBytes)
+				result, err := is.cosmosGateway.Handle(ctx, dataBytes)
 				if err != nil {
-					logger.Logger.Error("EthereumAPI", zap.Error(err))
+					tracing.Logger(ctx).Error("EthereumAPI", zap.Error(err))
 					return nil, 500, err
 				}
 
 				return result, 200, nil
 			},
 			//Middlewares: []service.Middleware{
-			//	is.p2pServer.MetricsCollector().CreateMetricsMiddleware("metrics"),
-			//	is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("metrics"),
+			//	is.p2pServer.MetricsCollector().CreateMetricsMiddleware("cosmos"),
+			//	is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("cosmos", is.strategy("cosmos", balancer.StrategyScore)),
 			//},
 		},
 		"rosetta": service.HandlerElement{
 			Name:        "RosettaAPI",
 			Description: "Proxy api endpoint for Rosetta",
 			Function: func(data, meta interface{}) (interface{}, int, error) {
-				return nil, 500, nil
+				if is.rosettaGateway == nil {
+					return nil, 500, errors.New("rosetta gateway is not available")
+				}
+
+				ctx := tracing.FromMetadata(meta)
+
+				dataBytes, err := json.Marshal(data)
+				if err != nil {
+					tracing.Logger(ctx).Error("RosettaAPI", zap.Error(err))
+					return nil, 500, err
+				}
+
+				result, err := is.rosettaGateway.Handle(ctx, dataBytes)
+				if err != nil {
+					tracing.Logger(ctx).Error("RosettaAPI", zap.Error(err))
+
+					// Rosetta clients expect the error object itself as the response body
+					var rosettaErr *types.RosettaError
+					if errors.As(err, &rosettaErr) {
+						return rosettaErr, 500, nil
+					}
+
+					return nil, 500, err
+				}
+
+				return result, 200, nil
 			},
 			Middlewares: []service.Middleware{
-				is.p2pServer.MetricsCollector().CreateMetricsMiddleware("metrics"),
-				is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("metrics"),
+				is.p2pServer.MetricsCollector().CreateMetricsMiddleware("rosetta"),
+				is.p2pServer.LoadBalancer().CreateChainLoadBalancerMiddleware("rosetta", is.strategy("rosetta", balancer.StrategyHashByRoute)),
 			},
 		},
 		"bitcoin": service.HandlerElement{
-			Name:        "RosettaAPI",
-			Description: "Proxy api endpoint for Rosetta",
+			Name:        "BitcoinAPI",
+			Description: "Proxy api endpoint for a bitcoin network",
 			Function: func(data, meta interface{}) (interface{}, int, error) {
-				return nil, 500, nil
+				ctx := tracing.FromMetadata(meta)
+
+				dataBytes, err := json.Marshal(data)
+				if err != nil {
+					tracing.Logger(ctx).Error("BitcoinAPI", zap.Error(err))
+					return nil, 500, err
+				}
+
+				result, err := is.bitcoinGateway.Handle(ctx, dataBytes)
+				if err != nil {
+					tracing.Logger(ctx).Error("BitcoinAPI", zap.Error(err))
+					return nil, 500, err
+				}
+
+				return result, 200, nil
 			},
 			Middlewares: []service.Middleware{
-				is.p2pServer.MetricsCollector().CreateMetricsMiddleware("metrics"),
-				is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("metrics"),
+				is.p2pServer.MetricsCollector().CreateMetricsMiddleware("bitcoin"),
+				is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("bitcoin", is.strategy("bitcoin", balancer.StrategyLeastActive)),
 			},
 		},
 		"default": service.HandlerElement{
@@ -106,9 +152,21 @@ func (is *InternalService) NewHandler() service.Handler {
 				return nil, 0, nil
 			},
 			Middlewares: []service.Middleware{
-				is.p2pServer.MetricsCollector().CreateMetricsMiddleware("metrics"),
-				is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("metrics"),
+				is.p2pServer.MetricsCollector().CreateMetricsMiddleware("default"),
+				is.p2pServer.LoadBalancer().CreateLoadBalancerMiddleware("default", is.strategy("default", balancer.StrategyScore)),
 			},
 		},
 	}
+
+	for name, element := range is.adminHandlers() {
+		handler[name] = element
+	}
+
+	// the tracing middleware runs first, so forwarded requests and the handler continue its span
+	for name, element := range handler {
+		element.Middlewares = append(element.Middlewares, tracing.Middleware(name))
+		handler[name] = element
+	}
+
+	return handler
 }
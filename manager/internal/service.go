@@ -1,14 +1,20 @@
 package internal
 
 import (
+	"context"
 	"time"
 
 	"github.com/spf13/cast"
+	"go.uber.org/zap"
 
 	"github.com/saiset-co/sai-interx-manager/gateway"
+	"github.com/saiset-co/sai-interx-manager/logger"
 	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/balancer"
 	"github.com/saiset-co/sai-interx-manager/p2p/config"
 	"github.com/saiset-co/sai-interx-manager/p2p/net"
+	"github.com/saiset-co/sai-interx-manager/subscription"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-interx-manager/types"
 	"github.com/saiset-co/sai-service/service"
 )
@@ -17,31 +23,75 @@ type InternalService struct {
 	Context         *service.Context
 	cosmosGateway   types.Gateway
 	ethereumGateway types.Gateway
+	bitcoinGateway  types.Gateway
+	rosettaGateway  types.Gateway
 	storageGateway  types.Gateway
 	storage         types.Storage
 	p2pServer       p2p.Network
+	subscriptions   *subscription.Server
 }
 
 func (is *InternalService) Init() {
 	var err error
 
+	_, err = tracing.Init(tracing.Config{
+		Enabled:     cast.ToBool(is.Context.GetConfig("tracing.enabled", false)),
+		Endpoint:    cast.ToString(is.Context.GetConfig("tracing.endpoint", "otel-collector:4318")),
+		Insecure:    cast.ToBool(is.Context.GetConfig("tracing.insecure", true)),
+		SampleRatio: cast.ToFloat64(is.Context.GetConfig("tracing.sample_ratio", 1.0)),
+		ServiceName: cast.ToString(is.Context.GetConfig("tracing.service_name", "sai-interx-manager")),
+	})
+	if err != nil {
+		panic(err)
+	}
+
 	is.storage = types.NewStorage(
 		cast.ToString(is.Context.GetConfig("storage.url", "")),
 		cast.ToString(is.Context.GetConfig("storage.token", "")),
 	)
 
-	nodeID := cast.ToString(is.Context.GetConfig("p2p.id", ""))
 	windowSize := cast.ToInt(is.Context.GetConfig("balancer.window_size", 60))
 	threshold := cast.ToFloat64(is.Context.GetConfig("balancer.threshold", 0.2))
+	clockSkew := cast.ToInt(is.Context.GetConfig("p2p.max_clock_skew", 30))
+
+	var allowedPeers []p2p.NodeID
+	for _, nodeID := range cast.ToStringSlice(is.Context.GetConfig("p2p.allowed_peers", []string{})) {
+		allowedPeers = append(allowedPeers, p2p.NodeID(nodeID))
+	}
 
 	networkConfig := config.NewNetworkConfig(
-		config.WithNodeID(p2p.NodeID(nodeID)),
 		config.WithListenAddress(cast.ToString(is.Context.GetConfig("p2p.address", "0.0.0.0:9000"))),
 		config.WithMaxPeers(cast.ToInt(is.Context.GetConfig("p2p.max_peers", 3))),
 		config.WithHTTPPort(cast.ToInt(is.Context.GetConfig("common.http.port", 8080))),
 		config.WithMetricsWindowSize(time.Duration(windowSize)*time.Second),
 		config.WithLoadBalancerThreshold(threshold),
+		config.WithMaxHops(cast.ToInt(is.Context.GetConfig("balancer.max_hops", 1))),
+		config.WithForwardTimeout(time.Duration(cast.ToInt(is.Context.GetConfig("balancer.forward_timeout", 10)))*time.Second),
+		config.WithCircuitBreaker(
+			cast.ToInt(is.Context.GetConfig("balancer.failure_threshold", 3)),
+			time.Duration(cast.ToInt(is.Context.GetConfig("balancer.cooldown", 30)))*time.Second,
+		),
 		config.WithInitialPeers(cast.ToStringSlice(is.Context.GetConfig("p2p.peers", []string{}))),
+		config.WithPeerBook(cast.ToString(is.Context.GetConfig("p2p.peer_book_file", "peers.json"))),
+		config.WithViewSizes(
+			cast.ToInt(is.Context.GetConfig("p2p.active_view", 8)),
+			cast.ToInt(is.Context.GetConfig("p2p.passive_view", 64)),
+		),
+		config.WithShuffle(
+			time.Duration(cast.ToInt(is.Context.GetConfig("p2p.shuffle_interval", 30)))*time.Second,
+			cast.ToInt(is.Context.GetConfig("p2p.shuffle_length", 8)),
+		),
+		config.WithKeyFile(cast.ToString(is.Context.GetConfig("p2p.key_file", "node.key"))),
+		config.WithAllowedPeers(allowedPeers),
+		config.WithTrustOnFirstUse(
+			cast.ToBool(is.Context.GetConfig("p2p.trust_on_first_use", false)),
+			cast.ToString(is.Context.GetConfig("p2p.known_peers_file", "known_peers.json")),
+		),
+		config.WithMaxClockSkew(time.Duration(clockSkew)*time.Second),
+		config.WithMTU(cast.ToInt(is.Context.GetConfig("p2p.mtu", 1200))),
+		config.WithMaxBlockLag(cast.ToInt64(is.Context.GetConfig("balancer.max_block_lag", 10))),
+		config.WithLegacyWireFormat(cast.ToBool(is.Context.GetConfig("p2p.legacy_json", false))),
+		config.WithStateGossipInterval(time.Duration(cast.ToInt(is.Context.GetConfig("shared_state.gossip_interval", 1000)))*time.Millisecond),
 	)
 
 	is.p2pServer, err = net.NewNetwork(is.Context.Context, networkConfig)
@@ -49,20 +99,61 @@ func (is *InternalService) Init() {
 		panic(err)
 	}
 
-	gatewayFactory := gateway.NewGatewayFactory(is.Context, is.storage)
+	gatewayFactory := gateway.NewGatewayFactory(is.Context, is.storage, is.p2pServer.SharedState())
 
 	is.cosmosGateway, err = gatewayFactory.CreateGateway("cosmos")
 	if err != nil {
 		panic(err)
 	}
+	if cosmosGateway, ok := is.cosmosGateway.(*gateway.CosmosGateway); ok {
+		is.rosettaGateway = gateway.NewRosettaGateway(cosmosGateway)
+	}
 	is.ethereumGateway, err = gatewayFactory.CreateGateway("ethereum")
 	if err != nil {
 		panic(err)
 	}
+	is.bitcoinGateway, err = gatewayFactory.CreateGateway("bitcoin")
+	if err != nil {
+		panic(err)
+	}
 	is.storageGateway, err = gatewayFactory.CreateGateway("storage")
 	if err != nil {
 		panic(err)
 	}
+
+	if cast.ToBool(is.Context.GetConfig("subscriptions.enabled", false)) {
+		is.subscriptions = is.newSubscriptionServer()
+	}
+}
+
+// newSubscriptionServer relays websocket subscriptions to the sekai node and to the ethereum nodes with a ws address
+func (is *InternalService) newSubscriptionServer() *subscription.Server {
+	chains, err := gateway.ParseEthereumNodes(is.Context.GetConfig("ethereum.nodes", map[string]interface{}{}))
+	if err != nil {
+		panic(err)
+	}
+
+	ethereumURLs := map[string][]string{}
+	for chainId, nodes := range chains {
+		for _, node := range nodes {
+			if node.WS != "" {
+				ethereumURLs[chainId] = append(ethereumURLs[chainId], node.WS)
+			}
+		}
+	}
+
+	return subscription.NewServer(
+		subscription.Config{
+			Address:          cast.ToString(is.Context.GetConfig("subscriptions.address", "0.0.0.0:8882")),
+			MaxConnections:   cast.ToInt(is.Context.GetConfig("subscriptions.max_connections", 1000)),
+			MaxSubscriptions: cast.ToInt(is.Context.GetConfig("subscriptions.max_subscriptions", 10)),
+			BufferSize:       cast.ToInt(is.Context.GetConfig("subscriptions.buffer_size", 256)),
+			CosmosEvents:     cast.ToStringSlice(is.Context.GetConfig("subscriptions.cosmos_events", []string{"NewBlock", "NewBlockHeader", "Tx"})),
+			EthereumTypes:    cast.ToStringSlice(is.Context.GetConfig("subscriptions.ethereum_types", []string{"newHeads", "logs", "newPendingTransactions"})),
+		},
+		cast.ToString(is.Context.GetConfig("cosmos.node.tendermint", "")),
+		ethereumURLs,
+	)
 }
 
 func (is *InternalService) Process() {
@@ -70,8 +161,57 @@ func (is *InternalService) Process() {
 		is.p2pServer.Stop()
 		is.cosmosGateway.Close()
 		is.ethereumGateway.Close()
+		is.bitcoinGateway.Close()
 		is.storageGateway.Close()
 
 		panic(err)
 	}
+
+	if is.subscriptions != nil {
+		if err := is.subscriptions.Start(); err != nil {
+			panic(err)
+		}
+	}
+
+	if cosmosGateway, ok := is.cosmosGateway.(*gateway.CosmosGateway); ok {
+		// the service context is taken once, the watcher lives as long as the service and not as a request
+		ctx := is.Context.Context
+		interval := cast.ToInt(is.Context.GetConfig("balancer.chain_state_interval", 5))
+		go is.watchChainState(ctx, cosmosGateway, time.Duration(interval)*time.Second)
+	}
+}
+
+// watchChainState periodically publishes the sekai sync state so peers can route around lagging nodes
+func (is *InternalService) watchChainState(ctx context.Context, cosmosGateway *gateway.CosmosGateway, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		state, err := cosmosGateway.ChainState(ctx)
+		if err != nil {
+			logger.Logger.Error("watchChainState", zap.Error(err))
+		} else {
+			is.p2pServer.MetricsCollector().SetChainState(state)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// strategy returns the balancing strategy configured for the handler under balancer.strategies, falling back to def
+func (is *InternalService) strategy(handler, def string) p2p.Strategy {
+	threshold := cast.ToFloat64(is.Context.GetConfig("balancer.threshold", 0.2))
+	name := cast.ToString(is.Context.GetConfig("balancer.strategies."+handler, def))
+
+	strategy, err := balancer.NewStrategy(name, threshold)
+	if err != nil {
+		logger.Logger.Error("strategy", zap.String("handler", handler), zap.Error(err))
+		strategy, _ = balancer.NewStrategy(def, threshold)
+	}
+
+	return strategy
 }
@@ -2,129 +2,501 @@ package balancer
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	saiService "github.com/saiset-co/sai-service/service"
+	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/saiset-co/sai-interx-manager/logger"
 	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/config"
 	"github.com/saiset-co/sai-interx-manager/p2p/metrics"
-	"github.com/saiset-co/sai-interx-manager/p2p/utils"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-interx-manager/types"
 )
 
+const (
+	MetadataFromPeer     = "X-From-Peer"
+	MetadataOriginalNode = "X-Original-Node"
+	MetadataForwardedBy  = "X-Forwarded-By"
+	MetadataHopCount     = "X-Hop-Count"
+	MetadataMinHeight    = "X-Min-Height"
+)
+
 type LoadBalancer struct {
-	nodeID    p2p.NodeID
-	metrics   metrics.Collector
-	threshold float64
+	nodeID         p2p.NodeID
+	metrics        metrics.Collector
+	threshold      float64
+	strategy       p2p.Strategy
+	maxHops        int
+	forwardTimeout time.Duration
+	maxBlockLag    int64
+	breaker        *CircuitBreaker
+	client         *http.Client
+	strategies     map[string]p2p.Strategy
+	chainMethods   map[string]bool
+	strategyMutex  sync.RWMutex
 }
 
-func NewLoadBalancer(nodeID p2p.NodeID, metrics metrics.Collector, threshold float64) *LoadBalancer {
+func NewLoadBalancer(nodeID p2p.NodeID, metrics metrics.Collector, lbConfig config.LoadBalancerConfig) *LoadBalancer {
 	return &LoadBalancer{
-		nodeID:    nodeID,
-		metrics:   metrics,
-		threshold: threshold,
+		nodeID:         nodeID,
+		metrics:        metrics,
+		threshold:      lbConfig.Threshold,
+		strategy:       NewScoreStrategy(lbConfig.Threshold),
+		maxHops:        lbConfig.MaxHops,
+		forwardTimeout: lbConfig.ForwardTimeout,
+		maxBlockLag:    lbConfig.MaxBlockLag,
+		breaker:        NewCircuitBreaker(lbConfig.FailureThreshold, lbConfig.Cooldown),
+		client:         &http.Client{},
+		strategies:     make(map[string]p2p.Strategy),
+		chainMethods:   make(map[string]bool),
 	}
 }
 
-func (lb *LoadBalancer) CreateLoadBalancerMiddleware(method string) func(next saiService.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+// CreateLoadBalancerMiddleware delegates requests to the node picked by the strategy, or the default score strategy when nil.
+// Requests that reached the hop limit or already passed through this node are always handled locally. When forwarding
+// fails, GET, HEAD and OPTIONS requests are handled locally and the others fail with 502, as the peer may have applied them.
+// The chain state reported by the nodes is not taken into account, X-Min-Height is ignored.
+func (lb *LoadBalancer) CreateLoadBalancerMiddleware(method string, strategy p2p.Strategy) func(next saiService.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+	return lb.middleware(method, strategy, false)
+}
+
+// CreateChainLoadBalancerMiddleware is CreateLoadBalancerMiddleware for the handlers served from the chain whose state
+// the nodes report. Peers on another chain, catching up or lagging are skipped and requests carrying X-Min-Height
+// are only served by nodes whose chain reached that height.
+func (lb *LoadBalancer) CreateChainLoadBalancerMiddleware(method string, strategy p2p.Strategy) func(next saiService.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+	return lb.middleware(method, strategy, true)
+}
+
+func (lb *LoadBalancer) middleware(method string, strategy p2p.Strategy, chainBound bool) func(next saiService.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+	if strategy == nil {
+		strategy = lb.strategy
+	}
+
+	lb.strategyMutex.Lock()
+	lb.strategies[method] = strategy
+	lb.chainMethods[method] = chainBound
+	lb.strategyMutex.Unlock()
+
 	return func(next saiService.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
 		metadataMap, ok := metadata.(map[string]interface{})
-		if ok && metadataMap["X-From-Peer"] == true {
+		if !ok {
 			return next(data, metadata)
 		}
 
-		shouldHandle, targetNodeID := lb.ShouldHandleRequest()
-		if !shouldHandle {
-			metadataMap["X-From-Peer"] = true
-			metadataMap["X-Original-Node"] = lb.nodeID
-
-			request := types.SaiRequest{
-				Method:   method,
-				Data:     data,
-				Metadata: metadataMap,
-			}
+		forwardedBy := cast.ToStringSlice(metadataMap[MetadataForwardedBy])
+		hops := cast.ToInt(metadataMap[MetadataHopCount])
+		request := requestInfo(method, chainBound, data, metadataMap)
+		localReady := lb.reachedHeight(request.MinHeight)
 
-			jsonData, err := json.Marshal(request)
-			if err != nil {
-				return nil, http.StatusInternalServerError, errors.New("failed to marshal request data")
+		if hops >= lb.maxHops || containsNode(forwardedBy, lb.nodeID) {
+			if !localReady {
+				return nil, http.StatusServiceUnavailable, heightUnavailable(request.MinHeight)
 			}
+			return next(data, metadata)
+		}
 
-			response, err := lb.ProxyRequest(jsonData, targetNodeID)
-			if err != nil {
-				logger.Logger.Error("loadBalancerMiddleware: error proxying request", zap.Error(err))
-				return nil, http.StatusInternalServerError, errors.New("failed to delegate request")
+		shouldHandle, targetNodeID := lb.selectNode(strategy, request, forwardedBy)
+		if shouldHandle {
+			if !localReady {
+				return nil, http.StatusServiceUnavailable, heightUnavailable(request.MinHeight)
 			}
+			return next(data, metadata)
+		}
 
-			defer response.Body.Close()
+		result, statusCode, err := lb.forward(method, data, metadataMap, forwardedBy, hops, targetNodeID)
+		if err != nil {
+			opened := lb.breaker.Failure(targetNodeID)
 
-			body, err := ioutil.ReadAll(response.Body)
-			if err != nil {
-				logger.Logger.Error("failed to read proxied response", zap.Error(err))
-				return nil, http.StatusInternalServerError, errors.New("failed to read proxied response")
+			// the peer may have applied the request before failing, only a read is safe to run again here
+			if !idempotent(data) {
+				logger.Logger.Warn("loadBalancerMiddleware: forwarding failed",
+					zap.Any("target", targetNodeID),
+					zap.Bool("circuitOpen", opened),
+					zap.Error(err))
+				return nil, http.StatusBadGateway, fmt.Errorf("forwarding to %s failed: %w", targetNodeID, err)
 			}
 
-			var result interface{}
-			err = json.Unmarshal(body, &result)
-			if err != nil {
-				logger.Logger.Error("failed to proxied proxied response", zap.Error(err))
-				return nil, http.StatusInternalServerError, errors.New("failed to parse proxied response")
+			logger.Logger.Warn("loadBalancerMiddleware: forwarding failed, handling locally",
+				zap.Any("target", targetNodeID),
+				zap.Bool("circuitOpen", opened),
+				zap.Error(err))
+			if !localReady {
+				return nil, http.StatusServiceUnavailable, heightUnavailable(request.MinHeight)
 			}
-
-			return result, response.StatusCode, nil
+			return next(data, metadata)
 		}
 
-		return next(data, metadata)
+		lb.breaker.Success(targetNodeID)
+		return result, statusCode, nil
+	}
+}
+
+func (lb *LoadBalancer) forward(method string, data interface{}, metadata map[string]interface{}, forwardedBy []string, hops int, targetNodeID p2p.NodeID) (interface{}, int, error) {
+	ctx, span := tracing.Tracer().Start(tracing.FromMetadata(metadata), "forward "+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("p2p.target", string(targetNodeID)), attribute.Int("p2p.hops", hops+1)))
+	defer span.End()
+
+	forwardedMetadata := make(map[string]interface{}, len(metadata)+4)
+	for key, value := range metadata {
+		forwardedMetadata[key] = value
+	}
+	tracing.InjectMetadata(ctx, forwardedMetadata)
+
+	chain := append(append([]string{}, forwardedBy...), string(lb.nodeID))
+	forwardedMetadata[MetadataFromPeer] = true
+	forwardedMetadata[MetadataForwardedBy] = chain
+	forwardedMetadata[MetadataHopCount] = hops + 1
+	if _, exists := forwardedMetadata[MetadataOriginalNode]; !exists {
+		forwardedMetadata[MetadataOriginalNode] = lb.nodeID
+	}
+
+	request := types.SaiRequest{
+		Method:   method,
+		Data:     data,
+		Metadata: forwardedMetadata,
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal request data: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set(MetadataForwardedBy, strings.Join(chain, ","))
+	header.Set(MetadataHopCount, strconv.Itoa(hops+1))
+	if minHeight := cast.ToInt64(metadata[MetadataMinHeight]); minHeight > 0 {
+		header.Set(MetadataMinHeight, strconv.FormatInt(minHeight, 10))
 	}
+	if clientIP := cast.ToString(metadata["ip"]); clientIP != "" {
+		header.Set("X-Real-IP", clientIP)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lb.forwardTimeout)
+	defer cancel()
+
+	response, err := lb.ProxyRequest(ctx, jsonData, targetNodeID, header)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, err
+	}
+	span.SetAttributes(attribute.Int("http.status_code", response.StatusCode))
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read proxied response: %w", err)
+	}
+
+	if response.StatusCode >= http.StatusInternalServerError {
+		return nil, 0, fmt.Errorf("peer responded with status %d", response.StatusCode)
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse proxied response: %w", err)
+	}
+
+	return result, response.StatusCode, nil
 }
 
 func (lb *LoadBalancer) ShouldHandleRequest() (bool, p2p.NodeID) {
-	localScore := lb.metrics.CalculateScore(lb.nodeID)
-	var scores = map[string]float64{}
+	return lb.SelectNode(lb.strategy, p2p.RequestInfo{ChainBound: true})
+}
+
+// SelectNode reports whether the local node should handle the request and which node was selected
+func (lb *LoadBalancer) SelectNode(strategy p2p.Strategy, request p2p.RequestInfo) (bool, p2p.NodeID) {
+	return lb.selectNode(strategy, request, nil)
+}
+
+// selectNode falls back to the best scored candidate when the strategy keeps the request
+// on a local node that is draining or has not reached the requested height
+func (lb *LoadBalancer) selectNode(strategy p2p.Strategy, request p2p.RequestInfo, exclude []string) (bool, p2p.NodeID) {
+	candidates := lb.candidates(exclude, request)
+
+	targetNodeID := strategy.Select(lb.nodeID, candidates, request)
+	if targetNodeID == "" {
+		targetNodeID = lb.nodeID
+	}
+
+	if targetNodeID == lb.nodeID && len(candidates) > 0 && (lb.metrics.Draining() || !lb.reachedHeight(request.MinHeight)) {
+		targetNodeID = bestScored(candidates)
+	}
+
+	return targetNodeID == lb.nodeID, targetNodeID
+}
+
+// OpenCircuits returns the peers excluded from selection after repeated forwarding failures
+func (lb *LoadBalancer) OpenCircuits() map[p2p.NodeID]time.Time {
+	return lb.breaker.OpenCircuits()
+}
+
+// SetDraining stops routing requests to the local node while any peer is eligible, and announces it to peers
+func (lb *LoadBalancer) SetDraining(enabled bool) {
+	lb.metrics.SetDraining(enabled)
+}
+
+func (lb *LoadBalancer) Draining() bool {
+	return lb.metrics.Draining()
+}
+
+// DecisionTable evaluates every known node and the current choice of each registered handler
+func (lb *LoadBalancer) DecisionTable() p2p.DecisionTable {
+	table := p2p.DecisionTable{
+		NodeID:       lb.nodeID,
+		Draining:     lb.metrics.Draining(),
+		OpenCircuits: lb.OpenCircuits(),
+	}
+
+	for _, evaluated := range lb.evaluate(nil, p2p.RequestInfo{ChainBound: true}) {
+		table.Candidates = append(table.Candidates, p2p.CandidateState{
+			NodeID:   evaluated.candidate.NodeID,
+			Metrics:  evaluated.candidate.Metrics,
+			Score:    evaluated.candidate.Score.Total,
+			Eligible: evaluated.reason == "",
+			Reason:   evaluated.reason,
+		})
+	}
+
+	// the handlers are copied under the lock, a middleware created meanwhile writes the maps
+	type handler struct {
+		method     string
+		strategy   p2p.Strategy
+		chainBound bool
+	}
+
+	lb.strategyMutex.RLock()
+	handlers := make([]handler, 0, len(lb.strategies))
+	for method, strategy := range lb.strategies {
+		handlers = append(handlers, handler{method: method, strategy: strategy, chainBound: lb.chainMethods[method]})
+	}
+	lb.strategyMutex.RUnlock()
+
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i].method < handlers[j].method })
+	for _, h := range handlers {
+		local, target := lb.SelectNode(h.strategy, p2p.RequestInfo{Method: h.method, ChainBound: h.chainBound})
+		table.Decisions = append(table.Decisions, p2p.Decision{
+			Method:   h.method,
+			Strategy: h.strategy.Name(),
+			Target:   target,
+			Local:    local,
+		})
+	}
+
+	return table
+}
+
+type evaluatedNode struct {
+	candidate p2p.Candidate
+	reason    string
+}
+
+func (lb *LoadBalancer) candidates(exclude []string, request p2p.RequestInfo) []p2p.Candidate {
+	evaluated := lb.evaluate(exclude, request)
+	candidates := make([]p2p.Candidate, 0, len(evaluated))
+
+	for _, node := range evaluated {
+		if node.reason == "" {
+			candidates = append(candidates, node.candidate)
+		}
+	}
+
+	return candidates
+}
+
+// evaluate lists the local node and the known peers with the reason each one is not eligible for forwarding.
+// Peers are skipped when excluded, circuit-broken, draining, catching up, on another chain, lagging more than
+// maxBlockLag behind the highest known height or below the requested height, the chain checks only apply to
+// chain bound requests. The local node is skipped when it is draining or below the requested height.
+func (lb *LoadBalancer) evaluate(exclude []string, request p2p.RequestInfo) []evaluatedNode {
+	allMetrics := lb.metrics.GetAllNodesMetrics()
+	local := lb.metrics.LocalChainState()
+	evaluated := make([]evaluatedNode, 0, len(allMetrics)+1)
+
+	tip := local.LatestBlockHeight
+	for nodeID, nodeMetrics := range allMetrics {
+		if nodeID != lb.nodeID && sameChain(local, nodeMetrics.ChainState) && nodeMetrics.LatestBlockHeight > tip {
+			tip = nodeMetrics.LatestBlockHeight
+		}
+	}
+
+	for nodeID, nodeMetrics := range allMetrics {
+		if nodeID == lb.nodeID {
+			continue
+		}
+
+		evaluated = append(evaluated, evaluatedNode{
+			candidate: p2p.Candidate{
+				NodeID:  nodeID,
+				Metrics: nodeMetrics,
+				Score:   lb.metrics.CalculateScore(nodeID),
+			},
+			reason: lb.peerExclusion(nodeID, nodeMetrics, local, tip, request, exclude),
+		})
+	}
+
+	localMetrics := allMetrics[lb.nodeID]
+	localMetrics.ChainState = local
+	localMetrics.Draining = lb.metrics.Draining()
+
+	localReason := ""
+	if localMetrics.Draining {
+		localReason = "draining"
+	} else if !lb.reachedHeight(request.MinHeight) {
+		localReason = "below requested height"
+	}
 
-	for nodeID := range lb.metrics.GetAllNodes() {
-		scores[string(nodeID)] = lb.metrics.CalculateScore(nodeID).Total
+	evaluated = append(evaluated, evaluatedNode{
+		candidate: p2p.Candidate{
+			NodeID:  lb.nodeID,
+			Metrics: localMetrics,
+			Score:   lb.metrics.CalculateScore(lb.nodeID),
+		},
+		reason: localReason,
+	})
+
+	sort.Slice(evaluated, func(i, j int) bool {
+		return evaluated[i].candidate.NodeID < evaluated[j].candidate.NodeID
+	})
+
+	return evaluated
+}
+
+// peerExclusion returns why the peer may not receive forwarded requests, or an empty string when it may
+func (lb *LoadBalancer) peerExclusion(nodeID p2p.NodeID, peer p2p.NodeMetrics, local p2p.ChainState, tip int64, request p2p.RequestInfo, exclude []string) string {
+	switch {
+	case containsNode(exclude, nodeID):
+		return "already forwarded through"
+	case !lb.breaker.Available(nodeID):
+		return "circuit open"
+	case peer.Draining:
+		return "draining"
+	case !request.ChainBound:
+		return ""
+	case !sameChain(local, peer.ChainState):
+		return "other chain"
+	case peer.CatchingUp:
+		return "catching up"
+	case lb.maxBlockLag > 0 && tip-peer.LatestBlockHeight > lb.maxBlockLag:
+		return fmt.Sprintf("lagging %d blocks", tip-peer.LatestBlockHeight)
+	case peer.LatestBlockHeight < request.MinHeight:
+		return "below requested height"
+	default:
+		return ""
+	}
+}
+
+func (lb *LoadBalancer) reachedHeight(minHeight int64) bool {
+	return minHeight <= 0 || lb.metrics.LocalChainState().LatestBlockHeight >= minHeight
+}
+
+// sameChain reports whether the peer runs the local chain. It holds while the local chain is still unknown.
+func sameChain(local, peer p2p.ChainState) bool {
+	return local.ChainID == "" || local.ChainID == peer.ChainID
+}
+
+func bestScored(candidates []p2p.Candidate) p2p.NodeID {
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if candidate.Score.Total < best.Score.Total {
+			best = candidate
+		}
+	}
+	return best.NodeID
+}
+
+func heightUnavailable(minHeight int64) error {
+	return fmt.Errorf("no node has reached block height %d", minHeight)
+}
+
+// requestInfo reads the request for the strategies, X-Min-Height is only read for chain bound requests
+func requestInfo(method string, chainBound bool, data interface{}, metadata map[string]interface{}) p2p.RequestInfo {
+	request := p2p.RequestInfo{
+		Method:     method,
+		ClientIP:   cast.ToString(metadata["ip"]),
+		ChainBound: chainBound,
+	}
+	if chainBound {
+		request.MinHeight = cast.ToInt64(metadata[MetadataMinHeight])
 	}
 
-	bestNodeID, bestScore, err := utils.MapFloatMinValue(scores)
-	if err != nil || localScore.Total+lb.threshold <= bestScore {
-		bestNodeID = string(lb.nodeID)
+	if dataMap, ok := data.(map[string]interface{}); ok {
+		request.Route = cast.ToString(dataMap["path"])
 	}
 
-	return p2p.NodeID(bestNodeID) == lb.nodeID, p2p.NodeID(bestNodeID)
+	return request
 }
 
-func (lb *LoadBalancer) ProxyRequest(jsonData []byte, targetNodeID p2p.NodeID) (*http.Response, error) {
+// idempotent reports whether the request carries a method that can be sent again without side effects
+func idempotent(data interface{}) bool {
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	switch strings.ToUpper(cast.ToString(dataMap["method"])) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+func (lb *LoadBalancer) ProxyRequest(ctx context.Context, jsonData []byte, targetNodeID p2p.NodeID, header http.Header) (*http.Response, error) {
 	nodeInfo, exists := lb.metrics.GetNodeInfo(targetNodeID)
 	if !exists {
 		err := fmt.Errorf("node %s not found", targetNodeID)
-		logger.Logger.Error("ProxyRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("ProxyRequest", zap.Error(err))
 		return nil, err
 	}
 
 	address, _, err := net.SplitHostPort(nodeInfo.Address)
 	if err != nil {
-		logger.Logger.Error("ProxyRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("ProxyRequest", zap.Error(err))
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s:%d", address, nodeInfo.HttpPort), bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("http://%s:%d", address, nodeInfo.HttpPort), bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
 
-	client := http.Client{}
-	response, err := client.Do(req)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.InjectHeader(ctx, req.Header)
+
+	response, err := lb.client.Do(req)
 	if err != nil {
-		logger.Logger.Error("ProxyRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("ProxyRequest", zap.Error(err))
 		return nil, err
 	}
 
 	return response, nil
 }
+
+func containsNode(nodes []string, nodeID p2p.NodeID) bool {
+	for _, node := range nodes {
+		if p2p.NodeID(node) == nodeID {
+			return true
+		}
+	}
+	return false
+}
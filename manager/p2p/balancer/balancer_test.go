@@ -0,0 +1,276 @@
+package balancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/types"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+func peerServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, int) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+	return server, port
+}
+
+func localHandler(called *int) func(data, metadata interface{}) (interface{}, int, error) {
+	return func(data, metadata interface{}) (interface{}, int, error) {
+		*called++
+		return "local", http.StatusOK, nil
+	}
+}
+
+func TestMiddlewareFallsBackLocallyAndOpensCircuit(t *testing.T) {
+	_, port := peerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	remote := node("remote", 5, 5)
+	remote.Address, remote.HttpPort = "127.0.0.1:9000", port
+	sim := newSimulation("local", node("local", 95, 95), remote)
+	middleware := sim.balancer.CreateLoadBalancerMiddleware("metrics", nil)
+
+	called := 0
+	for i := 0; i < 3; i++ {
+		result, code, err := middleware(localHandler(&called), map[string]interface{}{"method": "GET"}, map[string]interface{}{})
+		if err != nil || code != http.StatusOK || result != "local" {
+			t.Fatalf("expected a local fallback, got %v %d %v", result, code, err)
+		}
+	}
+
+	if called != 3 {
+		t.Fatalf("expected 3 local calls, got %d", called)
+	}
+
+	if _, open := sim.balancer.OpenCircuits()["remote"]; !open {
+		t.Fatal("expected the failing peer to be circuit-broken")
+	}
+
+	if shouldHandle, _ := sim.balancer.ShouldHandleRequest(); !shouldHandle {
+		t.Fatal("expected the circuit-broken peer to be excluded from selection")
+	}
+}
+
+func TestMiddlewareDoesNotResendNonIdempotentRequests(t *testing.T) {
+	received := 0
+	_, port := peerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		received++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	remote := node("remote", 5, 5)
+	remote.Address, remote.HttpPort = "127.0.0.1:9000", port
+	sim := newSimulation("local", node("local", 95, 95), remote)
+	middleware := sim.balancer.CreateLoadBalancerMiddleware("cosmos", nil)
+
+	called := 0
+	data := map[string]interface{}{"method": "POST", "path": "/api/kira/txs"}
+	result, code, err := middleware(localHandler(&called), data, map[string]interface{}{})
+	if err == nil || code != http.StatusBadGateway || result != nil {
+		t.Fatalf("expected the failed broadcast to be reported, got %v %d %v", result, code, err)
+	}
+	if received != 1 || called != 0 {
+		t.Fatalf("expected the broadcast to be sent once, got %d forwarded and %d local", received, called)
+	}
+	if _, open := sim.balancer.OpenCircuits()["remote"]; open {
+		t.Fatal("expected a single failure to leave the circuit closed")
+	}
+}
+
+func TestMiddlewareMarksForwardedRequests(t *testing.T) {
+	var forwarded types.SaiRequest
+	var hopHeader string
+
+	_, port := peerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		hopHeader = r.Header.Get(MetadataHopCount)
+		_ = json.NewDecoder(r.Body).Decode(&forwarded)
+		_, _ = w.Write([]byte(`{"served_by":"remote"}`))
+	})
+
+	remote := node("remote", 5, 5)
+	remote.Address, remote.HttpPort = "127.0.0.1:9000", port
+	sim := newSimulation("local", node("local", 95, 95), remote)
+	middleware := sim.balancer.CreateLoadBalancerMiddleware("metrics", nil)
+
+	called := 0
+	result, code, err := middleware(localHandler(&called), map[string]interface{}{}, map[string]interface{}{"ip": "10.0.0.1"})
+	if err != nil || code != http.StatusOK || called != 0 {
+		t.Fatalf("expected the request to be forwarded, got %v %d %v (local calls %d)", result, code, err, called)
+	}
+
+	metadata := forwarded.Metadata.(map[string]interface{})
+	if hopHeader != "1" || metadata[MetadataHopCount] != float64(1) {
+		t.Fatalf("expected hop count 1, got header %q metadata %v", hopHeader, metadata[MetadataHopCount])
+	}
+	if chain := metadata[MetadataForwardedBy].([]interface{}); len(chain) != 1 || chain[0] != "local" {
+		t.Fatalf("unexpected forwarded-by chain %v", chain)
+	}
+}
+
+func TestMiddlewareHandlesLocallyAtHopLimit(t *testing.T) {
+	remote := node("remote", 5, 5)
+	remote.Address, remote.HttpPort = "127.0.0.1:9000", 1
+	sim := newSimulation("local", node("local", 95, 95), remote)
+	middleware := sim.balancer.CreateLoadBalancerMiddleware("metrics", nil)
+
+	called := 0
+	metadata := map[string]interface{}{
+		MetadataForwardedBy: []interface{}{"remote"},
+		MetadataHopCount:    float64(1),
+	}
+
+	if _, _, err := middleware(localHandler(&called), map[string]interface{}{}, metadata); err != nil || called != 1 {
+		t.Fatalf("expected a forwarded request to be handled locally, got %v (local calls %d)", err, called)
+	}
+
+	if _, open := sim.balancer.OpenCircuits()[p2p.NodeID("remote")]; open {
+		t.Fatal("no forwarding should have been attempted")
+	}
+}
+
+func synced(n p2p.NodeMetrics, chainID string, height int64, catchingUp bool) p2p.NodeMetrics {
+	n.ChainState = p2p.ChainState{ChainID: chainID, LatestBlockHeight: height, CatchingUp: catchingUp}
+	return n
+}
+
+func TestSelectNodeSkipsPeersOutOfSync(t *testing.T) {
+	peers := []p2p.NodeMetrics{
+		synced(node("lagging", 5, 5), "kira", 80, false),
+		synced(node("catching_up", 5, 5), "kira", 100, true),
+		synced(node("other_chain", 5, 5), "other", 100, false),
+	}
+
+	for _, peer := range peers {
+		sim := newSimulation("local", synced(node("local", 95, 95), "kira", 100, false), peer)
+		sim.collector.SetChainState(p2p.ChainState{ChainID: "kira", LatestBlockHeight: 100})
+
+		if shouldHandle, target := sim.balancer.ShouldHandleRequest(); !shouldHandle {
+			t.Fatalf("expected %s to be excluded, got %s", peer.NodeID, target)
+		}
+	}
+
+	sim := newSimulation("local", synced(node("local", 95, 95), "kira", 100, false), synced(node("remote", 5, 5), "kira", 95, false))
+	sim.collector.SetChainState(p2p.ChainState{ChainID: "kira", LatestBlockHeight: 100})
+	if _, target := sim.balancer.ShouldHandleRequest(); target != "remote" {
+		t.Fatalf("expected a peer within the block lag to be selected, got %s", target)
+	}
+}
+
+func TestMiddlewareHonoursMinHeight(t *testing.T) {
+	_, port := peerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"served_by":"remote"}`))
+	})
+
+	remote := synced(node("remote", 90, 90), "kira", 105, false)
+	remote.Address, remote.HttpPort = "127.0.0.1:9000", port
+	sim := newSimulation("local", synced(node("local", 5, 5), "kira", 100, false), remote)
+	sim.collector.SetChainState(p2p.ChainState{ChainID: "kira", LatestBlockHeight: 100})
+	middleware := sim.balancer.CreateChainLoadBalancerMiddleware("rosetta", nil)
+
+	called := 0
+	_, code, err := middleware(localHandler(&called), map[string]interface{}{}, map[string]interface{}{MetadataMinHeight: "103"})
+	if err != nil || code != http.StatusOK || called != 0 {
+		t.Fatalf("expected the request to be forwarded to the node at the requested height, got %d %v (local calls %d)", code, err, called)
+	}
+
+	_, code, err = middleware(localHandler(&called), map[string]interface{}{}, map[string]interface{}{MetadataMinHeight: "110"})
+	if err == nil || code != http.StatusServiceUnavailable || called != 0 {
+		t.Fatalf("expected an unavailable height to be rejected, got %d %v (local calls %d)", code, err, called)
+	}
+
+	other := sim.balancer.CreateLoadBalancerMiddleware("ethereum", nil)
+	_, code, err = other(localHandler(&called), map[string]interface{}{}, map[string]interface{}{MetadataMinHeight: "110"})
+	if err != nil || code != http.StatusOK || called != 1 {
+		t.Fatalf("expected the height of another chain to be ignored, got %d %v (local calls %d)", code, err, called)
+	}
+}
+
+func TestMiddlewareIgnoresChainStateOfOtherHandlers(t *testing.T) {
+	_, port := peerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"served_by":"remote"}`))
+	})
+
+	remote := synced(node("remote", 5, 5), "kira", 50, true)
+	remote.Address, remote.HttpPort = "127.0.0.1:9000", port
+	sim := newSimulation("local", synced(node("local", 95, 95), "kira", 100, false), remote)
+	sim.collector.SetChainState(p2p.ChainState{ChainID: "kira", LatestBlockHeight: 100})
+
+	called := 0
+	chain := sim.balancer.CreateChainLoadBalancerMiddleware("rosetta", nil)
+	if _, _, err := chain(localHandler(&called), map[string]interface{}{}, map[string]interface{}{}); err != nil || called != 1 {
+		t.Fatalf("expected a peer catching up to be skipped for the chain handler, got %v (local calls %d)", err, called)
+	}
+
+	other := sim.balancer.CreateLoadBalancerMiddleware("bitcoin", nil)
+	if _, code, err := other(localHandler(&called), map[string]interface{}{}, map[string]interface{}{}); err != nil || code != http.StatusOK || called != 1 {
+		t.Fatalf("expected the request to be forwarded to the less loaded peer, got %d %v (local calls %d)", code, err, called)
+	}
+}
+
+func TestDrainingMovesTrafficAndIsReported(t *testing.T) {
+	draining := node("draining", 5, 5)
+	draining.Draining = true
+	sim := newSimulation("local", node("local", 10, 10), node("remote", 60, 60), draining)
+	sim.balancer.CreateLoadBalancerMiddleware("metrics", nil)
+
+	if shouldHandle, _ := sim.balancer.ShouldHandleRequest(); !shouldHandle {
+		t.Fatal("expected the request to stay local before draining")
+	}
+
+	sim.balancer.SetDraining(true)
+	if _, target := sim.balancer.ShouldHandleRequest(); target != "remote" {
+		t.Fatalf("expected a draining node to hand requests to the only eligible peer, got %s", target)
+	}
+
+	table := sim.balancer.DecisionTable()
+	reasons := make(map[p2p.NodeID]string)
+	for _, candidate := range table.Candidates {
+		reasons[candidate.NodeID] = candidate.Reason
+	}
+
+	if !table.Draining || reasons["local"] != "draining" || reasons["draining"] != "draining" || reasons["remote"] != "" {
+		t.Fatalf("unexpected decision table %+v", table)
+	}
+	if len(table.Decisions) != 1 || table.Decisions[0].Target != "remote" {
+		t.Fatalf("unexpected decisions %+v", table.Decisions)
+	}
+}
+
+// run with -race: the admin handler reads the decisions while the handlers are still being registered
+func TestDecisionTableWhileHandlersAreAdded(t *testing.T) {
+	sim := newSimulation("local", node("local", 10, 10), node("remote", 60, 60))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			sim.balancer.CreateChainLoadBalancerMiddleware(fmt.Sprintf("handler-%d", i), nil)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		sim.balancer.DecisionTable()
+	}
+	<-done
+
+	table := sim.balancer.DecisionTable()
+	if len(table.Decisions) != 100 || table.Decisions[0].Method != "handler-0" || table.Decisions[1].Method != "handler-1" {
+		t.Fatalf("expected the decisions of every handler sorted by method, got %d", len(table.Decisions))
+	}
+}
@@ -0,0 +1,86 @@
+package balancer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+)
+
+// CircuitBreaker excludes peers that fail repeatedly from selection until their cooldown expires.
+// After the cooldown a single further failure opens the circuit again.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	states    map[p2p.NodeID]*breakerState
+	mutex     sync.RWMutex
+}
+
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		states:    make(map[p2p.NodeID]*breakerState),
+	}
+}
+
+// Available reports whether requests may be forwarded to the node
+func (cb *CircuitBreaker) Available(nodeID p2p.NodeID) bool {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	state, exists := cb.states[nodeID]
+	return !exists || !time.Now().Before(state.openUntil)
+}
+
+func (cb *CircuitBreaker) Success(nodeID p2p.NodeID) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	delete(cb.states, nodeID)
+}
+
+// Failure records a failed forward and reports whether the circuit is now open
+func (cb *CircuitBreaker) Failure(nodeID p2p.NodeID) bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	state, exists := cb.states[nodeID]
+	if !exists {
+		state = &breakerState{}
+		cb.states[nodeID] = state
+	}
+
+	state.failures++
+	if state.failures >= cb.threshold {
+		state.openUntil = time.Now().Add(cb.cooldown)
+		return true
+	}
+
+	return false
+}
+
+// OpenCircuits returns the nodes currently excluded and when they become available again
+func (cb *CircuitBreaker) OpenCircuits() map[p2p.NodeID]time.Time {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	now := time.Now()
+	open := make(map[p2p.NodeID]time.Time)
+	for nodeID, state := range cb.states {
+		if now.Before(state.openUntil) {
+			open[nodeID] = state.openUntil
+		}
+	}
+
+	return open
+}
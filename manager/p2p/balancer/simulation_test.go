@@ -0,0 +1,178 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/config"
+	"github.com/saiset-co/sai-interx-manager/p2p/metrics"
+)
+
+// simulation drives a real CollectorImpl with synthetic node metrics and records where a strategy routes requests
+type simulation struct {
+	local     p2p.NodeID
+	collector *metrics.CollectorImpl
+	balancer  *LoadBalancer
+	nodes     map[p2p.NodeID]*p2p.NodeMetrics
+	latencies map[p2p.NodeID]float64
+}
+
+func newSimulation(local p2p.NodeID, nodes ...p2p.NodeMetrics) *simulation {
+	weights := p2p.Weights{CPU: 0.3, Memory: 0.3, RPS: 0.2, Latency: 0.2}
+	collector := metrics.NewCollector(local, "127.0.0.1:9000", 8080, weights, time.Minute)
+
+	sim := &simulation{
+		local:     local,
+		collector: collector,
+		balancer:  NewLoadBalancer(local, collector, config.DefaultNetworkConfig().LoadBalancerConfig),
+		nodes:     make(map[p2p.NodeID]*p2p.NodeMetrics),
+		latencies: make(map[p2p.NodeID]float64),
+	}
+
+	for i := range nodes {
+		node := nodes[i]
+		sim.nodes[node.NodeID] = &node
+	}
+	sim.publish()
+
+	return sim
+}
+
+func (s *simulation) publish() {
+	for nodeID, node := range s.nodes {
+		node.Timestamp = time.Now()
+		s.collector.UpdateNodeMetrics(*node, s.latencies[nodeID])
+	}
+}
+
+// run sends the given number of requests through the strategy. After every decision the
+// optional load function mutates the chosen node's metrics, which are then republished.
+func (s *simulation) run(strategy p2p.Strategy, requests int, request func(i int) p2p.RequestInfo, load func(node *p2p.NodeMetrics)) map[p2p.NodeID]int {
+	routed := make(map[p2p.NodeID]int)
+
+	for i := 0; i < requests; i++ {
+		var info p2p.RequestInfo
+		if request != nil {
+			info = request(i)
+		}
+
+		_, nodeID := s.balancer.SelectNode(strategy, info)
+		routed[nodeID]++
+
+		if load != nil {
+			load(s.nodes[nodeID])
+			s.publish()
+		}
+	}
+
+	return routed
+}
+
+func node(id string, cpu, memory float64) p2p.NodeMetrics {
+	return p2p.NodeMetrics{NodeID: p2p.NodeID(id), CPUUsage: cpu, MemoryUsage: memory}
+}
+
+func TestScoreStrategyKeepsRequestsLocalWithinThreshold(t *testing.T) {
+	sim := newSimulation("local", node("local", 40, 40), node("remote", 30, 30))
+
+	routed := sim.run(NewScoreStrategy(0.2), 100, nil, nil)
+	if routed["local"] != 100 {
+		t.Fatalf("expected all requests to stay local, got %v", routed)
+	}
+}
+
+func TestScoreStrategyForwardsToMuchLessLoadedNode(t *testing.T) {
+	sim := newSimulation("local", node("local", 95, 95), node("remote", 5, 5))
+
+	routed := sim.run(NewScoreStrategy(0.2), 100, nil, nil)
+	if routed["remote"] != 100 {
+		t.Fatalf("expected all requests to be forwarded, got %v", routed)
+	}
+}
+
+func TestLeastActiveStrategySpreadsLoad(t *testing.T) {
+	sim := newSimulation("a", node("a", 10, 10), node("b", 10, 10), node("c", 10, 10))
+
+	routed := sim.run(NewLeastActiveStrategy(), 300, nil, func(n *p2p.NodeMetrics) {
+		n.ActiveRequests++
+	})
+
+	for _, id := range []p2p.NodeID{"a", "b", "c"} {
+		if routed[id] != 100 {
+			t.Fatalf("expected an even spread, got %v", routed)
+		}
+	}
+}
+
+func TestPowerOfTwoStrategyAvoidsSlowNode(t *testing.T) {
+	fast1, fast2, slow := node("fast1", 10, 10), node("fast2", 10, 10), node("slow", 10, 10)
+	fast1.AverageLatency, fast2.AverageLatency, slow.AverageLatency = 0.01, 0.01, 2
+	sim := newSimulation("fast1", fast1, fast2, slow)
+
+	routed := sim.run(NewPowerOfTwoStrategy(), 1000, nil, nil)
+	if routed["slow"] != 0 {
+		t.Fatalf("expected the slow node to never win a comparison, got %v", routed)
+	}
+	if routed["fast1"] == 0 || routed["fast2"] == 0 {
+		t.Fatalf("expected both fast nodes to receive traffic, got %v", routed)
+	}
+}
+
+func TestClientHashStrategyIsStickyAndStable(t *testing.T) {
+	clients := func(i int) p2p.RequestInfo {
+		return p2p.RequestInfo{ClientIP: fmt.Sprintf("10.0.%d.%d", i/250, i%250)}
+	}
+	strategy := NewClientHashStrategy()
+
+	full := newSimulation("a", node("a", 10, 10), node("b", 10, 10), node("c", 10, 10), node("d", 10, 10))
+	reduced := newSimulation("a", node("a", 10, 10), node("b", 10, 10), node("c", 10, 10))
+
+	moved := 0
+	for i := 0; i < 500; i++ {
+		_, first := full.balancer.SelectNode(strategy, clients(i))
+		_, again := full.balancer.SelectNode(strategy, clients(i))
+		if first != again {
+			t.Fatalf("client %d was routed to %s and then %s", i, first, again)
+		}
+
+		_, after := reduced.balancer.SelectNode(strategy, clients(i))
+		if first != "d" && first != after {
+			moved++
+		}
+	}
+
+	if moved != 0 {
+		t.Fatalf("expected only clients of the removed node to move, %d others moved", moved)
+	}
+
+	routed := full.run(strategy, 500, clients, nil)
+	if len(routed) != 4 {
+		t.Fatalf("expected every node to own part of the ring, got %v", routed)
+	}
+}
+
+func TestRouteHashStrategyGroupsByRoute(t *testing.T) {
+	sim := newSimulation("a", node("a", 10, 10), node("b", 10, 10), node("c", 10, 10))
+
+	routed := sim.run(NewRouteHashStrategy(), 50, func(i int) p2p.RequestInfo {
+		return p2p.RequestInfo{Method: "rosetta", Route: "/network/status", ClientIP: fmt.Sprintf("10.0.0.%d", i)}
+	}, nil)
+
+	if len(routed) != 1 {
+		t.Fatalf("expected a single route to map to one node, got %v", routed)
+	}
+}
+
+func TestNewStrategy(t *testing.T) {
+	for _, name := range []string{"", StrategyScore, StrategyLeastActive, StrategyPowerOfTwo, StrategyHashByClient, StrategyHashByRoute} {
+		if _, err := NewStrategy(name, 0.2); err != nil {
+			t.Fatalf("strategy %q: %v", name, err)
+		}
+	}
+
+	if _, err := NewStrategy("round_robin", 0.2); err == nil {
+		t.Fatal("expected an error for an unknown strategy")
+	}
+}
@@ -0,0 +1,219 @@
+package balancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+)
+
+const (
+	StrategyScore          = "score"
+	StrategyLeastActive    = "least_active"
+	StrategyPowerOfTwo     = "power_of_two"
+	StrategyHashByClient   = "hash_client"
+	StrategyHashByRoute    = "hash_route"
+	defaultVirtualReplicas = 64
+)
+
+// NewStrategy creates a strategy by its configuration name
+func NewStrategy(name string, threshold float64) (p2p.Strategy, error) {
+	switch name {
+	case "", StrategyScore:
+		return NewScoreStrategy(threshold), nil
+	case StrategyLeastActive:
+		return NewLeastActiveStrategy(), nil
+	case StrategyPowerOfTwo:
+		return NewPowerOfTwoStrategy(), nil
+	case StrategyHashByClient:
+		return NewClientHashStrategy(), nil
+	case StrategyHashByRoute:
+		return NewRouteHashStrategy(), nil
+	default:
+		return nil, fmt.Errorf("unknown balancing strategy: %s", name)
+	}
+}
+
+// ScoreStrategy keeps requests local unless another node's weighted score is better by more than the threshold
+type ScoreStrategy struct {
+	threshold float64
+}
+
+func NewScoreStrategy(threshold float64) *ScoreStrategy {
+	return &ScoreStrategy{threshold: threshold}
+}
+
+func (s *ScoreStrategy) Name() string {
+	return StrategyScore
+}
+
+func (s *ScoreStrategy) Select(local p2p.NodeID, candidates []p2p.Candidate, _ p2p.RequestInfo) p2p.NodeID {
+	localScore := p2p.Score{Total: 1.0}
+	best := local
+	bestScore := 0.0
+	found := false
+
+	for _, candidate := range candidates {
+		if candidate.NodeID == local {
+			localScore = candidate.Score
+		}
+		if !found || candidate.Score.Total < bestScore {
+			best, bestScore, found = candidate.NodeID, candidate.Score.Total, true
+		}
+	}
+
+	if !found || localScore.Total <= bestScore+s.threshold {
+		return local
+	}
+
+	return best
+}
+
+// LeastActiveStrategy sends the request to the node with the fewest requests in flight, preferring the local node on ties
+type LeastActiveStrategy struct{}
+
+func NewLeastActiveStrategy() *LeastActiveStrategy {
+	return &LeastActiveStrategy{}
+}
+
+func (s *LeastActiveStrategy) Name() string {
+	return StrategyLeastActive
+}
+
+func (s *LeastActiveStrategy) Select(local p2p.NodeID, candidates []p2p.Candidate, _ p2p.RequestInfo) p2p.NodeID {
+	best := local
+	bestActive := -1
+
+	for _, candidate := range candidates {
+		if candidate.NodeID == local {
+			if bestActive < 0 || candidate.Metrics.ActiveRequests <= bestActive {
+				best, bestActive = local, candidate.Metrics.ActiveRequests
+			}
+			continue
+		}
+		if bestActive < 0 || candidate.Metrics.ActiveRequests < bestActive {
+			best, bestActive = candidate.NodeID, candidate.Metrics.ActiveRequests
+		}
+	}
+
+	return best
+}
+
+// PowerOfTwoStrategy samples two random candidates and keeps the one with the lower
+// latency weighted by its in-flight requests
+type PowerOfTwoStrategy struct {
+	rnd   *rand.Rand
+	mutex sync.Mutex
+}
+
+func NewPowerOfTwoStrategy() *PowerOfTwoStrategy {
+	return &PowerOfTwoStrategy{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (s *PowerOfTwoStrategy) Name() string {
+	return StrategyPowerOfTwo
+}
+
+func (s *PowerOfTwoStrategy) Select(local p2p.NodeID, candidates []p2p.Candidate, _ p2p.RequestInfo) p2p.NodeID {
+	switch len(candidates) {
+	case 0:
+		return local
+	case 1:
+		return candidates[0].NodeID
+	}
+
+	s.mutex.Lock()
+	first := s.rnd.Intn(len(candidates))
+	second := s.rnd.Intn(len(candidates) - 1)
+	s.mutex.Unlock()
+
+	if second >= first {
+		second++
+	}
+
+	a, b := candidates[first], candidates[second]
+	if latencyCost(b) < latencyCost(a) {
+		return b.NodeID
+	}
+	return a.NodeID
+}
+
+func latencyCost(candidate p2p.Candidate) float64 {
+	latency := candidate.Metrics.AverageLatency + candidate.Score.LatencyScore
+	return latency * float64(candidate.Metrics.ActiveRequests+1)
+}
+
+// HashStrategy maps a request key onto a consistent hash ring of the candidates,
+// so the same client or route sticks to the same node while membership is stable
+type HashStrategy struct {
+	name     string
+	key      func(request p2p.RequestInfo) string
+	replicas int
+}
+
+func NewClientHashStrategy() *HashStrategy {
+	return &HashStrategy{
+		name:     StrategyHashByClient,
+		key:      func(request p2p.RequestInfo) string { return request.ClientIP },
+		replicas: defaultVirtualReplicas,
+	}
+}
+
+func NewRouteHashStrategy() *HashStrategy {
+	return &HashStrategy{
+		name:     StrategyHashByRoute,
+		key:      func(request p2p.RequestInfo) string { return request.Method + " " + request.Route },
+		replicas: defaultVirtualReplicas,
+	}
+}
+
+func (s *HashStrategy) Name() string {
+	return s.name
+}
+
+func (s *HashStrategy) Select(local p2p.NodeID, candidates []p2p.Candidate, request p2p.RequestInfo) p2p.NodeID {
+	key := s.key(request)
+	if key == "" || len(candidates) == 0 {
+		return local
+	}
+
+	type point struct {
+		hash   uint32
+		nodeID p2p.NodeID
+	}
+
+	ring := make([]point, 0, len(candidates)*s.replicas)
+	for _, candidate := range candidates {
+		for i := 0; i < s.replicas; i++ {
+			ring = append(ring, point{
+				hash:   hashKey(string(candidate.NodeID) + "#" + strconv.Itoa(i)),
+				nodeID: candidate.NodeID,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	target := hashKey(key)
+	idx := sort.Search(len(ring), func(i int) bool {
+		return ring[i].hash >= target
+	})
+	if idx == len(ring) {
+		idx = 0
+	}
+
+	return ring[idx].nodeID
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
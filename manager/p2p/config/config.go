@@ -1,9 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/proto"
 )
 
 type NetworkConfig struct {
@@ -13,6 +16,10 @@ type NetworkConfig struct {
 	HTTPPort           int
 	MetricsConfig      MetricsConfig
 	LoadBalancerConfig LoadBalancerConfig
+	SecurityConfig     SecurityConfig
+	WireConfig         WireConfig
+	DiscoveryConfig    DiscoveryConfig
+	StateConfig        StateConfig
 	InitialPeers       []string
 }
 
@@ -22,7 +29,39 @@ type MetricsConfig struct {
 }
 
 type LoadBalancerConfig struct {
-	Threshold float64
+	Threshold        float64
+	MaxHops          int
+	ForwardTimeout   time.Duration
+	FailureThreshold int
+	Cooldown         time.Duration
+	MaxBlockLag      int64
+}
+
+type WireConfig struct {
+	MTU        int
+	LegacyJSON bool
+}
+
+// DiscoveryConfig bounds the active view of connected peers and the passive view kept in the peer book
+type DiscoveryConfig struct {
+	PeerBookFile    string
+	ActiveViewSize  int
+	PassiveViewSize int
+	ShuffleInterval time.Duration
+	ShuffleLength   int
+}
+
+// StateConfig controls how the replicated shared state is gossiped to the active peers
+type StateConfig struct {
+	GossipInterval time.Duration
+}
+
+type SecurityConfig struct {
+	KeyFile         string
+	AllowedPeers    []p2p.NodeID
+	TrustOnFirstUse bool
+	KnownPeersFile  string
+	MaxClockSkew    time.Duration
 }
 
 func DefaultNetworkConfig() NetworkConfig {
@@ -40,7 +79,67 @@ func DefaultNetworkConfig() NetworkConfig {
 			WindowSize: 60 * time.Second,
 		},
 		LoadBalancerConfig: LoadBalancerConfig{
-			Threshold: 0.2,
+			Threshold:        0.2,
+			MaxHops:          1,
+			ForwardTimeout:   10 * time.Second,
+			FailureThreshold: 3,
+			Cooldown:         30 * time.Second,
+			MaxBlockLag:      10,
+		},
+		SecurityConfig: SecurityConfig{
+			KeyFile:        "node.key",
+			KnownPeersFile: "known_peers.json",
+			MaxClockSkew:   30 * time.Second,
+		},
+		WireConfig: WireConfig{
+			MTU: 1200,
+		},
+		DiscoveryConfig: DiscoveryConfig{
+			PeerBookFile:    "peers.json",
+			ActiveViewSize:  8,
+			PassiveViewSize: 64,
+			ShuffleInterval: 30 * time.Second,
+			ShuffleLength:   8,
+		},
+		StateConfig: StateConfig{
+			GossipInterval: time.Second,
 		},
 	}
 }
+
+// Validate rejects the values the network cannot run with, such as a zero interval that would stop its tickers
+func (c NetworkConfig) Validate() error {
+	var errs []error
+
+	// messages are accepted while their timestamp is within the skew, with none every message is stale
+	if c.SecurityConfig.MaxClockSkew <= 0 {
+		errs = append(errs, fmt.Errorf("max clock skew must be positive, got %s", c.SecurityConfig.MaxClockSkew))
+	}
+	if c.WireConfig.MTU < proto.MinMTU || c.WireConfig.MTU > proto.MaxMTU {
+		errs = append(errs, fmt.Errorf("mtu must be between %d and %d, got %d", proto.MinMTU, proto.MaxMTU, c.WireConfig.MTU))
+	}
+	// with no hop a request is never forwarded and the balancer does nothing
+	if c.LoadBalancerConfig.MaxHops < 1 {
+		errs = append(errs, fmt.Errorf("max hops must be at least 1, got %d", c.LoadBalancerConfig.MaxHops))
+	}
+	if c.LoadBalancerConfig.ForwardTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("forward timeout must be positive, got %s", c.LoadBalancerConfig.ForwardTimeout))
+	}
+	if c.LoadBalancerConfig.FailureThreshold < 1 {
+		errs = append(errs, fmt.Errorf("circuit breaker failure threshold must be at least 1, got %d", c.LoadBalancerConfig.FailureThreshold))
+	}
+	if c.LoadBalancerConfig.Cooldown <= 0 {
+		errs = append(errs, fmt.Errorf("circuit breaker cooldown must be positive, got %s", c.LoadBalancerConfig.Cooldown))
+	}
+	if c.DiscoveryConfig.ShuffleInterval <= 0 {
+		errs = append(errs, fmt.Errorf("shuffle interval must be positive, got %s", c.DiscoveryConfig.ShuffleInterval))
+	}
+	if c.StateConfig.GossipInterval <= 0 {
+		errs = append(errs, fmt.Errorf("state gossip interval must be positive, got %s", c.StateConfig.GossipInterval))
+	}
+	if c.MetricsConfig.WindowSize <= 0 {
+		errs = append(errs, fmt.Errorf("metrics window size must be positive, got %s", c.MetricsConfig.WindowSize))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		option Option
+		valid  bool
+	}{
+		{name: "defaults", option: func(c *NetworkConfig) {}, valid: true},
+		{name: "zero clock skew", option: WithMaxClockSkew(0)},
+		{name: "negative clock skew", option: WithMaxClockSkew(-time.Second)},
+		{name: "zero mtu", option: WithMTU(0)},
+		{name: "mtu below the minimum", option: WithMTU(100)},
+		{name: "mtu above a datagram", option: WithMTU(65508)},
+		{name: "largest mtu", option: WithMTU(65507), valid: true},
+		{name: "no forwarding", option: WithMaxHops(0)},
+		{name: "negative max hops", option: WithMaxHops(-1)},
+		{name: "zero forward timeout", option: WithForwardTimeout(0)},
+		{name: "zero failure threshold", option: WithCircuitBreaker(0, time.Second)},
+		{name: "negative cooldown", option: WithCircuitBreaker(3, -time.Second)},
+		{name: "zero shuffle interval", option: WithShuffle(0, 8)},
+		{name: "negative shuffle interval", option: WithShuffle(-time.Second, 8)},
+		{name: "zero gossip interval", option: WithStateGossipInterval(0)},
+		{name: "zero window size", option: WithMetricsWindowSize(0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewNetworkConfig(test.option).Validate()
+			if test.valid && err != nil {
+				t.Fatalf("expected the config to be valid, got %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected the config to be rejected")
+			}
+		})
+	}
+}
@@ -51,6 +51,106 @@ func WithLoadBalancerThreshold(threshold float64) Option {
 	}
 }
 
+func WithKeyFile(keyFile string) Option {
+	return func(c *NetworkConfig) {
+		c.SecurityConfig.KeyFile = keyFile
+	}
+}
+
+func WithAllowedPeers(peers []p2p.NodeID) Option {
+	return func(c *NetworkConfig) {
+		c.SecurityConfig.AllowedPeers = peers
+	}
+}
+
+// WithTrustOnFirstUse pins each peer address to the first node identity seen from it
+func WithTrustOnFirstUse(enabled bool, knownPeersFile string) Option {
+	return func(c *NetworkConfig) {
+		c.SecurityConfig.TrustOnFirstUse = enabled
+		if knownPeersFile != "" {
+			c.SecurityConfig.KnownPeersFile = knownPeersFile
+		}
+	}
+}
+
+func WithMaxClockSkew(skew time.Duration) Option {
+	return func(c *NetworkConfig) {
+		c.SecurityConfig.MaxClockSkew = skew
+	}
+}
+
+func WithMTU(mtu int) Option {
+	return func(c *NetworkConfig) {
+		c.WireConfig.MTU = mtu
+	}
+}
+
+// WithLegacyWireFormat sends signed JSON messages so nodes that predate the binary format can still be reached during
+// a rollout. Nodes that predate message signing cannot join either way.
+func WithLegacyWireFormat(enabled bool) Option {
+	return func(c *NetworkConfig) {
+		c.WireConfig.LegacyJSON = enabled
+	}
+}
+
+// WithMaxHops limits how many times a request may be forwarded between nodes
+func WithMaxHops(maxHops int) Option {
+	return func(c *NetworkConfig) {
+		c.LoadBalancerConfig.MaxHops = maxHops
+	}
+}
+
+func WithForwardTimeout(timeout time.Duration) Option {
+	return func(c *NetworkConfig) {
+		c.LoadBalancerConfig.ForwardTimeout = timeout
+	}
+}
+
+// WithCircuitBreaker excludes a peer for the cooldown after the given number of consecutive forwarding failures
+func WithCircuitBreaker(failureThreshold int, cooldown time.Duration) Option {
+	return func(c *NetworkConfig) {
+		c.LoadBalancerConfig.FailureThreshold = failureThreshold
+		c.LoadBalancerConfig.Cooldown = cooldown
+	}
+}
+
+// WithMaxBlockLag excludes peers whose chain is more than maxLag blocks behind the highest known height
+func WithMaxBlockLag(maxLag int64) Option {
+	return func(c *NetworkConfig) {
+		c.LoadBalancerConfig.MaxBlockLag = maxLag
+	}
+}
+
+// WithPeerBook sets the file the known peers, their scores and bans are persisted to
+func WithPeerBook(file string) Option {
+	return func(c *NetworkConfig) {
+		c.DiscoveryConfig.PeerBookFile = file
+	}
+}
+
+// WithViewSizes bounds the number of connected peers and of peers kept in reserve
+func WithViewSizes(active, passive int) Option {
+	return func(c *NetworkConfig) {
+		c.DiscoveryConfig.ActiveViewSize = active
+		c.DiscoveryConfig.PassiveViewSize = passive
+	}
+}
+
+// WithShuffle sets how often and how many peers are exchanged with a random active peer
+func WithShuffle(interval time.Duration, length int) Option {
+	return func(c *NetworkConfig) {
+		c.DiscoveryConfig.ShuffleInterval = interval
+		c.DiscoveryConfig.ShuffleLength = length
+	}
+}
+
+// WithStateGossipInterval sets how often recent shared state changes are sent to the active peers
+func WithStateGossipInterval(interval time.Duration) Option {
+	return func(c *NetworkConfig) {
+		c.StateConfig.GossipInterval = interval
+	}
+}
+
 func NewNetworkConfig(options ...Option) NetworkConfig {
 	config := DefaultNetworkConfig()
 
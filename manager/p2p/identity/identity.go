@@ -0,0 +1,94 @@
+// Package identity provides ed25519 node identities and message authentication for the p2p network
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/proto"
+)
+
+const nodeIDLength = 20
+
+type Identity struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	nodeID     p2p.NodeID
+}
+
+// LoadOrCreate reads a hex encoded ed25519 seed from keyFile, generating and saving a new one when missing.
+func LoadOrCreate(keyFile string) (*Identity, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read node key: %w", err)
+	}
+
+	if err == nil {
+		seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid node key in %s", keyFile)
+		}
+
+		return FromPrivateKey(ed25519.NewKeyFromSeed(seed)), nil
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate node key: %w", err)
+	}
+
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(privateKey.Seed())), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save node key: %w", err)
+	}
+
+	return FromPrivateKey(privateKey), nil
+}
+
+func FromPrivateKey(privateKey ed25519.PrivateKey) *Identity {
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+
+	return &Identity{
+		privateKey: privateKey,
+		publicKey:  publicKey,
+		nodeID:     NodeIDFromPublicKey(publicKey),
+	}
+}
+
+// NodeIDFromPublicKey derives a node ID as the hex encoded prefix of the public key's SHA-256 hash.
+func NodeIDFromPublicKey(publicKey ed25519.PublicKey) p2p.NodeID {
+	hash := sha256.Sum256(publicKey)
+	return p2p.NodeID(hex.EncodeToString(hash[:nodeIDLength]))
+}
+
+func (i *Identity) NodeID() p2p.NodeID {
+	return i.nodeID
+}
+
+func (i *Identity) PublicKey() ed25519.PublicKey {
+	return i.publicKey
+}
+
+// Seal stamps the message with the sender identity, a fresh nonce and timestamp, and signs it.
+func (i *Identity) Seal(msg *proto.Message) error {
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	msg.From = i.nodeID
+	msg.PubKey = i.publicKey
+	msg.Nonce = binary.BigEndian.Uint64(nonce[:])
+	msg.Timestamp = time.Now().UnixNano()
+	msg.Signature = ed25519.Sign(i.privateKey, msg.SigningBytes())
+
+	return nil
+}
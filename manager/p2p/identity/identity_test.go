@@ -0,0 +1,95 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/p2p/proto"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+func TestLoadOrCreateSavesAndReloadsTheKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "node.key")
+
+	created, err := LoadOrCreate(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the key to be readable by its owner only, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := LoadOrCreate(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.NodeID() != created.NodeID() || !loaded.PublicKey().Equal(created.PublicKey()) {
+		t.Fatalf("expected the saved key to be loaded again, got %s instead of %s", loaded.NodeID(), created.NodeID())
+	}
+	if loaded.NodeID() != NodeIDFromPublicKey(loaded.PublicKey()) || len(loaded.NodeID()) != 2*nodeIDLength {
+		t.Fatalf("expected the node id to be derived from the public key, got %s", loaded.NodeID())
+	}
+}
+
+func TestLoadOrCreateRejectsInvalidKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "node.key")
+	if err := os.WriteFile(keyFile, []byte("not a seed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadOrCreate(keyFile); err == nil {
+		t.Fatal("expected an invalid key to be rejected rather than replaced")
+	}
+}
+
+func TestSeal(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := FromPrivateKey(privateKey)
+
+	first, err := proto.NewLegacyMessage(proto.MessageTypeMetrics, map[string]int{"load": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := proto.NewLegacyMessage(proto.MessageTypeMetrics, map[string]int{"load": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().UnixNano()
+	if err := id.Seal(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := id.Seal(second); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.From != id.NodeID() || !ed25519.PublicKey(first.PubKey).Equal(id.PublicKey()) {
+		t.Fatalf("expected the message to carry the identity, got %s", first.From)
+	}
+	if first.Timestamp < before || first.Timestamp > time.Now().UnixNano() {
+		t.Fatalf("expected the message to be stamped with the current time, got %d", first.Timestamp)
+	}
+	if first.Nonce == second.Nonce {
+		t.Fatal("expected every sealed message to get its own nonce")
+	}
+	if !ed25519.Verify(id.PublicKey(), first.SigningBytes(), first.Signature) {
+		t.Fatal("expected the signature to cover the signing bytes")
+	}
+}
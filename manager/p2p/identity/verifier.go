@@ -0,0 +1,254 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/proto"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid message signature")
+	ErrIdentityMismatch = errors.New("node id does not match public key")
+	ErrStaleMessage     = errors.New("message timestamp outside allowed clock skew")
+	ErrReplayedMessage  = errors.New("message nonce already seen")
+	ErrNotAllowed       = errors.New("node is not in the allow-list")
+	ErrPinMismatch      = errors.New("address is pinned to a different node")
+	ErrRevoked          = errors.New("node is revoked")
+)
+
+type VerifierConfig struct {
+	AllowedPeers    []p2p.NodeID
+	TrustOnFirstUse bool
+	KnownPeersFile  string
+	MaxClockSkew    time.Duration
+}
+
+// Verifier authenticates incoming messages and enforces the allow-list and trust-on-first-use policies.
+type Verifier struct {
+	allowed        map[p2p.NodeID]struct{}
+	tofu           bool
+	knownPeersFile string
+	maxSkew        time.Duration
+	pins           map[string]p2p.NodeID
+	revoked        map[p2p.NodeID]time.Time
+	seen           map[p2p.NodeID]map[uint64]time.Time
+	lastCleanup    time.Time
+	mutex          sync.Mutex
+}
+
+func NewVerifier(config VerifierConfig) *Verifier {
+	v := &Verifier{
+		allowed:        make(map[p2p.NodeID]struct{}),
+		tofu:           config.TrustOnFirstUse,
+		knownPeersFile: config.KnownPeersFile,
+		maxSkew:        config.MaxClockSkew,
+		pins:           make(map[string]p2p.NodeID),
+		revoked:        make(map[p2p.NodeID]time.Time),
+		seen:           make(map[p2p.NodeID]map[uint64]time.Time),
+		lastCleanup:    time.Now(),
+	}
+
+	for _, nodeID := range config.AllowedPeers {
+		v.allowed[nodeID] = struct{}{}
+	}
+
+	if v.tofu {
+		v.loadPins()
+	}
+
+	return v
+}
+
+// Verify checks the message signature, freshness and sender policy for a message received from fromAddr.
+func (v *Verifier) Verify(msg *proto.Message, fromAddr string) error {
+	if len(msg.PubKey) != ed25519.PublicKeySize || len(msg.Signature) != ed25519.SignatureSize {
+		return ErrInvalidSignature
+	}
+
+	if NodeIDFromPublicKey(msg.PubKey) != msg.From {
+		return ErrIdentityMismatch
+	}
+
+	if !ed25519.Verify(msg.PubKey, msg.SigningBytes(), msg.Signature) {
+		return ErrInvalidSignature
+	}
+
+	sentAt := time.Unix(0, msg.Timestamp)
+	if skew := time.Since(sentAt); skew > v.maxSkew || skew < -v.maxSkew {
+		return ErrStaleMessage
+	}
+
+	if len(v.allowed) > 0 {
+		if _, ok := v.allowed[msg.From]; !ok {
+			return ErrNotAllowed
+		}
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.cleanup()
+
+	if v.isRevoked(msg.From) {
+		return ErrRevoked
+	}
+
+	nonces, ok := v.seen[msg.From]
+	if !ok {
+		nonces = make(map[uint64]time.Time)
+		v.seen[msg.From] = nonces
+	}
+
+	if _, replayed := nonces[msg.Nonce]; replayed {
+		return ErrReplayedMessage
+	}
+
+	if v.tofu {
+		if err := v.checkPin(fromAddr, msg.From); err != nil {
+			return err
+		}
+	}
+
+	nonces[msg.Nonce] = sentAt
+
+	return nil
+}
+
+// IsAllowed reports whether the node passes the configured allow-list and is not revoked.
+func (v *Verifier) IsAllowed(nodeID p2p.NodeID) bool {
+	v.mutex.Lock()
+	revoked := v.isRevoked(nodeID)
+	v.mutex.Unlock()
+
+	if revoked {
+		return false
+	}
+
+	if len(v.allowed) == 0 {
+		return true
+	}
+
+	_, ok := v.allowed[nodeID]
+	return ok
+}
+
+// Revoke rejects the messages of the node until the given time and drops the addresses pinned to it and its
+// nonces, so the addresses can be trusted again for another node.
+func (v *Verifier) Revoke(nodeID p2p.NodeID, until time.Time) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.revoked[nodeID] = until
+	delete(v.seen, nodeID)
+
+	unpinned := false
+	for address, pinned := range v.pins {
+		if pinned == nodeID {
+			delete(v.pins, address)
+			unpinned = true
+		}
+	}
+	if unpinned {
+		v.savePins()
+	}
+}
+
+// Reinstate accepts the messages of a revoked node again
+func (v *Verifier) Reinstate(nodeID p2p.NodeID) {
+	v.mutex.Lock()
+	delete(v.revoked, nodeID)
+	v.mutex.Unlock()
+}
+
+func (v *Verifier) isRevoked(nodeID p2p.NodeID) bool {
+	until, revoked := v.revoked[nodeID]
+	if revoked && !time.Now().Before(until) {
+		delete(v.revoked, nodeID)
+		return false
+	}
+
+	return revoked
+}
+
+func (v *Verifier) checkPin(address string, nodeID p2p.NodeID) error {
+	pinned, exists := v.pins[address]
+	if exists {
+		if pinned != nodeID {
+			return fmt.Errorf("%w: %s is pinned to %s", ErrPinMismatch, address, pinned)
+		}
+		return nil
+	}
+
+	v.pins[address] = nodeID
+	v.savePins()
+
+	logger.Logger.Info("Trusting new peer on first use",
+		zap.String("address", address),
+		zap.String("nodeID", string(nodeID)))
+
+	return nil
+}
+
+func (v *Verifier) cleanup() {
+	if time.Since(v.lastCleanup) < v.maxSkew {
+		return
+	}
+
+	cutoff := time.Now().Add(-2 * v.maxSkew)
+	for nodeID, nonces := range v.seen {
+		for nonce, sentAt := range nonces {
+			if sentAt.Before(cutoff) {
+				delete(nonces, nonce)
+			}
+		}
+		if len(nonces) == 0 {
+			delete(v.seen, nodeID)
+		}
+	}
+
+	v.lastCleanup = time.Now()
+}
+
+func (v *Verifier) loadPins() {
+	if v.knownPeersFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(v.knownPeersFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Logger.Error("Verifier - loadPins", zap.Error(err))
+		}
+		return
+	}
+
+	if err := json.Unmarshal(data, &v.pins); err != nil {
+		logger.Logger.Error("Verifier - loadPins", zap.Error(err))
+	}
+}
+
+func (v *Verifier) savePins() {
+	if v.knownPeersFile == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(v.pins, "", "  ")
+	if err != nil {
+		logger.Logger.Error("Verifier - savePins", zap.Error(err))
+		return
+	}
+
+	if err := os.WriteFile(v.knownPeersFile, data, 0600); err != nil {
+		logger.Logger.Error("Verifier - savePins", zap.Error(err))
+	}
+}
@@ -0,0 +1,205 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/proto"
+)
+
+func newIdentity(t *testing.T) *Identity {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FromPrivateKey(privateKey)
+}
+
+func sealed(t *testing.T, id *Identity) *proto.Message {
+	t.Helper()
+
+	msg, err := proto.NewLegacyMessage(proto.MessageTypeState, map[string]string{"chain": "kira"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := id.Seal(msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// resealed signs the message again with its changed fields, as a sender with a wrong clock would
+func resealed(id *Identity, msg *proto.Message) *proto.Message {
+	msg.Signature = ed25519.Sign(id.privateKey, msg.SigningBytes())
+	return msg
+}
+
+func TestVerifierRejectsForgedMessages(t *testing.T) {
+	sender, other := newIdentity(t), newIdentity(t)
+
+	tests := []struct {
+		name   string
+		tamper func(msg *proto.Message) *proto.Message
+		err    error
+	}{
+		{name: "untouched", tamper: func(msg *proto.Message) *proto.Message { return msg }},
+		{
+			name:   "tampered payload",
+			tamper: func(msg *proto.Message) *proto.Message { msg.MsgPayload = []byte(`{"chain":"evil"}`); return msg },
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "tampered nonce",
+			tamper: func(msg *proto.Message) *proto.Message { msg.Nonce++; return msg },
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "truncated signature",
+			tamper: func(msg *proto.Message) *proto.Message { msg.Signature = msg.Signature[:10]; return msg },
+			err:    ErrInvalidSignature,
+		},
+		{
+			name:   "claimed by another node",
+			tamper: func(msg *proto.Message) *proto.Message { msg.From = other.NodeID(); return msg },
+			err:    ErrIdentityMismatch,
+		},
+		{
+			name: "signed by another key",
+			tamper: func(msg *proto.Message) *proto.Message {
+				msg.From, msg.PubKey = other.NodeID(), other.PublicKey()
+				return msg
+			},
+			err: ErrInvalidSignature,
+		},
+		{
+			name: "stale",
+			tamper: func(msg *proto.Message) *proto.Message {
+				msg.Timestamp = time.Now().Add(-2 * time.Minute).UnixNano()
+				return resealed(sender, msg)
+			},
+			err: ErrStaleMessage,
+		},
+		{
+			name: "from the future",
+			tamper: func(msg *proto.Message) *proto.Message {
+				msg.Timestamp = time.Now().Add(2 * time.Minute).UnixNano()
+				return resealed(sender, msg)
+			},
+			err: ErrStaleMessage,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier := NewVerifier(VerifierConfig{MaxClockSkew: time.Minute})
+
+			err := verifier.Verify(test.tamper(sealed(t, sender)), "10.0.0.1:9000")
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifierRejectsReplayedMessages(t *testing.T) {
+	sender := newIdentity(t)
+	verifier := NewVerifier(VerifierConfig{MaxClockSkew: time.Minute})
+
+	msg := sealed(t, sender)
+	if err := verifier.Verify(msg, "10.0.0.1:9000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(msg, "10.0.0.1:9000"); !errors.Is(err, ErrReplayedMessage) {
+		t.Fatalf("expected the replay to be rejected, got %v", err)
+	}
+
+	// the next message of the sender has a nonce of its own
+	if err := verifier.Verify(sealed(t, sender), "10.0.0.1:9000"); err != nil {
+		t.Fatalf("expected a new message to be accepted, got %v", err)
+	}
+}
+
+func TestVerifierReplayWindow(t *testing.T) {
+	sender := newIdentity(t)
+	verifier := NewVerifier(VerifierConfig{MaxClockSkew: 50 * time.Millisecond})
+
+	msg := sealed(t, sender)
+	if err := verifier.Verify(msg, "10.0.0.1:9000"); err != nil {
+		t.Fatal(err)
+	}
+
+	// once the message is out of the clock skew it is stale, its nonce can be forgotten
+	time.Sleep(120 * time.Millisecond)
+	if err := verifier.Verify(msg, "10.0.0.1:9000"); !errors.Is(err, ErrStaleMessage) {
+		t.Fatalf("expected the old message to be stale, got %v", err)
+	}
+	if err := verifier.Verify(sealed(t, sender), "10.0.0.1:9000"); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	if _, kept := verifier.seen[sender.NodeID()][msg.Nonce]; kept {
+		t.Fatal("expected the nonces older than twice the clock skew to be dropped")
+	}
+}
+
+func TestVerifierAllowList(t *testing.T) {
+	allowed, stranger := newIdentity(t), newIdentity(t)
+	verifier := NewVerifier(VerifierConfig{AllowedPeers: []p2p.NodeID{allowed.NodeID()}, MaxClockSkew: time.Minute})
+
+	if err := verifier.Verify(sealed(t, allowed), "10.0.0.1:9000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(sealed(t, stranger), "10.0.0.2:9000"); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("expected a node outside the allow-list to be rejected, got %v", err)
+	}
+	if !verifier.IsAllowed(allowed.NodeID()) || verifier.IsAllowed(stranger.NodeID()) {
+		t.Fatal("expected IsAllowed to follow the allow-list")
+	}
+
+	verifier.Revoke(allowed.NodeID(), time.Now().Add(time.Hour))
+	if err := verifier.Verify(sealed(t, allowed), "10.0.0.1:9000"); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected a revoked node to be rejected, got %v", err)
+	}
+
+	verifier.Reinstate(allowed.NodeID())
+	if err := verifier.Verify(sealed(t, allowed), "10.0.0.1:9000"); err != nil {
+		t.Fatalf("expected a reinstated node to be accepted, got %v", err)
+	}
+}
+
+func TestVerifierTrustOnFirstUse(t *testing.T) {
+	first, impostor := newIdentity(t), newIdentity(t)
+	knownPeers := filepath.Join(t.TempDir(), "known_peers.json")
+
+	verifier := NewVerifier(VerifierConfig{TrustOnFirstUse: true, KnownPeersFile: knownPeers, MaxClockSkew: time.Minute})
+
+	if err := verifier.Verify(sealed(t, first), "10.0.0.1:9000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(sealed(t, impostor), "10.0.0.1:9000"); !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("expected another node on a pinned address to be rejected, got %v", err)
+	}
+	if err := verifier.Verify(sealed(t, impostor), "10.0.0.2:9000"); err != nil {
+		t.Fatalf("expected the other node to be trusted on its own address, got %v", err)
+	}
+
+	// the pins are kept across restarts
+	restarted := NewVerifier(VerifierConfig{TrustOnFirstUse: true, KnownPeersFile: knownPeers, MaxClockSkew: time.Minute})
+	if err := restarted.Verify(sealed(t, impostor), "10.0.0.1:9000"); !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("expected the pin to be loaded again, got %v", err)
+	}
+
+	// revoking a node releases its addresses
+	restarted.Revoke(first.NodeID(), time.Now().Add(time.Hour))
+	if err := restarted.Verify(sealed(t, impostor), "10.0.0.1:9000"); err != nil {
+		t.Fatalf("expected the address of the revoked node to be trusted again, got %v", err)
+	}
+}
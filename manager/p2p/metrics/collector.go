@@ -22,6 +22,8 @@ type CollectorImpl struct {
 	latencies      map[p2p.NodeID]float64
 	requestHistory []RequestStat
 	weights        p2p.Weights
+	chainState     p2p.ChainState
+	draining       bool
 	startTime      time.Time
 	windowSize     time.Duration
 }
@@ -86,6 +88,8 @@ func (c *CollectorImpl) CollectLocalMetrics() p2p.NodeMetrics {
 		ActiveRequests: len(c.requests),
 		ErrorRate:      errorRate,
 		Timestamp:      time.Now(),
+		Draining:       c.draining,
+		ChainState:     c.chainState,
 	}
 
 	return c.metrics[c.nodeID]
@@ -100,6 +104,61 @@ func (c *CollectorImpl) UpdateNodeMetrics(metrics p2p.NodeMetrics, latency float
 	c.cleanup()
 }
 
+// RemoveNode forgets the metrics of a peer, it is no longer offered to the balancer
+func (c *CollectorImpl) RemoveNode(nodeID p2p.NodeID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.metrics, nodeID)
+	delete(c.latencies, nodeID)
+}
+
+// SetChainState records the sync state of the local blockchain node, announced with the next metrics broadcast
+func (c *CollectorImpl) SetChainState(state p2p.ChainState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.chainState = state
+	if local, exists := c.metrics[c.nodeID]; exists {
+		local.ChainState = state
+		c.metrics[c.nodeID] = local
+	}
+}
+
+// SetDraining marks the local node as draining in the metrics announced to peers
+func (c *CollectorImpl) SetDraining(enabled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.draining = enabled
+	if local, exists := c.metrics[c.nodeID]; exists {
+		local.Draining = enabled
+		c.metrics[c.nodeID] = local
+	}
+}
+
+func (c *CollectorImpl) Draining() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.draining
+}
+
+// Latency returns the last measured message latency of the node in milliseconds
+func (c *CollectorImpl) Latency(nodeID p2p.NodeID) float64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.latencies[nodeID]
+}
+
+func (c *CollectorImpl) LocalChainState() p2p.ChainState {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.chainState
+}
+
 func (c *CollectorImpl) CalculateScore(nodeID p2p.NodeID) p2p.Score {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
@@ -160,7 +219,11 @@ func (c *CollectorImpl) GetAllNodesMetrics() map[p2p.NodeID]p2p.NodeMetrics {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	return c.metrics
+	allMetrics := make(map[p2p.NodeID]p2p.NodeMetrics, len(c.metrics))
+	for nodeID, nodeMetrics := range c.metrics {
+		allMetrics[nodeID] = nodeMetrics
+	}
+	return allMetrics
 }
 
 func (c *CollectorImpl) GetAllNodes() map[p2p.NodeID]struct{} {
@@ -31,7 +31,13 @@ type Collector interface {
 	GetAllNodesMetrics() map[p2p.NodeID]p2p.NodeMetrics
 	CollectLocalMetrics() p2p.NodeMetrics
 	UpdateNodeMetrics(metrics p2p.NodeMetrics, latency float64)
+	RemoveNode(nodeID p2p.NodeID)
 	CalculateScore(nodeID p2p.NodeID) p2p.Score
+	SetChainState(state p2p.ChainState)
+	LocalChainState() p2p.ChainState
+	SetDraining(enabled bool)
+	Draining() bool
+	Latency(nodeID p2p.NodeID) float64
 	StartRequest(req *Request)
 	FinishRequest(reqID string, isError bool)
 	GetAllNodes() map[p2p.NodeID]struct{}
@@ -19,11 +19,24 @@ func (h *joinResponseHandler) HandleMessage(msg p2p.Message, from p2p.Peer) erro
 	}
 
 	var joinResp types.JoinResponse
-	if err := proto.UnmarshalPayload(msg.Payload(), &joinResp); err != nil {
+	signed, ok := msg.(*proto.Message)
+	if !ok {
+		err := fmt.Errorf("unexpected message implementation %T", msg)
+		h.errCh <- err
+		return err
+	}
+
+	if err := signed.DecodePayload(&joinResp); err != nil {
 		h.errCh <- fmt.Errorf("failed to unmarshal join response: %w", err)
 		return err
 	}
 
+	if signed.From != joinResp.NodeID {
+		err := fmt.Errorf("join response node id %s is not signed by its sender %s", joinResp.NodeID, signed.From)
+		h.errCh <- err
+		return err
+	}
+
 	h.responseCh <- joinResp
 	return nil
 }
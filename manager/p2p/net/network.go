@@ -10,7 +10,10 @@ import (
 	"github.com/saiset-co/sai-interx-manager/p2p"
 	"github.com/saiset-co/sai-interx-manager/p2p/balancer"
 	"github.com/saiset-co/sai-interx-manager/p2p/config"
+	"github.com/saiset-co/sai-interx-manager/p2p/identity"
 	"github.com/saiset-co/sai-interx-manager/p2p/metrics"
+	"github.com/saiset-co/sai-interx-manager/p2p/proto"
+	"github.com/saiset-co/sai-interx-manager/p2p/state"
 )
 
 type Network struct {
@@ -18,11 +21,37 @@ type Network struct {
 	peerManager      *PeerManager
 	metricsCollector metrics.Collector
 	loadBalancer     p2p.LoadBalancer
+	sharedState      *state.Store
 	ctx              context.Context
 	cancel           context.CancelFunc
 }
 
 func NewNetwork(ctx context.Context, config config.NetworkConfig) (p2p.Network, error) {
+	if err := config.Validate(); err != nil {
+		logger.Logger.Error("NewNetwork", zap.Error(err))
+		return nil, err
+	}
+
+	nodeIdentity, err := identity.LoadOrCreate(config.SecurityConfig.KeyFile)
+	if err != nil {
+		logger.Logger.Error("NewNetwork", zap.Error(err))
+		return nil, err
+	}
+
+	if config.NodeID != "" && config.NodeID != nodeIdentity.NodeID() {
+		logger.Logger.Warn("Configured node ID is ignored, using the one derived from the node key",
+			zap.Any("Configured", config.NodeID),
+			zap.Any("Derived", nodeIdentity.NodeID()))
+	}
+	config.NodeID = nodeIdentity.NodeID()
+
+	verifier := identity.NewVerifier(identity.VerifierConfig{
+		AllowedPeers:    config.SecurityConfig.AllowedPeers,
+		TrustOnFirstUse: config.SecurityConfig.TrustOnFirstUse,
+		KnownPeersFile:  config.SecurityConfig.KnownPeersFile,
+		MaxClockSkew:    config.SecurityConfig.MaxClockSkew,
+	})
+
 	networkCtx, cancel := context.WithCancel(ctx)
 
 	metricsCollector := metrics.NewCollector(
@@ -33,19 +62,26 @@ func NewNetwork(ctx context.Context, config config.NetworkConfig) (p2p.Network,
 		config.MetricsConfig.WindowSize,
 	)
 
+	sharedState := state.NewStore(config.NodeID)
+
 	peerManager := NewPeerManager(
 		networkCtx,
-		config.NodeID,
+		nodeIdentity,
+		verifier,
+		proto.NewCodec(config.WireConfig.MTU, config.WireConfig.LegacyJSON),
 		config.ListenAddress,
 		config.HTTPPort,
 		config.MaxPeers,
+		config.DiscoveryConfig,
 		metricsCollector,
+		config.StateConfig,
+		sharedState,
 	)
 
 	loadBalancer := balancer.NewLoadBalancer(
 		config.NodeID,
 		metricsCollector,
-		config.LoadBalancerConfig.Threshold,
+		config.LoadBalancerConfig,
 	)
 
 	return &Network{
@@ -53,13 +89,14 @@ func NewNetwork(ctx context.Context, config config.NetworkConfig) (p2p.Network,
 		peerManager:      peerManager,
 		metricsCollector: metricsCollector,
 		loadBalancer:     loadBalancer,
+		sharedState:      sharedState,
 		ctx:              networkCtx,
 		cancel:           cancel,
 	}, nil
 }
 
 func (n *Network) Start() error {
-	logger.Logger.Info("Starting UDP P2P Network...")
+	logger.Logger.Info("Starting UDP P2P Network...", zap.Any("Node ID", n.config.NodeID))
 
 	if err := n.peerManager.Start(); err != nil {
 		logger.Logger.Error("Start", zap.Error(err))
@@ -92,6 +129,8 @@ func (n *Network) connectToInitialPeers() {
 			)
 		}
 	}
+
+	n.peerManager.checkAndReconnect()
 }
 
 func (n *Network) Stop() {
@@ -112,3 +151,8 @@ func (n *Network) MetricsCollector() p2p.MetricsCollector {
 func (n *Network) LoadBalancer() p2p.LoadBalancer {
 	return n.loadBalancer
 }
+
+// SharedState returns the key-value state replicated across the mesh
+func (n *Network) SharedState() p2p.SharedState {
+	return n.sharedState
+}
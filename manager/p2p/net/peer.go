@@ -3,6 +3,7 @@ package net
 import (
 	"net"
 	"sync"
+	"time"
 
 	"github.com/saiset-co/sai-interx-manager/p2p"
 )
@@ -18,6 +19,7 @@ type Peer struct {
 	udpAddr     *net.UDPAddr
 	status      PeerStatus
 	remotePeer  bool
+	lastMessage time.Time
 	statusMutex sync.RWMutex
 }
 
@@ -56,3 +58,15 @@ func (p *Peer) GetUDPAddr() *net.UDPAddr {
 func (p *Peer) SetUDPAddr(newAddr *net.UDPAddr) {
 	p.udpAddr = newAddr
 }
+
+func (p *Peer) Touch() {
+	p.statusMutex.Lock()
+	p.lastMessage = time.Now()
+	p.statusMutex.Unlock()
+}
+
+func (p *Peer) LastMessage() time.Time {
+	p.statusMutex.RLock()
+	defer p.statusMutex.RUnlock()
+	return p.lastMessage
+}
@@ -0,0 +1,333 @@
+package net
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/types"
+)
+
+const (
+	maxPeerScore = 10.0
+	minPeerScore = -10.0
+	permanentBan = 100 * 365 * 24 * time.Hour
+)
+
+// PeerRecord is what the node remembers about a peer across restarts
+type PeerRecord struct {
+	NodeID      p2p.NodeID `json:"node_id"`
+	Address     string     `json:"address"`
+	HttpPort    int        `json:"http_port"`
+	Score       float64    `json:"score"`
+	LastSeen    time.Time  `json:"last_seen"`
+	Failures    int        `json:"failures"`
+	BannedUntil time.Time  `json:"banned_until,omitempty"`
+}
+
+func (r PeerRecord) Banned() bool {
+	return time.Now().Before(r.BannedUntil)
+}
+
+// PeerBook is the persisted set of known peers. Peers that are not connected form the passive view
+// from which the active view is refilled.
+type PeerBook struct {
+	file    string
+	maxSize int
+	records map[p2p.NodeID]*PeerRecord
+	dirty   bool
+	mutex   sync.RWMutex
+}
+
+func NewPeerBook(file string, maxSize int) *PeerBook {
+	book := &PeerBook{
+		file:    file,
+		maxSize: maxSize,
+		records: make(map[p2p.NodeID]*PeerRecord),
+	}
+	book.load()
+
+	return book
+}
+
+// Add remembers a peer learned from a join response or a peer exchange without changing its score.
+// Those come from other nodes, so a known peer keeps its address: it only changes when the peer itself
+// joins from another one, otherwise any node could redirect the traffic meant for another.
+func (b *PeerBook) Add(info types.PeerInfo) {
+	if info.NodeID == "" || info.Address == "" {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.records[info.NodeID]; exists {
+		return
+	}
+
+	b.records[info.NodeID] = &PeerRecord{
+		NodeID:   info.NodeID,
+		Address:  info.Address,
+		HttpPort: info.HttpPort,
+	}
+	b.dirty = true
+	b.evict()
+}
+
+// MarkConnected records a successful join and raises the peer score. The address is the one the
+// authenticated join of the peer came from.
+func (b *PeerBook) MarkConnected(nodeID p2p.NodeID, address string, httpPort int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	record, exists := b.records[nodeID]
+	if !exists {
+		record = &PeerRecord{NodeID: nodeID}
+		b.records[nodeID] = record
+	}
+
+	record.Address = address
+	if httpPort != 0 {
+		record.HttpPort = httpPort
+	}
+	record.Score = clampScore(record.Score + 1)
+	record.Failures = 0
+	record.LastSeen = time.Now()
+	b.dirty = true
+	b.evict()
+}
+
+func (b *PeerBook) MarkSeen(nodeID p2p.NodeID) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if record, exists := b.records[nodeID]; exists {
+		record.LastSeen = time.Now()
+		b.dirty = true
+	}
+}
+
+// MarkFailed lowers the score of the peer known under the address, or under the node ID
+func (b *PeerBook) MarkFailed(nodeID p2p.NodeID, address string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, record := range b.records {
+		if record.NodeID == nodeID || (address != "" && record.Address == address) {
+			record.Score = clampScore(record.Score - 1)
+			record.Failures++
+			b.dirty = true
+		}
+	}
+}
+
+func (b *PeerBook) Ban(nodeID p2p.NodeID, duration time.Duration) {
+	b.mutex.Lock()
+	record, exists := b.records[nodeID]
+	if !exists {
+		record = &PeerRecord{NodeID: nodeID}
+		b.records[nodeID] = record
+	}
+	record.BannedUntil = time.Now().Add(duration)
+	record.Score = minPeerScore
+	b.dirty = true
+	b.mutex.Unlock()
+
+	b.Save()
+}
+
+func (b *PeerBook) Unban(nodeID p2p.NodeID) {
+	b.mutex.Lock()
+	if record, exists := b.records[nodeID]; exists {
+		record.BannedUntil = time.Time{}
+		record.Score = 0
+		b.dirty = true
+	}
+	b.mutex.Unlock()
+
+	b.Save()
+}
+
+func (b *PeerBook) Remove(nodeID p2p.NodeID) {
+	b.mutex.Lock()
+	if _, exists := b.records[nodeID]; exists {
+		delete(b.records, nodeID)
+		b.dirty = true
+	}
+	b.mutex.Unlock()
+
+	b.Save()
+}
+
+func (b *PeerBook) IsBanned(nodeID p2p.NodeID) bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	record, exists := b.records[nodeID]
+	return exists && record.Banned()
+}
+
+// Best returns up to n peers that are not banned or excluded, highest score and most recently seen first
+func (b *PeerBook) Best(n int, exclude map[p2p.NodeID]bool) []PeerRecord {
+	records := b.eligible(exclude)
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Score != records[j].Score {
+			return records[i].Score > records[j].Score
+		}
+		return records[i].LastSeen.After(records[j].LastSeen)
+	})
+
+	if len(records) > n {
+		records = records[:n]
+	}
+	return records
+}
+
+// Sample returns up to n random peers that are not banned or excluded
+func (b *PeerBook) Sample(n int, exclude map[p2p.NodeID]bool) []PeerRecord {
+	records := b.eligible(exclude)
+
+	rand.Shuffle(len(records), func(i, j int) {
+		records[i], records[j] = records[j], records[i]
+	})
+
+	if len(records) > n {
+		records = records[:n]
+	}
+	return records
+}
+
+func (b *PeerBook) Records() []PeerRecord {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	records := make([]PeerRecord, 0, len(b.records))
+	for _, record := range b.records {
+		records = append(records, *record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].NodeID < records[j].NodeID
+	})
+	return records
+}
+
+// Save writes the book to disk if it changed since the last save
+func (b *PeerBook) Save() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.file == "" || !b.dirty {
+		return
+	}
+
+	records := make([]PeerRecord, 0, len(b.records))
+	for _, record := range b.records {
+		records = append(records, *record)
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		logger.Logger.Error("PeerBook - Save", zap.Error(err))
+		return
+	}
+
+	tmpFile := b.file + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		logger.Logger.Error("PeerBook - Save", zap.Error(err))
+		return
+	}
+
+	if err := os.Rename(tmpFile, b.file); err != nil {
+		logger.Logger.Error("PeerBook - Save", zap.Error(err))
+		return
+	}
+
+	b.dirty = false
+}
+
+func (b *PeerBook) eligible(exclude map[p2p.NodeID]bool) []PeerRecord {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	records := make([]PeerRecord, 0, len(b.records))
+	for nodeID, record := range b.records {
+		if exclude[nodeID] || record.Banned() || record.Address == "" {
+			continue
+		}
+		records = append(records, *record)
+	}
+	return records
+}
+
+// evict drops the lowest scored, least recently seen peers that are not banned once the book exceeds its size
+func (b *PeerBook) evict() {
+	if b.maxSize <= 0 || len(b.records) <= b.maxSize {
+		return
+	}
+
+	candidates := make([]*PeerRecord, 0, len(b.records))
+	for _, record := range b.records {
+		if !record.Banned() {
+			candidates = append(candidates, record)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score < candidates[j].Score
+		}
+		return candidates[i].LastSeen.Before(candidates[j].LastSeen)
+	})
+
+	for _, record := range candidates {
+		if len(b.records) <= b.maxSize {
+			break
+		}
+		delete(b.records, record.NodeID)
+	}
+}
+
+func (b *PeerBook) load() {
+	if b.file == "" {
+		return
+	}
+
+	data, err := os.ReadFile(b.file)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Logger.Error("PeerBook - load", zap.Error(err))
+		}
+		return
+	}
+
+	var records []PeerRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		logger.Logger.Error("PeerBook - load", zap.Error(err))
+		return
+	}
+
+	for i := range records {
+		record := records[i]
+		b.records[record.NodeID] = &record
+	}
+}
+
+func clampScore(score float64) float64 {
+	if score > maxPeerScore {
+		return maxPeerScore
+	}
+	if score < minPeerScore {
+		return minPeerScore
+	}
+	return score
+}
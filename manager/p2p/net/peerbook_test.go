@@ -0,0 +1,36 @@
+package net
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/p2p/types"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+func TestPeerBookKeepsKnownAddresses(t *testing.T) {
+	book := NewPeerBook("", 10)
+
+	book.Add(types.PeerInfo{NodeID: "node-b", Address: "10.0.0.2:9000", HttpPort: 8080})
+
+	// another node gossips a different address for node-b
+	book.Add(types.PeerInfo{NodeID: "node-b", Address: "10.6.6.6:9000", HttpPort: 6666})
+
+	records := book.Records()
+	if len(records) != 1 || records[0].Address != "10.0.0.2:9000" || records[0].HttpPort != 8080 {
+		t.Fatalf("expected gossip not to change a known address, got %+v", records)
+	}
+
+	// node-b joins from its new address itself
+	book.MarkConnected("node-b", "10.0.0.3:9000", 8081)
+
+	records = book.Records()
+	if records[0].Address != "10.0.0.3:9000" || records[0].HttpPort != 8081 || records[0].Score != 1 {
+		t.Fatalf("expected the join of the peer to update its address, got %+v", records[0])
+	}
+}
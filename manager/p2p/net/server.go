@@ -2,8 +2,8 @@ package net
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net"
 	"strconv"
 	"sync"
@@ -13,17 +13,31 @@ import (
 
 	"github.com/saiset-co/sai-interx-manager/logger"
 	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/config"
+	"github.com/saiset-co/sai-interx-manager/p2p/identity"
 	"github.com/saiset-co/sai-interx-manager/p2p/metrics"
 	"github.com/saiset-co/sai-interx-manager/p2p/proto"
+	"github.com/saiset-co/sai-interx-manager/p2p/state"
 	"github.com/saiset-co/sai-interx-manager/p2p/types"
 )
 
+// maxStateEntries keeps a state message within a handful of frames
+const maxStateEntries = 64
+
 type PeerManager struct {
 	nodeID           p2p.NodeID
+	identity         *identity.Identity
+	verifier         *identity.Verifier
+	codec            *proto.Codec
 	address          string
 	p2pPort          int
 	httpPort         int
 	maxPeers         int
+	activeViewSize   int
+	shuffleInterval  time.Duration
+	shuffleLength    int
+	gossipInterval   time.Duration
+	sharedState      *state.Store
 	peers            map[p2p.NodeID]*Peer
 	metricsCollector metrics.Collector
 	conn             *net.UDPConn
@@ -33,9 +47,9 @@ type PeerManager struct {
 	messageHandlers  map[string]p2p.MessageHandler
 	addrMap          map[string]p2p.NodeID
 	addrMapMutex     sync.RWMutex
-	pendingJoins     map[string]struct{}
+	pendingJoins     map[string]p2p.MessageHandler
 	pendingMutex     sync.RWMutex
-	knownPeers       map[p2p.NodeID]*net.UDPAddr
+	peerBook         *PeerBook
 	reconnecting     bool
 	reconnectMutex   sync.RWMutex
 	missingMetrics   map[p2p.NodeID]time.Time
@@ -44,11 +58,16 @@ type PeerManager struct {
 
 func NewPeerManager(
 	ctx context.Context,
-	nodeID p2p.NodeID,
+	nodeIdentity *identity.Identity,
+	verifier *identity.Verifier,
+	codec *proto.Codec,
 	address string,
 	httpPort int,
 	maxPeers int,
+	discovery config.DiscoveryConfig,
 	metricsCollector metrics.Collector,
+	stateConfig config.StateConfig,
+	sharedState *state.Store,
 ) *PeerManager {
 	peerCtx, cancel := context.WithCancel(ctx)
 
@@ -59,19 +78,27 @@ func NewPeerManager(
 	}
 
 	return &PeerManager{
-		nodeID:           nodeID,
+		nodeID:           nodeIdentity.NodeID(),
+		identity:         nodeIdentity,
+		verifier:         verifier,
+		codec:            codec,
 		address:          address,
 		p2pPort:          p2pPort,
 		httpPort:         httpPort,
 		maxPeers:         maxPeers,
+		activeViewSize:   discovery.ActiveViewSize,
+		shuffleInterval:  discovery.ShuffleInterval,
+		shuffleLength:    discovery.ShuffleLength,
+		gossipInterval:   stateConfig.GossipInterval,
+		sharedState:      sharedState,
 		peers:            make(map[p2p.NodeID]*Peer),
 		metricsCollector: metricsCollector,
 		ctx:              peerCtx,
 		cancel:           cancel,
 		messageHandlers:  make(map[string]p2p.MessageHandler),
 		addrMap:          make(map[string]p2p.NodeID),
-		pendingJoins:     make(map[string]struct{}),
-		knownPeers:       make(map[p2p.NodeID]*net.UDPAddr),
+		pendingJoins:     make(map[string]p2p.MessageHandler),
+		peerBook:         NewPeerBook(discovery.PeerBookFile, discovery.ActiveViewSize+discovery.PassiveViewSize),
 		missingMetrics:   make(map[p2p.NodeID]time.Time),
 	}
 }
@@ -92,6 +119,7 @@ func (pm *PeerManager) Start() error {
 
 	go pm.handleIncomingMessages()
 	go pm.startHealthCheck()
+	go pm.checkAndReconnect()
 
 	return nil
 }
@@ -108,6 +136,13 @@ func (pm *PeerManager) Stop() {
 	for _, peer := range pm.peers {
 		peer.Close()
 	}
+
+	pm.peerBook.Save()
+}
+
+// PeerBook returns the persisted set of known peers
+func (pm *PeerManager) PeerBook() *PeerBook {
+	return pm.peerBook
 }
 
 func (pm *PeerManager) AddPeer(address string, remote bool) (p2p.Peer, error) {
@@ -121,13 +156,6 @@ func (pm *PeerManager) addPeerWithVisited(address string, visitedNodes map[strin
 		zap.Bool("Remote", remote),
 	)
 
-	if len(pm.LocalPeers()) > 0 && !remote {
-		logger.Logger.Debug("ALREADY CONNECTED",
-			zap.Int("localPeerCount", len(pm.LocalPeers())),
-		)
-		return nil, fmt.Errorf("this peer already connected")
-	}
-
 	udpAddr, err := net.ResolveUDPAddr("udp", address)
 	if err != nil {
 		logger.Logger.Error("UDP ADDRESS RESOLUTION ERROR",
@@ -154,6 +182,11 @@ func (pm *PeerManager) addPeerWithVisited(address string, visitedNodes map[strin
 		}
 	}
 
+	if pm.activeViewFull() {
+		logger.Logger.Debug("ACTIVE VIEW FULL", zap.Int("activeViewSize", pm.activeViewSize))
+		return nil, fmt.Errorf("active view is full")
+	}
+
 	if visitedNodes != nil && visitedNodes[address] {
 		err := fmt.Errorf("this adress already tried")
 		logger.Logger.Debug("Skip already visited or failed connection",
@@ -162,11 +195,6 @@ func (pm *PeerManager) addPeerWithVisited(address string, visitedNodes map[strin
 		return nil, err
 	}
 
-	pm.pendingMutex.Lock()
-	pm.pendingJoins[udpAddr.String()] = struct{}{}
-	logger.Logger.Debug("Added pending join for address", zap.String("address", udpAddr.String()))
-	pm.pendingMutex.Unlock()
-
 	visitedNodes[string(pm.nodeID)] = true
 
 	joinReq := types.JoinRequest{
@@ -177,8 +205,6 @@ func (pm *PeerManager) addPeerWithVisited(address string, visitedNodes map[strin
 		Remote:       remote,
 	}
 
-	msg := proto.NewMessage(proto.MessageTypeJoinRequest, joinReq)
-
 	logger.Logger.Debug("SENDING JOIN REQUEST",
 		zap.Any("Node ID", joinReq.NodeID),
 		zap.Any("Address", joinReq.Address),
@@ -187,14 +213,9 @@ func (pm *PeerManager) addPeerWithVisited(address string, visitedNodes map[strin
 		zap.Bool("Remote", remote),
 	)
 
-	msgBytes, err := json.Marshal(msg)
+	frames, err := pm.encodeMessage(proto.MessageTypeJoinRequest, joinReq)
 	if err != nil {
 		logger.Logger.Error("JOIN REQUEST MARSHAL ERROR", zap.Error(err))
-
-		pm.pendingMutex.Lock()
-		delete(pm.pendingJoins, udpAddr.String())
-		pm.pendingMutex.Unlock()
-
 		return nil, fmt.Errorf("failed to marshal join request: %w", err)
 	}
 
@@ -207,23 +228,21 @@ func (pm *PeerManager) addPeerWithVisited(address string, visitedNodes map[strin
 		errCh:      errCh,
 	}
 
-	pm.mutex.Lock()
-	pm.messageHandlers[string(proto.MessageTypeJoinResponse)] = handler
-	pm.mutex.Unlock()
+	pm.pendingMutex.Lock()
+	pm.pendingJoins[udpAddr.String()] = handler
+	logger.Logger.Debug("Added pending join for address", zap.String("address", udpAddr.String()))
+	pm.pendingMutex.Unlock()
 
 	defer func() {
-		pm.mutex.Lock()
-		delete(pm.messageHandlers, string(proto.MessageTypeJoinResponse))
-		pm.mutex.Unlock()
-
 		pm.pendingMutex.Lock()
 		delete(pm.pendingJoins, udpAddr.String())
 		pm.pendingMutex.Unlock()
 	}()
 
-	_, sendErr := pm.conn.WriteToUDP(msgBytes, udpAddr)
+	sendErr := pm.writeFrames(frames, udpAddr)
 	if sendErr != nil {
 		logger.Logger.Error("JOIN REQUEST SEND ERROR", zap.Error(sendErr))
+		pm.peerBook.MarkFailed("", address)
 		return nil, fmt.Errorf("failed to send join request: %w", sendErr)
 	}
 
@@ -231,9 +250,11 @@ func (pm *PeerManager) addPeerWithVisited(address string, visitedNodes map[strin
 	case joinResp := <-responseCh:
 		return pm.processJoinResponse(joinResp, address, udpAddr, visitedNodes, remote)
 	case err := <-errCh:
+		pm.peerBook.MarkFailed("", address)
 		return nil, err
 	case <-timeoutCh:
 		logger.Logger.Debug("JOIN REQUEST TIMEOUT")
+		pm.peerBook.MarkFailed("", address)
 		return nil, fmt.Errorf("join request timed out")
 	}
 }
@@ -251,22 +272,29 @@ func (pm *PeerManager) processJoinResponse(
 		zap.Int("Alternative Peers", len(joinResp.AlternativePeers)),
 	)
 
+	if pm.peerBook.IsBanned(joinResp.NodeID) {
+		logger.Logger.Debug("JOIN RESPONSE FROM BANNED PEER", zap.Any("Node ID", joinResp.NodeID))
+		return nil, fmt.Errorf("peer %s is banned", joinResp.NodeID)
+	}
+
 	if !joinResp.Success {
 		logger.Logger.Debug("JOIN REQUEST REJECTED",
 			zap.String("Error", joinResp.Error),
 		)
 
 		visitedNodes[string(joinResp.NodeID)] = true
+		visitedNodes[address] = true
+		pm.rememberPeers(joinResp.AlternativePeers)
 
 		if len(joinResp.AlternativePeers) > 0 {
 			logger.Logger.Debug("Alternative Peers available",
 				zap.Int("count", len(joinResp.AlternativePeers)))
 
-			for nodeId, peerInfo := range joinResp.AlternativePeers {
+			for _, peerInfo := range joinResp.AlternativePeers {
 				logger.Logger.Debug("Trying alternative peer",
 					zap.String("address", peerInfo.Address))
 
-				if visitedNodes[strconv.Itoa(nodeId)] {
+				if visitedNodes[string(peerInfo.NodeID)] {
 					continue
 				}
 
@@ -284,13 +312,6 @@ func (pm *PeerManager) processJoinResponse(
 		return nil, fmt.Errorf("peer rejected connection: %s", joinResp.Error)
 	}
 
-	if !remote && len(pm.LocalPeers()) > 0 {
-		logger.Logger.Debug("ALREADY CONNECTED",
-			zap.Int("localPeerCount", len(pm.LocalPeers())),
-		)
-		return nil, fmt.Errorf("this peer already connected")
-	}
-
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
 
@@ -307,9 +328,7 @@ func (pm *PeerManager) processJoinResponse(
 	peer := NewPeer(remotePeerID, address, joinResp.HttpPort, udpAddr, remote)
 	pm.peers[remotePeerID] = peer
 
-	pm.reconnectMutex.RLock()
-	pm.knownPeers[remotePeerID] = udpAddr
-	pm.reconnectMutex.RUnlock()
+	pm.peerBook.MarkConnected(remotePeerID, address, joinResp.HttpPort)
 
 	pm.addrMapMutex.Lock()
 	pm.addrMap[udpAddr.String()] = remotePeerID
@@ -325,52 +344,33 @@ func (pm *PeerManager) processJoinResponse(
 	)
 
 	if len(joinResp.AlternativePeers) > 0 {
-		go pm.processAlternativePeers(joinResp.AlternativePeers, visitedNodes)
+		go pm.processAlternativePeers(joinResp.AlternativePeers)
 	}
 
 	return peer, nil
 }
 
-func (pm *PeerManager) processAlternativePeers(alternativePeers []types.PeerInfo, visitedNodes map[string]bool) {
-	pm.peeringMutex.RLock()
-	defer pm.peeringMutex.RUnlock()
-
-	time.Sleep(3 * time.Second)
-
-	pm.mutex.RLock()
-	existingPeers := make(map[p2p.NodeID]bool)
-	for nodeID := range pm.peers {
-		existingPeers[nodeID] = true
-	}
-	pm.mutex.RUnlock()
+// processAlternativePeers keeps the alternatives in the passive view and refills the active view from it
+func (pm *PeerManager) processAlternativePeers(alternativePeers []types.PeerInfo) {
+	pm.rememberPeers(alternativePeers)
+	pm.checkAndReconnect()
+}
 
-	var peersToConnect []types.PeerInfo
-	for _, peerInfo := range alternativePeers {
-		if !existingPeers[peerInfo.NodeID] {
-			peersToConnect = append(peersToConnect, peerInfo)
+// rememberPeers adds allowed peers other than this node to the peer book
+func (pm *PeerManager) rememberPeers(peers []types.PeerInfo) {
+	for _, peerInfo := range peers {
+		if peerInfo.NodeID == pm.nodeID || !pm.verifier.IsAllowed(peerInfo.NodeID) {
+			continue
 		}
+		pm.peerBook.Add(peerInfo)
 	}
+}
 
-	if len(peersToConnect) == 0 {
-		logger.Logger.Debug("No new alternative peers to connect")
-		return
-	}
-
-	logger.Logger.Debug("Processing alternative peers",
-		zap.Int("peers to connect", len(peersToConnect)))
-
-	for _, peerInfo := range peersToConnect {
-		logger.Logger.Debug("CONNECTING TO ALTERNATIVE PEER",
-			zap.Any("Node ID", peerInfo.NodeID),
-			zap.String("Address", peerInfo.Address))
+func (pm *PeerManager) activeViewFull() bool {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
 
-		_, err := pm.addPeerWithVisited(peerInfo.Address, visitedNodes, true)
-		if err != nil {
-			logger.Logger.Error("ALTERNATIVE PEER CONNECTION ERROR",
-				zap.Any("Node ID", peerInfo.NodeID),
-				zap.Error(err))
-		}
-	}
+	return pm.activeViewSize > 0 && len(pm.peers) >= pm.activeViewSize
 }
 
 func (pm *PeerManager) GetPeerId() p2p.NodeID {
@@ -395,8 +395,97 @@ func (pm *PeerManager) RemovePeer(id p2p.NodeID) {
 	}
 }
 
+// ForgetPeer disconnects the peer and drops it from the peer book
+func (pm *PeerManager) ForgetPeer(id p2p.NodeID) {
+	pm.RemovePeer(id)
+	pm.peerBook.Remove(id)
+}
+
+// BanPeer disconnects the peer and refuses it until the ban expires. A zero duration bans it for good.
+// Its metrics are dropped, so the balancer stops forwarding to it, and the verifier revokes it.
+func (pm *PeerManager) BanPeer(id p2p.NodeID, duration time.Duration) {
+	if duration <= 0 {
+		duration = permanentBan
+	}
+
+	pm.peerBook.Ban(id, duration)
+	pm.verifier.Revoke(id, time.Now().Add(duration))
+	pm.RemovePeer(id)
+	pm.metricsCollector.RemoveNode(id)
+}
+
+func (pm *PeerManager) UnbanPeer(id p2p.NodeID) {
+	pm.peerBook.Unban(id)
+	pm.verifier.Reinstate(id)
+}
+
+// Peers lists the active peers and the passive ones kept in the peer book
+func (pm *PeerManager) Peers() []p2p.PeerState {
+	pm.mutex.RLock()
+	active := make(map[p2p.NodeID]*Peer, len(pm.peers))
+	for nodeID, peer := range pm.peers {
+		active[nodeID] = peer
+	}
+	pm.mutex.RUnlock()
+
+	states := make([]p2p.PeerState, 0, len(active))
+	for _, record := range pm.peerBook.Records() {
+		state := p2p.PeerState{
+			NodeID:      record.NodeID,
+			Address:     record.Address,
+			HttpPort:    record.HttpPort,
+			Score:       record.Score,
+			Failures:    record.Failures,
+			LastSeen:    record.LastSeen,
+			BannedUntil: record.BannedUntil,
+		}
+
+		if peer, exists := active[record.NodeID]; exists {
+			state.Active = true
+			state.Remote = peer.remotePeer
+			state.LastMessage = peer.LastMessage()
+			state.RTT = pm.metricsCollector.Latency(record.NodeID)
+			delete(active, record.NodeID)
+		}
+
+		states = append(states, state)
+	}
+
+	for nodeID, peer := range active {
+		states = append(states, p2p.PeerState{
+			NodeID:      nodeID,
+			Address:     peer.Address(),
+			HttpPort:    peer.httpPort,
+			Active:      true,
+			Remote:      peer.remotePeer,
+			LastMessage: peer.LastMessage(),
+			RTT:         pm.metricsCollector.Latency(nodeID),
+		})
+	}
+
+	return states
+}
+
+func (pm *PeerManager) touchPeer(address string) {
+	pm.addrMapMutex.RLock()
+	nodeID, exists := pm.addrMap[address]
+	pm.addrMapMutex.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	pm.mutex.RLock()
+	peer, exists := pm.peers[nodeID]
+	pm.mutex.RUnlock()
+
+	if exists {
+		peer.Touch()
+	}
+}
+
 func (pm *PeerManager) handleIncomingMessages() {
-	buffer := make([]byte, 65536)
+	buffer := make([]byte, proto.MaxMessageSize)
 
 	for {
 		n, addr, err := pm.conn.ReadFromUDP(buffer)
@@ -410,58 +499,77 @@ func (pm *PeerManager) handleIncomingMessages() {
 			}
 		}
 
-		go pm.processUDPMessage(buffer[:n], addr)
+		packet := make([]byte, n)
+		copy(packet, buffer[:n])
+
+		go pm.processUDPMessage(packet, addr)
 	}
 }
 
-func (pm *PeerManager) processUDPMessage(msgBytes []byte, fromAddr *net.UDPAddr) {
-	var msg proto.Message
-	if err := json.Unmarshal(msgBytes, &msg); err != nil {
-		logger.Logger.Error("JSON DECODING ERROR",
+func (pm *PeerManager) processUDPMessage(packet []byte, fromAddr *net.UDPAddr) {
+	msg, err := pm.codec.Decode(packet, fromAddr.String())
+	if err != nil {
+		logger.Logger.Error("MESSAGE DECODING ERROR",
 			zap.Error(err),
 			zap.String("Remote Address", fromAddr.String()),
 		)
 		return
 	}
 
+	if msg == nil {
+		return
+	}
+
+	if err := pm.verifier.Verify(msg, fromAddr.String()); err != nil {
+		logger.Logger.Warn("REJECTED UNAUTHENTICATED MESSAGE",
+			zap.String("Type", msg.Type()),
+			zap.String("From", fromAddr.String()),
+			zap.Any("Node ID", msg.From),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if pm.peerBook.IsBanned(msg.From) {
+		logger.Logger.Debug("REJECTED MESSAGE FROM BANNED PEER",
+			zap.String("Type", msg.Type()),
+			zap.String("From", fromAddr.String()),
+			zap.Any("Node ID", msg.From),
+		)
+		return
+	}
+
 	logger.Logger.Debug("RECEIVED MESSAGE",
 		zap.String("Type", msg.Type()),
 		zap.String("From", fromAddr.String()),
+		zap.Any("Node ID", msg.From),
 	)
 
 	addrStr := fromAddr.String()
+	pm.touchPeer(addrStr)
 
 	if msg.Type() == string(proto.MessageTypeJoinResponse) {
 		pm.pendingMutex.RLock()
-		isPending := false
-
-		if _, ok := pm.pendingJoins[addrStr]; ok {
-			isPending = true
-		} else {
-			if _, ok := pm.pendingJoins[addrStr]; ok {
-				isPending = true
-				logger.Logger.Debug("Found pending join via alternative address",
-					zap.String("addrStr", addrStr))
-			}
-		}
+		handler, isPending := pm.pendingJoins[addrStr]
 		pm.pendingMutex.RUnlock()
 
 		if isPending {
-			handler, exists := pm.messageHandlers[string(proto.MessageTypeJoinResponse)]
-			if exists {
-				if err := handler.HandleMessage(&msg, nil); err != nil {
-					logger.Logger.Error("ERROR HANDLING JOIN RESPONSE", zap.Error(err))
-				}
-				return
+			if err := handler.HandleMessage(msg, nil); err != nil {
+				logger.Logger.Error("ERROR HANDLING JOIN RESPONSE", zap.Error(err))
 			}
+			return
 		}
 	}
 
 	switch msg.Type() {
 	case string(proto.MessageTypeJoinRequest):
-		pm.handleJoinRequest(&msg, fromAddr)
+		pm.handleJoinRequest(msg, fromAddr)
 	case string(proto.MessageTypeMetrics):
-		pm.handleMetricsUpdate(&msg, fromAddr)
+		pm.handleMetricsUpdate(msg, fromAddr)
+	case string(proto.MessageTypePeerExchange):
+		pm.handlePeerExchange(msg, fromAddr)
+	case string(proto.MessageTypeState):
+		pm.handleStateUpdate(msg, fromAddr)
 	default:
 		pm.addrMapMutex.RLock()
 		peerID, exists := pm.addrMap[fromAddr.String()]
@@ -494,7 +602,7 @@ func (pm *PeerManager) processUDPMessage(msgBytes []byte, fromAddr *net.UDPAddr)
 
 		handler, ok := pm.messageHandlers[msg.Type()]
 		if ok {
-			if err := handler.HandleMessage(&msg, peer); err != nil {
+			if err := handler.HandleMessage(msg, peer); err != nil {
 				logger.Logger.Error("ERROR HANDLING MESSAGE",
 					zap.String("Type", msg.Type()),
 					zap.Error(err),
@@ -509,11 +617,19 @@ func (pm *PeerManager) processUDPMessage(msgBytes []byte, fromAddr *net.UDPAddr)
 
 func (pm *PeerManager) handleJoinRequest(msg *proto.Message, fromAddr *net.UDPAddr) {
 	var joinReq types.JoinRequest
-	if err := proto.UnmarshalPayload(msg.Payload(), &joinReq); err != nil {
+	if err := msg.DecodePayload(&joinReq); err != nil {
 		logger.Logger.Error("JOIN REQUEST UNMARSHAL ERROR", zap.Error(err))
 		return
 	}
 
+	if joinReq.NodeID != msg.From {
+		logger.Logger.Warn("JOIN REQUEST NODE ID MISMATCH",
+			zap.Any("Claimed", joinReq.NodeID),
+			zap.Any("Signed By", msg.From),
+			zap.String("From UDP", fromAddr.String()))
+		return
+	}
+
 	logger.Logger.Debug("JOIN REQUEST RECEIVED",
 		zap.Any("Node ID", joinReq.NodeID),
 		zap.String("Address", joinReq.Address),
@@ -521,6 +637,19 @@ func (pm *PeerManager) handleJoinRequest(msg *proto.Message, fromAddr *net.UDPAd
 		zap.Any("Visited Nodes", joinReq.VisitedNodes),
 	)
 
+	if pm.peerBook.IsBanned(joinReq.NodeID) {
+		logger.Logger.Debug("JOIN REQUEST FROM BANNED PEER",
+			zap.Any("Node ID", joinReq.NodeID),
+			zap.String("From UDP", fromAddr.String()))
+
+		pm.sendJoinResponse(types.JoinResponse{
+			Success: false,
+			NodeID:  pm.nodeID,
+			Error:   "Peer is banned",
+		}, fromAddr)
+		return
+	}
+
 	pm.mutex.RLock()
 	existingPeer, peerExists := pm.peers[joinReq.NodeID]
 	pm.mutex.RUnlock()
@@ -550,9 +679,7 @@ func (pm *PeerManager) handleJoinRequest(msg *proto.Message, fromAddr *net.UDPAd
 		alternativePeers := pm.getAllPeersInfo(joinReq.NodeID)
 		pm.mutex.RUnlock()
 
-		pm.reconnectMutex.RLock()
-		pm.knownPeers[joinReq.NodeID] = fromAddr
-		pm.reconnectMutex.RUnlock()
+		pm.peerBook.MarkConnected(joinReq.NodeID, fromAddr.String(), joinReq.HttpPort)
 
 		response := types.JoinResponse{
 			Success:          true,
@@ -582,16 +709,22 @@ func (pm *PeerManager) handleJoinRequest(msg *proto.Message, fromAddr *net.UDPAd
 			zap.Bool("isRemoteRequest", joinReq.Remote))
 	}
 
+	if canAccept && pm.activeViewFull() {
+		canAccept = false
+	}
+
 	pm.mutex.RLock()
 	alternativePeers := pm.getAllPeersInfo(joinReq.NodeID)
 	pm.mutex.RUnlock()
 
 	if canAccept {
 		pm.mutex.Lock()
-		peer := NewPeer(joinReq.NodeID, joinReq.Address, joinReq.HttpPort, fromAddr, joinReq.Remote)
+		peer := NewPeer(joinReq.NodeID, fromAddr.String(), joinReq.HttpPort, fromAddr, joinReq.Remote)
 		pm.peers[joinReq.NodeID] = peer
 		pm.mutex.Unlock()
 
+		pm.peerBook.MarkConnected(joinReq.NodeID, fromAddr.String(), joinReq.HttpPort)
+
 		pm.addrMapMutex.Lock()
 		pm.addrMap[fromAddr.String()] = joinReq.NodeID
 		pm.addrMapMutex.Unlock()
@@ -616,7 +749,7 @@ func (pm *PeerManager) handleJoinRequest(msg *proto.Message, fromAddr *net.UDPAd
 			Success:          false,
 			NodeID:           pm.nodeID,
 			AlternativePeers: alternativePeers,
-			Error:            "Maximum number of local peers reached",
+			Error:            "Maximum number of peers reached",
 		}
 
 		pm.sendJoinResponse(response, fromAddr)
@@ -655,35 +788,42 @@ func (pm *PeerManager) remotePeerExists(nodeID p2p.NodeID) bool {
 }
 
 func (pm *PeerManager) sendJoinResponse(response types.JoinResponse, toAddr *net.UDPAddr) {
-	respMsg := proto.NewMessage(proto.MessageTypeJoinResponse, response)
-	respBytes, err := json.Marshal(respMsg)
+	frames, err := pm.encodeMessage(proto.MessageTypeJoinResponse, response)
 	if err != nil {
 		logger.Logger.Error("JOIN RESPONSE MARSHAL ERROR", zap.Error(err))
 		return
 	}
 
-	if _, err = pm.conn.WriteToUDP(respBytes, toAddr); err != nil {
+	if err = pm.writeFrames(frames, toAddr); err != nil {
 		logger.Logger.Error("JOIN RESPONSE SEND ERROR", zap.Error(err))
 	}
 }
 
 func (pm *PeerManager) handleMetricsUpdate(msg *proto.Message, fromAddr *net.UDPAddr) {
 	pm.addrMapMutex.RLock()
-	_, exists := pm.addrMap[fromAddr.String()]
+	peerID, exists := pm.addrMap[fromAddr.String()]
 	pm.addrMapMutex.RUnlock()
 
-	if !exists {
+	if !exists || peerID != msg.From {
 		logger.Logger.Debug("METRICS FROM UNKNOWN PEER",
-			zap.String("address", fromAddr.String()))
+			zap.String("address", fromAddr.String()),
+			zap.Any("Node ID", msg.From))
 		return
 	}
 
 	var nodeMetrics p2p.NodeMetrics
-	if err := proto.UnmarshalPayload(msg.Payload(), &nodeMetrics); err != nil {
+	if err := msg.DecodePayload(&nodeMetrics); err != nil {
 		logger.Logger.Error("METRICS UNMARSHAL ERROR", zap.Error(err))
 		return
 	}
 
+	if nodeMetrics.NodeID != msg.From {
+		logger.Logger.Warn("METRICS NODE ID MISMATCH",
+			zap.Any("Claimed", nodeMetrics.NodeID),
+			zap.Any("Signed By", msg.From))
+		return
+	}
+
 	logger.Logger.Debug("RECEIVED METRICS FROM PEER",
 		zap.Any("Node ID", nodeMetrics.NodeID),
 		zap.String("Address", nodeMetrics.Address),
@@ -696,14 +836,191 @@ func (pm *PeerManager) handleMetricsUpdate(msg *proto.Message, fromAddr *net.UDP
 
 	latency := time.Since(nodeMetrics.Timestamp).Seconds() * 1000
 	pm.metricsCollector.UpdateNodeMetrics(nodeMetrics, latency)
+	pm.peerBook.MarkSeen(nodeMetrics.NodeID)
+}
+
+func (pm *PeerManager) handlePeerExchange(msg *proto.Message, fromAddr *net.UDPAddr) {
+	pm.addrMapMutex.RLock()
+	peerID, exists := pm.addrMap[fromAddr.String()]
+	pm.addrMapMutex.RUnlock()
+
+	if !exists || peerID != msg.From {
+		logger.Logger.Debug("PEER EXCHANGE FROM UNKNOWN PEER",
+			zap.String("address", fromAddr.String()),
+			zap.Any("Node ID", msg.From))
+		return
+	}
+
+	var exchange types.PeerExchange
+	if err := msg.DecodePayload(&exchange); err != nil {
+		logger.Logger.Error("PEER EXCHANGE UNMARSHAL ERROR", zap.Error(err))
+		return
+	}
+
+	logger.Logger.Debug("RECEIVED PEER EXCHANGE",
+		zap.Any("Node ID", peerID),
+		zap.Int("Peers", len(exchange.Peers)),
+		zap.Bool("Reply", exchange.Reply))
+
+	pm.rememberPeers(exchange.Peers)
+
+	if !exchange.Reply {
+		pm.sendPeerExchange(types.PeerExchange{Peers: pm.peerSample(peerID), Reply: true}, fromAddr)
+	}
+
+	pm.checkAndReconnect()
+}
+
+func (pm *PeerManager) handleStateUpdate(msg *proto.Message, fromAddr *net.UDPAddr) {
+	pm.addrMapMutex.RLock()
+	peerID, exists := pm.addrMap[fromAddr.String()]
+	pm.addrMapMutex.RUnlock()
+
+	if !exists || peerID != msg.From {
+		logger.Logger.Debug("STATE FROM UNKNOWN PEER",
+			zap.String("address", fromAddr.String()),
+			zap.Any("Node ID", msg.From))
+		return
+	}
+
+	var delta types.StateDelta
+	if err := msg.DecodePayload(&delta); err != nil {
+		logger.Logger.Error("STATE UNMARSHAL ERROR", zap.Error(err))
+		return
+	}
+
+	changed := pm.sharedState.Merge(delta)
+
+	logger.Logger.Debug("RECEIVED STATE FROM PEER",
+		zap.Any("Node ID", peerID),
+		zap.Int("Counters", len(delta.Counters)),
+		zap.Int("Registers", len(delta.Registers)),
+		zap.Bool("Changed", changed))
+}
+
+// gossipState sends the shared state changes of the last few intervals to every active peer.
+// Changes are repeated on several ticks, so a lost datagram is covered by the next one.
+func (pm *PeerManager) gossipState() {
+	pm.sharedState.Expire()
+
+	delta := pm.sharedState.Changes(time.Now().Add(-3 * pm.gossipInterval))
+	if len(delta.Counters) == 0 && len(delta.Registers) == 0 {
+		return
+	}
+
+	pm.mutex.RLock()
+	activePeers := make([]*Peer, 0, len(pm.peers))
+	for _, peer := range pm.peers {
+		activePeers = append(activePeers, peer)
+	}
+	pm.mutex.RUnlock()
+
+	for _, peer := range activePeers {
+		if udpAddr := peer.GetUDPAddr(); udpAddr != nil {
+			pm.sendState(delta, udpAddr)
+		}
+	}
+}
+
+// syncState sends the whole shared state to a random active peer, repairing whatever
+// the incremental gossip missed, for example while the mesh was partitioned
+func (pm *PeerManager) syncState() {
+	pm.mutex.RLock()
+	activePeers := make([]*Peer, 0, len(pm.peers))
+	for _, peer := range pm.peers {
+		activePeers = append(activePeers, peer)
+	}
+	pm.mutex.RUnlock()
+
+	if len(activePeers) == 0 {
+		return
+	}
+
+	target := activePeers[rand.Intn(len(activePeers))]
+	if udpAddr := target.GetUDPAddr(); udpAddr != nil {
+		pm.sendState(pm.sharedState.Snapshot(), udpAddr)
+	}
+}
+
+func (pm *PeerManager) sendState(delta types.StateDelta, toAddr *net.UDPAddr) {
+	for _, part := range state.Split(delta, maxStateEntries) {
+		frames, err := pm.encodeMessage(proto.MessageTypeState, part)
+		if err != nil {
+			logger.Logger.Error("STATE MARSHAL ERROR", zap.Error(err))
+			return
+		}
+
+		if err = pm.writeFrames(frames, toAddr); err != nil {
+			logger.Logger.Error("STATE SEND ERROR", zap.Error(err))
+			return
+		}
+	}
+}
+
+// shufflePeers sends a random sample of the active and passive views to a random active peer,
+// which answers with a sample of its own, so the passive views spread across the mesh
+func (pm *PeerManager) shufflePeers() {
+	pm.mutex.RLock()
+	activePeers := make([]*Peer, 0, len(pm.peers))
+	for _, peer := range pm.peers {
+		activePeers = append(activePeers, peer)
+	}
+	pm.mutex.RUnlock()
+
+	if len(activePeers) == 0 {
+		return
+	}
+
+	target := activePeers[rand.Intn(len(activePeers))]
+	if udpAddr := target.GetUDPAddr(); udpAddr != nil {
+		pm.sendPeerExchange(types.PeerExchange{Peers: pm.peerSample(target.ID())}, udpAddr)
+	}
+}
+
+func (pm *PeerManager) peerSample(exclude p2p.NodeID) []types.PeerInfo {
+	records := pm.peerBook.Sample(pm.shuffleLength, map[p2p.NodeID]bool{
+		pm.nodeID: true,
+		exclude:   true,
+	})
+
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	sample := make([]types.PeerInfo, 0, len(records))
+	for _, record := range records {
+		_, connected := pm.peers[record.NodeID]
+		sample = append(sample, types.PeerInfo{
+			NodeID:    record.NodeID,
+			Address:   record.Address,
+			HttpPort:  record.HttpPort,
+			Connected: connected,
+		})
+	}
+	return sample
+}
+
+func (pm *PeerManager) sendPeerExchange(exchange types.PeerExchange, toAddr *net.UDPAddr) {
+	frames, err := pm.encodeMessage(proto.MessageTypePeerExchange, exchange)
+	if err != nil {
+		logger.Logger.Error("PEER EXCHANGE MARSHAL ERROR", zap.Error(err))
+		return
+	}
+
+	if err = pm.writeFrames(frames, toAddr); err != nil {
+		logger.Logger.Error("PEER EXCHANGE SEND ERROR", zap.Error(err))
+	}
 }
 
 func (pm *PeerManager) startHealthCheck() {
 	ticker := time.NewTicker(10 * time.Second)
 	reconnectTicker := time.NewTicker(30 * time.Second)
+	shuffleTicker := time.NewTicker(pm.shuffleInterval)
+	gossipTicker := time.NewTicker(pm.gossipInterval)
 
 	defer ticker.Stop()
 	defer reconnectTicker.Stop()
+	defer shuffleTicker.Stop()
+	defer gossipTicker.Stop()
 
 	for {
 		select {
@@ -714,11 +1031,18 @@ func (pm *PeerManager) startHealthCheck() {
 			pm.updateLastConnCheck()
 		case <-reconnectTicker.C:
 			pm.checkAndReconnect()
+		case <-shuffleTicker.C:
+			pm.shufflePeers()
+			pm.syncState()
+			pm.peerBook.Save()
+		case <-gossipTicker.C:
+			pm.gossipState()
 		}
 	}
 }
 
-func (pm *PeerManager) reconnectToPeers() {
+// reconnectToPeers tries the given peers from the peer book until the active view is full
+func (pm *PeerManager) reconnectToPeers(records []PeerRecord) {
 	pm.peeringMutex.RLock()
 	defer pm.peeringMutex.RUnlock()
 
@@ -728,39 +1052,34 @@ func (pm *PeerManager) reconnectToPeers() {
 		pm.reconnectMutex.Unlock()
 	}()
 
-	pm.reconnectMutex.RLock()
-	initialPeers := pm.knownPeers
-	pm.reconnectMutex.RUnlock()
-
-	logger.Logger.Debug("ATTEMPTING TO RECONNECT TO NETWORK",
-		zap.Any("Initial peers", initialPeers),
+	logger.Logger.Debug("ATTEMPTING TO FILL ACTIVE VIEW",
+		zap.Int("Candidates", len(records)),
 	)
 
-	for _, address := range initialPeers {
+	for _, record := range records {
 		select {
 		case <-pm.ctx.Done():
 			return
 		default:
 		}
 
-		if address.String() == "" {
-			continue
+		if pm.activeViewFull() {
+			return
 		}
 
-		logger.Logger.Debug("RECONNECTING: Trying peer", zap.String("address", address.String()))
+		logger.Logger.Debug("RECONNECTING: Trying peer",
+			zap.Any("nodeID", record.NodeID),
+			zap.String("address", record.Address))
 
-		peer, err := pm.AddPeer(address.String(), false)
+		peer, err := pm.AddPeer(record.Address, true)
 		if err != nil {
-			logger.Logger.Error("RECONNECTION FAILED", zap.Error(err))
-			time.Sleep(2 * time.Second)
+			logger.Logger.Debug("RECONNECTION FAILED", zap.String("address", record.Address), zap.Error(err))
 			continue
 		}
 
 		logger.Logger.Debug("RECONNECTION SUCCESSFUL",
 			zap.String("peerID", string(peer.ID())),
 			zap.String("address", peer.Address()))
-
-		break
 	}
 
 	pm.mutex.RLock()
@@ -772,23 +1091,34 @@ func (pm *PeerManager) reconnectToPeers() {
 	}
 }
 
+// checkAndReconnect promotes the best peers of the passive view while the active view has room
 func (pm *PeerManager) checkAndReconnect() {
 	pm.mutex.RLock()
-	activePeers := len(pm.peers)
+	missing := pm.activeViewSize - len(pm.peers)
+	exclude := map[p2p.NodeID]bool{pm.nodeID: true}
+	for nodeID := range pm.peers {
+		exclude[nodeID] = true
+	}
 	pm.mutex.RUnlock()
 
-	pm.reconnectMutex.RLock()
-	reconnecting := pm.reconnecting
-	initialPeers := pm.knownPeers
-	pm.reconnectMutex.RUnlock()
+	if missing <= 0 {
+		return
+	}
+
+	pm.reconnectMutex.Lock()
+	defer pm.reconnectMutex.Unlock()
 
-	if activePeers < len(initialPeers) && !reconnecting && len(initialPeers) > 0 {
-		pm.reconnectMutex.Lock()
-		pm.reconnecting = true
-		pm.reconnectMutex.Unlock()
+	if pm.reconnecting {
+		return
+	}
 
-		go pm.reconnectToPeers()
+	records := pm.peerBook.Best(missing, exclude)
+	if len(records) == 0 {
+		return
 	}
+
+	pm.reconnecting = true
+	go pm.reconnectToPeers(records)
 }
 
 func (pm *PeerManager) updateLastConnCheck() {
@@ -808,6 +1138,7 @@ func (pm *PeerManager) updateLastConnCheck() {
 			if ok {
 				if nodeMetrics.Timestamp.Add(30 * time.Second).Before(time.Now()) {
 					pm.RemovePeer(nodeID)
+					pm.peerBook.MarkFailed(nodeID, "")
 
 					pm.reconnectMutex.Lock()
 					if _, exists := pm.missingMetrics[nodeID]; exists {
@@ -817,6 +1148,7 @@ func (pm *PeerManager) updateLastConnCheck() {
 				}
 			} else if isMissing && missingMetrics.Add(30*time.Second).Before(time.Now()) {
 				pm.RemovePeer(nodeID)
+				pm.peerBook.MarkFailed(nodeID, "")
 
 				pm.reconnectMutex.Lock()
 				if _, exists := pm.missingMetrics[nodeID]; exists {
@@ -838,8 +1170,6 @@ func (pm *PeerManager) sendMetricsToPeers() {
 	localMetrics.Address = pm.address
 	localMetrics.HttpPort = pm.httpPort
 
-	metricsMsg := proto.NewMessage(proto.MessageTypeMetrics, localMetrics)
-
 	//logger.Logger.Debug("PREPARING TO SEND METRICS",
 	//	zap.Any("Local Node ID", localMetrics.NodeID),
 	//	zap.Float64("Memory Usage", localMetrics.MemoryUsage),
@@ -847,19 +1177,12 @@ func (pm *PeerManager) sendMetricsToPeers() {
 	//	zap.String("Local Address", localMetrics.Address),
 	//)
 
-	msgBytes, err := json.Marshal(metricsMsg)
+	frames, err := pm.encodeMessage(proto.MessageTypeMetrics, localMetrics)
 	if err != nil {
 		logger.Logger.Error("METRICS SERIALIZATION ERROR", zap.Error(err))
 		return
 	}
 
-	if len(msgBytes) > 1400 {
-		logger.Logger.Warn("Metrics message size may exceed UDP MTU",
-			zap.Int("size", len(msgBytes)))
-	}
-
-	msgBytes = append(msgBytes, '\n')
-
 	pm.mutex.RLock()
 	activePeers := make([]*Peer, 0, len(pm.peers))
 	for _, peer := range pm.peers {
@@ -892,9 +1215,10 @@ func (pm *PeerManager) sendMetricsToPeers() {
 				zap.Any("UDP Address", udpAddr),
 			)
 
-			_, err := pm.conn.WriteToUDP(msgBytes, udpAddr)
-			if err == nil {
-				return
+			if err := pm.writeFrames(frames, udpAddr); err != nil {
+				logger.Logger.Error("METRICS SEND ERROR",
+					zap.String("peerID", string(peer.ID())),
+					zap.Error(err))
 			}
 		}(peer)
 	}
@@ -915,3 +1239,25 @@ func (pm *PeerManager) LocalPeers() map[p2p.NodeID]*Peer {
 
 	return localPeers
 }
+
+func (pm *PeerManager) encodeMessage(msgType proto.MessageType, payload interface{}) ([][]byte, error) {
+	msg, err := pm.codec.NewMessage(msgType, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pm.identity.Seal(msg); err != nil {
+		return nil, err
+	}
+
+	return pm.codec.Encode(msg)
+}
+
+func (pm *PeerManager) writeFrames(frames [][]byte, toAddr *net.UDPAddr) error {
+	for _, frame := range frames {
+		if _, err := pm.conn.WriteToUDP(frame, toAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
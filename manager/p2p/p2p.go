@@ -21,6 +21,25 @@ type PeerManager interface {
 	GetPeerId() NodeID
 	AddPeer(address string, remote bool) (Peer, error)
 	RemovePeer(id NodeID)
+	ForgetPeer(id NodeID)
+	BanPeer(id NodeID, duration time.Duration)
+	UnbanPeer(id NodeID)
+	Peers() []PeerState
+}
+
+// PeerState is the view of a known peer exposed to operators
+type PeerState struct {
+	NodeID      NodeID    `json:"node_id"`
+	Address     string    `json:"address"`
+	HttpPort    int       `json:"http_port"`
+	Active      bool      `json:"active"`
+	Remote      bool      `json:"remote"`
+	Score       float64   `json:"score"`
+	Failures    int       `json:"failures"`
+	RTT         float64   `json:"rtt_ms"`
+	LastSeen    time.Time `json:"last_seen"`
+	LastMessage time.Time `json:"last_message,omitempty"`
+	BannedUntil time.Time `json:"banned_until,omitempty"`
 }
 
 type Message interface {
@@ -37,12 +56,64 @@ type MetricsCollector interface {
 	CollectLocalMetrics() NodeMetrics
 	UpdateNodeMetrics(metrics NodeMetrics, latency float64)
 	CalculateScore(nodeID NodeID) Score
+	SetChainState(state ChainState)
+	Latency(nodeID NodeID) float64
 	CreateMetricsMiddleware(method string) func(next saiService.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error)
 }
 
 type LoadBalancer interface {
 	ShouldHandleRequest() (bool, NodeID)
-	CreateLoadBalancerMiddleware(method string) func(next saiService.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error)
+	SelectNode(strategy Strategy, request RequestInfo) (bool, NodeID)
+	CreateLoadBalancerMiddleware(method string, strategy Strategy) func(next saiService.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error)
+	CreateChainLoadBalancerMiddleware(method string, strategy Strategy) func(next saiService.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error)
+	SetDraining(enabled bool)
+	Draining() bool
+	DecisionTable() DecisionTable
+}
+
+// DecisionTable shows which nodes the balancer may route to and where each handler currently sends requests
+type DecisionTable struct {
+	NodeID       NodeID               `json:"node_id"`
+	Draining     bool                 `json:"draining"`
+	Candidates   []CandidateState     `json:"candidates"`
+	Decisions    []Decision           `json:"decisions"`
+	OpenCircuits map[NodeID]time.Time `json:"open_circuits"`
+}
+
+type CandidateState struct {
+	NodeID   NodeID      `json:"node_id"`
+	Metrics  NodeMetrics `json:"metrics"`
+	Score    float64     `json:"score"`
+	Eligible bool        `json:"eligible"`
+	Reason   string      `json:"reason,omitempty"`
+}
+
+type Decision struct {
+	Method   string `json:"method"`
+	Strategy string `json:"strategy"`
+	Target   NodeID `json:"target"`
+	Local    bool   `json:"local"`
+}
+
+// Strategy picks the node that should serve a request among the known candidates
+type Strategy interface {
+	Name() string
+	Select(local NodeID, candidates []Candidate, request RequestInfo) NodeID
+}
+
+type Candidate struct {
+	NodeID  NodeID
+	Metrics NodeMetrics
+	Score   Score
+}
+
+type RequestInfo struct {
+	Method    string
+	Route     string
+	ClientIP  string
+	MinHeight int64
+	// ChainBound requests are served from the chain whose state the nodes report, peers out of sync with it are skipped
+	ChainBound bool
 }
 
 type NodeMetrics struct {
@@ -56,6 +127,15 @@ type NodeMetrics struct {
 	ActiveRequests int       `json:"active_requests"`
 	ErrorRate      float64   `json:"error_rate"`
 	Timestamp      time.Time `json:"timestamp"`
+	Draining       bool      `json:"draining"`
+	ChainState
+}
+
+// ChainState describes the sync state of the blockchain node behind a manager
+type ChainState struct {
+	ChainID           string `json:"chain_id"`
+	LatestBlockHeight int64  `json:"latest_block_height"`
+	CatchingUp        bool   `json:"catching_up"`
 }
 
 type Score struct {
@@ -73,10 +153,22 @@ type Weights struct {
 	Latency float64
 }
 
+// SharedState is a key-value facility replicated across the mesh. Counters add up the increments
+// of all nodes; values resolve concurrent writes by the latest timestamp. Both keep working while
+// the cluster is partitioned and converge once the partitions can talk again.
+type SharedState interface {
+	Increment(key string, delta uint64, ttl time.Duration) uint64
+	Counter(key string) uint64
+	Put(key, value string, ttl time.Duration)
+	Get(key string) (string, bool)
+	Delete(key string)
+}
+
 type Network interface {
 	Start() error
 	Stop()
 	PeerManager() PeerManager
 	MetricsCollector() MetricsCollector
 	LoadBalancer() LoadBalancer
+	SharedState() SharedState
 }
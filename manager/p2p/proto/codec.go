@@ -0,0 +1,322 @@
+package proto
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+)
+
+const (
+	frameMagic      byte = 0xA7
+	frameHeaderSize      = 14
+
+	// DefaultMTU keeps every datagram below the common path MTU once IP and UDP headers are added.
+	DefaultMTU = 1200
+	// MinMTU keeps the fragments of the largest message within the 16 bit fragment count,
+	// MaxMTU is the largest UDP payload.
+	MinMTU = 512
+	MaxMTU = 65507
+	// MaxMessageSize bounds the size of a reassembled envelope.
+	MaxMessageSize = 64 * 1024
+
+	fragmentTimeout = 5 * time.Second
+	maxPending      = 1024
+)
+
+var (
+	ErrMalformedFrame  = errors.New("malformed frame")
+	ErrMessageTooLarge = errors.New("message exceeds maximum size")
+	ErrUnsignedMessage = errors.New("unsigned legacy message")
+)
+
+var messageKinds = map[MessageType]uint64{
+	MessageTypeJoinRequest:  1,
+	MessageTypeJoinResponse: 2,
+	MessageTypeMetrics:      3,
+	MessageTypePeerExchange: 4,
+	MessageTypeState:        5,
+}
+
+// Codec converts messages to and from UDP datagrams. Binary envelopes are split into
+// MTU sized frames; signed JSON datagrams of nodes that predate the binary format are still
+// accepted on decode. The unsigned JSON of nodes that predate message signing is rejected.
+type Codec struct {
+	mtu        int
+	legacyJSON bool
+	nextID     uint32
+	pending    map[string]*partialMessage
+	mutex      sync.Mutex
+}
+
+type partialMessage struct {
+	chunks   [][]byte
+	received int
+	size     int
+	created  time.Time
+}
+
+type legacyMessage struct {
+	MsgType   MessageType     `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	From      p2p.NodeID      `json:"from"`
+	PubKey    []byte          `json:"pub_key"`
+	Nonce     uint64          `json:"nonce"`
+	Timestamp int64           `json:"timestamp"`
+	Signature []byte          `json:"signature"`
+}
+
+func NewCodec(mtu int, legacyJSON bool) *Codec {
+	if mtu <= frameHeaderSize {
+		mtu = DefaultMTU
+	}
+
+	return &Codec{
+		mtu:        mtu,
+		legacyJSON: legacyJSON,
+		nextID:     uint32(time.Now().UnixNano()),
+		pending:    make(map[string]*partialMessage),
+	}
+}
+
+// NewMessage builds a message in the encoding this codec sends.
+func (c *Codec) NewMessage(msgType MessageType, payload interface{}) (*Message, error) {
+	if c.legacyJSON {
+		return NewLegacyMessage(msgType, payload)
+	}
+	return NewMessage(msgType, payload)
+}
+
+// Encode serializes a signed message into one or more datagrams.
+func (c *Codec) Encode(msg *Message) ([][]byte, error) {
+	if msg.Encoding == EncodingJSON {
+		data, err := json.Marshal(legacyMessage{
+			MsgType:   msg.MsgType,
+			Payload:   msg.MsgPayload,
+			From:      msg.From,
+			PubKey:    msg.PubKey,
+			Nonce:     msg.Nonce,
+			Timestamp: msg.Timestamp,
+			Signature: msg.Signature,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{data}, nil
+	}
+
+	envelope, err := marshalEnvelope(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(envelope) > MaxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	chunkSize := c.mtu - frameHeaderSize
+	count := (len(envelope) + chunkSize - 1) / chunkSize
+	msgID := atomic.AddUint32(&c.nextID, 1)
+	frames := make([][]byte, 0, count)
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(envelope) {
+			end = len(envelope)
+		}
+		chunk := envelope[i*chunkSize : end]
+
+		frame := make([]byte, frameHeaderSize, frameHeaderSize+len(chunk))
+		frame[0] = frameMagic
+		frame[1] = byte(ProtocolVersion)
+		binary.BigEndian.PutUint32(frame[2:6], msgID)
+		binary.BigEndian.PutUint16(frame[6:8], uint16(i))
+		binary.BigEndian.PutUint16(frame[8:10], uint16(count))
+		binary.BigEndian.PutUint32(frame[10:14], uint32(len(chunk)))
+		frames = append(frames, append(frame, chunk...))
+	}
+
+	return frames, nil
+}
+
+// Decode parses a datagram received from the given address. It returns a nil message
+// without error while fragments of a larger message are still outstanding.
+// The codec takes ownership of packet.
+func (c *Codec) Decode(packet []byte, from string) (*Message, error) {
+	if len(packet) == 0 {
+		return nil, ErrMalformedFrame
+	}
+
+	if packet[0] == '{' {
+		return decodeLegacy(packet)
+	}
+
+	if packet[0] != frameMagic || len(packet) < frameHeaderSize {
+		return nil, ErrMalformedFrame
+	}
+
+	if uint32(packet[1]) > ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d", packet[1])
+	}
+
+	msgID := binary.BigEndian.Uint32(packet[2:6])
+	index := int(binary.BigEndian.Uint16(packet[6:8]))
+	count := int(binary.BigEndian.Uint16(packet[8:10]))
+	length := int(binary.BigEndian.Uint32(packet[10:14]))
+	chunk := packet[frameHeaderSize:]
+
+	if count == 0 || index >= count || length != len(chunk) {
+		return nil, ErrMalformedFrame
+	}
+
+	if count == 1 {
+		return unmarshalEnvelope(chunk)
+	}
+
+	envelope, err := c.reassemble(fmt.Sprintf("%s/%d", from, msgID), index, count, chunk)
+	if err != nil || envelope == nil {
+		return nil, err
+	}
+
+	return unmarshalEnvelope(envelope)
+}
+
+func (c *Codec) reassemble(key string, index, count int, chunk []byte) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for k, p := range c.pending {
+		if now.Sub(p.created) > fragmentTimeout {
+			delete(c.pending, k)
+		}
+	}
+
+	partial, exists := c.pending[key]
+	if !exists {
+		if len(c.pending) >= maxPending {
+			return nil, errors.New("too many incomplete messages")
+		}
+		partial = &partialMessage{chunks: make([][]byte, count), created: now}
+		c.pending[key] = partial
+	}
+
+	if len(partial.chunks) != count {
+		delete(c.pending, key)
+		return nil, ErrMalformedFrame
+	}
+
+	if partial.chunks[index] != nil {
+		return nil, nil
+	}
+
+	partial.size += len(chunk)
+	if partial.size > MaxMessageSize {
+		delete(c.pending, key)
+		return nil, ErrMessageTooLarge
+	}
+
+	partial.chunks[index] = chunk
+	partial.received++
+
+	if partial.received < count {
+		return nil, nil
+	}
+
+	delete(c.pending, key)
+
+	envelope := make([]byte, 0, partial.size)
+	for _, part := range partial.chunks {
+		envelope = append(envelope, part...)
+	}
+
+	return envelope, nil
+}
+
+func decodeLegacy(packet []byte) (*Message, error) {
+	var legacy legacyMessage
+	if err := json.Unmarshal(packet, &legacy); err != nil {
+		return nil, fmt.Errorf("failed to decode legacy message: %w", err)
+	}
+
+	if legacy.From == "" || len(legacy.PubKey) == 0 || len(legacy.Signature) == 0 {
+		return nil, ErrUnsignedMessage
+	}
+
+	return &Message{
+		MsgType:    legacy.MsgType,
+		Encoding:   EncodingJSON,
+		MsgPayload: legacy.Payload,
+		From:       legacy.From,
+		PubKey:     legacy.PubKey,
+		Nonce:      legacy.Nonce,
+		Timestamp:  legacy.Timestamp,
+		Signature:  legacy.Signature,
+	}, nil
+}
+
+func marshalEnvelope(msg *Message) ([]byte, error) {
+	kind, ok := messageKinds[msg.MsgType]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %q", msg.MsgType)
+	}
+
+	var b []byte
+	b = appendVarint(b, 1, uint64(msg.Version))
+	b = appendVarint(b, 2, kind)
+	b = appendString(b, 3, string(msg.From))
+	b = appendBytes(b, 4, msg.PubKey)
+	b = appendFixed64(b, 5, msg.Nonce)
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, protowire.EncodeZigZag(msg.Timestamp))
+	b = appendBytes(b, 7, msg.MsgPayload)
+	b = appendBytes(b, 8, msg.Signature)
+
+	return b, nil
+}
+
+func unmarshalEnvelope(data []byte) (*Message, error) {
+	msg := &Message{Encoding: EncodingProto}
+	var kind uint64
+
+	err := decodeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch num {
+		case 1:
+			msg.Version = uint32(decodeVarint(typ, value))
+		case 2:
+			kind = decodeVarint(typ, value)
+		case 3:
+			msg.From = p2p.NodeID(value)
+		case 4:
+			msg.PubKey = value
+		case 5:
+			msg.Nonce = decodeFixed64(typ, value)
+		case 6:
+			msg.Timestamp = protowire.DecodeZigZag(decodeVarint(typ, value))
+		case 7:
+			msg.MsgPayload = value
+		case 8:
+			msg.Signature = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode envelope: %w", err)
+	}
+
+	for msgType, k := range messageKinds {
+		if k == kind {
+			msg.MsgType = msgType
+			return msg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown message kind %d", kind)
+}
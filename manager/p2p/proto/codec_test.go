@@ -0,0 +1,259 @@
+package proto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/types"
+)
+
+func signed(t *testing.T, codec *Codec, msgType MessageType, payload interface{}) *Message {
+	msg, err := codec.NewMessage(msgType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg.From = "node-a"
+	msg.PubKey = bytes.Repeat([]byte{1}, 32)
+	msg.Nonce = 42
+	msg.Timestamp = 1729330600000000000
+	msg.Signature = bytes.Repeat([]byte{2}, 64)
+
+	return msg
+}
+
+func peerExchange(peers int) types.PeerExchange {
+	exchange := types.PeerExchange{Reply: true}
+	for i := 0; i < peers; i++ {
+		exchange.Peers = append(exchange.Peers, types.PeerInfo{
+			NodeID:   p2p.NodeID(fmt.Sprintf("node-%04d", i)),
+			Address:  fmt.Sprintf("10.0.%d.%d:9000", i/250, i%250),
+			HttpPort: 8080,
+		})
+	}
+	return exchange
+}
+
+func frame(msgID uint32, index, count int, chunk []byte) []byte {
+	header := make([]byte, frameHeaderSize)
+	header[0] = frameMagic
+	header[1] = byte(ProtocolVersion)
+	binary.BigEndian.PutUint32(header[2:6], msgID)
+	binary.BigEndian.PutUint16(header[6:8], uint16(index))
+	binary.BigEndian.PutUint16(header[8:10], uint16(count))
+	binary.BigEndian.PutUint32(header[10:14], uint32(len(chunk)))
+	return append(header, chunk...)
+}
+
+func assertMessage(t *testing.T, got, want *Message, payload types.PeerExchange) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatal("expected a decoded message")
+	}
+	if got.MsgType != want.MsgType || got.Encoding != want.Encoding || got.From != want.From || got.Nonce != want.Nonce ||
+		got.Timestamp != want.Timestamp || !bytes.Equal(got.PubKey, want.PubKey) || !bytes.Equal(got.Signature, want.Signature) {
+		t.Fatalf("unexpected message %+v", got)
+	}
+	if !bytes.Equal(got.SigningBytes(), want.SigningBytes()) {
+		t.Fatal("expected the signed bytes to survive the round trip")
+	}
+
+	var decoded types.PeerExchange
+	if err := got.DecodePayload(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, payload) {
+		t.Fatalf("unexpected payload %+v", decoded)
+	}
+}
+
+func TestEncodeSingleFrame(t *testing.T) {
+	codec := NewCodec(DefaultMTU, false)
+	payload := peerExchange(2)
+	msg := signed(t, codec, MessageTypePeerExchange, payload)
+
+	frames, err := codec.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 {
+		t.Fatalf("expected a single frame, got %d", len(frames))
+	}
+
+	header := frames[0][:frameHeaderSize]
+	if header[0] != frameMagic || uint32(header[1]) != ProtocolVersion {
+		t.Fatalf("unexpected frame magic or version % x", header[:2])
+	}
+	if index, count := binary.BigEndian.Uint16(header[6:8]), binary.BigEndian.Uint16(header[8:10]); index != 0 || count != 1 {
+		t.Fatalf("unexpected fragment %d of %d", index, count)
+	}
+	if length := binary.BigEndian.Uint32(header[10:14]); int(length) != len(frames[0])-frameHeaderSize {
+		t.Fatalf("expected the header to carry the chunk length, got %d", length)
+	}
+
+	decoded, err := NewCodec(DefaultMTU, false).Decode(frames[0], "10.0.0.1:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMessage(t, decoded, msg, payload)
+}
+
+func TestFragmentsReassembleInAnyOrder(t *testing.T) {
+	codec := NewCodec(128, false)
+	payload := peerExchange(20)
+	msg := signed(t, codec, MessageTypePeerExchange, payload)
+
+	frames, err := codec.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) < 3 {
+		t.Fatalf("expected the message to be fragmented, got %d frames", len(frames))
+	}
+	for _, f := range frames {
+		if len(f) > 128 {
+			t.Fatalf("expected frames within the MTU, got %d bytes", len(f))
+		}
+	}
+
+	receiver := NewCodec(128, false)
+	var decoded *Message
+	for i := len(frames) - 1; i >= 0; i-- {
+		// a repeated fragment is ignored
+		if i == len(frames)-1 {
+			if _, err := receiver.Decode(frames[i], "10.0.0.1:9000"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		decoded, err = receiver.Decode(frames[i], "10.0.0.1:9000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && decoded != nil {
+			t.Fatalf("expected no message before the last fragment, got one after fragment %d", i)
+		}
+	}
+
+	assertMessage(t, decoded, msg, payload)
+	if len(receiver.pending) != 0 {
+		t.Fatalf("expected the reassembled message to be released, %d pending", len(receiver.pending))
+	}
+}
+
+func TestMissingFragmentKeepsMessagePending(t *testing.T) {
+	codec := NewCodec(128, false)
+	frames, err := codec.Encode(signed(t, codec, MessageTypePeerExchange, peerExchange(20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := NewCodec(128, false)
+	for _, f := range frames[1:] {
+		msg, err := receiver.Decode(f, "10.0.0.1:9000")
+		if err != nil || msg != nil {
+			t.Fatalf("expected an incomplete message to stay pending, got %v %v", msg, err)
+		}
+	}
+
+	// fragments are keyed by sender, the missing one from another address does not complete the message
+	if msg, err := receiver.Decode(frames[0], "10.0.0.2:9000"); err != nil || msg != nil {
+		t.Fatalf("expected fragments of another sender to be kept apart, got %v %v", msg, err)
+	}
+	if len(receiver.pending) != 2 {
+		t.Fatalf("expected two pending messages, got %d", len(receiver.pending))
+	}
+}
+
+func TestOversizedMessagesAreRejected(t *testing.T) {
+	codec := NewCodec(DefaultMTU, false)
+	if _, err := codec.Encode(signed(t, codec, MessageTypePeerExchange, peerExchange(3000))); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected an oversized message not to be encoded, got %v", err)
+	}
+
+	receiver := NewCodec(DefaultMTU, false)
+	chunk := make([]byte, DefaultMTU-frameHeaderSize)
+	count := MaxMessageSize/len(chunk) + 2
+
+	var err error
+	for i := 0; i < count && err == nil; i++ {
+		_, err = receiver.Decode(frame(7, i, count, chunk), "10.0.0.1:9000")
+	}
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected fragments adding up past the maximum size to be rejected, got %v", err)
+	}
+	if len(receiver.pending) != 0 {
+		t.Fatalf("expected the oversized message to be dropped, %d pending", len(receiver.pending))
+	}
+}
+
+func TestMalformedFramesAreRejected(t *testing.T) {
+	chunk := []byte{1, 2, 3}
+
+	future := frame(1, 0, 1, chunk)
+	future[1] = byte(ProtocolVersion + 1)
+
+	badLength := frame(1, 0, 1, chunk)
+	binary.BigEndian.PutUint32(badLength[10:14], 4)
+
+	tests := map[string][]byte{
+		"empty":           {},
+		"bad magic":       append([]byte{0x01}, frame(1, 0, 1, chunk)[1:]...),
+		"short header":    frame(1, 0, 1, nil)[:frameHeaderSize-1],
+		"future version":  future,
+		"no fragments":    frame(1, 0, 0, chunk),
+		"index past end":  frame(1, 2, 2, chunk),
+		"length mismatch": badLength,
+	}
+
+	for name, packet := range tests {
+		t.Run(name, func(t *testing.T) {
+			if msg, err := NewCodec(DefaultMTU, false).Decode(packet, "10.0.0.1:9000"); err == nil {
+				t.Fatalf("expected the frame to be rejected, got %+v", msg)
+			}
+		})
+	}
+
+	receiver := NewCodec(DefaultMTU, false)
+	if _, err := receiver.Decode(frame(9, 0, 3, chunk), "10.0.0.1:9000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiver.Decode(frame(9, 1, 4, chunk), "10.0.0.1:9000"); !errors.Is(err, ErrMalformedFrame) {
+		t.Fatalf("expected a fragment with another total to be rejected, got %v", err)
+	}
+}
+
+func TestLegacyJSON(t *testing.T) {
+	codec := NewCodec(DefaultMTU, true)
+	payload := peerExchange(2)
+	msg := signed(t, codec, MessageTypePeerExchange, payload)
+
+	frames, err := codec.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0][0] != '{' {
+		t.Fatalf("expected a single JSON datagram, got %d frames", len(frames))
+	}
+
+	// a node sending the binary format still reads legacy datagrams
+	decoded, err := NewCodec(DefaultMTU, false).Decode(frames[0], "10.0.0.1:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMessage(t, decoded, msg, payload)
+
+	unsigned := []byte(`{"type":"peer_exchange","payload":{"peers":[]}}`)
+	if _, err := NewCodec(DefaultMTU, true).Decode(unsigned, "10.0.0.1:9000"); !errors.Is(err, ErrUnsignedMessage) {
+		t.Fatalf("expected the unsigned messages of nodes that predate signing to be rejected, got %v", err)
+	}
+
+	if _, err := NewCodec(DefaultMTU, true).Decode([]byte(`{"type":`), "10.0.0.1:9000"); err == nil {
+		t.Fatal("expected broken JSON to be rejected")
+	}
+}
@@ -1,21 +1,44 @@
 package proto
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
 )
 
+// ProtocolVersion is the current version of the binary wire format.
+// Version 0 denotes legacy JSON messages.
+const ProtocolVersion uint32 = 1
+
 type MessageType string
 
 const (
 	MessageTypeJoinRequest  MessageType = "join_request"
 	MessageTypeJoinResponse MessageType = "join_response"
 	MessageTypeMetrics      MessageType = "metrics"
+	MessageTypePeerExchange MessageType = "peer_exchange"
+	MessageTypeState        MessageType = "state"
+)
+
+type Encoding uint8
+
+const (
+	EncodingJSON Encoding = iota
+	EncodingProto
 )
 
 type Message struct {
-	MsgType    MessageType `json:"type"`
-	MsgPayload interface{} `json:"payload"`
+	Version    uint32
+	MsgType    MessageType
+	Encoding   Encoding
+	MsgPayload []byte
+	From       p2p.NodeID
+	PubKey     []byte
+	Nonce      uint64
+	Timestamp  int64
+	Signature  []byte
 }
 
 func (m *Message) Type() string {
@@ -26,20 +49,66 @@ func (m *Message) Payload() interface{} {
 	return m.MsgPayload
 }
 
-func NewMessage(msgType MessageType, payload interface{}) *Message {
-	return &Message{
-		MsgType:    msgType,
-		MsgPayload: payload,
+// SigningBytes returns the canonical byte representation covered by the signature.
+func (m *Message) SigningBytes() []byte {
+	buf := make([]byte, 0, len(m.MsgType)+len(m.From)+len(m.PubKey)+len(m.MsgPayload)+23)
+
+	if m.Version > 0 {
+		buf = binary.BigEndian.AppendUint32(buf, m.Version)
 	}
+
+	buf = append(buf, m.MsgType...)
+	buf = append(buf, 0)
+	buf = append(buf, m.From...)
+	buf = append(buf, 0)
+	buf = append(buf, m.PubKey...)
+	buf = binary.BigEndian.AppendUint64(buf, m.Nonce)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(m.Timestamp))
+	buf = append(buf, m.MsgPayload...)
+
+	return buf
 }
 
-func UnmarshalPayload(payload interface{}, target interface{}) error {
-	bytes, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+// DecodePayload decodes the message payload into target according to the message encoding.
+func (m *Message) DecodePayload(target interface{}) error {
+	if m.Encoding == EncodingJSON {
+		if err := json.Unmarshal(m.MsgPayload, target); err != nil {
+			return fmt.Errorf("failed to unmarshal payload: %w", err)
+		}
+		return nil
 	}
-	if err := json.Unmarshal(bytes, target); err != nil {
+
+	if err := unmarshalPayload(m.MsgPayload, target); err != nil {
 		return fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
 	return nil
 }
+
+// NewMessage builds a message with the payload encoded in the binary wire format.
+func NewMessage(msgType MessageType, payload interface{}) (*Message, error) {
+	payloadBytes, err := marshalPayload(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	return &Message{
+		Version:    ProtocolVersion,
+		MsgType:    msgType,
+		Encoding:   EncodingProto,
+		MsgPayload: payloadBytes,
+	}, nil
+}
+
+// NewLegacyMessage builds a message with a JSON payload understood by nodes that sign messages but predate the binary format.
+func NewLegacyMessage(msgType MessageType, payload interface{}) (*Message, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	return &Message{
+		MsgType:    msgType,
+		Encoding:   EncodingJSON,
+		MsgPayload: payloadBytes,
+	}, nil
+}
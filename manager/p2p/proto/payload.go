@@ -0,0 +1,428 @@
+package proto
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/types"
+)
+
+// Field numbers follow the messages declared in wire.proto.
+
+func marshalPayload(payload interface{}) ([]byte, error) {
+	switch p := payload.(type) {
+	case types.JoinRequest:
+		return appendJoinRequest(nil, &p), nil
+	case *types.JoinRequest:
+		return appendJoinRequest(nil, p), nil
+	case types.JoinResponse:
+		return appendJoinResponse(nil, &p), nil
+	case *types.JoinResponse:
+		return appendJoinResponse(nil, p), nil
+	case p2p.NodeMetrics:
+		return appendNodeMetrics(nil, &p), nil
+	case *p2p.NodeMetrics:
+		return appendNodeMetrics(nil, p), nil
+	case types.PeerExchange:
+		return appendPeerExchange(nil, &p), nil
+	case *types.PeerExchange:
+		return appendPeerExchange(nil, p), nil
+	case types.StateDelta:
+		return appendStateDelta(nil, &p), nil
+	case *types.StateDelta:
+		return appendStateDelta(nil, p), nil
+	default:
+		return nil, fmt.Errorf("unsupported payload type %T", payload)
+	}
+}
+
+func unmarshalPayload(data []byte, target interface{}) error {
+	switch t := target.(type) {
+	case *types.JoinRequest:
+		return decodeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			return decodeJoinRequestField(t, num, typ, value)
+		})
+	case *types.JoinResponse:
+		return decodeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			return decodeJoinResponseField(t, num, typ, value)
+		})
+	case *p2p.NodeMetrics:
+		return decodeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			return decodeNodeMetricsField(t, num, typ, value)
+		})
+	case *types.PeerExchange:
+		return decodeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			return decodePeerExchangeField(t, num, typ, value)
+		})
+	case *types.StateDelta:
+		return decodeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			return decodeStateDeltaField(t, num, typ, value)
+		})
+	default:
+		return fmt.Errorf("unsupported payload type %T", target)
+	}
+}
+
+func appendJoinRequest(b []byte, r *types.JoinRequest) []byte {
+	b = appendString(b, 1, string(r.NodeID))
+	b = appendString(b, 2, r.Address)
+	b = appendVarint(b, 3, uint64(r.HttpPort))
+
+	visited := make([]string, 0, len(r.VisitedNodes))
+	for node, ok := range r.VisitedNodes {
+		if ok {
+			visited = append(visited, node)
+		}
+	}
+	sort.Strings(visited)
+	for _, node := range visited {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, node)
+	}
+
+	return appendBool(b, 5, r.Remote)
+}
+
+func appendJoinResponse(b []byte, r *types.JoinResponse) []byte {
+	b = appendBool(b, 1, r.Success)
+	b = appendString(b, 2, string(r.NodeID))
+	b = appendString(b, 3, r.Error)
+	for i := range r.AlternativePeers {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendPeerInfo(nil, &r.AlternativePeers[i]))
+	}
+	b = appendVarint(b, 5, uint64(r.NATPort))
+	return appendVarint(b, 6, uint64(r.HttpPort))
+}
+
+func appendPeerInfo(b []byte, p *types.PeerInfo) []byte {
+	b = appendString(b, 1, string(p.NodeID))
+	b = appendString(b, 2, p.Address)
+	b = appendVarint(b, 3, uint64(p.HttpPort))
+	return appendBool(b, 4, p.Connected)
+}
+
+func appendPeerExchange(b []byte, p *types.PeerExchange) []byte {
+	for i := range p.Peers {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendPeerInfo(nil, &p.Peers[i]))
+	}
+	return appendBool(b, 2, p.Reply)
+}
+
+func appendStateDelta(b []byte, d *types.StateDelta) []byte {
+	for i := range d.Counters {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendCounterEntry(nil, &d.Counters[i]))
+	}
+	for i := range d.Registers {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendRegisterEntry(nil, &d.Registers[i]))
+	}
+	return b
+}
+
+func appendCounterEntry(b []byte, c *types.CounterEntry) []byte {
+	b = appendString(b, 1, c.Key)
+	b = appendString(b, 2, string(c.NodeID))
+	b = appendVarint(b, 3, c.Value)
+	return appendVarint(b, 4, protowire.EncodeZigZag(c.Expires))
+}
+
+func appendRegisterEntry(b []byte, r *types.RegisterEntry) []byte {
+	b = appendString(b, 1, r.Key)
+	b = appendString(b, 2, r.Value)
+	b = appendVarint(b, 3, protowire.EncodeZigZag(r.Timestamp))
+	b = appendString(b, 4, string(r.NodeID))
+	b = appendVarint(b, 5, protowire.EncodeZigZag(r.Expires))
+	return appendBool(b, 6, r.Deleted)
+}
+
+func appendNodeMetrics(b []byte, m *p2p.NodeMetrics) []byte {
+	b = appendString(b, 1, string(m.NodeID))
+	b = appendString(b, 2, m.Address)
+	b = appendVarint(b, 3, uint64(m.HttpPort))
+	b = appendDouble(b, 4, m.CPUUsage)
+	b = appendDouble(b, 5, m.MemoryUsage)
+	b = appendDouble(b, 6, m.RequestsPerSec)
+	b = appendDouble(b, 7, m.AverageLatency)
+	b = appendVarint(b, 8, uint64(m.ActiveRequests))
+	b = appendDouble(b, 9, m.ErrorRate)
+	if !m.Timestamp.IsZero() {
+		b = protowire.AppendTag(b, 10, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(m.Timestamp.UnixNano()))
+	}
+	b = appendString(b, 11, m.ChainID)
+	b = appendVarint(b, 12, uint64(m.LatestBlockHeight))
+	b = appendBool(b, 13, m.CatchingUp)
+	return appendBool(b, 14, m.Draining)
+}
+
+func decodeJoinRequestField(r *types.JoinRequest, num protowire.Number, typ protowire.Type, value []byte) error {
+	switch num {
+	case 1:
+		r.NodeID = p2p.NodeID(value)
+	case 2:
+		r.Address = string(value)
+	case 3:
+		r.HttpPort = int(decodeVarint(typ, value))
+	case 4:
+		if r.VisitedNodes == nil {
+			r.VisitedNodes = make(map[string]bool)
+		}
+		r.VisitedNodes[string(value)] = true
+	case 5:
+		r.Remote = decodeBool(typ, value)
+	}
+	return nil
+}
+
+func decodeJoinResponseField(r *types.JoinResponse, num protowire.Number, typ protowire.Type, value []byte) error {
+	switch num {
+	case 1:
+		r.Success = decodeBool(typ, value)
+	case 2:
+		r.NodeID = p2p.NodeID(value)
+	case 3:
+		r.Error = string(value)
+	case 4:
+		var peer types.PeerInfo
+		if err := decodeFields(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			return decodePeerInfoField(&peer, num, typ, value)
+		}); err != nil {
+			return err
+		}
+		r.AlternativePeers = append(r.AlternativePeers, peer)
+	case 5:
+		r.NATPort = int(decodeVarint(typ, value))
+	case 6:
+		r.HttpPort = int(decodeVarint(typ, value))
+	}
+	return nil
+}
+
+func decodePeerInfoField(p *types.PeerInfo, num protowire.Number, typ protowire.Type, value []byte) error {
+	switch num {
+	case 1:
+		p.NodeID = p2p.NodeID(value)
+	case 2:
+		p.Address = string(value)
+	case 3:
+		p.HttpPort = int(decodeVarint(typ, value))
+	case 4:
+		p.Connected = decodeBool(typ, value)
+	}
+	return nil
+}
+
+func decodePeerExchangeField(p *types.PeerExchange, num protowire.Number, typ protowire.Type, value []byte) error {
+	switch num {
+	case 1:
+		var peer types.PeerInfo
+		if err := decodeFields(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			return decodePeerInfoField(&peer, num, typ, value)
+		}); err != nil {
+			return err
+		}
+		p.Peers = append(p.Peers, peer)
+	case 2:
+		p.Reply = decodeBool(typ, value)
+	}
+	return nil
+}
+
+func decodeNodeMetricsField(m *p2p.NodeMetrics, num protowire.Number, typ protowire.Type, value []byte) error {
+	switch num {
+	case 1:
+		m.NodeID = p2p.NodeID(value)
+	case 2:
+		m.Address = string(value)
+	case 3:
+		m.HttpPort = int(decodeVarint(typ, value))
+	case 4:
+		m.CPUUsage = decodeDouble(typ, value)
+	case 5:
+		m.MemoryUsage = decodeDouble(typ, value)
+	case 6:
+		m.RequestsPerSec = decodeDouble(typ, value)
+	case 7:
+		m.AverageLatency = decodeDouble(typ, value)
+	case 8:
+		m.ActiveRequests = int(decodeVarint(typ, value))
+	case 9:
+		m.ErrorRate = decodeDouble(typ, value)
+	case 10:
+		m.Timestamp = time.Unix(0, protowire.DecodeZigZag(decodeVarint(typ, value)))
+	case 11:
+		m.ChainID = string(value)
+	case 12:
+		m.LatestBlockHeight = int64(decodeVarint(typ, value))
+	case 13:
+		m.CatchingUp = decodeBool(typ, value)
+	case 14:
+		m.Draining = decodeBool(typ, value)
+	}
+	return nil
+}
+
+func decodeStateDeltaField(d *types.StateDelta, num protowire.Number, _ protowire.Type, value []byte) error {
+	switch num {
+	case 1:
+		var entry types.CounterEntry
+		if err := decodeFields(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			return decodeCounterEntryField(&entry, num, typ, value)
+		}); err != nil {
+			return err
+		}
+		d.Counters = append(d.Counters, entry)
+	case 2:
+		var entry types.RegisterEntry
+		if err := decodeFields(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			return decodeRegisterEntryField(&entry, num, typ, value)
+		}); err != nil {
+			return err
+		}
+		d.Registers = append(d.Registers, entry)
+	}
+	return nil
+}
+
+func decodeCounterEntryField(c *types.CounterEntry, num protowire.Number, typ protowire.Type, value []byte) error {
+	switch num {
+	case 1:
+		c.Key = string(value)
+	case 2:
+		c.NodeID = p2p.NodeID(value)
+	case 3:
+		c.Value = decodeVarint(typ, value)
+	case 4:
+		c.Expires = protowire.DecodeZigZag(decodeVarint(typ, value))
+	}
+	return nil
+}
+
+func decodeRegisterEntryField(r *types.RegisterEntry, num protowire.Number, typ protowire.Type, value []byte) error {
+	switch num {
+	case 1:
+		r.Key = string(value)
+	case 2:
+		r.Value = string(value)
+	case 3:
+		r.Timestamp = protowire.DecodeZigZag(decodeVarint(typ, value))
+	case 4:
+		r.NodeID = p2p.NodeID(value)
+	case 5:
+		r.Expires = protowire.DecodeZigZag(decodeVarint(typ, value))
+	case 6:
+		r.Deleted = decodeBool(typ, value)
+	}
+	return nil
+}
+
+// fieldDecoder receives each field of a message. Varint and fixed values are passed
+// as their raw wire bytes, length-delimited values as their contents.
+type fieldDecoder func(num protowire.Number, typ protowire.Type, value []byte) error
+
+func decodeFields(data []byte, decode fieldDecoder) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var value []byte
+		switch typ {
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return protowire.ParseError(m)
+			}
+			value, n = v, m
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value = data[:n]
+		}
+		data = data[n:]
+
+		if err := decode(num, typ, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	return appendVarint(b, num, 1)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	return appendFixed64(b, num, math.Float64bits(v))
+}
+
+func decodeVarint(typ protowire.Type, value []byte) uint64 {
+	if typ != protowire.VarintType {
+		return 0
+	}
+	v, _ := protowire.ConsumeVarint(value)
+	return v
+}
+
+func decodeFixed64(typ protowire.Type, value []byte) uint64 {
+	if typ != protowire.Fixed64Type {
+		return 0
+	}
+	v, _ := protowire.ConsumeFixed64(value)
+	return v
+}
+
+func decodeBool(typ protowire.Type, value []byte) bool {
+	return decodeVarint(typ, value) != 0
+}
+
+func decodeDouble(typ protowire.Type, value []byte) float64 {
+	return math.Float64frombits(decodeFixed64(typ, value))
+}
@@ -0,0 +1,329 @@
+// Package state replicates a small key-value store across the mesh with CRDTs:
+// grow-only counters that sum the shares of every node and last-writer-wins registers.
+package state
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+	"github.com/saiset-co/sai-interx-manager/p2p/types"
+)
+
+type counterShare struct {
+	value   uint64
+	expires int64
+	updated time.Time
+}
+
+type register struct {
+	entry   types.RegisterEntry
+	updated time.Time
+}
+
+// Store holds the replicated state of the local node. Every entry records when it last changed
+// locally, so recent changes, including those merged from peers, are gossiped onwards.
+type Store struct {
+	nodeID    p2p.NodeID
+	counters  map[string]map[p2p.NodeID]*counterShare
+	registers map[string]*register
+	mutex     sync.RWMutex
+}
+
+func NewStore(nodeID p2p.NodeID) *Store {
+	return &Store{
+		nodeID:    nodeID,
+		counters:  make(map[string]map[p2p.NodeID]*counterShare),
+		registers: make(map[string]*register),
+	}
+}
+
+// Increment adds delta to the local share of the counter and returns the cluster-wide total
+func (s *Store) Increment(key string, delta uint64, ttl time.Duration) uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	shares, exists := s.counters[key]
+	if !exists {
+		shares = make(map[p2p.NodeID]*counterShare)
+		s.counters[key] = shares
+	}
+
+	share, exists := shares[s.nodeID]
+	if !exists {
+		share = &counterShare{}
+		shares[s.nodeID] = share
+	}
+
+	share.value += delta
+	share.expires = maxInt64(share.expires, now.Add(ttl).UnixNano())
+	share.updated = now
+
+	return s.total(key, now.UnixNano())
+}
+
+// Counter returns the sum of all known shares of the counter
+func (s *Store) Counter(key string) uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.total(key, time.Now().UnixNano())
+}
+
+func (s *Store) Put(key, value string, ttl time.Duration) {
+	s.write(key, value, ttl, false)
+}
+
+// Delete replaces the value with a tombstone that outlives the value it removes
+func (s *Store) Delete(key string) {
+	s.mutex.RLock()
+	current, exists := s.registers[key]
+	s.mutex.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	ttl := time.Until(time.Unix(0, current.entry.Expires))
+	if ttl <= 0 {
+		return
+	}
+
+	s.write(key, "", ttl, true)
+}
+
+func (s *Store) Get(key string) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	current, exists := s.registers[key]
+	if !exists || current.entry.Deleted || current.entry.Expires <= time.Now().UnixNano() {
+		return "", false
+	}
+
+	return current.entry.Value, true
+}
+
+// Changes returns the entries that changed locally since the given time
+func (s *Store) Changes(since time.Time) types.StateDelta {
+	return s.collect(func(updated time.Time) bool {
+		return updated.After(since)
+	})
+}
+
+// Snapshot returns every live entry, used for anti-entropy with a single peer
+func (s *Store) Snapshot() types.StateDelta {
+	return s.collect(func(time.Time) bool {
+		return true
+	})
+}
+
+// Merge applies entries received from a peer and reports whether the local state changed.
+// Counter shares keep the highest value seen per node, registers keep the latest write.
+func (s *Store) Merge(delta types.StateDelta) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	changed := false
+
+	for _, entry := range delta.Counters {
+		if entry.Expires <= now.UnixNano() {
+			continue
+		}
+
+		shares, exists := s.counters[entry.Key]
+		if !exists {
+			shares = make(map[p2p.NodeID]*counterShare)
+			s.counters[entry.Key] = shares
+		}
+
+		share, exists := shares[entry.NodeID]
+		if !exists {
+			share = &counterShare{}
+			shares[entry.NodeID] = share
+		}
+
+		if entry.Value > share.value || entry.Expires > share.expires {
+			share.value = maxUint64(share.value, entry.Value)
+			share.expires = maxInt64(share.expires, entry.Expires)
+			share.updated = now
+			changed = true
+		}
+	}
+
+	for _, entry := range delta.Registers {
+		if entry.Expires <= now.UnixNano() {
+			continue
+		}
+
+		current, exists := s.registers[entry.Key]
+		if exists && !newer(entry, current.entry) {
+			continue
+		}
+
+		s.registers[entry.Key] = &register{entry: entry, updated: now}
+		changed = true
+	}
+
+	return changed
+}
+
+// Expire drops counter shares and registers whose time to live has passed
+func (s *Store) Expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UnixNano()
+
+	for key, shares := range s.counters {
+		for nodeID, share := range shares {
+			if share.expires <= now {
+				delete(shares, nodeID)
+			}
+		}
+		if len(shares) == 0 {
+			delete(s.counters, key)
+		}
+	}
+
+	for key, current := range s.registers {
+		if current.entry.Expires <= now {
+			delete(s.registers, key)
+		}
+	}
+}
+
+// Split cuts a delta into parts of at most maxEntries entries so each fits into one message
+func Split(delta types.StateDelta, maxEntries int) []types.StateDelta {
+	if maxEntries <= 0 {
+		return []types.StateDelta{delta}
+	}
+
+	var parts []types.StateDelta
+	current := types.StateDelta{}
+	size := 0
+
+	flush := func() {
+		if size > 0 {
+			parts = append(parts, current)
+			current = types.StateDelta{}
+			size = 0
+		}
+	}
+
+	for _, entry := range delta.Counters {
+		current.Counters = append(current.Counters, entry)
+		if size++; size >= maxEntries {
+			flush()
+		}
+	}
+	for _, entry := range delta.Registers {
+		current.Registers = append(current.Registers, entry)
+		if size++; size >= maxEntries {
+			flush()
+		}
+	}
+	flush()
+
+	return parts
+}
+
+func (s *Store) write(key, value string, ttl time.Duration, deleted bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	timestamp := now.UnixNano()
+	if current, exists := s.registers[key]; exists && current.entry.Timestamp >= timestamp {
+		timestamp = current.entry.Timestamp + 1
+	}
+
+	s.registers[key] = &register{
+		entry: types.RegisterEntry{
+			Key:       key,
+			Value:     value,
+			Timestamp: timestamp,
+			NodeID:    s.nodeID,
+			Expires:   now.Add(ttl).UnixNano(),
+			Deleted:   deleted,
+		},
+		updated: now,
+	}
+}
+
+func (s *Store) collect(include func(updated time.Time) bool) types.StateDelta {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now().UnixNano()
+	delta := types.StateDelta{}
+
+	for key, shares := range s.counters {
+		for nodeID, share := range shares {
+			if share.expires > now && include(share.updated) {
+				delta.Counters = append(delta.Counters, types.CounterEntry{
+					Key:     key,
+					NodeID:  nodeID,
+					Value:   share.value,
+					Expires: share.expires,
+				})
+			}
+		}
+	}
+
+	for _, current := range s.registers {
+		if current.entry.Expires > now && include(current.updated) {
+			delta.Registers = append(delta.Registers, current.entry)
+		}
+	}
+
+	sort.Slice(delta.Counters, func(i, j int) bool {
+		if delta.Counters[i].Key != delta.Counters[j].Key {
+			return delta.Counters[i].Key < delta.Counters[j].Key
+		}
+		return delta.Counters[i].NodeID < delta.Counters[j].NodeID
+	})
+	sort.Slice(delta.Registers, func(i, j int) bool {
+		return delta.Registers[i].Key < delta.Registers[j].Key
+	})
+
+	return delta
+}
+
+func (s *Store) total(key string, now int64) uint64 {
+	var total uint64
+	for _, share := range s.counters[key] {
+		if share.expires > now {
+			total += share.value
+		}
+	}
+	return total
+}
+
+// newer orders register writes by timestamp and breaks ties by node ID, so every node picks the same winner
+func newer(candidate, current types.RegisterEntry) bool {
+	if candidate.Timestamp != current.Timestamp {
+		return candidate.Timestamp > current.Timestamp
+	}
+	if candidate.NodeID != current.NodeID {
+		return candidate.NodeID > current.NodeID
+	}
+	return candidate.Expires > current.Expires
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,116 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/saiset-co/sai-interx-manager/p2p"
+)
+
+// exchange sends the full state of every store to every other store
+func exchange(stores ...*Store) {
+	for _, from := range stores {
+		snapshot := from.Snapshot()
+		for _, to := range stores {
+			if to != from {
+				to.Merge(snapshot)
+			}
+		}
+	}
+}
+
+func TestCountersConvergeAcrossNodes(t *testing.T) {
+	a, b, c := NewStore("a"), NewStore("b"), NewStore("c")
+
+	a.Increment("requests", 3, time.Minute)
+	b.Increment("requests", 2, time.Minute)
+	c.Increment("requests", 1, time.Minute)
+
+	exchange(a, b, c)
+	exchange(a, b, c)
+
+	for _, store := range []*Store{a, b, c} {
+		if total := store.Counter("requests"); total != 6 {
+			t.Fatalf("expected 6 requests on %s, got %d", store.nodeID, total)
+		}
+	}
+
+	if a.Merge(b.Snapshot()) {
+		t.Fatal("merging the same state again must not report a change")
+	}
+}
+
+func TestCountersHealAfterPartition(t *testing.T) {
+	a, b, c := NewStore("a"), NewStore("b"), NewStore("c")
+
+	a.Increment("requests", 1, time.Minute)
+	exchange(a, b, c)
+
+	// a is cut off from b and c, both sides keep counting
+	a.Increment("requests", 4, time.Minute)
+	b.Increment("requests", 2, time.Minute)
+	exchange(b, c)
+
+	if total := a.Counter("requests"); total != 5 {
+		t.Fatalf("expected a to count its own side of the partition, got %d", total)
+	}
+	if total := c.Counter("requests"); total != 3 {
+		t.Fatalf("expected c to count its own side of the partition, got %d", total)
+	}
+
+	exchange(a, b, c)
+
+	for _, store := range []*Store{a, b, c} {
+		if total := store.Counter("requests"); total != 7 {
+			t.Fatalf("expected 7 requests on %s after healing, got %d", store.nodeID, total)
+		}
+	}
+}
+
+func TestRegistersKeepLastWrite(t *testing.T) {
+	a, b := NewStore("a"), NewStore("b")
+
+	a.Put("faucet:addr", "first", time.Minute)
+	time.Sleep(time.Millisecond)
+	b.Put("faucet:addr", "second", time.Minute)
+
+	exchange(a, b)
+
+	for _, store := range []*Store{a, b} {
+		if value, _ := store.Get("faucet:addr"); value != "second" {
+			t.Fatalf("expected the later write on %s, got %q", store.nodeID, value)
+		}
+	}
+
+	a.Delete("faucet:addr")
+	exchange(a, b)
+
+	if _, exists := b.Get("faucet:addr"); exists {
+		t.Fatal("expected the delete to replicate")
+	}
+}
+
+func TestChangesAndExpiry(t *testing.T) {
+	store := NewStore("a")
+	store.Increment("old", 1, time.Minute)
+
+	since := time.Now()
+	time.Sleep(time.Millisecond)
+	store.Increment("new", 1, time.Minute)
+	store.Put("short", "value", time.Millisecond)
+
+	changes := store.Changes(since)
+	if len(changes.Counters) != 1 || changes.Counters[0].Key != "new" || changes.Counters[0].NodeID != p2p.NodeID("a") {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	store.Expire()
+
+	if _, exists := store.Get("short"); exists {
+		t.Fatal("expected the register to expire")
+	}
+	if parts := Split(store.Snapshot(), 1); len(parts) != 2 {
+		t.Fatalf("expected one part per entry, got %d", len(parts))
+	}
+}
@@ -25,3 +25,33 @@ type PeerInfo struct {
 	HttpPort  int
 	Connected bool
 }
+
+// StateDelta carries entries of the replicated key-value state
+type StateDelta struct {
+	Counters  []CounterEntry  `json:"counters,omitempty"`
+	Registers []RegisterEntry `json:"registers,omitempty"`
+}
+
+// CounterEntry is the share of a grow-only counter contributed by one node
+type CounterEntry struct {
+	Key     string     `json:"key"`
+	NodeID  p2p.NodeID `json:"node_id"`
+	Value   uint64     `json:"value"`
+	Expires int64      `json:"expires"`
+}
+
+// RegisterEntry is a last-writer-wins value. Deleted entries are kept as tombstones until they expire.
+type RegisterEntry struct {
+	Key       string     `json:"key"`
+	Value     string     `json:"value"`
+	Timestamp int64      `json:"timestamp"`
+	NodeID    p2p.NodeID `json:"node_id"`
+	Expires   int64      `json:"expires"`
+	Deleted   bool       `json:"deleted,omitempty"`
+}
+
+// PeerExchange carries a sample of known peers. The receiver answers a shuffle with a Reply sample of its own.
+type PeerExchange struct {
+	Peers []PeerInfo `json:"peers"`
+	Reply bool       `json:"reply,omitempty"`
+}
@@ -0,0 +1,292 @@
+package subscription
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// message is a JSON-RPC 2.0 message in either direction
+type message struct {
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+const (
+	codeInvalidRequest   = -32600
+	codeMethodNotFound   = -32601
+	codeInvalidParams    = -32602
+	codeInternalError    = -32603
+	codeLimitExceeded    = -32005
+	codeSubscriptionGone = -32000
+)
+
+type action int
+
+const (
+	actionSubscribe action = iota + 1
+	actionUnsubscribe
+	actionUnsubscribeAll
+)
+
+// request is a client message understood by a dialect
+type request struct {
+	action action
+	// key identifies the upstream subscription, requests with the same key share one
+	key string
+	// params are sent upstream to subscribe
+	params json.RawMessage
+	// ref is the client-facing subscription to create or cancel
+	ref string
+	// filter selects the events of the upstream subscription the client asked for, nil passes every event
+	filter func(msg message) bool
+}
+
+// dialect is the subscription protocol spoken by a node and, unchanged, by the clients of its hub
+type dialect interface {
+	// parse turns a client message into a request, or an error answered to the client
+	parse(msg message) (request, *rpcError)
+	// ref is the client-facing id of a new subscription
+	ref(req request) string
+	// subscribeResult answers the client once its subscription is active
+	subscribeResult(s *subscriber) interface{}
+	// unsubscribeResult answers the client once its subscription is cancelled
+	unsubscribeResult() interface{}
+
+	subscribeMessage(id uint64, params json.RawMessage) message
+	unsubscribeMessage(id uint64, upstream *upstreamSubscription) message
+	// upstreamID is the node's id of a subscription it confirmed
+	upstreamID(upstream *upstreamSubscription, result json.RawMessage) (string, error)
+	// event returns the node's subscription id of an event message
+	event(msg message) (string, bool)
+	// deliver rewrites an event for one subscriber
+	deliver(s *subscriber, msg message) interface{}
+}
+
+// tendermintDialect speaks the Tendermint RPC websocket protocol. A subscription is identified by its
+// query and events carry the id of the request that subscribed. The node caps the subscriptions of a
+// connection (max_subscriptions_per_client, 5 by default), so the hub subscribes once per tm.event and
+// the rest of every client query is evaluated locally.
+type tendermintDialect struct {
+	events map[string]bool
+}
+
+func newTendermintDialect(events []string) *tendermintDialect {
+	d := &tendermintDialect{events: map[string]bool{}}
+	for _, event := range events {
+		d.events[event] = true
+	}
+	return d
+}
+
+func (d *tendermintDialect) parse(msg message) (request, *rpcError) {
+	var params struct {
+		Query string `json:"query"`
+	}
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return request{}, &rpcError{Code: codeInvalidParams, Message: "params must be an object with a query"}
+		}
+	}
+
+	switch msg.Method {
+	case "subscribe":
+		query, err := parseTmQuery(params.Query)
+		if err != nil {
+			return request{}, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		if !d.events[query.event] {
+			return request{}, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("event %s is not available", query.event)}
+		}
+
+		key := fmt.Sprintf("tm.event = '%s'", query.event)
+		upstream, _ := json.Marshal(map[string]string{"query": key})
+		return request{action: actionSubscribe, key: key, params: upstream, ref: params.Query, filter: query.filter()}, nil
+	case "unsubscribe":
+		return request{action: actionUnsubscribe, ref: params.Query}, nil
+	case "unsubscribe_all":
+		return request{action: actionUnsubscribeAll}, nil
+	}
+
+	return request{}, &rpcError{Code: codeMethodNotFound, Message: "only subscribe, unsubscribe and unsubscribe_all are served over websocket"}
+}
+
+func (d *tendermintDialect) ref(req request) string {
+	return req.ref
+}
+
+func (d *tendermintDialect) subscribeResult(*subscriber) interface{} {
+	return struct{}{}
+}
+
+func (d *tendermintDialect) unsubscribeResult() interface{} {
+	return struct{}{}
+}
+
+func (d *tendermintDialect) subscribeMessage(id uint64, params json.RawMessage) message {
+	return message{JSONRPC: "2.0", ID: idOf(id), Method: "subscribe", Params: params}
+}
+
+func (d *tendermintDialect) unsubscribeMessage(id uint64, upstream *upstreamSubscription) message {
+	return message{JSONRPC: "2.0", ID: idOf(id), Method: "unsubscribe", Params: upstream.params}
+}
+
+func (d *tendermintDialect) upstreamID(upstream *upstreamSubscription, _ json.RawMessage) (string, error) {
+	return upstream.key, nil
+}
+
+func (d *tendermintDialect) event(msg message) (string, bool) {
+	var result struct {
+		Query string `json:"query"`
+	}
+	if len(msg.Result) == 0 || json.Unmarshal(msg.Result, &result) != nil || result.Query == "" {
+		return "", false
+	}
+	return result.Query, true
+}
+
+// deliver names the query of the client in the event, it carries the query of the upstream subscription
+func (d *tendermintDialect) deliver(s *subscriber, msg message) interface{} {
+	var result map[string]json.RawMessage
+	if json.Unmarshal(msg.Result, &result) != nil {
+		return message{JSONRPC: "2.0", ID: s.requestID, Result: msg.Result}
+	}
+
+	result["query"], _ = json.Marshal(s.ref)
+	data, _ := json.Marshal(result)
+
+	return message{JSONRPC: "2.0", ID: s.requestID, Result: data}
+}
+
+// ethereumDialect speaks eth_subscribe. The node names every subscription and events carry that name,
+// which is replaced by the name the gateway gave the client.
+type ethereumDialect struct {
+	types map[string]bool
+}
+
+func newEthereumDialect(types []string) *ethereumDialect {
+	d := &ethereumDialect{types: map[string]bool{}}
+	for _, t := range types {
+		d.types[t] = true
+	}
+	return d
+}
+
+func (d *ethereumDialect) parse(msg message) (request, *rpcError) {
+	var params []interface{}
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return request{}, &rpcError{Code: codeInvalidParams, Message: "params must be an array"}
+		}
+	}
+
+	switch msg.Method {
+	case "eth_subscribe":
+		if len(params) == 0 || len(params) > 2 {
+			return request{}, &rpcError{Code: codeInvalidParams, Message: "expected a subscription type and an optional filter"}
+		}
+
+		subscriptionType, _ := params[0].(string)
+		if !d.types[subscriptionType] {
+			return request{}, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("subscription %v is not available", params[0])}
+		}
+		if len(params) == 2 {
+			if _, ok := params[1].(map[string]interface{}); !ok {
+				return request{}, &rpcError{Code: codeInvalidParams, Message: "the filter must be an object"}
+			}
+		}
+
+		// marshalling sorts the filter fields, so equal filters share a key
+		upstream, _ := json.Marshal(params)
+		return request{action: actionSubscribe, key: string(upstream), params: upstream}, nil
+	case "eth_unsubscribe":
+		if len(params) != 1 {
+			return request{}, &rpcError{Code: codeInvalidParams, Message: "expected the subscription id"}
+		}
+		ref, _ := params[0].(string)
+		return request{action: actionUnsubscribe, ref: ref}, nil
+	}
+
+	return request{}, &rpcError{Code: codeMethodNotFound, Message: "only eth_subscribe and eth_unsubscribe are served over websocket"}
+}
+
+func (d *ethereumDialect) ref(request) string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return "0x" + hex.EncodeToString(id)
+}
+
+func (d *ethereumDialect) subscribeResult(s *subscriber) interface{} {
+	return s.ref
+}
+
+func (d *ethereumDialect) unsubscribeResult() interface{} {
+	return true
+}
+
+func (d *ethereumDialect) subscribeMessage(id uint64, params json.RawMessage) message {
+	return message{JSONRPC: "2.0", ID: idOf(id), Method: "eth_subscribe", Params: params}
+}
+
+func (d *ethereumDialect) unsubscribeMessage(id uint64, upstream *upstreamSubscription) message {
+	params, _ := json.Marshal([]string{upstream.upstreamID})
+	return message{JSONRPC: "2.0", ID: idOf(id), Method: "eth_unsubscribe", Params: params}
+}
+
+func (d *ethereumDialect) upstreamID(_ *upstreamSubscription, result json.RawMessage) (string, error) {
+	var id string
+	if err := json.Unmarshal(result, &id); err != nil || id == "" {
+		return "", errors.New("the node did not name the subscription")
+	}
+	return id, nil
+}
+
+func (d *ethereumDialect) event(msg message) (string, bool) {
+	if msg.Method != "eth_subscription" {
+		return "", false
+	}
+
+	var params struct {
+		Subscription string `json:"subscription"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil || params.Subscription == "" {
+		return "", false
+	}
+	return params.Subscription, true
+}
+
+func (d *ethereumDialect) deliver(s *subscriber, msg message) interface{} {
+	var params struct {
+		Result json.RawMessage `json:"result"`
+	}
+	_ = json.Unmarshal(msg.Params, &params)
+
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscription",
+		"params": map[string]interface{}{
+			"subscription": s.ref,
+			"result":       params.Result,
+		},
+	}
+}
+
+func idOf(id uint64) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf("%d", id))
+}
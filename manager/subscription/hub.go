@@ -0,0 +1,365 @@
+package subscription
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+)
+
+const (
+	subscribeTimeout = 10 * time.Second
+	writeTimeout     = 10 * time.Second
+	minReconnect     = time.Second
+	maxReconnect     = 30 * time.Second
+)
+
+// Hub keeps one websocket to a node and shares a single upstream subscription between all clients
+// whose requests have the same key, each client keeping only the events its filter selects. It reconnects,
+// trying the next node URL, and resubscribes whenever the connection drops.
+type Hub struct {
+	name    string
+	urls    []string
+	dialect dialect
+
+	mutex       sync.Mutex
+	conn        *websocket.Conn
+	nextID      uint64
+	byKey       map[string]*upstreamSubscription
+	byUpstream  map[string]*upstreamSubscription
+	pending     map[uint64]*upstreamSubscription
+	unsubscribe map[uint64]bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// upstreamSubscription is one subscription on the node with every client subscribed to it
+type upstreamSubscription struct {
+	key        string
+	params     json.RawMessage
+	upstreamID string
+
+	// ready is closed once the node confirmed or refused the first subscribe
+	ready       chan struct{}
+	confirmed   bool
+	err         error
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber is the subscription of one client
+type subscriber struct {
+	client *client
+	// ref is the id the client knows the subscription by
+	ref string
+	// requestID is the id of the client request that subscribed
+	requestID json.RawMessage
+	// filter selects the events delivered to the client, nil delivers every event of the upstream subscription
+	filter   func(msg message) bool
+	upstream *upstreamSubscription
+}
+
+func newHub(name string, urls []string, dialect dialect) *Hub {
+	return &Hub{
+		name:        name,
+		urls:        urls,
+		dialect:     dialect,
+		byKey:       map[string]*upstreamSubscription{},
+		byUpstream:  map[string]*upstreamSubscription{},
+		pending:     map[uint64]*upstreamSubscription{},
+		unsubscribe: map[uint64]bool{},
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start keeps the hub connected until Stop is called
+func (h *Hub) Start() {
+	go h.run()
+}
+
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+
+		h.mutex.Lock()
+		if h.conn != nil {
+			_ = h.conn.Close()
+		}
+		h.mutex.Unlock()
+	})
+}
+
+func (h *Hub) run() {
+	delay := minReconnect
+
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-h.stop:
+			return
+		default:
+		}
+
+		url := h.urls[attempt%len(h.urls)]
+
+		conn, err := websocket.Dial(url, "", "http://localhost/")
+		if err != nil {
+			logger.Logger.Warn("Hub - dial failed", zap.String("hub", h.name), zap.String("url", url), zap.Error(err))
+
+			select {
+			case <-h.stop:
+				return
+			case <-time.After(delay):
+			}
+
+			delay *= 2
+			if delay > maxReconnect {
+				delay = maxReconnect
+			}
+			continue
+		}
+
+		delay = minReconnect
+		logger.Logger.Info("Hub - connected", zap.String("hub", h.name), zap.String("url", url))
+
+		h.connected(conn)
+		h.read(conn)
+		h.disconnected()
+
+		// try the same node again first, it may only have restarted
+		attempt--
+
+		select {
+		case <-h.stop:
+			return
+		case <-time.After(minReconnect):
+		}
+	}
+}
+
+// connected resubscribes everything clients are still subscribed to
+func (h *Hub) connected(conn *websocket.Conn) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.conn = conn
+	for _, upstream := range h.byKey {
+		h.sendSubscribe(upstream)
+	}
+}
+
+func (h *Hub) disconnected() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	_ = h.conn.Close()
+	h.conn = nil
+	h.byUpstream = map[string]*upstreamSubscription{}
+	h.pending = map[uint64]*upstreamSubscription{}
+	h.unsubscribe = map[uint64]bool{}
+
+	for _, upstream := range h.byKey {
+		upstream.upstreamID = ""
+	}
+}
+
+func (h *Hub) read(conn *websocket.Conn) {
+	for {
+		var msg message
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			logger.Logger.Warn("Hub - connection lost", zap.String("hub", h.name), zap.Error(err))
+			return
+		}
+
+		if id, err := strconv.ParseUint(string(msg.ID), 10, 64); err == nil && h.answered(id, msg) {
+			continue
+		}
+
+		if upstreamID, ok := h.dialect.event(msg); ok {
+			h.fanOut(upstreamID, msg)
+		}
+	}
+}
+
+// answered handles the reply to a subscribe or unsubscribe the hub sent, reporting whether it was one
+func (h *Hub) answered(id uint64, msg message) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.unsubscribe[id] {
+		delete(h.unsubscribe, id)
+		return true
+	}
+
+	upstream, ok := h.pending[id]
+	if !ok {
+		return false
+	}
+	delete(h.pending, id)
+
+	var err error
+	if msg.Error != nil {
+		err = msg.Error
+	} else {
+		upstream.upstreamID, err = h.dialect.upstreamID(upstream, msg.Result)
+	}
+
+	if err != nil {
+		logger.Logger.Warn("Hub - subscribe refused", zap.String("hub", h.name), zap.String("key", upstream.key), zap.Error(err))
+		if h.byKey[upstream.key] == upstream {
+			delete(h.byKey, upstream.key)
+		}
+		if !upstream.confirmed {
+			// nobody received anything yet, the waiting clients get the error and the next attempt starts over
+			upstream.err = err
+			close(upstream.ready)
+			return true
+		}
+
+		// the node refused to resubscribe after a reconnect, the clients are told their subscription is gone
+		// so they can subscribe again rather than wait for events that never come
+		for s := range upstream.subscribers {
+			if s.client.drop(s) {
+				s.client.enqueue(message{
+					JSONRPC: "2.0",
+					ID:      s.requestID,
+					Error:   &rpcError{Code: codeSubscriptionGone, Message: "the node refused to resubscribe: " + err.Error(), Data: s.ref},
+				})
+			}
+		}
+		upstream.subscribers = map[*subscriber]struct{}{}
+		return true
+	}
+
+	// every client left before the node answered
+	if h.byKey[upstream.key] != upstream {
+		h.nextID++
+		h.unsubscribe[h.nextID] = true
+		h.send(h.dialect.unsubscribeMessage(h.nextID, upstream))
+		return true
+	}
+
+	h.byUpstream[upstream.upstreamID] = upstream
+	if !upstream.confirmed {
+		upstream.confirmed = true
+		close(upstream.ready)
+	}
+
+	return true
+}
+
+func (h *Hub) fanOut(upstreamID string, msg message) {
+	h.mutex.Lock()
+	upstream, ok := h.byUpstream[upstreamID]
+	var subscribers []*subscriber
+	if ok {
+		for s := range upstream.subscribers {
+			subscribers = append(subscribers, s)
+		}
+	}
+	h.mutex.Unlock()
+
+	for _, s := range subscribers {
+		if s.filter == nil || s.filter(msg) {
+			s.client.enqueue(h.dialect.deliver(s, msg))
+		}
+	}
+}
+
+// subscribe adds the subscriber to the upstream subscription of its key, subscribing on the node
+// when it is the first one, and waits until the node confirmed it
+func (h *Hub) subscribe(s *subscriber, key string, params json.RawMessage) error {
+	h.mutex.Lock()
+
+	upstream, ok := h.byKey[key]
+	if !ok {
+		upstream = &upstreamSubscription{
+			key:         key,
+			params:      params,
+			ready:       make(chan struct{}),
+			subscribers: map[*subscriber]struct{}{},
+		}
+		h.byKey[key] = upstream
+
+		// while disconnected the subscription is sent once the hub is connected again
+		if h.conn != nil {
+			h.sendSubscribe(upstream)
+		}
+	}
+
+	s.upstream = upstream
+	upstream.subscribers[s] = struct{}{}
+	ready := upstream.ready
+
+	h.mutex.Unlock()
+
+	select {
+	case <-ready:
+	case <-time.After(subscribeTimeout):
+		h.unsubscribeClient(s)
+		return errors.New("the node did not confirm the subscription in time")
+	}
+
+	if upstream.err != nil {
+		h.unsubscribeClient(s)
+		return upstream.err
+	}
+
+	return nil
+}
+
+// unsubscribeClient removes the subscriber, cancelling the upstream subscription after the last one left
+func (h *Hub) unsubscribeClient(s *subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	upstream := s.upstream
+	delete(upstream.subscribers, s)
+	if len(upstream.subscribers) > 0 || h.byKey[upstream.key] != upstream {
+		return
+	}
+
+	delete(h.byKey, upstream.key)
+	if upstream.upstreamID == "" {
+		return
+	}
+
+	delete(h.byUpstream, upstream.upstreamID)
+	if h.conn != nil {
+		h.nextID++
+		h.unsubscribe[h.nextID] = true
+		h.send(h.dialect.unsubscribeMessage(h.nextID, upstream))
+	}
+}
+
+// sendSubscribe must be called with the mutex held
+func (h *Hub) sendSubscribe(upstream *upstreamSubscription) {
+	h.nextID++
+	h.pending[h.nextID] = upstream
+	h.send(h.dialect.subscribeMessage(h.nextID, upstream.params))
+}
+
+// send must be called with the mutex held, a failed write drops the connection to have it reestablished
+func (h *Hub) send(msg message) {
+	_ = h.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := websocket.JSON.Send(h.conn, msg); err != nil {
+		logger.Logger.Warn("Hub - write failed", zap.String("hub", h.name), zap.Error(err))
+		_ = h.conn.Close()
+	}
+}
+
+// Subscriptions reports the number of upstream subscriptions and of the clients subscribed to them
+func (h *Hub) Subscriptions() (upstream int, subscribers int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, u := range h.byKey {
+		subscribers += len(u.subscribers)
+	}
+	return len(h.byKey), subscribers
+}
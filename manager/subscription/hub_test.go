@@ -0,0 +1,388 @@
+package subscription
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+// fakeNode answers eth_subscribe with a fresh subscription id and lets the test push events
+type fakeNode struct {
+	mutex      sync.Mutex
+	conn       *websocket.Conn
+	subscribes int
+	// refuse answers eth_subscribe with an error
+	refuse bool
+}
+
+func (n *fakeNode) serve(conn *websocket.Conn) {
+	n.mutex.Lock()
+	n.conn = conn
+	n.mutex.Unlock()
+
+	for {
+		var msg message
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			return
+		}
+
+		n.mutex.Lock()
+		var result json.RawMessage
+		switch msg.Method {
+		case "eth_subscribe":
+			n.subscribes++
+			if n.refuse {
+				_ = websocket.JSON.Send(conn, message{JSONRPC: "2.0", ID: msg.ID, Error: &rpcError{Code: -32000, Message: "too many subscriptions"}})
+				n.mutex.Unlock()
+				continue
+			}
+			result = json.RawMessage(`"0xnode` + string(msg.ID) + `"`)
+		default:
+			result = json.RawMessage("true")
+		}
+		_ = websocket.JSON.Send(conn, message{JSONRPC: "2.0", ID: msg.ID, Result: result})
+		n.mutex.Unlock()
+	}
+}
+
+func (n *fakeNode) push(subscription string, result string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	params, _ := json.Marshal(map[string]interface{}{"subscription": subscription, "result": json.RawMessage(result)})
+	_ = websocket.JSON.Send(n.conn, message{JSONRPC: "2.0", Method: "eth_subscription", Params: params})
+}
+
+func dialClient(t *testing.T, addr string) *websocket.Conn {
+	conn, err := websocket.Dial("ws://"+addr+"/ws/ethereum/chain1", "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func call(t *testing.T, conn *websocket.Conn, id int, method string, params string) message {
+	request := map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": json.RawMessage(params)}
+	if err := websocket.JSON.Send(conn, request); err != nil {
+		t.Fatal(err)
+	}
+
+	return receive(t, conn)
+}
+
+func receive(t *testing.T, conn *websocket.Conn) message {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var reply message
+	if err := websocket.JSON.Receive(conn, &reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func TestEthereumSubscriptionsShareUpstream(t *testing.T) {
+	node := &fakeNode{}
+	upstream := httptest.NewServer(websocket.Handler(node.serve))
+	defer upstream.Close()
+
+	server := NewServer(Config{
+		Address:          "127.0.0.1:0",
+		MaxSubscriptions: 1,
+		BufferSize:       16,
+		EthereumTypes:    []string{"newHeads", "logs"},
+	}, "", map[string][]string{"chain1": {strings.Replace(upstream.URL, "http://", "ws://", 1)}})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	first, second := dialClient(t, server.Addr()), dialClient(t, server.Addr())
+	defer first.Close()
+	defer second.Close()
+
+	var refs []string
+	for _, conn := range []*websocket.Conn{first, second} {
+		reply := call(t, conn, 1, "eth_subscribe", `["newHeads"]`)
+		if reply.Error != nil {
+			t.Fatalf("subscribe: %v", reply.Error)
+		}
+
+		var ref string
+		_ = json.Unmarshal(reply.Result, &ref)
+		refs = append(refs, ref)
+	}
+
+	if refs[0] == refs[1] || !strings.HasPrefix(refs[0], "0x") {
+		t.Fatalf("expected distinct subscription ids, got %v", refs)
+	}
+
+	node.mutex.Lock()
+	subscribes := node.subscribes
+	node.mutex.Unlock()
+	if subscribes != 1 {
+		t.Fatalf("expected one upstream subscription, got %d", subscribes)
+	}
+
+	if upstreams, subscribers := server.hubs["/ws/ethereum/chain1"].Subscriptions(); upstreams != 1 || subscribers != 2 {
+		t.Fatalf("expected 1 upstream subscription with 2 subscribers, got %d and %d", upstreams, subscribers)
+	}
+
+	node.push("0xnode1", `{"number":"0x10"}`)
+
+	for i, conn := range []*websocket.Conn{first, second} {
+		event := receive(t, conn)
+
+		var params struct {
+			Subscription string          `json:"subscription"`
+			Result       json.RawMessage `json:"result"`
+		}
+		_ = json.Unmarshal(event.Params, &params)
+
+		if event.Method != "eth_subscription" || params.Subscription != refs[i] || string(params.Result) != `{"number":"0x10"}` {
+			t.Fatalf("unexpected event for client %d: %+v", i, event)
+		}
+	}
+
+	if reply := call(t, first, 2, "eth_subscribe", `["logs",{"address":"0x01"}]`); reply.Error == nil || reply.Error.Code != codeLimitExceeded {
+		t.Fatalf("expected the subscription limit, got %+v", reply)
+	}
+
+	if reply := call(t, first, 3, "eth_subscribe", `["newPendingTransactions"]`); reply.Error == nil || reply.Error.Code != codeInvalidParams {
+		t.Fatalf("expected a disallowed subscription type to be refused, got %+v", reply)
+	}
+
+	if reply := call(t, first, 4, "eth_unsubscribe", `["`+refs[0]+`"]`); reply.Error != nil || string(reply.Result) != "true" {
+		t.Fatalf("unsubscribe: %+v", reply)
+	}
+
+	if upstreams, subscribers := server.hubs["/ws/ethereum/chain1"].Subscriptions(); upstreams != 1 || subscribers != 1 {
+		t.Fatalf("expected the upstream subscription to stay for the second client, got %d and %d", upstreams, subscribers)
+	}
+}
+
+func TestRefusedResubscribeTellsClients(t *testing.T) {
+	node := &fakeNode{}
+	upstream := httptest.NewServer(websocket.Handler(node.serve))
+	defer upstream.Close()
+
+	server := NewServer(Config{Address: "127.0.0.1:0", BufferSize: 16, EthereumTypes: []string{"newHeads"}},
+		"", map[string][]string{"chain1": {strings.Replace(upstream.URL, "http://", "ws://", 1)}})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	conn := dialClient(t, server.Addr())
+	defer conn.Close()
+
+	if reply := call(t, conn, 7, "eth_subscribe", `["newHeads"]`); reply.Error != nil {
+		t.Fatalf("subscribe: %v", reply.Error)
+	}
+
+	// the node restarts and no longer accepts the subscription
+	node.mutex.Lock()
+	node.refuse = true
+	_ = node.conn.Close()
+	node.mutex.Unlock()
+
+	gone := receive(t, conn)
+	if gone.Error == nil || gone.Error.Code != codeSubscriptionGone || string(gone.ID) != "7" {
+		t.Fatalf("expected the client to be told its subscription is gone, got %+v", gone)
+	}
+
+	if upstreams, subscribers := server.hubs["/ws/ethereum/chain1"].Subscriptions(); upstreams != 0 || subscribers != 0 {
+		t.Fatalf("expected the refused subscription to be dropped, got %d and %d", upstreams, subscribers)
+	}
+
+	// the client can subscribe again once the node accepts it
+	node.mutex.Lock()
+	node.refuse = false
+	node.mutex.Unlock()
+	if reply := call(t, conn, 8, "eth_subscribe", `["newHeads"]`); reply.Error != nil {
+		t.Fatalf("subscribe again: %v", reply.Error)
+	}
+}
+
+func TestTendermintDialectEvents(t *testing.T) {
+	d := newTendermintDialect([]string{"NewBlock"})
+
+	if _, err := d.parse(message{Method: "subscribe", Params: json.RawMessage(`{"query":"tm.event='Tx'"}`)}); err == nil {
+		t.Fatal("expected Tx events to be refused")
+	}
+
+	req, err := d.parse(message{Method: "subscribe", Params: json.RawMessage(`{"query":"tm.event = 'NewBlock'"}`)})
+	if err != nil || req.action != actionSubscribe || req.key != "tm.event = 'NewBlock'" {
+		t.Fatalf("unexpected request %+v, %v", req, err)
+	}
+
+	query, ok := d.event(message{Result: json.RawMessage(`{"query":"tm.event = 'NewBlock'","data":{}}`)})
+	if !ok || query != req.key {
+		t.Fatalf("expected the event to match the subscription, got %q", query)
+	}
+}
+
+// fakeTendermint answers subscribe and lets the test push events to every upstream subscription
+type fakeTendermint struct {
+	mutex   sync.Mutex
+	conn    *websocket.Conn
+	queries map[string]json.RawMessage
+}
+
+func (n *fakeTendermint) serve(conn *websocket.Conn) {
+	n.mutex.Lock()
+	n.conn = conn
+	n.mutex.Unlock()
+
+	for {
+		var msg message
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			return
+		}
+
+		var params struct {
+			Query string `json:"query"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+
+		n.mutex.Lock()
+		if msg.Method == "subscribe" {
+			n.queries[params.Query] = msg.ID
+		}
+		_ = websocket.JSON.Send(conn, message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("{}")})
+		n.mutex.Unlock()
+	}
+}
+
+func (n *fakeTendermint) push(query string, events string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	result, _ := json.Marshal(map[string]interface{}{"query": query, "data": map[string]interface{}{}, "events": json.RawMessage(events)})
+	_ = websocket.JSON.Send(n.conn, message{JSONRPC: "2.0", ID: n.queries[query], Result: result})
+}
+
+func TestTendermintQueriesShareOneUpstreamPerEvent(t *testing.T) {
+	node := &fakeTendermint{queries: map[string]json.RawMessage{}}
+	upstream := httptest.NewServer(websocket.Handler(node.serve))
+	defer upstream.Close()
+
+	server := NewServer(Config{Address: "127.0.0.1:0", BufferSize: 16, CosmosEvents: []string{"NewBlock", "Tx"}}, upstream.URL, nil)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	conn, err := websocket.Dial("ws://"+server.Addr()+"/ws/cosmos", "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// more distinct queries than a node accepts on one connection
+	queries := []string{
+		"tm.event='Tx' AND transfer.recipient='kira1a'",
+		"tm.event='Tx' AND transfer.recipient='kira1b'",
+		"tm.event='Tx' AND tx.height > 100",
+		"tm.event='Tx' AND message.action CONTAINS 'Send'",
+		"tm.event='Tx' AND transfer.amount EXISTS",
+		"tm.event = 'Tx'",
+		"tm.event='NewBlock'",
+	}
+	for i, query := range queries {
+		params, _ := json.Marshal(map[string]string{"query": query})
+		if reply := call(t, conn, i+1, "subscribe", string(params)); reply.Error != nil {
+			t.Fatalf("subscribe %q: %v", query, reply.Error)
+		}
+	}
+
+	node.mutex.Lock()
+	upstreamQueries := len(node.queries)
+	node.mutex.Unlock()
+	if upstreamQueries != 2 {
+		t.Fatalf("expected one upstream subscription per event, got %d", upstreamQueries)
+	}
+
+	node.push("tm.event = 'Tx'", `{"tm.event":["Tx"],"transfer.recipient":["kira1c","kira1b"],"tx.height":["99"],"message.action":["/kira.MsgSend"]}`)
+
+	received := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		event := receive(t, conn)
+
+		var result struct {
+			Query string `json:"query"`
+		}
+		_ = json.Unmarshal(event.Result, &result)
+		received[result.Query] = true
+	}
+
+	for _, query := range []string{queries[1], queries[3], queries[5]} {
+		if !received[query] {
+			t.Fatalf("expected the event under the query of the client %q, got %v", query, received)
+		}
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var extra message
+	if err := websocket.JSON.Receive(conn, &extra); err == nil {
+		t.Fatalf("expected no event for the queries the event does not match, got %s", extra.Result)
+	}
+}
+
+func TestTmQuery(t *testing.T) {
+	events := map[string][]string{
+		"transfer.recipient": {"kira1a", "kira1b"},
+		"tx.height":          {"120"},
+		"message.action":     {"/kira.gov.MsgVote"},
+	}
+
+	tests := map[string]bool{
+		"tm.event='Tx'": true,
+		"tm.event='Tx' AND transfer.recipient='kira1b'":                    true,
+		"tm.event='Tx' AND transfer.recipient='kira1c'":                    false,
+		"tm.event='Tx' AND tx.height >= 120 AND tx.height < 121":           true,
+		"tm.event='Tx' AND tx.height > 120":                                false,
+		"tm.event='Tx' AND tx.height = 120":                                true,
+		"tm.event='Tx' AND message.action CONTAINS 'MsgVote'":              true,
+		"tm.event='Tx' AND message.action CONTAINS 'MsgSend'":              false,
+		"tm.event='Tx' AND transfer.recipient EXISTS":                      true,
+		"tm.event='Tx' AND transfer.sender EXISTS":                         false,
+		"tm.event='Tx' AND message.action = 'a AND b'":                     false,
+		"transfer.recipient='kira1a' AND tm.event='Tx' AND tx.height<=120": true,
+	}
+	for query, expected := range tests {
+		q, err := parseTmQuery(query)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		if q.event != "Tx" || q.matches(events) != expected {
+			t.Fatalf("expected %q to match %v", query, expected)
+		}
+	}
+
+	for _, query := range []string{
+		"",
+		"transfer.recipient='kira1a'",
+		"tm.event='Tx' AND tm.event='NewBlock'",
+		"tm.event CONTAINS 'Tx'",
+		"tm.event='Tx' AND block.time > TIME 2024-01-01T00:00:00Z",
+		"tm.event='Tx' AND tx.height >",
+		"tm.event='Tx' AND message.action CONTAINS 5",
+		"tm.event='Tx' OR tm.event='NewBlock'",
+	} {
+		if _, err := parseTmQuery(query); err == nil {
+			t.Fatalf("expected %q to be refused", query)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package subscription
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tmCondition is one condition of a Tendermint event query, tag op operand or tag EXISTS
+type tmCondition struct {
+	tag      string
+	op       string
+	operand  string
+	number   float64
+	isNumber bool
+}
+
+// tmQuery is a Tendermint event query, conditions joined by AND. It is evaluated by the hub against the
+// events of the upstream subscription of its tm.event, so that any number of client queries share one.
+type tmQuery struct {
+	event      string
+	conditions []tmCondition
+}
+
+var tmOperators = []string{"<=", ">=", "=", "<", ">", "CONTAINS", "EXISTS"}
+
+// parseTmQuery reads the query language of Tendermint with string and number operands. The query must select
+// exactly one tm.event with =.
+func parseTmQuery(query string) (*tmQuery, error) {
+	q := &tmQuery{}
+
+	for _, part := range splitAnd(query) {
+		condition, err := parseTmCondition(part)
+		if err != nil {
+			return nil, err
+		}
+
+		if condition.tag != "tm.event" {
+			q.conditions = append(q.conditions, condition)
+			continue
+		}
+		if condition.op != "=" || condition.isNumber || q.event != "" {
+			return nil, errors.New("the query must select a single tm.event with =")
+		}
+		q.event = condition.operand
+	}
+
+	if q.event == "" {
+		return nil, errors.New("the query must select a tm.event")
+	}
+
+	return q, nil
+}
+
+// splitAnd splits the query on the AND keyword outside of quoted operands
+func splitAnd(query string) []string {
+	var parts []string
+	var quoted bool
+
+	start := 0
+	for i := 0; i < len(query); i++ {
+		switch {
+		case query[i] == '\'':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(query[i:], " AND "):
+			parts = append(parts, query[start:i])
+			start = i + len(" AND ")
+			i += len(" AND ") - 1
+		}
+	}
+
+	return append(parts, query[start:])
+}
+
+func parseTmCondition(text string) (tmCondition, error) {
+	text = strings.TrimSpace(text)
+
+	end := strings.IndexAny(text, " <>=")
+	if end <= 0 {
+		return tmCondition{}, fmt.Errorf("invalid condition %q", text)
+	}
+
+	condition := tmCondition{tag: text[:end]}
+	rest := strings.TrimSpace(text[end:])
+
+	for _, op := range tmOperators {
+		if strings.HasPrefix(rest, op) {
+			condition.op = op
+			rest = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+
+	switch {
+	case condition.op == "":
+		return tmCondition{}, fmt.Errorf("invalid operator in %q", text)
+	case condition.op == "EXISTS":
+		if rest != "" {
+			return tmCondition{}, fmt.Errorf("EXISTS takes no operand in %q", text)
+		}
+		return condition, nil
+	case len(rest) >= 2 && rest[0] == '\'' && rest[len(rest)-1] == '\'':
+		condition.operand = rest[1 : len(rest)-1]
+		if strings.Contains(condition.operand, "'") {
+			return tmCondition{}, fmt.Errorf("invalid operand in %q", text)
+		}
+		return condition, nil
+	case condition.op == "CONTAINS":
+		return tmCondition{}, fmt.Errorf("CONTAINS takes a quoted operand in %q", text)
+	}
+
+	number, err := strconv.ParseFloat(rest, 64)
+	if err != nil {
+		return tmCondition{}, fmt.Errorf("unsupported operand in %q, only quoted strings and numbers are served", text)
+	}
+	condition.operand, condition.number, condition.isNumber = rest, number, true
+
+	return condition, nil
+}
+
+// matches reports whether the events of an event message satisfy every condition. A condition holds when
+// any value of its tag does, as on the node.
+func (q *tmQuery) matches(events map[string][]string) bool {
+	for _, condition := range q.conditions {
+		if !condition.matches(events[condition.tag]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c tmCondition) matches(values []string) bool {
+	if c.op == "EXISTS" {
+		return len(values) > 0
+	}
+
+	for _, value := range values {
+		if c.matchesValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c tmCondition) matchesValue(value string) bool {
+	if c.op == "CONTAINS" {
+		return strings.Contains(value, c.operand)
+	}
+
+	if !c.isNumber {
+		return c.op == "=" && value == c.operand
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+
+	switch c.op {
+	case "=":
+		return number == c.number
+	case "<":
+		return number < c.number
+	case "<=":
+		return number <= c.number
+	case ">":
+		return number > c.number
+	case ">=":
+		return number >= c.number
+	}
+	return false
+}
+
+// filter returns the filter of the subscriber, nil when the query only selects the event
+func (q *tmQuery) filter() func(msg message) bool {
+	if len(q.conditions) == 0 {
+		return nil
+	}
+
+	return func(msg message) bool {
+		var result struct {
+			Events map[string][]string `json:"events"`
+		}
+		if json.Unmarshal(msg.Result, &result) != nil {
+			return false
+		}
+		return q.matches(result.Events)
+	}
+}
@@ -0,0 +1,342 @@
+package subscription
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+)
+
+// maxMessageSize caps what a client may send in one message
+const maxMessageSize = 64 * 1024
+
+type Config struct {
+	// Address is where the websocket server listens
+	Address string
+	// MaxConnections caps the clients connected at the same time
+	MaxConnections int
+	// MaxSubscriptions caps the subscriptions of one client
+	MaxSubscriptions int
+	// BufferSize is the number of events queued for a client. A client that falls further behind is disconnected.
+	BufferSize int
+	// CosmosEvents are the tm.event values clients may subscribe to
+	CosmosEvents []string
+	// EthereumTypes are the eth_subscribe types clients may subscribe to
+	EthereumTypes []string
+}
+
+// Server relays subscriptions of websocket clients: /ws/cosmos to the Tendermint websocket of the sekai node
+// and /ws/ethereum/{chain} to eth_subscribe on the nodes of the chain
+type Server struct {
+	config      Config
+	hubs        map[string]*Hub
+	connections int64
+	listener    net.Listener
+	httpServer  *http.Server
+}
+
+// NewServer creates the server with a hub per node. tendermintURL is the Tendermint RPC address and
+// ethereumURLs the websocket addresses of the nodes of every chain; chains without any are not served.
+func NewServer(config Config, tendermintURL string, ethereumURLs map[string][]string) *Server {
+	s := &Server{
+		config: config,
+		hubs:   map[string]*Hub{},
+	}
+
+	if tendermintURL != "" {
+		s.hubs["/ws/cosmos"] = newHub("cosmos", []string{tendermintWebsocket(tendermintURL)}, newTendermintDialect(config.CosmosEvents))
+	}
+
+	for chainId, urls := range ethereumURLs {
+		if len(urls) > 0 {
+			s.hubs["/ws/ethereum/"+chainId] = newHub("ethereum/"+chainId, urls, newEthereumDialect(config.EthereumTypes))
+		}
+	}
+
+	return s
+}
+
+// tendermintWebsocket turns the Tendermint RPC address into the address of its websocket
+func tendermintWebsocket(url string) string {
+	url = strings.TrimSuffix(url, "/")
+	url = strings.Replace(url, "https://", "wss://", 1)
+	url = strings.Replace(url, "http://", "ws://", 1)
+	return url + "/websocket"
+}
+
+func (s *Server) Start() error {
+	mux := http.NewServeMux()
+	for path, hub := range s.hubs {
+		hub.Start()
+		mux.Handle(path, s.handler(hub))
+	}
+
+	listener, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	s.httpServer = &http.Server{Handler: mux}
+
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Logger.Error("Subscription server", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Addr is the address the server listens on once started
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Stop() {
+	for _, hub := range s.hubs {
+		hub.Stop()
+	}
+
+	if s.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.httpServer.Shutdown(ctx)
+	}
+}
+
+func (s *Server) handler(hub *Hub) http.Handler {
+	ws := websocket.Server{
+		// the proxy and non-browser clients send no Origin, the connection limit is what protects the server
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			s.serve(hub, conn)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.MaxConnections > 0 && atomic.AddInt64(&s.connections, 1) > int64(s.config.MaxConnections) {
+			atomic.AddInt64(&s.connections, -1)
+			http.Error(w, "too many connections", http.StatusServiceUnavailable)
+			return
+		}
+		defer atomic.AddInt64(&s.connections, -1)
+
+		ws.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) serve(hub *Hub, conn *websocket.Conn) {
+	conn.MaxPayloadBytes = maxMessageSize
+
+	c := newClient(conn, s.config.BufferSize)
+	go c.write()
+
+	defer func() {
+		for _, subscriber := range c.all() {
+			hub.unsubscribeClient(subscriber)
+		}
+		c.close()
+	}()
+
+	for {
+		var msg message
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				c.enqueue(message{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: -32700, Message: "parse error"}})
+				continue
+			}
+			return
+		}
+
+		result, rpcErr := s.handle(hub, c, msg)
+
+		reply := message{JSONRPC: "2.0", ID: msg.ID, Error: rpcErr}
+		if reply.ID == nil {
+			reply.ID = json.RawMessage("null")
+		}
+		if rpcErr == nil {
+			reply.Result, _ = json.Marshal(result)
+		}
+		c.enqueue(reply)
+	}
+}
+
+func (s *Server) handle(hub *Hub, c *client, msg message) (interface{}, *rpcError) {
+	if msg.JSONRPC != "2.0" || msg.Method == "" {
+		return nil, &rpcError{Code: codeInvalidRequest, Message: "invalid request"}
+	}
+
+	req, rpcErr := hub.dialect.parse(msg)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	switch req.action {
+	case actionSubscribe:
+		ref := hub.dialect.ref(req)
+		if c.get(ref) != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "already subscribed"}
+		}
+		if s.config.MaxSubscriptions > 0 && c.count() >= s.config.MaxSubscriptions {
+			return nil, &rpcError{Code: codeLimitExceeded, Message: "too many subscriptions on this connection"}
+		}
+
+		subscriber := &subscriber{client: c, ref: ref, requestID: msg.ID, filter: req.filter}
+		c.add(subscriber)
+
+		if err := hub.subscribe(subscriber, req.key, req.params); err != nil {
+			c.remove(ref)
+			return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+
+		return hub.dialect.subscribeResult(subscriber), nil
+	case actionUnsubscribe:
+		subscriber := c.remove(req.ref)
+		if subscriber == nil {
+			return nil, &rpcError{Code: codeSubscriptionGone, Message: "subscription not found"}
+		}
+
+		hub.unsubscribeClient(subscriber)
+		return hub.dialect.unsubscribeResult(), nil
+	case actionUnsubscribeAll:
+		for _, subscriber := range c.all() {
+			c.remove(subscriber.ref)
+			hub.unsubscribeClient(subscriber)
+		}
+		return hub.dialect.unsubscribeResult(), nil
+	}
+
+	return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found"}
+}
+
+// client is one websocket connection. Messages are queued and written by a single goroutine so a slow
+// reader never blocks the hub; once the queue is full the client is disconnected.
+type client struct {
+	conn      *websocket.Conn
+	queue     chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mutex         sync.Mutex
+	subscriptions map[string]*subscriber
+}
+
+func newClient(conn *websocket.Conn, bufferSize int) *client {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+
+	return &client{
+		conn:          conn,
+		queue:         make(chan []byte, bufferSize),
+		closed:        make(chan struct{}),
+		subscriptions: map[string]*subscriber{},
+	}
+}
+
+func (c *client) enqueue(msg interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Logger.Error("Subscription client - enqueue", zap.Error(err))
+		return
+	}
+
+	select {
+	case <-c.closed:
+		return
+	default:
+	}
+
+	select {
+	case c.queue <- data:
+	default:
+		logger.Logger.Warn("Subscription client - disconnecting a slow consumer", zap.String("remote", c.conn.Request().RemoteAddr))
+		c.close()
+	}
+}
+
+func (c *client) write() {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case data := <-c.queue:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := websocket.Message.Send(c.conn, string(data)); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		_ = c.conn.Close()
+	})
+}
+
+func (c *client) add(s *subscriber) {
+	c.mutex.Lock()
+	c.subscriptions[s.ref] = s
+	c.mutex.Unlock()
+}
+
+func (c *client) get(ref string) *subscriber {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.subscriptions[ref]
+}
+
+func (c *client) remove(ref string) *subscriber {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	s := c.subscriptions[ref]
+	delete(c.subscriptions, ref)
+	return s
+}
+
+// drop removes the subscription if it is still the one under its ref, reporting whether it was
+func (c *client) drop(s *subscriber) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.subscriptions[s.ref] != s {
+		return false
+	}
+	delete(c.subscriptions, s.ref)
+	return true
+}
+
+func (c *client) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.subscriptions)
+}
+
+func (c *client) all() []*subscriber {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	result := make([]*subscriber, 0, len(c.subscriptions))
+	for _, s := range c.subscriptions {
+		result = append(result, s)
+	}
+	return result
+}
@@ -0,0 +1,197 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/saiset-co/sai-service/service"
+	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interx-manager/logger"
+)
+
+// MetadataRequestID carries the request id between services, next to the W3C trace context headers
+const MetadataRequestID = "X-Request-Id"
+
+const tracerName = "github.com/saiset-co/sai-interx-manager"
+
+type Config struct {
+	Enabled bool
+	// Endpoint is the host:port of the OTLP/HTTP collector
+	Endpoint    string
+	Insecure    bool
+	SampleRatio float64
+	ServiceName string
+}
+
+type requestIDKey struct{}
+
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Init installs the tracer provider exporting spans over OTLP. Trace context is propagated even when
+// exporting is disabled, so the services around the manager still see one trace.
+func Init(config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	if !config.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// metadataCarrier reads and writes the trace context of sai-service request metadata
+type metadataCarrier map[string]interface{}
+
+func (c metadataCarrier) Get(key string) string {
+	return cast.ToString(c[key])
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// FromMetadata returns a context carrying the trace and the request id of the request metadata
+func FromMetadata(metadata interface{}) context.Context {
+	metadataMap, ok := metadata.(map[string]interface{})
+	if !ok {
+		return context.Background()
+	}
+
+	ctx := propagator.Extract(context.Background(), metadataCarrier(metadataMap))
+	if requestID := cast.ToString(metadataMap[MetadataRequestID]); requestID != "" {
+		ctx = WithRequestID(ctx, requestID)
+	}
+
+	return ctx
+}
+
+// InjectMetadata writes the trace and the request id of ctx to request metadata sent to another sai service
+func InjectMetadata(ctx context.Context, metadata map[string]interface{}) {
+	propagator.Inject(ctx, metadataCarrier(metadata))
+	if requestID := RequestID(ctx); requestID != "" {
+		metadata[MetadataRequestID] = requestID
+	}
+}
+
+// InjectHeader writes the trace and the request id of ctx to the headers of an outgoing request
+func InjectHeader(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+	if requestID := RequestID(ctx); requestID != "" {
+		header.Set(MetadataRequestID, requestID)
+	}
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+func NewRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Logger is the service logger annotated with the request id and the trace of ctx
+func Logger(ctx context.Context) *zap.Logger {
+	var fields []zap.Field
+	if requestID := RequestID(ctx); requestID != "" {
+		fields = append(fields, zap.String("request_id", requestID))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		fields = append(fields, zap.String("trace_id", spanContext.TraceID().String()), zap.String("span_id", spanContext.SpanID().String()))
+	}
+
+	return logger.Logger.With(fields...)
+}
+
+// Middleware starts the span of a request handled by the manager. The metadata passed on carries the
+// span and a request id, generated when the caller sent none, so handlers and forwarded requests continue the trace.
+func Middleware(method string) func(next service.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+	return func(next service.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+		metadataMap, _ := metadata.(map[string]interface{})
+
+		ctx := FromMetadata(metadataMap)
+		if RequestID(ctx) == "" {
+			ctx = WithRequestID(ctx, NewRequestID())
+		}
+
+		attributes := []attribute.KeyValue{attribute.String("sai.method", method), attribute.String("request.id", RequestID(ctx))}
+		if dataMap, ok := data.(map[string]interface{}); ok {
+			attributes = append(attributes,
+				attribute.String("http.method", cast.ToString(dataMap["method"])),
+				attribute.String("http.route", cast.ToString(dataMap["path"])),
+			)
+		}
+
+		ctx, span := Tracer().Start(ctx, "manager "+method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+		defer span.End()
+
+		forwarded := make(map[string]interface{}, len(metadataMap)+3)
+		for key, value := range metadataMap {
+			forwarded[key] = value
+		}
+		InjectMetadata(ctx, forwarded)
+
+		result, statusCode, err := next(data, forwarded)
+
+		span.SetAttributes(attribute.Int("http.status_code", statusCode))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return result, statusCode, err
+	}
+}
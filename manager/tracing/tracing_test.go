@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	if _, err := Init(Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	metadata := map[string]interface{}{"traceparent": traceparent, MetadataRequestID: "req-1", "ip": "10.0.0.1"}
+
+	var handlerSpan trace.SpanContext
+	var handlerRequestID string
+	var handlerMetadata map[string]interface{}
+
+	middleware := Middleware("cosmos")
+	_, code, err := middleware(func(data, meta interface{}) (interface{}, int, error) {
+		ctx := FromMetadata(meta)
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		handlerRequestID = RequestID(ctx)
+		handlerMetadata = meta.(map[string]interface{})
+		return nil, 200, nil
+	}, map[string]interface{}{"method": "GET", "path": "/status"}, metadata)
+	if err != nil || code != 200 {
+		t.Fatalf("unexpected result %d, %v", code, err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	span := spans[0]
+
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" || span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("the span does not continue the caller's trace: parent %s, trace %s", span.Parent().SpanID(), span.SpanContext().TraceID())
+	}
+	if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("the handler sees span %s, expected %s", handlerSpan.SpanID(), span.SpanContext().SpanID())
+	}
+	if handlerRequestID != "req-1" || handlerMetadata["ip"] != "10.0.0.1" {
+		t.Fatalf("the metadata was not passed on: %v", handlerMetadata)
+	}
+	if metadata["traceparent"] != traceparent {
+		t.Fatal("the caller's metadata was modified")
+	}
+}
+
+func TestMiddlewareAssignsRequestID(t *testing.T) {
+	middleware := Middleware("ethereum")
+
+	var requestID string
+	_, _, _ = middleware(func(data, meta interface{}) (interface{}, int, error) {
+		requestID = RequestID(FromMetadata(meta))
+		return nil, 200, nil
+	}, nil, map[string]interface{}{})
+
+	if len(requestID) != 32 {
+		t.Fatalf("expected a generated request id, got %q", requestID)
+	}
+}
@@ -163,6 +163,16 @@ type TxsResultResponse struct {
 	Pagination   Pagination               `json:"pagination"`
 }
 
+type BlockEventsResultResponse struct {
+	Events     []map[string]interface{} `json:"events"`
+	Pagination Pagination               `json:"pagination"`
+}
+
+type ValidatorUpdatesResultResponse struct {
+	Updates    []map[string]interface{} `json:"updates"`
+	Pagination Pagination               `json:"pagination"`
+}
+
 type TransactionResultResponse struct {
 	Time      int64         `json:"time"`
 	Hash      string        `json:"hash"`
@@ -184,6 +194,8 @@ type QueryTxsParams struct {
 	Types      []string `json:"types,omitempty"`
 	Offset     int      `json:"offset,string,omitempty"`
 	Limit      int      `json:"limit,string,omitempty"`
+	Cursor     string   `json:"cursor,omitempty"`
+	CountTotal string   `json:"count_total,omitempty"`
 }
 
 type TxResponse struct {
@@ -280,6 +292,8 @@ type Proposal struct {
 type Pagination struct {
 	NextKey string `json:"next_key"`
 	Total   int    `json:"total,string"`
+	// TotalEstimated tells that the total is a lower bound or an estimate from the collection metadata
+	TotalEstimated bool `json:"total_estimated,omitempty"`
 }
 
 type ProposalsResponse = struct {
@@ -1,7 +1,9 @@
 package types
 
+import "context"
+
 type Gateway interface {
-	Handle(data []byte) (interface{}, error)
+	Handle(ctx context.Context, data []byte) (interface{}, error)
 	Close()
 }
 
@@ -0,0 +1,151 @@
+package types
+
+import "fmt"
+
+// Rosetta Data API objects, see https://docs.cloud.coinbase.com/rosetta/docs/models
+
+type RosettaNetworkIdentifier struct {
+	Blockchain string `json:"blockchain"`
+	Network    string `json:"network"`
+}
+
+type RosettaBlockIdentifier struct {
+	Index int64  `json:"index"`
+	Hash  string `json:"hash"`
+}
+
+type RosettaPartialBlockIdentifier struct {
+	Index *int64 `json:"index,omitempty"`
+	Hash  string `json:"hash,omitempty"`
+}
+
+type RosettaTransactionIdentifier struct {
+	Hash string `json:"hash"`
+}
+
+type RosettaAccountIdentifier struct {
+	Address string `json:"address"`
+}
+
+type RosettaCurrency struct {
+	Symbol   string `json:"symbol"`
+	Decimals int32  `json:"decimals"`
+}
+
+type RosettaAmount struct {
+	Value    string          `json:"value"`
+	Currency RosettaCurrency `json:"currency"`
+}
+
+type RosettaOperationIdentifier struct {
+	Index int64 `json:"index"`
+}
+
+type RosettaOperation struct {
+	OperationIdentifier RosettaOperationIdentifier   `json:"operation_identifier"`
+	RelatedOperations   []RosettaOperationIdentifier `json:"related_operations,omitempty"`
+	Type                string                       `json:"type"`
+	Status              string                       `json:"status"`
+	Account             *RosettaAccountIdentifier    `json:"account,omitempty"`
+	Amount              *RosettaAmount               `json:"amount,omitempty"`
+}
+
+type RosettaTransaction struct {
+	TransactionIdentifier RosettaTransactionIdentifier `json:"transaction_identifier"`
+	Operations            []RosettaOperation           `json:"operations"`
+	Metadata              map[string]interface{}       `json:"metadata,omitempty"`
+}
+
+type RosettaBlock struct {
+	BlockIdentifier       RosettaBlockIdentifier `json:"block_identifier"`
+	ParentBlockIdentifier RosettaBlockIdentifier `json:"parent_block_identifier"`
+	Timestamp             int64                  `json:"timestamp"`
+	Transactions          []RosettaTransaction   `json:"transactions"`
+}
+
+type RosettaPeer struct {
+	PeerID string `json:"peer_id"`
+}
+
+type RosettaSyncStatus struct {
+	CurrentIndex int64 `json:"current_index"`
+	Synced       bool  `json:"synced"`
+}
+
+type RosettaRequest struct {
+	NetworkIdentifier     RosettaNetworkIdentifier       `json:"network_identifier"`
+	AccountIdentifier     *RosettaAccountIdentifier      `json:"account_identifier,omitempty"`
+	BlockIdentifier       *RosettaPartialBlockIdentifier `json:"block_identifier,omitempty"`
+	TransactionIdentifier *RosettaTransactionIdentifier  `json:"transaction_identifier,omitempty"`
+	Currencies            []RosettaCurrency              `json:"currencies,omitempty"`
+}
+
+type RosettaNetworkListResponse struct {
+	NetworkIdentifiers []RosettaNetworkIdentifier `json:"network_identifiers"`
+}
+
+type RosettaNetworkStatusResponse struct {
+	CurrentBlockIdentifier RosettaBlockIdentifier `json:"current_block_identifier"`
+	CurrentBlockTimestamp  int64                  `json:"current_block_timestamp"`
+	GenesisBlockIdentifier RosettaBlockIdentifier `json:"genesis_block_identifier"`
+	OldestBlockIdentifier  RosettaBlockIdentifier `json:"oldest_block_identifier"`
+	SyncStatus             RosettaSyncStatus      `json:"sync_status"`
+	Peers                  []RosettaPeer          `json:"peers"`
+}
+
+type RosettaOperationStatus struct {
+	Status     string `json:"status"`
+	Successful bool   `json:"successful"`
+}
+
+type RosettaNetworkOptionsResponse struct {
+	Version struct {
+		RosettaVersion string `json:"rosetta_version"`
+		NodeVersion    string `json:"node_version"`
+	} `json:"version"`
+	Allow struct {
+		OperationStatuses       []RosettaOperationStatus `json:"operation_statuses"`
+		OperationTypes          []string                 `json:"operation_types"`
+		Errors                  []RosettaError           `json:"errors"`
+		HistoricalBalanceLookup bool                     `json:"historical_balance_lookup"`
+		CallMethods             []string                 `json:"call_methods"`
+		BalanceExemptions       []interface{}            `json:"balance_exemptions"`
+		MempoolCoins            bool                     `json:"mempool_coins"`
+	} `json:"allow"`
+}
+
+type RosettaAccountBalanceResponse struct {
+	BlockIdentifier RosettaBlockIdentifier `json:"block_identifier"`
+	Balances        []RosettaAmount        `json:"balances"`
+}
+
+type RosettaBlockResponse struct {
+	Block RosettaBlock `json:"block"`
+}
+
+type RosettaBlockTransactionResponse struct {
+	Transaction RosettaTransaction `json:"transaction"`
+}
+
+type RosettaMempoolResponse struct {
+	TransactionIdentifiers []RosettaTransactionIdentifier `json:"transaction_identifiers"`
+}
+
+// RosettaError is both the error returned by the Rosetta gateway and the body Rosetta clients expect with it
+type RosettaError struct {
+	Code        int32                  `json:"code"`
+	Message     string                 `json:"message"`
+	Description string                 `json:"description,omitempty"`
+	Retriable   bool                   `json:"retriable"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *RosettaError) Error() string {
+	return fmt.Sprintf("rosetta error %d: %s", e.Code, e.Message)
+}
+
+// WithDetails returns a copy of the error carrying the cause
+func (e RosettaError) WithDetails(err error) *RosettaError {
+	e.Details = map[string]interface{}{"error": err.Error()}
+	return &e
+}
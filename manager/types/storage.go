@@ -1,35 +1,144 @@
 package types
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
-	"github.com/saiset-co/sai-interx-manager/logger"
+	"github.com/saiset-co/sai-interx-manager/tracing"
 	"github.com/saiset-co/sai-storage-mongo/external/adapter"
 )
 
 type Storage interface {
-	Create(collection string, document interface{}) (*adapter.SaiStorageResponse, error)
-	Read(collection string, criteria map[string]interface{}, options *adapter.Options, fields []string) (*adapter.SaiStorageResponse, error)
-	Upsert(collection string, criteria map[string]interface{}, document interface{}) (*adapter.SaiStorageResponse, error)
-	Update(collection string, criteria map[string]interface{}, document interface{}) (*adapter.SaiStorageResponse, error)
-	Delete(collection string, criteria map[string]interface{}) (*adapter.SaiStorageResponse, error)
+	Create(ctx context.Context, collection string, document interface{}) (*adapter.SaiStorageResponse, error)
+	Read(ctx context.Context, collection string, criteria map[string]interface{}, options *adapter.Options, fields []string) (*adapter.SaiStorageResponse, error)
+	ReadPage(ctx context.Context, collection string, criteria map[string]interface{}, options *PageOptions, fields []string) (*StoragePage, error)
+	Upsert(ctx context.Context, collection string, criteria map[string]interface{}, document interface{}) (*adapter.SaiStorageResponse, error)
+	Update(ctx context.Context, collection string, criteria map[string]interface{}, document interface{}) (*adapter.SaiStorageResponse, error)
+	Delete(ctx context.Context, collection string, criteria map[string]interface{}) (*adapter.SaiStorageResponse, error)
 }
 
 type storage struct {
-	saiStorage adapter.SaiStorage
+	url    string
+	token  string
+	client *http.Client
+}
+
+// storageRequest is an adapter request carrying the trace of the caller in its metadata
+type storageRequest struct {
+	adapter.Request
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Counts a page read can ask for
+const (
+	CountExact     = 1
+	CountEstimated = 2
+)
+
+// PageOptions are the read options of a page continued by a cursor, adapter.Options of sai-storage-mongo v1.1.4 has no cursor
+type PageOptions struct {
+	Limit  int64       `json:"limit"`
+	Skip   int64       `json:"skip,omitempty"`
+	Sort   interface{} `json:"sort,omitempty"`
+	Count  int64       `json:"count,omitempty"`
+	Cursor string      `json:"cursor,omitempty"`
+}
+
+type StoragePage struct {
+	Status         string                   `json:"Status"`
+	Error          string                   `json:"Error"`
+	Result         []map[string]interface{} `json:"result"`
+	Count          int                      `json:"count"`
+	CountEstimated bool                     `json:"count_estimated"`
+	Cursor         string                   `json:"cursor"`
+}
+
+type pageRequest struct {
+	adapter.ReadRequest
+	Options *PageOptions `json:"options"`
 }
 
 func NewStorage(address, token string) Storage {
 	return &storage{
-		saiStorage: adapter.SaiStorage{
-			Url:   address,
-			Token: token,
-		},
+		url:    address,
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// send posts the request to the storage worker like adapter.SaiStorage does, continuing the trace of ctx
+func (s *storage) send(ctx context.Context, request adapter.Request) (*adapter.SaiStorageResponse, error) {
+	result := new(adapter.SaiStorageResponse)
+	if err := s.sendTo(ctx, request, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// sendTo sends the request like send, decoding the response into result
+func (s *storage) sendTo(ctx context.Context, request adapter.Request, result interface{}) error {
+	collection := ""
+	if data, ok := request.Data.(adapter.IRequest); ok {
+		collection = data.GetCollection()
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "storage "+request.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.operation", request.Method), attribute.String("db.collection", collection)))
+	defer span.End()
+
+	if err := s.do(ctx, request, result); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *storage) do(ctx context.Context, request adapter.Request, result interface{}) error {
+	// the storage checks the permissions of the token in the metadata, it does not see the headers
+	body := storageRequest{Request: request, Metadata: map[string]interface{}{"token": s.token}}
+	tracing.InjectMetadata(ctx, body.Metadata)
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Token", s.token)
+	req.Header.Set("Content-Type", "application/json")
+	tracing.InjectHeader(ctx, req.Header)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
 	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse response body: %v", err)
+	}
+
+	return nil
 }
 
-func (s *storage) Create(collection string, document interface{}) (*adapter.SaiStorageResponse, error) {
+func (s *storage) Create(ctx context.Context, collection string, document interface{}) (*adapter.SaiStorageResponse, error) {
 	storageRequest := adapter.Request{
 		Method: "create",
 		Data: adapter.CreateRequest{
@@ -38,16 +147,16 @@ func (s *storage) Create(collection string, document interface{}) (*adapter.SaiS
 		},
 	}
 
-	result, err := s.saiStorage.Send(storageRequest)
+	result, err := s.send(ctx, storageRequest)
 	if err != nil {
-		logger.Logger.Error("Create", zap.Error(err))
+		tracing.Logger(ctx).Error("Create", zap.Error(err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-func (s *storage) Read(collection string, criteria map[string]interface{}, options *adapter.Options, fields []string) (*adapter.SaiStorageResponse, error) {
+func (s *storage) Read(ctx context.Context, collection string, criteria map[string]interface{}, options *adapter.Options, fields []string) (*adapter.SaiStorageResponse, error) {
 	storageRequest := adapter.Request{
 		Method: "read",
 		Data: adapter.ReadRequest{
@@ -58,16 +167,45 @@ func (s *storage) Read(collection string, criteria map[string]interface{}, optio
 		},
 	}
 
-	result, err := s.saiStorage.Send(storageRequest)
+	result, err := s.send(ctx, storageRequest)
 	if err != nil {
-		logger.Logger.Error("Read", zap.Error(err))
+		tracing.Logger(ctx).Error("Read", zap.Error(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ReadPage reads a page of documents, the cursor of a full page reads the page after it
+func (s *storage) ReadPage(ctx context.Context, collection string, criteria map[string]interface{}, options *PageOptions, fields []string) (*StoragePage, error) {
+	storageRequest := adapter.Request{
+		Method: "read",
+		Data: pageRequest{
+			ReadRequest: adapter.ReadRequest{
+				Collection:    collection,
+				Select:        criteria,
+				IncludeFields: fields,
+			},
+			Options: options,
+		},
+	}
+
+	result := new(StoragePage)
+	if err := s.sendTo(ctx, storageRequest, result); err != nil {
+		tracing.Logger(ctx).Error("ReadPage", zap.Error(err))
+		return nil, err
+	}
+
+	if result.Status == "NOK" {
+		err := fmt.Errorf("storage read failed: %s", result.Error)
+		tracing.Logger(ctx).Error("ReadPage", zap.Error(err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-func (s *storage) Update(collection string, criteria map[string]interface{}, document interface{}) (*adapter.SaiStorageResponse, error) {
+func (s *storage) Update(ctx context.Context, collection string, criteria map[string]interface{}, document interface{}) (*adapter.SaiStorageResponse, error) {
 	storageRequest := adapter.Request{
 		Method: "update",
 		Data: adapter.UpdateRequest{
@@ -77,16 +215,16 @@ func (s *storage) Update(collection string, criteria map[string]interface{}, doc
 		},
 	}
 
-	result, err := s.saiStorage.Send(storageRequest)
+	result, err := s.send(ctx, storageRequest)
 	if err != nil {
-		logger.Logger.Error("Update", zap.Error(err))
+		tracing.Logger(ctx).Error("Update", zap.Error(err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-func (s *storage) Upsert(collection string, criteria map[string]interface{}, document interface{}) (*adapter.SaiStorageResponse, error) {
+func (s *storage) Upsert(ctx context.Context, collection string, criteria map[string]interface{}, document interface{}) (*adapter.SaiStorageResponse, error) {
 	storageRequest := adapter.Request{
 		Method: "upsert",
 		Data: adapter.UpsertRequest{
@@ -96,16 +234,16 @@ func (s *storage) Upsert(collection string, criteria map[string]interface{}, doc
 		},
 	}
 
-	result, err := s.saiStorage.Send(storageRequest)
+	result, err := s.send(ctx, storageRequest)
 	if err != nil {
-		logger.Logger.Error("Upsert", zap.Error(err))
+		tracing.Logger(ctx).Error("Upsert", zap.Error(err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-func (s *storage) Delete(collection string, criteria map[string]interface{}) (*adapter.SaiStorageResponse, error) {
+func (s *storage) Delete(ctx context.Context, collection string, criteria map[string]interface{}) (*adapter.SaiStorageResponse, error) {
 	storageRequest := adapter.Request{
 		Method: "delete",
 		Data: adapter.DeleteRequest{
@@ -114,9 +252,9 @@ func (s *storage) Delete(collection string, criteria map[string]interface{}) (*a
 		},
 	}
 
-	result, err := s.saiStorage.Send(storageRequest)
+	result, err := s.send(ctx, storageRequest)
 	if err != nil {
-		logger.Logger.Error("Delete", zap.Error(err))
+		tracing.Logger(ctx).Error("Delete", zap.Error(err))
 		return nil, err
 	}
 
@@ -25,7 +25,44 @@ type EVMStatus struct {
 		LatestBlockHeight   uint64 `json:"latest_block_height"`
 		LatestBlockTime     uint64 `json:"latest_block_time"`
 	} `json:"sync_info"`
-	GasPrice string `json:"gas_price"`
+	GasPrice  string              `json:"gas_price"`
+	Endpoints []EVMEndpointHealth `json:"endpoints"`
+}
+
+type EVMEndpointHealth struct {
+	URL       string  `json:"url"`
+	Archive   bool    `json:"archive"`
+	Healthy   bool    `json:"healthy"`
+	Head      uint64  `json:"head"`
+	HeadLag   uint64  `json:"head_lag"`
+	LatencyMs int64   `json:"latency_ms"`
+	ErrorRate float64 `json:"error_rate"`
+	LastError string  `json:"last_error,omitempty"`
+	CheckedAt int64   `json:"checked_at"`
+}
+
+type BTCStatus struct {
+	NodeInfo struct {
+		Network    string `json:"network"`
+		RPCAddress string `json:"rpc_address"`
+		Version    struct {
+			Node       int64  `json:"node"`
+			SubVersion string `json:"sub_version"`
+			Protocol   int64  `json:"protocol"`
+		} `json:"version"`
+		Connections int64 `json:"connections"`
+	} `json:"node_info"`
+	SyncInfo struct {
+		CatchingUp           bool    `json:"catching_up"`
+		VerificationProgress float64 `json:"verification_progress"`
+		EarliestBlockHash    string  `json:"earliest_block_hash"`
+		EarliestBlockHeight  uint64  `json:"earliest_block_height"`
+		EarliestBlockTime    uint64  `json:"earliest_block_time"`
+		LatestBlockHash      string  `json:"latest_block_hash"`
+		LatestBlockHeight    uint64  `json:"latest_block_height"`
+		LatestBlockTime      uint64  `json:"latest_block_time"`
+	} `json:"sync_info"`
+	FeeRate string `json:"fee_rate"`
 }
 
 type IdentityRecord struct {
@@ -2,17 +2,25 @@ package internal
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/rs/cors"
 	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/saiset-co/sai-interax-proxy/logger"
+	"github.com/saiset-co/sai-interax-proxy/tracing"
 	"github.com/saiset-co/sai-interax-proxy/types"
 	"github.com/saiset-co/sai-service/service"
 )
@@ -20,10 +28,23 @@ import (
 type InternalService struct {
 	Context  *service.Context
 	ProxyUrl string
+	WsUrl    string
 }
 
 func (is *InternalService) Init() {
 	is.ProxyUrl = cast.ToString(is.Context.GetConfig("manager.url", ""))
+	is.WsUrl = cast.ToString(is.Context.GetConfig("manager.ws_url", ""))
+
+	_, err := tracing.Init(tracing.Config{
+		Enabled:     cast.ToBool(is.Context.GetConfig("tracing.enabled", false)),
+		Endpoint:    cast.ToString(is.Context.GetConfig("tracing.endpoint", "otel-collector:4318")),
+		Insecure:    cast.ToBool(is.Context.GetConfig("tracing.insecure", true)),
+		SampleRatio: cast.ToFloat64(is.Context.GetConfig("tracing.sample_ratio", 1.0)),
+		ServiceName: cast.ToString(is.Context.GetConfig("tracing.service_name", "sai-interax-proxy")),
+	})
+	if err != nil {
+		logger.Logger.Error("Init", zap.Error(err))
+	}
 }
 
 func (is *InternalService) Process() {
@@ -36,6 +57,16 @@ func (is *InternalService) StartHttpProxy() {
 	corsHandler := cors.AllowAll().Handler(handler)
 
 	http.Handle("/", corsHandler)
+
+	if is.WsUrl != "" {
+		relay := newWebsocketRelay(
+			is.WsUrl,
+			cast.ToInt(is.Context.GetConfig("subscriptions.max_connections", 1000)),
+			cast.ToInt(is.Context.GetConfig("subscriptions.max_connections_per_ip", 10)),
+		)
+		http.Handle("/ws/", relay)
+		http.Handle("/api/ws/", relay)
+	}
 	logger.Logger.Info("Starting HTTP server on port", zap.Int("Port", port))
 
 	err := http.ListenAndServe(":"+strconv.Itoa(port), nil)
@@ -44,32 +75,73 @@ func (is *InternalService) StartHttpProxy() {
 	}
 }
 
+// forwardedHeaders are passed on to the manager, as headers and as request metadata for the handlers
+var forwardedHeaders = []string{"Authorization", "X-Forwarded-For", "X-Request-Id", "X-Min-Height"}
+
+// ProxyResponse is what the manager answered
+type ProxyResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// ErrorResponse is the error body of interx
+type ErrorResponse struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
 func (is *InternalService) handleHttpConnections(w http.ResponseWriter, r *http.Request) {
-	logger.Logger.Debug("handleHttpConnections", zap.Any("method", r.Method), zap.Any("path", r.URL.Path))
+
+	requestID := r.Header.Get("X-Request-Id")
+	if requestID == "" {
+		requestID = newRequestID()
+		r.Header.Set("X-Request-Id", requestID)
+	}
+	w.Header().Set("X-Request-Id", requestID)
+
+	ctx := tracing.WithRequestID(tracing.Extract(r.Context(), r.Header), requestID)
+	ctx, span := tracing.Tracer().Start(ctx, "proxy "+r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("http.method", r.Method),
+		attribute.String("http.target", r.URL.Path),
+		attribute.String("request.id", requestID),
+	))
+	defer span.End()
+
+	tracing.Logger(ctx).Debug("handleHttpConnections", zap.Any("method", r.Method), zap.Any("path", r.URL.Path))
+
+	if spanContext := span.SpanContext(); spanContext.HasTraceID() {
+		w.Header().Set("X-Trace-Id", spanContext.TraceID().String())
+	}
+
+	// the manager sees the address the connection comes from after any the client reported
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		r.Header.Set("X-Forwarded-For", forwarded+", "+clientIP(r))
+	} else {
+		r.Header.Set("X-Forwarded-For", clientIP(r))
+	}
 
 	var requestData interface{}
 
-	if r.Method == "GET" {
-		queryParams := r.URL.Query()
-		paramMap := make(map[string]string)
-		for key, values := range queryParams {
-			if len(values) > 0 {
-				paramMap[key] = values[0]
-			}
-		}
-		requestData = paramMap
-	} else if r.Method == "POST" {
+	switch r.Method {
+	case http.MethodGet:
+		requestData = queryParams(r)
+	case http.MethodPost, http.MethodPut, http.MethodDelete:
 		body, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
 
 		if err != nil {
-			logger.Logger.Error("handleHttpConnections", zap.Error(err))
-			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			tracing.Logger(ctx).Error("handleHttpConnections", zap.Error(err))
+			writeError(w, http.StatusBadRequest, "Error reading request body", nil)
 			return
 		}
 
-		if r.Header.Get("Content-Type") == "application/json" {
-			var jsonData map[string]interface{}
+		if len(body) == 0 && r.Method == http.MethodDelete {
+			requestData = queryParams(r)
+		} else if isJSON(r.Header.Get("Content-Type")) {
+			// objects and arrays alike, a JSON-RPC batch is an array
+			var jsonData interface{}
 			if err := json.Unmarshal(body, &jsonData); err == nil {
 				requestData = jsonData
 			} else {
@@ -78,6 +150,10 @@ func (is *InternalService) handleHttpConnections(w http.ResponseWriter, r *http.
 		} else {
 			requestData = string(body)
 		}
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", r.Method)
+		return
 	}
 
 	method := determineMethod(r.URL.Path)
@@ -96,32 +172,122 @@ func (is *InternalService) handleHttpConnections(w http.ResponseWriter, r *http.
 		},
 	}
 
-	response, err := is.SendProxyRequest(request)
+	headers := http.Header{}
+	request.Metadata = map[string]interface{}{}
+	for _, name := range forwardedHeaders {
+		if value := r.Header.Get(name); value != "" {
+			headers.Set(name, value)
+			request.Metadata[name] = value
+		}
+	}
+	headers.Set("X-Real-Ip", clientIP(r))
+	tracing.Inject(ctx, headers, request.Metadata)
+
+	response, err := is.SendProxyRequest(ctx, request, headers)
 	if err != nil {
-		logger.Logger.Error("handleHttpConnections", zap.Error(err))
-		http.Error(w, "Error processing request", http.StatusInternalServerError)
+		tracing.Logger(ctx).Error("handleHttpConnections", zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		writeError(w, http.StatusBadGateway, "Error processing request", nil)
 		return
 	}
 
+	span.SetAttributes(attribute.Int("http.status_code", response.StatusCode))
+	if response.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(response.StatusCode))
+	}
+
+	writeResponse(w, response)
+}
+
+// writeResponse passes the answer of the manager on, turning its error bodies into interx errors
+func writeResponse(w http.ResponseWriter, response *ProxyResponse) {
+	if response.StatusCode >= http.StatusBadRequest {
+		var managerErr struct {
+			Status string      `json:"Status"`
+			Error  interface{} `json:"Error"`
+		}
+		if json.Unmarshal(response.Body, &managerErr) == nil && managerErr.Status == "NOK" {
+			writeError(w, response.StatusCode, cast.ToString(managerErr.Error), nil)
+			return
+		}
+	}
+
+	contentType := response.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(response.StatusCode)
+	_, _ = w.Write(response.Body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string, details interface{}) {
+	body, _ := json.Marshal(ErrorResponse{Code: statusCode, Message: message, Details: details})
+
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(response)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
 }
 
-func (is *InternalService) SendProxyRequest(r types.SaiRequest) ([]byte, error) {
+func (is *InternalService) SendProxyRequest(ctx context.Context, r types.SaiRequest, headers http.Header) (*ProxyResponse, error) {
 	reqData, err := json.Marshal(r)
 	if err != nil {
-		logger.Logger.Error("SendProxyRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("SendProxyRequest", zap.Error(err))
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, is.ProxyUrl, bytes.NewReader(reqData))
+	if err != nil {
+		tracing.Logger(ctx).Error("SendProxyRequest", zap.Error(err))
 		return nil, err
 	}
 
-	resp, err := http.Post(is.ProxyUrl, "application/json", io.NopCloser(io.Reader(bytes.NewBuffer(reqData))))
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		logger.Logger.Error("SendProxyRequest", zap.Error(err))
+		tracing.Logger(ctx).Error("SendProxyRequest", zap.Error(err))
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tracing.Logger(ctx).Error("SendProxyRequest", zap.Error(err))
+		return nil, err
+	}
+
+	return &ProxyResponse{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        body,
+	}, nil
+}
+
+func queryParams(r *http.Request) map[string]string {
+	paramMap := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		if len(values) > 0 {
+			paramMap[key] = values[0]
+		}
+	}
+	return paramMap
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
 }
 
 func determineMethod(path string) string {
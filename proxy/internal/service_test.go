@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-interax-proxy/logger"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+// contractCase is a request to the proxy, what the manager answers it and what legacy interx answered
+type contractCase struct {
+	Name    string `json:"name"`
+	Request struct {
+		Method  string            `json:"method"`
+		Path    string            `json:"path"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body"`
+	} `json:"request"`
+	Manager *struct {
+		// Expect holds the fields the manager must receive, metadata is compared key by key
+		Expect *struct {
+			Method   string                 `json:"method"`
+			Data     json.RawMessage        `json:"data"`
+			Metadata map[string]interface{} `json:"metadata"`
+		} `json:"expect"`
+		Status int             `json:"status"`
+		Body   json.RawMessage `json:"body"`
+	} `json:"manager"`
+	Interx struct {
+		Status  int               `json:"status"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body"`
+	} `json:"interx"`
+}
+
+func equalJSON(t *testing.T, expected, actual []byte) bool {
+	var e, a interface{}
+	if err := json.Unmarshal(expected, &e); err != nil {
+		t.Fatalf("expected body is not JSON: %v", err)
+	}
+	if err := json.Unmarshal(actual, &a); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(e, a)
+}
+
+func TestInterxContract(t *testing.T) {
+	data, err := os.ReadFile("testdata/interx_contract.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cases []contractCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c.Manager == nil {
+					t.Error("the request should not reach the manager")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				var received struct {
+					Method   string                 `json:"method"`
+					Data     json.RawMessage        `json:"data"`
+					Metadata map[string]interface{} `json:"metadata"`
+				}
+				body, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(body, &received); err != nil {
+					t.Errorf("manager request: %v", err)
+				}
+
+				if expect := c.Manager.Expect; expect != nil {
+					if received.Method != expect.Method || !equalJSON(t, expect.Data, received.Data) {
+						t.Errorf("manager received %s %s, expected %s %s", received.Method, received.Data, expect.Method, expect.Data)
+					}
+					for key, value := range expect.Metadata {
+						if received.Metadata[key] != value {
+							t.Errorf("metadata %s is %v, expected %v", key, received.Metadata[key], value)
+						}
+						if r.Header.Get(key) != value {
+							t.Errorf("header %s is %q, expected %v", key, r.Header.Get(key), value)
+						}
+					}
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(c.Manager.Status)
+				_, _ = w.Write(c.Manager.Body)
+			}))
+			defer manager.Close()
+
+			is := &InternalService{ProxyUrl: manager.URL}
+
+			req := httptest.NewRequest(c.Request.Method, c.Request.Path, bytes.NewReader(c.Request.Body))
+			for name, value := range c.Request.Headers {
+				req.Header.Set(name, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			is.handleHttpConnections(recorder, req)
+
+			if recorder.Code != c.Interx.Status {
+				t.Errorf("status %d, interx answered %d", recorder.Code, c.Interx.Status)
+			}
+			for name, value := range c.Interx.Headers {
+				if recorder.Header().Get(name) != value {
+					t.Errorf("header %s is %q, interx sent %q", name, recorder.Header().Get(name), value)
+				}
+			}
+			if recorder.Header().Get("X-Request-Id") == "" {
+				t.Error("the response carries no request id")
+			}
+			if !equalJSON(t, c.Interx.Body, recorder.Body.Bytes()) {
+				t.Errorf("body %s, interx answered %s", recorder.Body.String(), c.Interx.Body)
+			}
+		})
+	}
+}
+
+func TestManagerUnavailable(t *testing.T) {
+	manager := httptest.NewServer(http.NotFoundHandler())
+	manager.Close()
+
+	is := &InternalService{ProxyUrl: manager.URL}
+
+	recorder := httptest.NewRecorder()
+	is.handleHttpConnections(recorder, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+
+	if recorder.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", recorder.Code)
+	}
+
+	var body ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.Code != http.StatusBadGateway || body.Message == "" {
+		t.Fatalf("unexpected error body %s", recorder.Body.String())
+	}
+}
+
+func TestTraceContextReachesManager(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	var metadata map[string]interface{}
+	var header http.Header
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received struct {
+			Metadata map[string]interface{} `json:"metadata"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		metadata, header = received.Metadata, r.Header
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer manager.Close()
+
+	is := &InternalService{ProxyUrl: manager.URL}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	recorder := httptest.NewRecorder()
+	is.handleHttpConnections(recorder, req)
+
+	traceparent, _ := metadata["traceparent"].(string)
+	if !strings.Contains(traceparent, traceID) || header.Get("traceparent") != traceparent {
+		t.Fatalf("the trace was not passed on: metadata %v, header %q", metadata, header.Get("traceparent"))
+	}
+	if metadata["X-Request-Id"] != recorder.Header().Get("X-Request-Id") {
+		t.Fatalf("the manager got request id %v, the client %q", metadata["X-Request-Id"], recorder.Header().Get("X-Request-Id"))
+	}
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"github.com/saiset-co/sai-interax-proxy/logger"
+)
+
+// maxWebsocketMessage caps what a client may send in one message
+const maxWebsocketMessage = 64 * 1024
+
+// websocketRelay passes websocket connections of clients on to the subscription server of the manager.
+// The manager owns the subscriptions, the relay only limits how many connections a client may open.
+type websocketRelay struct {
+	managerURL       string
+	maxConnections   int64
+	maxConnectionsIP int
+
+	connections int64
+	mutex       sync.Mutex
+	perIP       map[string]int
+}
+
+func newWebsocketRelay(managerURL string, maxConnections, maxConnectionsIP int) *websocketRelay {
+	return &websocketRelay{
+		managerURL:       strings.TrimSuffix(managerURL, "/"),
+		maxConnections:   int64(maxConnections),
+		maxConnectionsIP: maxConnectionsIP,
+		perIP:            map[string]int{},
+	}
+}
+
+func (wr *websocketRelay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip := clientIP(r)
+
+	if !wr.acquire(ip) {
+		http.Error(w, "Too many connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer wr.release(ip)
+
+	server := websocket.Server{
+		// browsers on any origin may subscribe, as they may call the HTTP API
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			wr.relay(conn, strings.Replace(r.URL.Path, "/api", "", 1))
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func (wr *websocketRelay) acquire(ip string) bool {
+	if wr.maxConnections > 0 && atomic.AddInt64(&wr.connections, 1) > wr.maxConnections {
+		atomic.AddInt64(&wr.connections, -1)
+		return false
+	}
+
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+
+	if wr.maxConnectionsIP > 0 && wr.perIP[ip] >= wr.maxConnectionsIP {
+		if wr.maxConnections > 0 {
+			atomic.AddInt64(&wr.connections, -1)
+		}
+		return false
+	}
+	wr.perIP[ip]++
+
+	return true
+}
+
+func (wr *websocketRelay) release(ip string) {
+	if wr.maxConnections > 0 {
+		atomic.AddInt64(&wr.connections, -1)
+	}
+
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+
+	wr.perIP[ip]--
+	if wr.perIP[ip] <= 0 {
+		delete(wr.perIP, ip)
+	}
+}
+
+// relay copies messages both ways until either side closes. Copying is synchronous, so a client that
+// does not read stalls its upstream connection and the manager disconnects it once its queue is full.
+func (wr *websocketRelay) relay(client *websocket.Conn, path string) {
+	defer client.Close()
+	client.MaxPayloadBytes = maxWebsocketMessage
+
+	upstream, err := websocket.Dial(wr.managerURL+path, "", "http://localhost/")
+	if err != nil {
+		logger.Logger.Error("websocketRelay", zap.String("path", path), zap.Error(err))
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+
+	go func() {
+		pipe(upstream, client)
+		done <- struct{}{}
+	}()
+	go func() {
+		pipe(client, upstream)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+func pipe(dst, src *websocket.Conn) {
+	for {
+		var message string
+		if err := websocket.Message.Receive(src, &message); err != nil {
+			return
+		}
+		if err := websocket.Message.Send(dst, message); err != nil {
+			return
+		}
+	}
+}
+
+// clientIP is the address the connection comes from. X-Forwarded-For is not trusted, a client could set it
+// to get around the per-address limit.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
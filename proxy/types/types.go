@@ -7,6 +7,7 @@ type SaiData struct {
 }
 
 type SaiRequest struct {
-	Method string      `json:"method"`
-	Data   interface{} `json:"data"`
+	Method   string                 `json:"method"`
+	Data     interface{}            `json:"data"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"sort"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/saiCosmosIndexer/internal/model"
+	"github.com/saiset-co/saiCosmosIndexer/logger"
+)
+
+// isAddress tells if a value is an account, a validator or a consensus address of the chain
+func isAddress(value string) bool {
+	hrp, _, err := bech32.DecodeAndConvert(value)
+	if err != nil {
+		return false
+	}
+
+	config := sdk.GetConfig()
+
+	return hrp == config.GetBech32AccountAddrPrefix() || hrp == config.GetBech32ValidatorAddrPrefix() ||
+		hrp == config.GetBech32ConsensusAddrPrefix()
+}
+
+// eventAddresses returns the addresses in the attributes of an event
+func eventAddresses(event model.Event) []string {
+	found := map[string]struct{}{}
+	for _, attribute := range event.Attributes {
+		if isAddress(attribute.Value) {
+			found[attribute.Value] = struct{}{}
+		}
+	}
+
+	return sortedAddresses(found)
+}
+
+// collectAddresses adds the addresses found in the strings of a decoded message, at any depth
+func collectAddresses(value interface{}, found map[string]struct{}) {
+	switch typed := value.(type) {
+	case string:
+		if isAddress(typed) {
+			found[typed] = struct{}{}
+		}
+	case map[string]interface{}:
+		for _, item := range typed {
+			collectAddresses(item, found)
+		}
+	case model.Message:
+		collectAddresses(map[string]interface{}(typed), found)
+	case []interface{}:
+		for _, item := range typed {
+			collectAddresses(item, found)
+		}
+	}
+}
+
+func sortedAddresses(found map[string]struct{}) []string {
+	addresses := make([]string, 0, len(found))
+	for address := range found {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// txAddresses returns the signers of a tx and every address it involves: the signers, the addresses in the fields
+// of its messages and in the attributes of its events, such as the recipients of transfers. A tx the codec could
+// not decode has no signers and no messages, its events are still read.
+func txAddresses(tx sdk.Tx, txRes model.Tx) (addresses []string, signers []string) {
+	found := map[string]struct{}{}
+	signed := map[string]struct{}{}
+
+	if tx != nil {
+		for _, msg := range tx.GetMsgs() {
+			for _, signer := range msg.GetSigners() {
+				signed[signer.String()] = struct{}{}
+				found[signer.String()] = struct{}{}
+			}
+		}
+	}
+
+	for _, message := range txRes.Messages {
+		collectAddresses(message, found)
+	}
+
+	for _, event := range txRes.TxResult.Events {
+		for _, address := range eventAddresses(event) {
+			found[address] = struct{}{}
+		}
+	}
+
+	return sortedAddresses(found), sortedAddresses(signed)
+}
+
+// balanceDeltas sums the coin_spent and coin_received events of a tx into the balance change of every address
+// and denom, fees included
+func balanceDeltas(txRes model.Tx) map[string]map[string]sdk.Int {
+	deltas := map[string]map[string]sdk.Int{}
+
+	for _, event := range txRes.TxResult.Events {
+		var key string
+		switch event.Type {
+		case "coin_spent":
+			key = "spender"
+		case "coin_received":
+			key = "receiver"
+		default:
+			continue
+		}
+
+		var address, amount string
+		for _, attribute := range event.Attributes {
+			switch attribute.Key {
+			case key:
+				address = attribute.Value
+			case "amount":
+				amount = attribute.Value
+			}
+		}
+		if address == "" || amount == "" {
+			continue
+		}
+
+		coins, err := sdk.ParseCoinsNormalized(amount)
+		if err != nil {
+			logger.Logger.Error("balanceDeltas", zap.String("hash", txRes.Hash), zap.String("amount", amount), zap.Error(err))
+			continue
+		}
+
+		if deltas[address] == nil {
+			deltas[address] = map[string]sdk.Int{}
+		}
+		for _, coin := range coins {
+			delta, ok := deltas[address][coin.Denom]
+			if !ok {
+				delta = sdk.ZeroInt()
+			}
+			if event.Type == "coin_spent" {
+				deltas[address][coin.Denom] = delta.Sub(coin.Amount)
+			} else {
+				deltas[address][coin.Denom] = delta.Add(coin.Amount)
+			}
+		}
+	}
+
+	return deltas
+}
+
+func (is *InternalService) isTracked(address string) bool {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	_, ok := is.addresses[address]
+
+	return ok
+}
+
+// accountHistory returns the history entries of the tracked addresses a tx involves, with their balance changes
+func (is *InternalService) accountHistory(txRes model.Tx) []model.AccountHistory {
+	var history []model.AccountHistory
+	deltas := balanceDeltas(txRes)
+
+	for _, address := range txRes.Addresses {
+		if !is.isTracked(address) {
+			continue
+		}
+
+		entry := model.AccountHistory{
+			Address:     address,
+			Hash:        txRes.Hash,
+			BlockHeight: txRes.BlockHeight,
+			Timestamp:   txRes.Timestamp,
+			Code:        txRes.TxResult.Code,
+			Deltas:      []model.Amount{},
+		}
+
+		denoms := make([]string, 0, len(deltas[address]))
+		for denom := range deltas[address] {
+			denoms = append(denoms, denom)
+		}
+		sort.Strings(denoms)
+
+		for _, denom := range denoms {
+			if delta := deltas[address][denom]; !delta.IsZero() {
+				entry.Deltas = append(entry.Deltas, model.Amount{Denom: denom, Amount: delta.String()})
+			}
+		}
+
+		history = append(history, entry)
+	}
+
+	return history
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/external/adapter"
+	"github.com/saiset-co/saiCosmosIndexer/internal/model"
+	"github.com/saiset-co/saiCosmosIndexer/logger"
+)
+
+func (is *InternalService) getBackfilled() *model.Checkpoint {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	return is.backfilled
+}
+
+func (is *InternalService) setBackfilled(checkpoint model.Checkpoint) {
+	is.mu.Lock()
+	is.backfilled = &checkpoint
+	is.mu.Unlock()
+}
+
+// startBackfill stores the backfill checkpoint for the heights from..to the head follower starts above. A backfill
+// left from a start that did not store a head checkpoint keeps its progress.
+func (is *InternalService) startBackfill(from, to int64) error {
+	if from < 1 {
+		from = 1
+	}
+
+	checkpoint := model.Checkpoint{Name: backfillCheckpoint, Height: from - 1}
+
+	stored, err := is.readCheckpoint(backfillCheckpoint)
+	if err != nil {
+		return err
+	}
+	if stored != nil {
+		checkpoint = *stored
+	}
+
+	if checkpoint.Target < to {
+		checkpoint.Target = to
+	}
+	if checkpoint.Height >= checkpoint.Target {
+		return nil
+	}
+	checkpoint.UpdatedAt = time.Now().UTC()
+
+	return is.sendBatches([]adapter.Request{is.checkpointOperation(checkpoint)})
+}
+
+// backfill indexes the heights below the point the head follower started at, next to it and up to the target
+// of the backfill checkpoint
+func (is *InternalService) backfill() {
+	if !is.config.Backfill {
+		return
+	}
+
+	sleepDuration := cast.ToDuration(is.Context.GetConfig("sleep_duration", 2))
+
+	for {
+		select {
+		case <-is.Context.Context.Done():
+			return
+		default:
+			checkpoint := is.getBackfilled()
+			if checkpoint == nil {
+				stored, err := is.readCheckpoint(backfillCheckpoint)
+				if err != nil {
+					logger.Logger.Error("backfill", zap.Error(err))
+					time.Sleep(time.Second * sleepDuration)
+					continue
+				}
+				if stored == nil {
+					return
+				}
+
+				is.setBackfilled(*stored)
+				checkpoint = stored
+			}
+
+			if checkpoint.Height >= checkpoint.Target {
+				logger.Logger.Info("backfill is done", zap.Int64("height", checkpoint.Height))
+				return
+			}
+
+			err := is.indexRange(checkpoint.Height+1, checkpoint.Target, is.config.BackfillConcurrency, is.commitBackfill)
+			if err != nil {
+				logger.Logger.Error("backfill", zap.Error(err))
+				time.Sleep(time.Second * sleepDuration)
+			}
+		}
+	}
+}
+
+// commitBackfill stores a height of the backfill with its checkpoint. The heights are below the head, their
+// txs are not sent to the notifier.
+func (is *InternalService) commitBackfill(data *heightData) error {
+	checkpoint := *is.getBackfilled()
+	checkpoint.Height = data.height
+	checkpoint.Hash = data.block.BlockId.Hash
+	checkpoint.UpdatedAt = time.Now().UTC()
+
+	err := is.storeHeight(data, &checkpoint)
+	if err != nil {
+		return err
+	}
+
+	is.setBackfilled(checkpoint)
+	is.metrics.committed(backfillCheckpoint)
+
+	return nil
+}
@@ -6,7 +6,6 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 
 	jsoniter "github.com/json-iterator/go"
@@ -34,9 +33,9 @@ func (is *InternalService) getLatestBlock() (*model.LatestBlock, error) {
 	return lb, err
 }
 
-func (is *InternalService) getBlockInfo() (*model.BlockInfo, error) {
+func (is *InternalService) getBlockInfo(height int64) (*model.BlockInfo, error) {
 	var query = url.Values{}
-	query.Add("height", fmt.Sprintf("\"%d\"", is.currentBlock))
+	query.Add("height", fmt.Sprintf("\"%d\"", height))
 
 	res, err := is.makeTendermintRPCRequest("/block", query.Encode())
 	if err != nil {
@@ -54,28 +53,60 @@ func (is *InternalService) getBlockInfo() (*model.BlockInfo, error) {
 	return blockInfo, nil
 }
 
-func (is *InternalService) getBlockTxs() ([]model.Tx, error) {
+func (is *InternalService) getBlockResults(height int64) (*model.BlockResults, error) {
 	var query = url.Values{}
-	if is.config.TxType != "" {
-		query.Add("query", fmt.Sprintf("\"tx.height=%d AND message.action='%s'\"", is.currentBlock, is.config.TxType))
-	} else {
-		query.Add("query", fmt.Sprintf("\"tx.height=%d\"", is.currentBlock))
-	}
+	query.Add("height", fmt.Sprintf("\"%d\"", height))
 
-	res, err := is.makeTendermintRPCRequest("/tx_search", query.Encode())
+	res, err := is.makeTendermintRPCRequest("/block_results", query.Encode())
 	if err != nil {
-		logger.Logger.Error("getBlockTxs", zap.Error(err))
+		logger.Logger.Error("getBlockResults", zap.Error(err))
 		return nil, err
 	}
 
-	blockInfo := model.BlockTransactions{}
-	err = jsoniter.Unmarshal(res, &blockInfo)
+	var blockResults = new(model.BlockResults)
+	err = jsoniter.Unmarshal(res, blockResults)
 	if err != nil {
-		logger.Logger.Error("getBlockTxs", zap.Error(err))
+		logger.Logger.Error("getBlockResults", zap.Error(err))
 		return nil, err
 	}
 
-	return blockInfo.Txs, nil
+	return blockResults, nil
+}
+
+// getBlockTxs reads every page of the txs of a height, tx_search returns 30 of them per page by default
+func (is *InternalService) getBlockTxs(height int64) ([]model.Tx, error) {
+	var txs []model.Tx
+
+	for page := 1; ; page++ {
+		var query = url.Values{}
+		if is.config.TxType != "" {
+			query.Add("query", fmt.Sprintf("\"tx.height=%d AND message.action='%s'\"", height, is.config.TxType))
+		} else {
+			query.Add("query", fmt.Sprintf("\"tx.height=%d\"", height))
+		}
+		query.Add("page", fmt.Sprintf("\"%d\"", page))
+		query.Add("per_page", fmt.Sprintf("\"%d\"", txSearchPageSize))
+
+		res, err := is.makeTendermintRPCRequest("/tx_search", query.Encode())
+		if err != nil {
+			logger.Logger.Error("getBlockTxs", zap.Error(err))
+			return nil, err
+		}
+
+		blockInfo := model.BlockTransactions{}
+		err = jsoniter.Unmarshal(res, &blockInfo)
+		if err != nil {
+			logger.Logger.Error("getBlockTxs", zap.Error(err))
+			return nil, err
+		}
+
+		txs = append(txs, blockInfo.Txs...)
+
+		total, _ := strconv.Atoi(blockInfo.TotalCount)
+		if len(blockInfo.Txs) == 0 || len(txs) >= total {
+			return txs, nil
+		}
+	}
 }
 
 func (is *InternalService) makeTendermintRPCRequest(url string, query string) ([]byte, error) {
@@ -115,7 +146,3 @@ func (is *InternalService) makeTendermintRPCRequest(url string, query string) ([
 
 	return result.Result, nil
 }
-
-func (is *InternalService) rewriteLastHandledBlock(blockHeight int64) error {
-	return os.WriteFile(filePathLatestBlock, []byte(strconv.Itoa(int(blockHeight))), os.ModePerm)
-}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/external/adapter"
+	"github.com/saiset-co/saiCosmosIndexer/internal/model"
+	"github.com/saiset-co/saiCosmosIndexer/logger"
+	"github.com/saiset-co/saiCosmosIndexer/utils"
+)
+
+const (
+	headCheckpoint     = "head"
+	backfillCheckpoint = "backfill"
+)
+
+// errFork is returned for a block that does not follow the block stored at the checkpoint
+var errFork = errors.New("the chain does not continue the checkpoint")
+
+func (is *InternalService) getCheckpoint() model.Checkpoint {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	return is.checkpoint
+}
+
+func (is *InternalService) setCheckpoint(checkpoint model.Checkpoint) {
+	is.mu.Lock()
+	is.checkpoint = checkpoint
+	is.mu.Unlock()
+}
+
+// readCheckpoint returns the checkpoint of a name from storage, nil when there is none
+func (is *InternalService) readCheckpoint(name string) (*model.Checkpoint, error) {
+	storageRequest := adapter.Request{
+		Method: "read",
+		Data: adapter.ReadRequest{
+			Collection: is.storageConfig.Collection + "_checkpoints",
+			Select:     map[string]interface{}{"name": name},
+			Options:    &adapter.Options{Limit: 1},
+		},
+		Metadata: map[string]interface{}{"token": is.storageConfig.Token},
+	}
+
+	bodyBytes, err := jsoniter.Marshal(&storageRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := utils.SaiQuerySender(bytes.NewBuffer(bodyBytes), is.storageConfig.Url, is.storageConfig.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Result []model.Checkpoint `json:"result"`
+	}
+	if err = jsoniter.Unmarshal(res, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Result) == 0 {
+		return nil, nil
+	}
+
+	return &response.Result[0], nil
+}
+
+// loadCheckpoint resumes from the checkpoint in storage. Without one it starts after the height of the
+// latest_handled_block file of older versions, or at start_block. With the backfill enabled a first start
+// follows the latest height right away and leaves the heights from start_block to the backfill.
+func (is *InternalService) loadCheckpoint() error {
+	stored, err := is.readCheckpoint(headCheckpoint)
+	if err != nil {
+		return err
+	}
+
+	startBlock := cast.ToInt64(is.Context.GetConfig("start_block", 0))
+
+	checkpoint := model.Checkpoint{Name: headCheckpoint}
+	if stored != nil {
+		checkpoint = *stored
+	} else if fileBytes, err := os.ReadFile(filePathLatestBlock); err == nil {
+		// the file held the height being handled, it is handled again
+		latestHandledBlock, err := strconv.ParseInt(strings.TrimSpace(string(fileBytes)), 10, 64)
+		if err != nil {
+			logger.Logger.Error("loadCheckpoint", zap.Error(err))
+		} else {
+			checkpoint.Height = latestHandledBlock - 1
+		}
+	} else if is.config.Backfill {
+		latest, err := is.getLatestHeight()
+		if err != nil {
+			return err
+		}
+		if err = is.startBackfill(startBlock, latest-1); err != nil {
+			return err
+		}
+		checkpoint.Height = latest - 1
+	}
+
+	if checkpoint.Height < startBlock-1 {
+		checkpoint = model.Checkpoint{Name: headCheckpoint, Height: startBlock - 1}
+	}
+
+	is.setCheckpoint(checkpoint)
+
+	logger.Logger.Info("loadCheckpoint", zap.Int64("height", checkpoint.Height), zap.String("hash", checkpoint.Hash))
+
+	return nil
+}
+
+// nextCheckpoint moves the checkpoint to a height, keeping the hashes of the latest depth heights
+func nextCheckpoint(checkpoint model.Checkpoint, height int64, hash string, depth int) model.Checkpoint {
+	recent := append([]model.BlockHash{}, checkpoint.Recent...)
+	recent = append(recent, model.BlockHash{Height: height, Hash: hash})
+	if depth > 0 && len(recent) > depth {
+		recent = recent[len(recent)-depth:]
+	}
+
+	return model.Checkpoint{
+		Name:      checkpoint.Name,
+		Height:    height,
+		Hash:      hash,
+		Recent:    recent,
+		UpdatedAt: time.Now().UTC(),
+	}
+}
+
+func (is *InternalService) checkpointOperation(checkpoint model.Checkpoint) adapter.Request {
+	return adapter.Request{
+		Method: "upsert",
+		Data: adapter.UpsertRequest{
+			Select:     map[string]interface{}{"name": checkpoint.Name},
+			Collection: is.storageConfig.Collection + "_checkpoints",
+			Document:   checkpoint,
+		},
+	}
+}
+
+// rollback handles a block that does not follow the checkpoint: it looks for the latest recent height the node
+// still has the same block at, removes what was stored above it and moves the checkpoint back to it
+func (is *InternalService) rollback() error {
+	current := is.getCheckpoint()
+
+	for i := len(current.Recent) - 1; i >= 0; i-- {
+		recent := current.Recent[i]
+
+		blockInfo, err := is.getBlockInfo(recent.Height)
+		if err != nil {
+			return err
+		}
+		if blockInfo.BlockId.Hash != recent.Hash {
+			continue
+		}
+
+		if recent.Height == current.Height {
+			return fmt.Errorf("the node still has block %s at %d but the next block does not follow it", recent.Hash, recent.Height)
+		}
+
+		checkpoint := current
+		checkpoint.Height, checkpoint.Hash, checkpoint.Recent = recent.Height, recent.Hash, current.Recent[:i+1]
+		checkpoint.UpdatedAt = time.Now().UTC()
+
+		above := map[string]interface{}{"block_height": map[string]interface{}{"$gt": recent.Height}}
+		operations := []adapter.Request{
+			{Method: "delete", Data: adapter.DeleteRequest{Collection: is.storageConfig.Collection + "_txs", Select: above}},
+			{Method: "delete", Data: adapter.DeleteRequest{Collection: is.storageConfig.Collection + "_blocks", Select: above}},
+			{Method: "delete", Data: adapter.DeleteRequest{Collection: is.storageConfig.Collection + "_account_history", Select: above}},
+			{Method: "delete", Data: adapter.DeleteRequest{Collection: is.storageConfig.Collection + "_block_events", Select: above}},
+			{Method: "delete", Data: adapter.DeleteRequest{Collection: is.storageConfig.Collection + "_validator_updates", Select: above}},
+			is.checkpointOperation(checkpoint),
+		}
+		if err = is.sendBatches(operations); err != nil {
+			return err
+		}
+
+		is.setCheckpoint(checkpoint)
+
+		logger.Logger.Warn("rollback", zap.Int64("from", current.Height), zap.Int64("to", checkpoint.Height), zap.String("hash", checkpoint.Hash))
+
+		return nil
+	}
+
+	return fmt.Errorf("the chain changed below the %d recent heights of the checkpoint, reindex from an earlier height", len(current.Recent))
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/saiset-co/saiCosmosIndexer/internal/model"
+)
+
+func TestNextCheckpointKeepsReorgDepth(t *testing.T) {
+	checkpoint := model.Checkpoint{Name: "cosmos", Height: 1, Hash: "H1"}
+
+	for height, hash := range []string{"H2", "H3", "H4", "H5"} {
+		checkpoint = nextCheckpoint(checkpoint, int64(height+2), hash, 3)
+	}
+
+	if checkpoint.Name != "cosmos" || checkpoint.Height != 5 || checkpoint.Hash != "H5" || checkpoint.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected checkpoint %+v", checkpoint)
+	}
+
+	expected := []model.BlockHash{{Height: 3, Hash: "H3"}, {Height: 4, Hash: "H4"}, {Height: 5, Hash: "H5"}}
+	if !reflect.DeepEqual(checkpoint.Recent, expected) {
+		t.Fatalf("expected the hashes of the latest 3 heights, got %v", checkpoint.Recent)
+	}
+}
+
+func TestNextCheckpointDoesNotShareRecent(t *testing.T) {
+	previous := model.Checkpoint{
+		Name:   "cosmos",
+		Height: 2,
+		Hash:   "H2",
+		Recent: make([]model.BlockHash, 2, 4),
+	}
+	previous.Recent[0] = model.BlockHash{Height: 1, Hash: "H1"}
+	previous.Recent[1] = model.BlockHash{Height: 2, Hash: "H2"}
+
+	// both are built on the same checkpoint, as a rollback does when a height is re-indexed
+	first := nextCheckpoint(previous, 3, "H3", 10)
+	second := nextCheckpoint(previous, 3, "H3b", 10)
+
+	if first.Recent[2].Hash != "H3" || second.Recent[2].Hash != "H3b" {
+		t.Fatalf("expected the recent hashes not to share the previous array, got %v and %v", first.Recent, second.Recent)
+	}
+	if len(previous.Recent) != 2 {
+		t.Fatalf("expected the previous checkpoint to be left as it was, got %v", previous.Recent)
+	}
+}
+
+func TestNextCheckpointWithoutDepthKeepsEveryHeight(t *testing.T) {
+	checkpoint := model.Checkpoint{Name: "cosmos"}
+	for height := int64(1); height <= 5; height++ {
+		checkpoint = nextCheckpoint(checkpoint, height, "H", 0)
+	}
+
+	if len(checkpoint.Recent) != 5 {
+		t.Fatalf("expected every height to be kept without a reorg depth, got %d", len(checkpoint.Recent))
+	}
+}
@@ -1,9 +1,16 @@
 package internal
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"sync/atomic"
+
+	jsoniter "github.com/json-iterator/go"
+	"go.uber.org/zap"
 
 	saiService "github.com/saiset-co/sai-service/service"
+	"github.com/saiset-co/saiCosmosIndexer/logger"
 )
 
 func (is *InternalService) NewHandler() saiService.Handler {
@@ -22,6 +29,20 @@ func (is *InternalService) NewHandler() saiService.Handler {
 				return is.deleteAddress(data)
 			},
 		},
+		"reindex": saiService.HandlerElement{
+			Name:        "reindex",
+			Description: "Index again the heights from..to below the checkpoint",
+			Function: func(data, meta interface{}) (interface{}, int, error) {
+				return is.reindex(data)
+			},
+		},
+		"progress": saiService.HandlerElement{
+			Name:        "progress",
+			Description: "Head lag, backfill progress and blocks per second",
+			Function: func(data, meta interface{}) (interface{}, int, error) {
+				return is.progress(), http.StatusOK, nil
+			},
+		},
 	}
 }
 
@@ -72,3 +93,53 @@ func (is *InternalService) deleteAddress(data interface{}) (string, int, error)
 
 	return "deleteAddress", http.StatusOK, nil
 }
+
+type reindexRequest struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// reindex stores the heights of the range again in the background, one reindex runs at a time. Heights above
+// the checkpoint are left to the head follower.
+func (is *InternalService) reindex(data interface{}) (interface{}, int, error) {
+	request := reindexRequest{}
+
+	dataBytes, err := jsoniter.Marshal(data)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if err = jsoniter.Unmarshal(dataBytes, &request); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	head := is.getCheckpoint().Height
+	if request.From <= 0 || request.To < request.From {
+		return nil, http.StatusBadRequest, errors.New("from and to should be heights with from <= to")
+	}
+	if request.From > head {
+		return nil, http.StatusBadRequest, fmt.Errorf("heights above the checkpoint %d are indexed by the head follower", head)
+	}
+	if request.To > head {
+		request.To = head
+	}
+
+	if !atomic.CompareAndSwapInt32(&is.reindexing, 0, 1) {
+		return nil, http.StatusConflict, errors.New("a reindex is running")
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&is.reindexing, 0)
+
+		err := is.indexRange(request.From, request.To, is.config.FetchConcurrency, func(data *heightData) error {
+			return is.storeHeight(data, nil)
+		})
+		if err != nil {
+			logger.Logger.Error("reindex", zap.Error(err))
+			return
+		}
+
+		logger.Logger.Info("reindex", zap.Int64("from", request.From), zap.Int64("to", request.To))
+	}()
+
+	return request, http.StatusOK, nil
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/saiCosmosIndexer/internal/model"
+	"github.com/saiset-co/saiCosmosIndexer/logger"
+)
+
+// progressMetrics counts the heights committed by the head follower and the backfill, the rates are computed
+// over the last sampling interval
+type progressMetrics struct {
+	mu        *sync.Mutex
+	latest    int64
+	blocks    map[string]int64
+	sampled   map[string]int64
+	sampledAt time.Time
+	rates     map[string]float64
+}
+
+func newProgressMetrics() *progressMetrics {
+	return &progressMetrics{
+		mu:        &sync.Mutex{},
+		blocks:    map[string]int64{},
+		sampled:   map[string]int64{},
+		sampledAt: time.Now(),
+		rates:     map[string]float64{},
+	}
+}
+
+func (m *progressMetrics) setLatest(height int64) {
+	m.mu.Lock()
+	m.latest = height
+	m.mu.Unlock()
+}
+
+func (m *progressMetrics) committed(name string) {
+	m.mu.Lock()
+	m.blocks[name]++
+	m.mu.Unlock()
+}
+
+func (m *progressMetrics) sample() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elapsed := time.Since(m.sampledAt).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	for name, blocks := range m.blocks {
+		m.rates[name] = float64(blocks-m.sampled[name]) / elapsed
+		m.sampled[name] = blocks
+	}
+	m.sampledAt = time.Now()
+}
+
+func (m *progressMetrics) snapshot() (int64, map[string]float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rates := make(map[string]float64, len(m.rates))
+	for name, rate := range m.rates {
+		rates[name] = rate
+	}
+
+	return m.latest, rates
+}
+
+// progress returns how far the head follower and the backfill are
+func (is *InternalService) progress() model.Progress {
+	latest, rates := is.metrics.snapshot()
+	head := is.getCheckpoint()
+
+	progress := model.Progress{
+		LatestHeight: latest,
+		Head: model.HeadProgress{
+			Height:          head.Height,
+			BlocksPerSecond: rates[headCheckpoint],
+		},
+	}
+	if latest > head.Height {
+		progress.Head.Lag = latest - head.Height
+	}
+
+	if backfilled := is.getBackfilled(); backfilled != nil {
+		progress.Backfill = &model.BackfillProgress{
+			Height:          backfilled.Height,
+			Target:          backfilled.Target,
+			Remaining:       backfilled.Target - backfilled.Height,
+			BlocksPerSecond: rates[backfillCheckpoint],
+		}
+	}
+
+	return progress
+}
+
+// reportProgress samples the rates and logs the progress every metrics_interval seconds
+func (is *InternalService) reportProgress() {
+	interval := cast.ToDuration(is.Context.GetConfig("metrics_interval", 10))
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second * interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-is.Context.Context.Done():
+			return
+		case <-ticker.C:
+			is.metrics.sample()
+			progress := is.progress()
+
+			fields := []zap.Field{
+				zap.Int64("latest_height", progress.LatestHeight),
+				zap.Int64("head_height", progress.Head.Height),
+				zap.Int64("head_lag", progress.Head.Lag),
+				zap.Float64("head_blocks_per_second", progress.Head.BlocksPerSecond),
+			}
+			if progress.Backfill != nil {
+				fields = append(fields,
+					zap.Int64("backfill_height", progress.Backfill.Height),
+					zap.Int64("backfill_remaining", progress.Backfill.Remaining),
+					zap.Float64("backfill_blocks_per_second", progress.Backfill.BlocksPerSecond),
+				)
+			}
+
+			logger.Logger.Info("progress", fields...)
+		}
+	}
+}
@@ -1,5 +1,43 @@
 package model
 
+import "time"
+
 type LatestBlock struct {
 	LastHeight string `json:"last_height"`
 }
+
+// Checkpoint is the last height stored with all its txs, with the hashes of the heights before it to find where
+// the chain changed
+type Checkpoint struct {
+	Name   string      `json:"name"`
+	Height int64       `json:"height"`
+	Hash   string      `json:"hash"`
+	Recent []BlockHash `json:"recent"`
+	// Target is the last height of the backfill
+	Target    int64     `json:"target,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type BlockHash struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+type Progress struct {
+	LatestHeight int64             `json:"latest_height"`
+	Head         HeadProgress      `json:"head"`
+	Backfill     *BackfillProgress `json:"backfill,omitempty"`
+}
+
+type HeadProgress struct {
+	Height          int64   `json:"height"`
+	Lag             int64   `json:"lag"`
+	BlocksPerSecond float64 `json:"blocks_per_second"`
+}
+
+type BackfillProgress struct {
+	Height          int64   `json:"height"`
+	Target          int64   `json:"target"`
+	Remaining       int64   `json:"remaining"`
+	BlocksPerSecond float64 `json:"blocks_per_second"`
+}
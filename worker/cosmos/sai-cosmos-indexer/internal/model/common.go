@@ -65,10 +65,13 @@ type BlockInfo struct {
 			} `json:"signatures"`
 		} `json:"last_commit"`
 	} `json:"block"`
+	// BlockHeight is the height as a number, the header one is a string
+	BlockHeight int64 `json:"block_height"`
 }
 
 type BlockTransactions struct {
 	Txs         []Tx         `json:"txs"`
+	TotalCount  string       `json:"total_count"`
 	TxResponses []TxResponse `json:"tx_responses"`
 	Pagination  Pagination   `json:"pagination"`
 }
@@ -89,33 +92,85 @@ type TxResponse struct {
 }
 
 type Tx struct {
-	Timestamp time.Time `json:"timestamp"`
-	Hash      string    `json:"hash"`
-	Height    string    `json:"height"`
-	Index     int       `json:"index"`
-	TxResult  struct {
-		Code      int    `json:"code"`
-		Data      string `json:"data"`
-		Log       string `json:"log"`
-		Info      string `json:"info"`
-		GasWanted string `json:"gas_wanted"`
-		GasUsed   string `json:"gas_used"`
-		Events    []struct {
-			Type       string `json:"type"`
-			Attributes []struct {
-				Key   string `json:"key"`
-				Value string `json:"value"`
-				Index bool   `json:"index"`
-			} `json:"attributes"`
-		} `json:"events"`
-		Codespace string `json:"codespace"`
+	Timestamp   time.Time `json:"timestamp"`
+	Hash        string    `json:"hash"`
+	Height      string    `json:"height"`
+	BlockHeight int64     `json:"block_height"`
+	Index       int       `json:"index"`
+	TxResult    struct {
+		Code      int     `json:"code"`
+		Data      string  `json:"data"`
+		Log       string  `json:"log"`
+		Info      string  `json:"info"`
+		GasWanted string  `json:"gas_wanted"`
+		GasUsed   string  `json:"gas_used"`
+		Events    []Event `json:"events"`
+		Codespace string  `json:"codespace"`
 	} `json:"tx_result"`
 	Tx       string        `json:"tx"`
 	Messages []interface{} `json:"messages"`
+	// Addresses are the signers and the addresses found in the messages and the events
+	Addresses []string `json:"addresses"`
+	Signers   []string `json:"signers"`
+}
+
+// AccountHistory is a tx involving a tracked address, with the balance changes of the address by denom
+type AccountHistory struct {
+	Address     string    `json:"address"`
+	Hash        string    `json:"hash"`
+	BlockHeight int64     `json:"block_height"`
+	Timestamp   time.Time `json:"timestamp"`
+	Code        int       `json:"code"`
+	Deltas      []Amount  `json:"deltas"`
 }
 
 type Message map[string]interface{}
 
+type Event struct {
+	Type       string           `json:"type"`
+	Attributes []EventAttribute `json:"attributes"`
+}
+
+type EventAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Index bool   `json:"index"`
+}
+
+// BlockResults are the events of a height outside of its txs and the changes of the validator set
+type BlockResults struct {
+	Height           string            `json:"height"`
+	BeginBlockEvents []Event           `json:"begin_block_events"`
+	EndBlockEvents   []Event           `json:"end_block_events"`
+	ValidatorUpdates []ValidatorUpdate `json:"validator_updates"`
+}
+
+type ValidatorUpdate struct {
+	PubKey interface{} `json:"pub_key"`
+	Power  string      `json:"power"`
+}
+
+// BlockEvent is a begin or end block event, slashing, jailing, rewards or proposals enacted among others
+type BlockEvent struct {
+	BlockHeight int64            `json:"block_height"`
+	Timestamp   time.Time        `json:"timestamp"`
+	Stage       string           `json:"stage"`
+	Index       int              `json:"index"`
+	Type        string           `json:"type"`
+	Attributes  []EventAttribute `json:"attributes"`
+	// Addresses are the account, validator and consensus addresses in the attributes
+	Addresses []string `json:"addresses"`
+}
+
+// ValidatorSetUpdate is the power of a validator set at a height, 0 removes it from the set
+type ValidatorSetUpdate struct {
+	BlockHeight int64       `json:"block_height"`
+	Timestamp   time.Time   `json:"timestamp"`
+	Index       int         `json:"index"`
+	PubKey      interface{} `json:"pub_key"`
+	Power       int64       `json:"power"`
+}
+
 type Amount struct {
 	Denom  string `json:"denom"`
 	Amount string `json:"amount"`
@@ -1,11 +1,17 @@
 package model
 
 type ServiceConfig struct {
-	NodeAddress    string
-	TxType         string
-	SkipFailedTxs  bool
-	HandleBlocks   bool
-	CollectionName string
+	NodeAddress   string
+	TxType        string
+	SkipFailedTxs bool
+	HandleBlocks  bool
+	// HandleBlockResults stores the begin and end block events and the validator updates
+	HandleBlockResults bool
+	CollectionName     string
+	// FetchConcurrency is the number of heights read from the node at the same time
+	FetchConcurrency    int
+	Backfill            bool
+	BackfillConcurrency int
 }
 
 type StorageConfig struct {
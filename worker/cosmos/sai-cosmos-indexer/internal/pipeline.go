@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	sekaiapp "github.com/KiraCore/sekai/app"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/saiCosmosIndexer/internal/model"
+	"github.com/saiset-co/saiCosmosIndexer/logger"
+)
+
+var (
+	encodingOnce sync.Once
+	encoding     sekaiapp.EncodingConfig
+)
+
+// txDecoder returns the decoder of sekai txs, the encoding config registers the messages in global registries
+// so it is made once and shared by the fetchers
+func txDecoder() sdk.TxDecoder {
+	encodingOnce.Do(func() {
+		encoding = sekaiapp.MakeEncodingConfig()
+	})
+
+	return encoding.TxConfig.TxDecoder()
+}
+
+// heightData is a height read from the node, ready to be stored
+type heightData struct {
+	height  int64
+	block   *model.BlockInfo
+	txs     []model.Tx
+	history []model.AccountHistory
+	// events and validators are only read with handle_block_results
+	events     []model.BlockEvent
+	validators []model.ValidatorSetUpdate
+}
+
+type fetchedHeight struct {
+	data *heightData
+	err  error
+}
+
+// fetchHeight reads the block and the txs of a height and decodes the messages of the txs
+func (is *InternalService) fetchHeight(height int64) (*heightData, error) {
+	blockInfo, err := is.getBlockInfo(height)
+	if err != nil {
+		return nil, err
+	}
+
+	blockTxs, err := is.getBlockTxs(height)
+	if err != nil {
+		return nil, err
+	}
+
+	blockInfo.BlockHeight = height
+
+	var txArray []model.Tx
+	var history []model.AccountHistory
+	decode := txDecoder()
+
+	for _, txRes := range blockTxs {
+		if is.config.SkipFailedTxs && txRes.TxResult.Code != 0 {
+			continue
+		}
+
+		if len(txRes.TxResult.Events) < 1 {
+			continue
+		}
+
+		txRes.Timestamp = blockInfo.Block.Header.Time
+		txRes.BlockHeight = height
+
+		txBytes, err := base64.StdEncoding.DecodeString(txRes.Tx)
+		if err != nil {
+			return nil, err
+		}
+
+		// a tx the codec cannot decode is stored without its messages rather than dropped
+		tx, err := decode(txBytes)
+		if err != nil {
+			logger.Logger.Error("fetchHeight", zap.String("hash", txRes.Hash), zap.Error(err))
+			txRes.Addresses, txRes.Signers = txAddresses(nil, txRes)
+			txArray = append(txArray, txRes)
+			history = append(history, is.accountHistory(txRes)...)
+			continue
+		}
+
+		for _, msg := range tx.GetMsgs() {
+			var message = model.Message{}
+
+			msgBytes, err := json.Marshal(msg)
+			if err != nil {
+				logger.Logger.Error("fetchHeight", zap.Error(err))
+				continue
+			}
+
+			err = json.Unmarshal(msgBytes, &message)
+			if err != nil {
+				logger.Logger.Error("fetchHeight", zap.Error(err))
+				continue
+			}
+
+			message["typeUrl"] = sdk.MsgTypeURL(msg)
+
+			txRes.Messages = append(txRes.Messages, message)
+		}
+
+		txRes.Addresses, txRes.Signers = txAddresses(tx, txRes)
+		txArray = append(txArray, txRes)
+		history = append(history, is.accountHistory(txRes)...)
+	}
+
+	data := &heightData{height: height, block: blockInfo, txs: txArray, history: history}
+
+	if is.config.HandleBlockResults {
+		blockResults, err := is.getBlockResults(height)
+		if err != nil {
+			return nil, err
+		}
+
+		data.events, data.validators, err = blockResultsData(height, blockInfo.Block.Header.Time, blockResults)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// blockResultsData numbers the begin and end block events and the validator updates of a height in their order
+func blockResultsData(height int64, timestamp time.Time, blockResults *model.BlockResults) ([]model.BlockEvent, []model.ValidatorSetUpdate, error) {
+	var events []model.BlockEvent
+
+	stages := []struct {
+		name   string
+		events []model.Event
+	}{
+		{name: "begin_block", events: blockResults.BeginBlockEvents},
+		{name: "end_block", events: blockResults.EndBlockEvents},
+	}
+	for _, stage := range stages {
+		for i, event := range stage.events {
+			events = append(events, model.BlockEvent{
+				BlockHeight: height,
+				Timestamp:   timestamp,
+				Stage:       stage.name,
+				Index:       i,
+				Type:        event.Type,
+				Attributes:  event.Attributes,
+				Addresses:   eventAddresses(event),
+			})
+		}
+	}
+
+	var validators []model.ValidatorSetUpdate
+	for i, update := range blockResults.ValidatorUpdates {
+		power, err := strconv.ParseInt(update.Power, 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		validators = append(validators, model.ValidatorSetUpdate{
+			BlockHeight: height,
+			Timestamp:   timestamp,
+			Index:       i,
+			PubKey:      update.PubKey,
+			Power:       power,
+		})
+	}
+
+	return events, validators, nil
+}
+
+// fetchHeights reads the heights from..to with up to concurrency requests running and returns them in order.
+// The channel is closed after the first error or when the context is done.
+func (is *InternalService) fetchHeights(ctx context.Context, from, to int64, concurrency int) <-chan fetchedHeight {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make(chan fetchedHeight)
+	pending := make(chan chan fetchedHeight, concurrency)
+	slots := make(chan struct{}, concurrency)
+
+	go func() {
+		defer close(pending)
+
+		for height := from; height <= to; height++ {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			result := make(chan fetchedHeight, 1)
+			go func(height int64) {
+				data, err := is.fetchHeight(height)
+				result <- fetchedHeight{data: data, err: err}
+			}(height)
+
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(results)
+
+		for result := range pending {
+			var fetched fetchedHeight
+			select {
+			case fetched = <-result:
+			case <-ctx.Done():
+				return
+			}
+			<-slots
+
+			select {
+			case results <- fetched:
+			case <-ctx.Done():
+				return
+			}
+			if fetched.err != nil {
+				return
+			}
+		}
+	}()
+
+	return results
+}
+
+// indexRange fetches the heights from..to concurrently and commits them one by one in order, it stops at the
+// first height that could not be fetched or committed
+func (is *InternalService) indexRange(from, to int64, concurrency int, commit func(*heightData) error) error {
+	ctx, cancel := context.WithCancel(is.Context.Context)
+	defer cancel()
+
+	for fetched := range is.fetchHeights(ctx, from, to, concurrency) {
+		if fetched.err != nil {
+			return fetched.err
+		}
+		if err := commit(fetched.data); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	saiService "github.com/saiset-co/sai-service/service"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/saiCosmosIndexer/logger"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+// fakeNode answers the block and tx_search requests of the tendermint RPC, block calls block before answering
+type fakeNode struct {
+	block    func(height int64) error
+	inFlight int32
+	maxLoad  int32
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/block":
+		height, _ := strconv.ParseInt(strings.Trim(r.URL.Query().Get("height"), `"`), 10, 64)
+
+		load := atomic.AddInt32(&n.inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&n.maxLoad)
+			if load <= max || atomic.CompareAndSwapInt32(&n.maxLoad, max, load) {
+				break
+			}
+		}
+		err := n.block(height)
+		atomic.AddInt32(&n.inFlight, -1)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":-1,"error":%q}`, err.Error())
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":-1,"result":{"block_id":{"hash":"H%d"},"block":{"header":{"height":"%d","time":"2024-10-19T10:00:00Z"}}}}`, height, height)
+	case "/tx_search":
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":-1,"result":{"txs":[],"total_count":"0"}}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":-1,"error":"not found"}`)
+	}
+}
+
+func newTestService(t *testing.T, node *fakeNode) *InternalService {
+	srv := httptest.NewServer(node)
+	t.Cleanup(srv.Close)
+
+	ctx := saiService.NewContext()
+	ctx.Configuration["node_address"] = srv.URL
+
+	return &InternalService{Context: ctx}
+}
+
+func TestFetchHeightsDeliversInOrder(t *testing.T) {
+	node := &fakeNode{block: func(height int64) error {
+		// the later heights are answered first
+		time.Sleep(time.Duration(12-height) * 10 * time.Millisecond)
+		return nil
+	}}
+	is := newTestService(t, node)
+
+	var heights []int64
+	for fetched := range is.fetchHeights(context.Background(), 1, 10, 3) {
+		if fetched.err != nil {
+			t.Fatal(fetched.err)
+		}
+		if fetched.data.block.BlockId.Hash != fmt.Sprintf("H%d", fetched.data.height) {
+			t.Fatalf("unexpected block %s for height %d", fetched.data.block.BlockId.Hash, fetched.data.height)
+		}
+		heights = append(heights, fetched.data.height)
+	}
+
+	if len(heights) != 10 {
+		t.Fatalf("expected 10 heights, got %v", heights)
+	}
+	for i, height := range heights {
+		if height != int64(i+1) {
+			t.Fatalf("expected the heights in order, got %v", heights)
+		}
+	}
+
+	// a slot is released once its height is delivered, no more than 3 requests run at a time
+	if load := atomic.LoadInt32(&node.maxLoad); load > 3 || load < 2 {
+		t.Fatalf("expected up to 3 concurrent requests, got %d", load)
+	}
+}
+
+func TestFetchHeightsStopsAfterError(t *testing.T) {
+	var requested sync.Map
+	node := &fakeNode{block: func(height int64) error {
+		requested.Store(height, true)
+		if height == 3 {
+			return fmt.Errorf("height %d is not available", height)
+		}
+		return nil
+	}}
+	is := newTestService(t, node)
+
+	var heights []int64
+	var err error
+	for fetched := range is.fetchHeights(context.Background(), 1, 20, 2) {
+		if fetched.err != nil {
+			err = fetched.err
+			continue
+		}
+		heights = append(heights, fetched.data.height)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "height 3 is not available") {
+		t.Fatalf("expected the error of height 3, got %v", err)
+	}
+	if len(heights) != 2 || heights[0] != 1 || heights[1] != 2 {
+		t.Fatalf("expected the heights before the error only, got %v", heights)
+	}
+
+	// the producer is held by the slots, it cannot run far past the failed height
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := requested.Load(int64(10)); ok {
+		t.Fatal("expected the heights after the error not to be requested")
+	}
+}
+
+func TestFetchHeightsStopsWhenCancelled(t *testing.T) {
+	release := make(chan struct{})
+	node := &fakeNode{block: func(height int64) error {
+		if height > 2 {
+			<-release
+		}
+		return nil
+	}}
+	is := newTestService(t, node)
+	// the node is released before the server is closed, so the stuck requests can finish
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := is.fetchHeights(ctx, 1, 100, 4)
+
+	for height := int64(1); height <= 2; height++ {
+		fetched := <-results
+		if fetched.err != nil || fetched.data.height != height {
+			t.Fatalf("expected height %d, got %+v", height, fetched)
+		}
+	}
+
+	cancel()
+
+	select {
+	case fetched, ok := <-results:
+		if ok {
+			t.Fatalf("expected no height after the cancellation, got %+v", fetched)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the results to be closed once the context is cancelled")
+	}
+
+	if load := atomic.LoadInt32(&node.maxLoad); load > 4 {
+		t.Fatalf("expected up to 4 concurrent requests, got %d", load)
+	}
+}
@@ -2,10 +2,8 @@ package internal
 
 import (
 	"bytes"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
-	sekaiapp "github.com/KiraCore/sekai/app"
+	"fmt"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	"go.uber.org/zap"
 	"net/http"
@@ -27,14 +25,21 @@ import (
 const (
 	filePathAddresses   = "./addresses.json"
 	filePathLatestBlock = "./latest_handled_block"
+	// storageBatchSize stays below the maxBatchSize of the storage
+	storageBatchSize = 500
+	// txSearchPageSize is the largest page tx_search returns
+	txSearchPageSize = 100
 )
 
 type InternalService struct {
 	mu            *sync.Mutex
 	Context       *saiService.Context
 	config        model.ServiceConfig
-	handleBlocks  bool
-	currentBlock  int64
+	checkpoint    model.Checkpoint
+	reorgDepth    int
+	reindexing    int32
+	backfilled    *model.Checkpoint
+	metrics       *progressMetrics
 	addresses     map[string]struct{}
 	storageConfig model.StorageConfig
 	notifier      Notifier
@@ -53,6 +58,7 @@ func (is *InternalService) Init() {
 	is.mu = &sync.Mutex{}
 	is.config = model.ServiceConfig{}
 	is.client = http.Client{}
+	is.metrics = newProgressMetrics()
 
 	is.addresses = make(map[string]struct{})
 	is.config.TxType = cast.ToString(is.Context.GetConfig("tx_type", ""))
@@ -60,6 +66,10 @@ func (is *InternalService) Init() {
 	is.config.CollectionName = cast.ToString(is.Context.GetConfig("storage.mongo_collection_name", ""))
 	is.config.SkipFailedTxs = cast.ToBool(is.Context.GetConfig("skip_failed_tx", false))
 	is.config.HandleBlocks = cast.ToBool(is.Context.GetConfig("handle_blocks", false))
+	is.config.HandleBlockResults = cast.ToBool(is.Context.GetConfig("handle_block_results", false))
+	is.config.FetchConcurrency = cast.ToInt(is.Context.GetConfig("fetch_concurrency", 4))
+	is.config.Backfill = cast.ToBool(is.Context.GetConfig("backfill.enabled", false))
+	is.config.BackfillConcurrency = cast.ToInt(is.Context.GetConfig("backfill.concurrency", 2))
 	is.storageConfig = model.StorageConfig{
 		Token:      cast.ToString(is.Context.GetConfig("storage.token", "")),
 		Url:        cast.ToString(is.Context.GetConfig("storage.url", "")),
@@ -81,28 +91,12 @@ func (is *InternalService) Init() {
 		logger.Logger.Error("loadAddresses", zap.Error(err))
 	}
 
-	fileBytes, err := os.ReadFile(filePathLatestBlock)
-	if err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			logger.Logger.Error("can't read "+filePathLatestBlock, zap.Error(err))
-		}
-	} else {
-		latestHandledBlock, err := strconv.Atoi(string(fileBytes))
-		if err != nil {
-			logger.Logger.Error("strconv.Atoi", zap.Error(err))
-		}
-
-		is.currentBlock = int64(latestHandledBlock)
-	}
-
-	startBlock := cast.ToInt64(is.Context.GetConfig("start_block", 0))
-	if is.currentBlock < startBlock {
-		is.currentBlock = startBlock
-	}
+	is.reorgDepth = cast.ToInt(is.Context.GetConfig("reorg_depth", 20))
 }
 
 func (is *InternalService) Process() {
 	sleepDuration := cast.ToDuration(is.Context.GetConfig("sleep_duration", 2))
+	checkpointLoaded := false
 
 	for {
 		select {
@@ -110,155 +104,214 @@ func (is *InternalService) Process() {
 			logger.Logger.Debug("saiCosmosIndexer loop is done")
 			return
 		default:
-			latestBlock, err := is.getLatestBlock()
-			if err != nil {
-				logger.Logger.Error("getLatestBlock", zap.Error(err))
-				time.Sleep(time.Second * sleepDuration)
-				continue
+			if !checkpointLoaded {
+				if err := is.loadCheckpoint(); err != nil {
+					logger.Logger.Error("loadCheckpoint", zap.Error(err))
+					time.Sleep(time.Second * sleepDuration)
+					continue
+				}
+				checkpointLoaded = true
+
+				go is.backfill()
+				go is.reportProgress()
 			}
 
-			lb, err := strconv.Atoi(latestBlock.LastHeight)
+			latestBlock, err := is.getLatestHeight()
 			if err != nil {
 				logger.Logger.Error("getLatestBlock", zap.Error(err))
 				time.Sleep(time.Second * sleepDuration)
 				continue
 			}
 
-			if is.currentBlock >= int64(lb) {
+			from := is.getCheckpoint().Height + 1
+			if from > latestBlock {
 				time.Sleep(time.Second * sleepDuration)
 				continue
 			}
 
-			err = is.handleBlockTxs()
+			err = is.indexRange(from, latestBlock, is.config.FetchConcurrency, is.commitHead)
+			if errors.Is(err, errFork) {
+				logger.Logger.Warn("indexRange", zap.Error(err))
+				err = is.rollback()
+			}
 			if err != nil {
-				logger.Logger.Error("handleBlockTxs", zap.Error(err))
+				logger.Logger.Error("indexRange", zap.Error(err))
 				time.Sleep(time.Second * sleepDuration)
 				continue
 			}
 
-			logger.Logger.Debug("handleBlockTxs processed", zap.Any("block", is.currentBlock))
-
-			is.currentBlock += 1
+			logger.Logger.Debug("indexRange processed", zap.Int64("from", from), zap.Int64("to", latestBlock))
 		}
 	}
 }
 
-func (is *InternalService) handleBlockTxs() error {
-	blockInfo, err := is.getBlockInfo()
+// getLatestHeight returns the latest height of the node and keeps it for the progress metrics
+func (is *InternalService) getLatestHeight() (int64, error) {
+	latestBlock, err := is.getLatestBlock()
 	if err != nil {
-		logger.Logger.Error("handleBlockTxs", zap.Error(err))
-		return err
+		return 0, err
 	}
 
-	if is.handleBlocks {
-		err = is.sendBlockToStorage(blockInfo)
-		if err != nil {
-			logger.Logger.Error("handleBlockTxs", zap.Error(err))
-			return err
-		}
-	}
-
-	blockTxs, err := is.getBlockTxs()
+	latest, err := strconv.ParseInt(latestBlock.LastHeight, 10, 64)
 	if err != nil {
-		logger.Logger.Error("handleBlockTxs", zap.Error(err))
-		return err
+		return 0, err
 	}
 
-	var txArray []model.Tx
-	encode := sekaiapp.MakeEncodingConfig()
+	is.metrics.setLatest(latest)
 
-	for _, txRes := range blockTxs {
-		if is.config.SkipFailedTxs && txRes.TxResult.Code != 0 {
-			continue
-		}
+	return latest, nil
+}
 
-		if len(txRes.TxResult.Events) < 1 {
-			continue
-		}
+// commitHead stores the next height of the head follower after checking that its block continues the checkpoint,
+// and moves the checkpoint to it
+func (is *InternalService) commitHead(data *heightData) error {
+	current := is.getCheckpoint()
+	if data.height != current.Height+1 {
+		return fmt.Errorf("height %d does not follow the checkpoint %d", data.height, current.Height)
+	}
 
-		txRes.Timestamp = blockInfo.Block.Header.Time
+	lastBlockHash := data.block.Block.Header.LastBlockId.Hash
+	if current.Hash != "" && lastBlockHash != current.Hash {
+		return fmt.Errorf("%w: block %d follows %s instead of the stored %s", errFork, data.height, lastBlockHash, current.Hash)
+	}
 
-		txBytes, err := base64.StdEncoding.DecodeString(txRes.Tx)
-		if err != nil {
-			return err
-		}
+	checkpoint := nextCheckpoint(current, data.height, data.block.BlockId.Hash, is.reorgDepth)
 
-		tx, err := encode.TxConfig.TxDecoder()(txBytes)
-		if err != nil {
-			logger.Logger.Error("handleBlockTxs", zap.Error(err))
-			continue
-		}
+	err := is.storeHeight(data, &checkpoint)
+	if err != nil {
+		return err
+	}
 
-		for _, msg := range tx.GetMsgs() {
-			var message = model.Message{}
+	is.setCheckpoint(checkpoint)
+	is.metrics.committed(headCheckpoint)
 
-			msgBytes, err := json.Marshal(msg)
-			if err != nil {
-				logger.Logger.Error("handleBlockTxs", zap.Error(err))
-				continue
-			}
+	for _, tx := range data.txs {
+		go is.sendTxNotification(tx)
+	}
 
-			err = json.Unmarshal(msgBytes, &message)
-			if err != nil {
-				logger.Logger.Error("handleBlockTxs", zap.Error(err))
-				continue
-			}
+	return nil
+}
+
+// storeHeight replaces the txs, the account history and the block of a height, the checkpoint goes with the last batch so it only moves
+// once the whole height is stored. A height fitting one batch is stored in one transaction, a larger one is stored
+// again from its start after a failure.
+func (is *InternalService) storeHeight(data *heightData, checkpoint *model.Checkpoint) error {
+	operations := []adapter.Request{
+		{
+			Method: "delete",
+			Data: adapter.DeleteRequest{
+				Collection: is.storageConfig.Collection + "_txs",
+				Select:     map[string]interface{}{"block_height": data.height},
+			},
+		},
+		{
+			Method: "delete",
+			Data: adapter.DeleteRequest{
+				Collection: is.storageConfig.Collection + "_account_history",
+				Select:     map[string]interface{}{"block_height": data.height},
+			},
+		},
+	}
 
-			message["typeUrl"] = sdk.MsgTypeURL(msg)
+	for _, tx := range data.txs {
+		operations = append(operations, adapter.Request{
+			Method: "upsert",
+			Data: adapter.UpsertRequest{
+				Select: map[string]interface{}{
+					"hash": tx.Hash,
+				},
+				Collection: is.storageConfig.Collection + "_txs",
+				Document:   tx,
+			},
+		})
+	}
 
-			txRes.Messages = append(txRes.Messages, message)
-		}
+	for _, entry := range data.history {
+		operations = append(operations, adapter.Request{
+			Method: "upsert",
+			Data: adapter.UpsertRequest{
+				Select: map[string]interface{}{
+					"address": entry.Address,
+					"hash":    entry.Hash,
+				},
+				Collection: is.storageConfig.Collection + "_account_history",
+				Document:   entry,
+			},
+		})
+	}
 
-		txArray = append(txArray, txRes)
-		go is.sendTxNotification(txRes)
+	if is.config.HandleBlocks {
+		operations = append(operations, adapter.Request{
+			Method: "upsert",
+			Data: adapter.UpsertRequest{
+				Select: map[string]interface{}{
+					"block_id.hash": data.block.BlockId.Hash,
+				},
+				Collection: is.storageConfig.Collection + "_blocks",
+				Document:   data.block,
+			},
+		})
 	}
 
-	if len(txArray) > 0 {
-		err = is.sendTxsToStorage(txArray)
-		if err != nil {
-			logger.Logger.Error("handleBlockTxs", zap.Error(err))
-			return err
-		}
+	if is.config.HandleBlockResults {
+		operations = append(operations, is.replaceHeight("_block_events", data.height, documents(data.events))...)
+		operations = append(operations, is.replaceHeight("_validator_updates", data.height, documents(data.validators))...)
 	}
 
-	err = is.rewriteLastHandledBlock(is.currentBlock)
+	if checkpoint != nil {
+		operations = append(operations, is.checkpointOperation(*checkpoint))
+	}
 
-	return err
+	return is.sendBatches(operations)
 }
 
-func (is *InternalService) sendBlockToStorage(block *model.BlockInfo) error {
-	storageRequest := adapter.Request{
-		Method: "upsert",
-		Data: adapter.UpsertRequest{
-			Select: map[string]interface{}{
-				"block_id.hash": block.BlockId.Hash,
-			},
-			Collection: is.storageConfig.Collection + "_blocks",
-			Document:   block,
+// replaceHeight removes the documents of a height from a collection and creates its documents
+func (is *InternalService) replaceHeight(suffix string, height int64, documents []interface{}) []adapter.Request {
+	operations := []adapter.Request{{
+		Method: "delete",
+		Data: adapter.DeleteRequest{
+			Collection: is.storageConfig.Collection + suffix,
+			Select:     map[string]interface{}{"block_height": height},
 		},
+	}}
+
+	if len(documents) > 0 {
+		operations = append(operations, adapter.Request{
+			Method: "create",
+			Data: adapter.CreateRequest{
+				Collection: is.storageConfig.Collection + suffix,
+				Documents:  documents,
+			},
+		})
 	}
 
-	bodyBytes, err := jsoniter.Marshal(&storageRequest)
-	if err != nil {
-		return err
-	}
+	return operations
+}
 
-	_, err = utils.SaiQuerySender(bytes.NewBuffer(bodyBytes), is.storageConfig.Url, is.storageConfig.Token)
+func documents[T any](items []T) []interface{} {
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		result = append(result, item)
+	}
 
-	return err
+	return result
 }
 
-func (is *InternalService) sendTxsToStorage(txs []model.Tx) error {
-	for _, tx := range txs {
+// sendBatches sends the operations in ordered batches, each stored in one transaction
+func (is *InternalService) sendBatches(operations []adapter.Request) error {
+	for start := 0; start < len(operations); start += storageBatchSize {
+		end := start + storageBatchSize
+		if end > len(operations) {
+			end = len(operations)
+		}
+
 		storageRequest := adapter.Request{
-			Method: "upsert",
-			Data: adapter.UpsertRequest{
-				Select: map[string]interface{}{
-					"hash": tx.Hash,
-				},
-				Collection: is.storageConfig.Collection + "_txs",
-				Document:   tx,
+			Method: "batch",
+			Data: adapter.BatchRequest{
+				Operations: operations[start:end],
+				Ordered:    true,
 			},
+			Metadata: map[string]interface{}{"token": is.storageConfig.Token},
 		}
 
 		bodyBytes, err := jsoniter.Marshal(&storageRequest)
@@ -268,7 +321,7 @@ func (is *InternalService) sendTxsToStorage(txs []model.Tx) error {
 
 		_, err = utils.SaiQuerySender(bytes.NewBuffer(bodyBytes), is.storageConfig.Url, is.storageConfig.Token)
 		if err != nil {
-			continue
+			return err
 		}
 	}
 
@@ -13,22 +13,73 @@ type SaiStorage struct {
 }
 
 type SaiStorageResponse struct {
-	Status string                   `json:"Status"`
-	Result []map[string]interface{} `json:"result"`
-	Count  int                      `json:"count"`
+	Status         string                   `json:"Status"`
+	Result         []map[string]interface{} `json:"result"`
+	Count          int                      `json:"count"`
+	CountEstimated bool                     `json:"count_estimated"`
+	Cursor         string                   `json:"cursor"`
+}
+
+type SaiStorageBatchResponse struct {
+	Status      string                  `json:"Status"`
+	Error       string                  `json:"Error"`
+	Transaction bool                    `json:"transaction"`
+	Results     []SaiStorageBatchResult `json:"results"`
+}
+
+type SaiStorageBatchResult struct {
+	Status string      `json:"Status"`
+	Result interface{} `json:"result"`
+	Error  string      `json:"Error"`
 }
 
 func (s *SaiStorage) Send(request Request) (*SaiStorageResponse, error) {
+	var result = new(SaiStorageResponse)
+	err := s.send(request, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Batch sends create, update, upsert and delete requests at once. Ordered batches run in one transaction,
+// unordered ones as bulk writes with a result per operation.
+func (s *SaiStorage) Batch(operations []Request, ordered bool) (*SaiStorageBatchResponse, error) {
+	request := Request{
+		Method: "batch",
+		Data: BatchRequest{
+			Operations: operations,
+			Ordered:    ordered,
+		},
+	}
+
+	var result = new(SaiStorageBatchResponse)
+	err := s.send(request, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Status == "NOK" {
+		return nil, fmt.Errorf("batch failed: %s", result.Error)
+	}
+
+	return result, nil
+}
+
+func (s *SaiStorage) send(request Request, result interface{}) error {
+	request.Metadata = map[string]interface{}{"token": s.Token}
+
 	// Define the request body
 	requestBody, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+		return fmt.Errorf("failed to marshal request body: %v", err)
 	}
 
 	// Create a new POST request with the request body
 	req, err := http.NewRequest("POST", s.Url, bytes.NewBuffer(requestBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return fmt.Errorf("failed to create request: %v", err)
 	}
 
 	// Add the Token header to the request
@@ -37,16 +88,15 @@ func (s *SaiStorage) Send(request Request) (*SaiStorageResponse, error) {
 	// Send the request and get the response
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+		return fmt.Errorf("failed to send request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Parse the response body into the struct
-	var result = new(SaiStorageResponse)
 	err = json.NewDecoder(resp.Body).Decode(result)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse response body: %v", err)
+		return fmt.Errorf("failed to parse response body: %v", err)
 	}
 
-	return result, nil
+	return nil
 }
@@ -16,13 +16,18 @@ type IRequest interface {
 type Request struct {
 	Method string   `json:"method"`
 	Data   IRequest `json:"data"`
+	// Metadata carries the token the storage checks permissions of
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
 type Options struct {
 	Limit int64       `json:"limit"`
 	Skip  int64       `json:"skip"`
 	Sort  interface{} `json:"sort"`
-	Count int64       `json:"count"`
+	// Count is 1 for an exact count and 2 for an estimated one
+	Count int64 `json:"count"`
+	// Cursor is the cursor of the previous response, the sort has to stay the same
+	Cursor string `json:"cursor,omitempty"`
 }
 
 func (r Request) GetMethod() string {
@@ -68,6 +73,12 @@ type AggregateRequest struct {
 	Pipeline   []interface{} `json:"pipeline,omitempty" validate:"required"`
 }
 
+// BatchRequest runs its operations in one request, ordered ones in one transaction
+type BatchRequest struct {
+	Operations []Request `json:"operations" validate:"required"`
+	Ordered    bool      `json:"ordered"`
+}
+
 type DeleteRequest struct {
 	Collection string                 `json:"collection" validate:"required"`
 	Select     map[string]interface{} `json:"select,omitempty" validate:"required"`
@@ -141,8 +152,8 @@ func (r UpsertRequest) GetSelect() map[string]interface{} {
 	return r.Select
 }
 
-func (r UpsertRequest) GetData() interface{} {
-	return r.Document
+func (r UpsertRequest) GetData() []interface{} {
+	return []interface{}{r.Document}
 }
 
 func (r UpsertRequest) GetOptions() *Options {
@@ -161,7 +172,7 @@ func (r AggregateRequest) GetSelect() map[string]interface{} {
 	return nil
 }
 
-func (r AggregateRequest) GetData() interface{} {
+func (r AggregateRequest) GetData() []interface{} {
 	return r.Pipeline
 }
 
@@ -192,3 +203,27 @@ func (r DeleteRequest) GetOptions() *Options {
 func (r DeleteRequest) GetIncludeFields() []string {
 	return nil
 }
+
+func (r BatchRequest) GetCollection() string {
+	return ""
+}
+
+func (r BatchRequest) GetSelect() map[string]interface{} {
+	return nil
+}
+
+func (r BatchRequest) GetData() []interface{} {
+	operations := make([]interface{}, len(r.Operations))
+	for i, operation := range r.Operations {
+		operations[i] = operation
+	}
+	return operations
+}
+
+func (r BatchRequest) GetOptions() *Options {
+	return nil
+}
+
+func (r BatchRequest) GetIncludeFields() []string {
+	return nil
+}
@@ -30,7 +30,10 @@ func (action *AggregateAction) Handle(request types.IRequest) (interface{}, int,
 		return nil, http.StatusInternalServerError, err
 	}
 
-	action.Client.Duplicate(Update, request, data.Result)
+	err = action.Client.Duplicate(Update, request, data.Result)
+	if err != nil {
+		logger.Logger.Error("AggregateAction", zap.Error(err))
+	}
 
 	return data, http.StatusOK, nil
 }
@@ -0,0 +1,325 @@
+package actions
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+	"github.com/saiset-co/sai-storage-mongo/mongo"
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+type BatchAction struct {
+	Client *mongo.Client
+}
+
+type BatchResult struct {
+	// Transaction tells whether the operations were applied atomically
+	Transaction bool                   `json:"transaction"`
+	Results     []BatchOperationResult `json:"results"`
+}
+
+type BatchOperationResult struct {
+	Status string      `json:"Status"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"Error,omitempty"`
+}
+
+// bulkOperation is an operation of an unordered batch, written with the other operations on its collection
+type bulkOperation struct {
+	index     int
+	method    string
+	request   types.IRequest
+	documents []interface{}
+	removed   []interface{}
+	models    []int
+}
+
+func NewBatchAction(client *mongo.Client) *BatchAction {
+	return &BatchAction{
+		Client: client,
+	}
+}
+
+func (action *BatchAction) Handle(request types.IRequest) (interface{}, int, error) {
+	batchRequest, ok := request.(types.BatchRequest)
+	if !ok {
+		return nil, http.StatusBadRequest, errors.New("wrong batch request")
+	}
+
+	if maxSize := action.Client.Config.MaxBatchSize; maxSize > 0 && len(batchRequest.Requests) > maxSize {
+		return nil, http.StatusBadRequest, fmt.Errorf("a batch holds at most %d operations", maxSize)
+	}
+
+	if batchRequest.Ordered != nil && !*batchRequest.Ordered {
+		return action.bulk(batchRequest)
+	}
+
+	return action.transaction(batchRequest)
+}
+
+func (action *BatchAction) writer(method string) writer {
+	switch method {
+	case Create:
+		return NewSaveAction(action.Client)
+	case Update:
+		return NewUpdateAction(action.Client)
+	case Upsert:
+		return NewUpsertAction(action.Client)
+	default:
+		return NewDeleteAction(action.Client)
+	}
+}
+
+// transaction applies the operations in order in one transaction, the first failure rolls all of them back
+func (action *BatchAction) transaction(request types.BatchRequest) (interface{}, int, error) {
+	result := BatchResult{Transaction: action.Client.Replicated()}
+	var changes []Change
+
+	err := action.Client.Transaction(func(client mongo.Client) error {
+		result.Results = make([]BatchOperationResult, 0, len(request.Requests))
+		changes = changes[:0]
+
+		for i, operationRequest := range request.Requests {
+			method := request.Operations[i].Method
+
+			operationResult, change, err := action.writer(method).apply(client, operationRequest)
+			if err != nil {
+				if !result.Transaction {
+					return errors.Wrapf(err, "operation %d (%s), the operations before it have been applied", i, method)
+				}
+				return errors.Wrapf(err, "operation %d (%s)", i, method)
+			}
+
+			result.Results = append(result.Results, BatchOperationResult{Status: "OK", Result: operationResult})
+			changes = append(changes, change)
+		}
+
+		return nil
+	})
+	if err != nil {
+		logger.Logger.Error("BatchAction", zap.Error(err))
+		return nil, http.StatusInternalServerError, err
+	}
+
+	for _, change := range changes {
+		action.Client.Notify(change.Operation, change.Collection, change.Documents)
+	}
+
+	return result, http.StatusOK, nil
+}
+
+// bulk writes the operations of each collection in one unordered bulk write, a failed operation does not stop the others
+func (action *BatchAction) bulk(request types.BatchRequest) (interface{}, int, error) {
+	result := BatchResult{Results: make([]BatchOperationResult, len(request.Requests))}
+	tracked := action.Client.Config.Duplicate || !action.Client.Replicated()
+
+	var collections []string
+	seen := map[string]bool{}
+	operations := map[string][]*bulkOperation{}
+	models := map[string][]mongodriver.WriteModel{}
+
+	for i, operationRequest := range request.Requests {
+		collection := operationRequest.GetCollection()
+		if !seen[collection] {
+			seen[collection] = true
+			collections = append(collections, collection)
+		}
+
+		operation := &bulkOperation{index: i, method: request.Operations[i].Method, request: operationRequest}
+		result.Results[i] = BatchOperationResult{Status: "OK"}
+
+		switch operation.method {
+		case Create:
+			documents, err := NewSaveAction(action.Client).process(operationRequest.GetData())
+			if err != nil {
+				result.Results[i] = BatchOperationResult{Status: "NOK", Error: err.Error()}
+				continue
+			}
+
+			insertedIDs := make([]interface{}, 0, len(documents))
+			for j, document := range documents {
+				if documentMap, ok := document.(map[string]interface{}); ok {
+					if _, ok := documentMap["_id"]; !ok {
+						documentMap["_id"] = primitive.NewObjectID()
+					}
+					insertedIDs = append(insertedIDs, documentMap["_id"])
+					documents[j] = documentMap
+				}
+
+				operation.models = append(operation.models, len(models[collection]))
+				models[collection] = append(models[collection], mongodriver.NewInsertOneModel().SetDocument(document))
+			}
+
+			operation.documents = documents
+			result.Results[i].Result = map[string]interface{}{"inserted_ids": insertedIDs}
+		case Update:
+			update, err := NewUpdateAction(action.Client).process(operationRequest.GetData())
+			if err != nil {
+				result.Results[i] = BatchOperationResult{Status: "NOK", Error: err.Error()}
+				continue
+			}
+
+			operation.models = []int{len(models[collection])}
+			models[collection] = append(models[collection], mongodriver.NewUpdateManyModel().SetFilter(operationRequest.GetSelect()).SetUpdate(update))
+		case Upsert:
+			operation.models = []int{len(models[collection])}
+			models[collection] = append(models[collection], mongodriver.NewUpdateManyModel().
+				SetFilter(operationRequest.GetSelect()).
+				SetUpdate(upsertDocument(operationRequest.GetData())).
+				SetUpsert(true))
+		case Delete:
+			if !action.Client.Replicated() {
+				removed, err := action.Client.Find(collection, operationRequest.GetSelect(), nil, []string{"_id"})
+				if err != nil {
+					result.Results[i] = BatchOperationResult{Status: "NOK", Error: err.Error()}
+					continue
+				}
+				operation.removed = removed.Result
+			}
+
+			operation.models = []int{len(models[collection])}
+			models[collection] = append(models[collection], mongodriver.NewDeleteManyModel().SetFilter(operationRequest.GetSelect()))
+		}
+
+		operations[collection] = append(operations[collection], operation)
+	}
+
+	for _, collection := range collections {
+		if len(models[collection]) == 0 {
+			continue
+		}
+
+		bulkResult, err := action.Client.BulkWrite(collection, models[collection], false)
+
+		failed := map[int]string{}
+		var bulkErr mongodriver.BulkWriteException
+		switch {
+		case errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil:
+			for _, writeErr := range bulkErr.WriteErrors {
+				failed[writeErr.Index] = writeErr.Message
+			}
+		case err != nil:
+			for model := range models[collection] {
+				failed[model] = err.Error()
+			}
+		}
+
+		for _, operation := range operations[collection] {
+			operationResult := &result.Results[operation.index]
+			if operationResult.Status != "OK" {
+				continue
+			}
+
+			for _, model := range operation.models {
+				if message, ok := failed[model]; ok {
+					*operationResult = BatchOperationResult{Status: "NOK", Error: message}
+					break
+				}
+			}
+			if operationResult.Status != "OK" {
+				continue
+			}
+
+			upserted := false
+			if operation.method == Upsert && bulkResult != nil {
+				if upsertedID, ok := bulkResult.UpsertedIDs[int64(operation.models[0])]; ok {
+					operationResult.Result = map[string]interface{}{"upserted_id": upsertedID}
+					upserted = true
+				}
+			}
+
+			if tracked {
+				action.track(operation, upserted)
+			}
+		}
+	}
+
+	return result, http.StatusOK, nil
+}
+
+// track records a written bulk operation in the outbox and notifies the subscribers, bulk writes leave no transaction to do it in
+func (action *BatchAction) track(operation *bulkOperation, upserted bool) {
+	collection := operation.request.GetCollection()
+	documents := operation.documents
+
+	if operation.method == Update || operation.method == Upsert {
+		found, err := action.Client.Find(collection, operation.request.GetSelect(), operation.request.GetOptions(), operation.request.GetIncludeFields())
+		if err != nil {
+			logger.Logger.Error("BatchAction", zap.Error(err))
+			return
+		}
+		documents = found.Result
+	}
+
+	var duplicateMethod, changeOperation string
+	var processed interface{} = &types.FindResult{Result: documents}
+	switch {
+	case operation.method == Create:
+		duplicateMethod, changeOperation = Create, "insert"
+	case operation.method == Update:
+		duplicateMethod, changeOperation = Update, "update"
+	case operation.method == Upsert && upserted:
+		duplicateMethod, changeOperation = UpsertCreate, "insert"
+	case operation.method == Upsert:
+		duplicateMethod, changeOperation = UpsertUpdate, "update"
+	default:
+		duplicateMethod, changeOperation, processed = Delete, "delete", []interface{}{}
+		documents = operation.removed
+	}
+
+	if err := action.Client.Duplicate(duplicateMethod, operation.request, processed); err != nil {
+		logger.Logger.Error("BatchAction", zap.Error(err))
+	}
+
+	action.Client.Notify(changeOperation, collection, documents)
+}
+
+// upsertDocument turns an upsert document into one update setting the change time, and the creation fields on insert
+func upsertDocument(data interface{}) interface{} {
+	document, ok := data.(map[string]interface{})
+	if !ok {
+		return data
+	}
+
+	update := map[string]interface{}{}
+	set := map[string]interface{}{}
+	for key, value := range document {
+		if strings.HasPrefix(key, "$") {
+			update[key] = value
+		} else {
+			set[key] = value
+		}
+	}
+	if operatorSet, ok := update["$set"].(map[string]interface{}); ok {
+		for key, value := range operatorSet {
+			set[key] = value
+		}
+	}
+
+	now := time.Now().Unix()
+	set["ch_time"] = now
+	update["$set"] = set
+
+	onInsert, _ := update["$setOnInsert"].(map[string]interface{})
+	if onInsert == nil {
+		onInsert = map[string]interface{}{}
+	}
+	if _, ok := set["internal_id"]; !ok {
+		onInsert["internal_id"] = uuid.New().String()
+	}
+	if _, ok := set["cr_time"]; !ok {
+		onInsert["cr_time"] = now
+	}
+	update["$setOnInsert"] = onInsert
+
+	return update
+}
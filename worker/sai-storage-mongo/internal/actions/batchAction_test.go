@@ -0,0 +1,129 @@
+package actions
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/saiset-co/sai-storage-mongo/mongo"
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+func TestUpsertDocument(t *testing.T) {
+	update := upsertDocument(map[string]interface{}{
+		"hash":    "A1",
+		"$set":    map[string]interface{}{"height": float64(5)},
+		"$inc":    map[string]interface{}{"seen": float64(1)},
+		"cr_time": float64(100),
+	}).(map[string]interface{})
+
+	set := update["$set"].(map[string]interface{})
+	if set["hash"] != "A1" || set["height"] != float64(5) || set["ch_time"] == nil {
+		t.Fatalf("expected the fields and the $set of the document in one $set with the change time, got %v", set)
+	}
+	if !reflect.DeepEqual(update["$inc"], map[string]interface{}{"seen": float64(1)}) {
+		t.Fatalf("expected the other operators to be kept, got %v", update)
+	}
+
+	onInsert := update["$setOnInsert"].(map[string]interface{})
+	if id, ok := onInsert["internal_id"].(string); !ok || id == "" {
+		t.Fatalf("expected an internal id on insert, got %v", onInsert)
+	}
+	if _, ok := onInsert["cr_time"]; ok {
+		t.Fatalf("expected the creation time of the document to be kept, got %v", onInsert)
+	}
+
+	if data := upsertDocument([]interface{}{"pipeline"}); !reflect.DeepEqual(data, []interface{}{"pipeline"}) {
+		t.Fatalf("expected anything but a document to be left as it is, got %v", data)
+	}
+}
+
+func batchClient(mt *mtest.T) *mongo.Client {
+	return &mongo.Client{Config: &types.StorageConfig{Database: "test"}, Host: mt.Client}
+}
+
+func commandNames(mt *mtest.T) []string {
+	var names []string
+	for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+		names = append(names, started.CommandName)
+	}
+	return names
+}
+
+func TestBatchOrdered(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("stops at the first failure", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateCursorResponse(0, "test.txs", mtest.FirstBatch, bson.D{{Key: "hash", Value: "A1"}}),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Message: "bad update", Name: "BadValue"}),
+		)
+
+		_, status, err := NewBatchAction(batchClient(mt)).Handle(types.BatchRequest{
+			Operations: []types.BatchOperation{{Method: Create}, {Method: Update}, {Method: Delete}},
+			Requests: []types.IRequest{
+				types.CreateRequest{Collection: "txs", Documents: []interface{}{map[string]interface{}{"hash": "A1"}}},
+				types.UpdateRequest{Collection: "txs", Select: map[string]interface{}{"hash": "A1"}, Document: map[string]interface{}{"$set": map[string]interface{}{"height": 5}}},
+				types.DeleteRequest{Collection: "txs", Select: map[string]interface{}{"hash": "A1"}},
+			},
+		})
+
+		// without a replica set the operations before the failure stay applied, the error says so
+		if status != http.StatusInternalServerError || err == nil || !strings.Contains(err.Error(), "operation 1 (update), the operations before it have been applied") {
+			t.Fatalf("expected the batch to fail at the update, got %d %v", status, err)
+		}
+		if names := commandNames(mt); !reflect.DeepEqual(names, []string{"insert", "find", "find"}) {
+			t.Fatalf("expected the operations to run in order up to the failure, got %v", names)
+		}
+	})
+}
+
+func TestBatchUnordered(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ordered := false
+
+	mt.Run("one bulk write per collection", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateCursorResponse(0, "test.blocks", mtest.FirstBatch, bson.D{{Key: "height", Value: 5}}),
+		)
+
+		result, status, err := NewBatchAction(batchClient(mt)).Handle(types.BatchRequest{
+			Ordered:    &ordered,
+			Operations: []types.BatchOperation{{Method: Create}, {Method: Update}, {Method: Create}},
+			Requests: []types.IRequest{
+				types.CreateRequest{Collection: "txs", Documents: []interface{}{map[string]interface{}{"hash": "A1"}}},
+				types.UpdateRequest{Collection: "blocks", Select: map[string]interface{}{"height": 5}, Document: map[string]interface{}{"$set": map[string]interface{}{"hash": "H5"}}},
+				types.CreateRequest{Collection: "txs", Documents: []interface{}{map[string]interface{}{"hash": "A1"}}},
+			},
+		})
+		if err != nil || status != http.StatusOK {
+			t.Fatalf("expected the batch to be answered per operation, got %d %v", status, err)
+		}
+
+		batch := result.(BatchResult)
+		if batch.Transaction || len(batch.Results) != 3 {
+			t.Fatalf("unexpected batch result %+v", batch)
+		}
+		if batch.Results[0].Status != "OK" || batch.Results[1].Status != "OK" {
+			t.Fatalf("expected the other operations to be written, got %+v", batch.Results)
+		}
+		if ids := batch.Results[0].Result.(map[string]interface{})["inserted_ids"].([]interface{}); len(ids) != 1 {
+			t.Fatalf("expected the inserted id, got %v", batch.Results[0].Result)
+		}
+		if batch.Results[2].Status != "NOK" || batch.Results[2].Error != "duplicate key" {
+			t.Fatalf("expected the second insert of txs to fail alone, got %+v", batch.Results[2])
+		}
+
+		// both creates of txs go in one unordered write, the update of blocks in another, then the update is read back
+		if names := commandNames(mt); !reflect.DeepEqual(names, []string{"insert", "update", "find"}) {
+			t.Fatalf("expected one write per collection, got %v", names)
+		}
+	})
+}
@@ -1,14 +1,11 @@
 package actions
 
 import (
-	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.uber.org/zap"
 
-	"github.com/saiset-co/sai-storage-mongo/logger"
 	"github.com/saiset-co/sai-storage-mongo/mongo"
 	"github.com/saiset-co/sai-storage-mongo/types"
 )
@@ -26,27 +23,26 @@ func NewSaveAction(client *mongo.Client) *CreateAction {
 }
 
 func (action *CreateAction) Handle(request types.IRequest) (interface{}, int, error) {
+	return handleWrite("CreateAction", action.Client, action, request)
+}
+
+func (action *CreateAction) apply(client mongo.Client, request types.IRequest) (interface{}, Change, error) {
 	precessed, err := action.process(request.GetData())
 	if err != nil {
-		logger.Logger.Error("CreateAction", zap.Error(err))
-		return nil, http.StatusInternalServerError, err
+		return nil, Change{}, err
 	}
 
-	insertResult, err := action.Client.InsertMany(request.GetCollection(), precessed)
+	insertResult, err := client.InsertMany(request.GetCollection(), precessed)
 	if err != nil {
-		logger.Logger.Error("CreateAction", zap.Error(err))
-		return nil, http.StatusInternalServerError, err
+		return nil, Change{}, err
 	}
 
-	result, err := action.Client.Find(request.GetCollection(), bson.M{"_id": bson.M{"$in": insertResult.InsertedIDs}}, request.GetOptions(), request.GetIncludeFields())
+	result, err := client.Find(request.GetCollection(), bson.M{"_id": bson.M{"$in": insertResult.InsertedIDs}}, request.GetOptions(), request.GetIncludeFields())
 	if err != nil {
-		logger.Logger.Error("CreateAction", zap.Error(err))
-		return nil, http.StatusInternalServerError, err
+		return nil, Change{}, err
 	}
 
-	action.Client.Duplicate(Create, request, result)
-
-	return result, http.StatusOK, nil
+	return result, Change{"insert", request.GetCollection(), result.Result}, client.Duplicate(Create, request, result)
 }
 
 func (action *CreateAction) process(data interface{}) ([]interface{}, error) {
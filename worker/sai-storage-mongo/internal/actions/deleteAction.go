@@ -1,11 +1,6 @@
 package actions
 
 import (
-	"net/http"
-
-	"go.uber.org/zap"
-
-	"github.com/saiset-co/sai-storage-mongo/logger"
 	"github.com/saiset-co/sai-storage-mongo/mongo"
 	"github.com/saiset-co/sai-storage-mongo/types"
 )
@@ -23,13 +18,24 @@ func NewDeleteAction(client *mongo.Client) *DeleteAction {
 }
 
 func (action *DeleteAction) Handle(request types.IRequest) (interface{}, int, error) {
-	err := action.Client.Remove(request.GetCollection(), request.GetSelect())
-	if err != nil {
-		logger.Logger.Error("DeleteAction", zap.Error(err))
-		return nil, http.StatusInternalServerError, err
+	return handleWrite("DeleteAction", action.Client, action, request)
+}
+
+func (action *DeleteAction) apply(client mongo.Client, request types.IRequest) (interface{}, Change, error) {
+	removed := &types.FindResult{}
+	var err error
+	// without change streams the subscribers learn the removed documents from the storage itself
+	if !client.Replicated() {
+		removed, err = client.Find(request.GetCollection(), request.GetSelect(), nil, []string{"_id"})
+		if err != nil {
+			return nil, Change{}, err
+		}
 	}
 
-	action.Client.Duplicate(Delete, request, []interface{}{})
+	err = client.Remove(request.GetCollection(), request.GetSelect())
+	if err != nil {
+		return nil, Change{}, err
+	}
 
-	return "Documents have been deleted", http.StatusOK, nil
+	return "Documents have been deleted", Change{"delete", request.GetCollection(), removed.Result}, client.Duplicate(Delete, request, []interface{}{})
 }
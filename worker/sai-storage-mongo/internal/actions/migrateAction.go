@@ -0,0 +1,52 @@
+package actions
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+	"github.com/saiset-co/sai-storage-mongo/mongo"
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+type MigrateAction struct {
+	Client *mongo.Client
+}
+
+type MigrateResult struct {
+	DryRun     bool                    `json:"dry_run"`
+	Migrations []mongo.MigrationResult `json:"migrations"`
+	Error      string                  `json:"error,omitempty"`
+}
+
+func NewMigrateAction(client *mongo.Client) *MigrateAction {
+	return &MigrateAction{
+		Client: client,
+	}
+}
+
+// Handle reads the migrations directory again, so migrations added since the start can be applied without a restart
+func (action *MigrateAction) Handle(request types.IRequest) (interface{}, int, error) {
+	migrateRequest, ok := request.(types.MigrateRequest)
+	if !ok {
+		return nil, http.StatusBadRequest, errors.New("wrong migrate request")
+	}
+
+	migrations, err := mongo.LoadMigrations(action.Client.Config.MigrationsDirectory)
+	if err != nil {
+		logger.Logger.Error("MigrateAction", zap.Error(err))
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// a failure keeps the migrations applied before it, they are reported with the error rather than dropped
+	// with it, the service answers an error without its result
+	results, err := action.Client.Migrate(migrations, migrateRequest.Version, migrateRequest.DryRun)
+	if err != nil {
+		logger.Logger.Error("MigrateAction", zap.Error(err))
+		return MigrateResult{DryRun: migrateRequest.DryRun, Migrations: results, Error: err.Error()}, http.StatusInternalServerError, nil
+	}
+
+	return MigrateResult{DryRun: migrateRequest.DryRun, Migrations: results}, http.StatusOK, nil
+}
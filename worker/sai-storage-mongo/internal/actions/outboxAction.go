@@ -0,0 +1,78 @@
+package actions
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+	"github.com/saiset-co/sai-storage-mongo/mongo"
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+const outboxLimit = 100
+
+type GetOutboxAction struct {
+	Client *mongo.Client
+}
+
+type ReplayOutboxAction struct {
+	Client *mongo.Client
+}
+
+func NewGetOutboxAction(client *mongo.Client) *GetOutboxAction {
+	return &GetOutboxAction{
+		Client: client,
+	}
+}
+
+func NewReplayOutboxAction(client *mongo.Client) *ReplayOutboxAction {
+	return &ReplayOutboxAction{
+		Client: client,
+	}
+}
+
+func (action *GetOutboxAction) Handle(request types.IRequest) (interface{}, int, error) {
+	requestOptions := request.GetOptions()
+	if requestOptions == nil {
+		requestOptions = &types.Options{}
+	}
+	if requestOptions.Limit == 0 {
+		requestOptions.Limit = outboxLimit
+	}
+
+	entries, err := action.Client.OutboxEntries(outboxSelector(request), requestOptions)
+	if err != nil {
+		logger.Logger.Error("GetOutboxAction", zap.Error(err))
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return entries, http.StatusOK, nil
+}
+
+func (action *ReplayOutboxAction) Handle(request types.IRequest) (interface{}, int, error) {
+	replayed, err := action.Client.ReplayOutbox(outboxSelector(request))
+	if err != nil {
+		logger.Logger.Error("ReplayOutboxAction", zap.Error(err))
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return map[string]interface{}{"replayed": replayed}, http.StatusOK, nil
+}
+
+// outboxSelector selects the dead-lettered entries unless the request selects otherwise
+func outboxSelector(request types.IRequest) map[string]interface{} {
+	selector := map[string]interface{}{}
+	for key, value := range request.GetSelect() {
+		selector[key] = value
+	}
+
+	if _, ok := selector["status"]; !ok {
+		selector["status"] = mongo.OutboxDead
+	}
+	if request.GetCollection() != "" {
+		selector["collection"] = request.GetCollection()
+	}
+
+	return selector
+}
@@ -3,6 +3,7 @@ package actions
 import (
 	"net/http"
 
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	"github.com/saiset-co/sai-storage-mongo/logger"
@@ -24,6 +25,9 @@ func NewGetAction(client *mongo.Client) *ReadAction {
 
 func (action *ReadAction) Handle(request types.IRequest) (interface{}, int, error) {
 	data, err := action.Client.Find(request.GetCollection(), request.GetSelect(), request.GetOptions(), request.GetIncludeFields())
+	if errors.Is(err, mongo.ErrInvalidCursor) {
+		return nil, http.StatusBadRequest, err
+	}
 	if err != nil {
 		logger.Logger.Error("ReadAction", zap.Error(err))
 		return nil, http.StatusInternalServerError, err
@@ -0,0 +1,31 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+	"github.com/saiset-co/sai-storage-mongo/mongo"
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+// The client has no connection, a malformed cursor is answered before the read reaches mongo
+func TestReadRejectsMalformedCursor(t *testing.T) {
+	action := NewGetAction(&mongo.Client{Config: &types.StorageConfig{Database: "db"}})
+
+	_, status, err := action.Handle(types.ReadRequest{
+		Collection: "txs",
+		Select:     map[string]interface{}{},
+		Options:    &types.Options{Limit: 10, Cursor: "bm90LWEtY3Vyc29y", Count: types.CountExact},
+	})
+	if status != http.StatusBadRequest || !errors.Is(err, mongo.ErrInvalidCursor) {
+		t.Fatalf("expected 400 with ErrInvalidCursor, got %d %v", status, err)
+	}
+}
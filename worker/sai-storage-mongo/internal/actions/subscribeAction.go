@@ -0,0 +1,89 @@
+package actions
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+	"github.com/saiset-co/sai-storage-mongo/mongo"
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+const (
+	subscribeTimeout    = 25 * time.Second
+	subscribeMaxTimeout = 60 * time.Second
+	subscribeLimit      = 100
+)
+
+type SubscribeAction struct {
+	Client *mongo.Client
+}
+
+type SubscribeResult struct {
+	Events      []*mongo.ChangeEvent `json:"events"`
+	ResumeToken string               `json:"resume_token"`
+}
+
+func NewSubscribeAction(client *mongo.Client) *SubscribeAction {
+	return &SubscribeAction{
+		Client: client,
+	}
+}
+
+// Handle long-polls for changes: it waits up to the timeout for the first change and returns it with those already queued
+func (action *SubscribeAction) Handle(request types.IRequest) (interface{}, int, error) {
+	subscribeRequest, ok := request.(types.SubscribeRequest)
+	if !ok {
+		return nil, http.StatusBadRequest, errors.New("wrong subscribe request")
+	}
+
+	timeout := time.Duration(subscribeRequest.Timeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = subscribeTimeout
+	}
+	if timeout > subscribeMaxTimeout {
+		timeout = subscribeMaxTimeout
+	}
+
+	limit := subscribeRequest.Limit
+	if limit <= 0 || limit > subscribeLimit {
+		limit = subscribeLimit
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stream, err := action.Client.Watch(ctx, request.GetCollection(), request.GetSelect(), subscribeRequest.ResumeToken)
+	if errors.Is(err, mongo.ErrResumeTokenExpired) {
+		return nil, http.StatusGone, err
+	}
+	if err != nil {
+		logger.Logger.Error("SubscribeAction", zap.Error(err))
+		return nil, http.StatusInternalServerError, err
+	}
+	defer stream.Close()
+
+	result := SubscribeResult{Events: []*mongo.ChangeEvent{}}
+
+	event, err := stream.Next(ctx)
+	for err == nil && event != nil {
+		result.Events = append(result.Events, event)
+		if int64(len(result.Events)) >= limit {
+			break
+		}
+
+		event, err = stream.TryNext(ctx)
+	}
+	if err != nil && ctx.Err() == nil {
+		logger.Logger.Error("SubscribeAction", zap.Error(err))
+		return nil, http.StatusInternalServerError, err
+	}
+
+	result.ResumeToken = stream.ResumeToken()
+
+	return result, http.StatusOK, nil
+}
@@ -2,12 +2,8 @@ package actions
 
 import (
 	"maps"
-	"net/http"
 	"time"
 
-	"go.uber.org/zap"
-
-	"github.com/saiset-co/sai-storage-mongo/logger"
 	"github.com/saiset-co/sai-storage-mongo/mongo"
 	"github.com/saiset-co/sai-storage-mongo/types"
 	"github.com/saiset-co/sai-storage-mongo/utils"
@@ -26,22 +22,23 @@ func NewUpdateAction(client *mongo.Client) *UpdateAction {
 }
 
 func (action *UpdateAction) Handle(request types.IRequest) (interface{}, int, error) {
+	return handleWrite("UpdateAction", action.Client, action, request)
+}
+
+func (action *UpdateAction) apply(client mongo.Client, request types.IRequest) (interface{}, Change, error) {
 	precessed, err := action.process(request.GetData())
 	if err != nil {
-		logger.Logger.Error("UpdateAction", zap.Error(err))
-		return nil, http.StatusInternalServerError, err
+		return nil, Change{}, err
 	}
 
-	findResult, err := action.Client.Find(request.GetCollection(), request.GetSelect(), request.GetOptions(), request.GetIncludeFields())
+	findResult, err := client.Find(request.GetCollection(), request.GetSelect(), request.GetOptions(), request.GetIncludeFields())
 	if err != nil {
-		logger.Logger.Error("CreateAction", zap.Error(err))
-		return nil, http.StatusInternalServerError, err
+		return nil, Change{}, err
 	}
 
-	_, err = action.Client.Update(request.GetCollection(), request.GetSelect(), precessed)
+	_, err = client.Update(request.GetCollection(), request.GetSelect(), precessed)
 	if err != nil {
-		logger.Logger.Error("UpdateAction", zap.Error(err))
-		return nil, http.StatusInternalServerError, err
+		return nil, Change{}, err
 	}
 
 	for i, item := range findResult.Result {
@@ -59,9 +56,7 @@ func (action *UpdateAction) Handle(request types.IRequest) (interface{}, int, er
 		}
 	}
 
-	action.Client.Duplicate(Update, request, findResult)
-
-	return findResult, http.StatusOK, nil
+	return findResult, Change{"update", request.GetCollection(), findResult.Result}, client.Duplicate(Update, request, findResult)
 }
 
 func (action *UpdateAction) process(data interface{}) (interface{}, error) {
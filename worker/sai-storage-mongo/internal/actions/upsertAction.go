@@ -2,20 +2,18 @@ package actions
 
 import (
 	"maps"
-	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.uber.org/zap"
 
-	"github.com/saiset-co/sai-storage-mongo/logger"
 	"github.com/saiset-co/sai-storage-mongo/mongo"
 	"github.com/saiset-co/sai-storage-mongo/types"
 	"github.com/saiset-co/sai-storage-mongo/utils"
 )
 
 const (
+	Upsert       = "upsert"
 	UpsertUpdate = "upsert_update"
 	UpsertCreate = "upsert_create"
 )
@@ -31,72 +29,77 @@ func NewUpsertAction(client *mongo.Client) *UpsertAction {
 }
 
 func (action *UpsertAction) Handle(request types.IRequest) (interface{}, int, error) {
-	exists, err := action.Client.Find(request.GetCollection(), request.GetSelect(), request.GetOptions(), []string{"_id"})
+	return handleWrite("UpsertAction", action.Client, action, request)
+}
+
+func (action *UpsertAction) apply(client mongo.Client, request types.IRequest) (interface{}, Change, error) {
+	exists, err := client.Find(request.GetCollection(), request.GetSelect(), request.GetOptions(), []string{"_id"})
 	if err != nil {
-		logger.Logger.Error("UpsertAction", zap.Error(err))
-		return nil, http.StatusInternalServerError, err
+		return nil, Change{}, err
 	}
 
 	if len(exists.Result) > 0 {
-		precessed, err := action.processUpdate(request.GetData())
+		result, err := action.update(client, request)
 		if err != nil {
-			logger.Logger.Error("UpsertAction", zap.Error(err))
-			return nil, http.StatusInternalServerError, err
+			return nil, Change{}, err
 		}
 
-		findResult, err := action.Client.Find(request.GetCollection(), request.GetSelect(), request.GetOptions(), request.GetIncludeFields())
-		if err != nil {
-			logger.Logger.Error("CreateAction", zap.Error(err))
-			return nil, http.StatusInternalServerError, err
-		}
+		return result, Change{"update", request.GetCollection(), result.Result}, client.Duplicate(UpsertUpdate, request, result)
+	}
 
-		_, err = action.Client.Update(request.GetCollection(), request.GetSelect(), precessed)
-		if err != nil {
-			logger.Logger.Error("UpsertAction", zap.Error(err))
-			return nil, http.StatusInternalServerError, err
-		}
+	result, err := action.insert(client, request)
+	if err != nil {
+		return nil, Change{}, err
+	}
 
-		for i, item := range findResult.Result {
-			if itemData, itemOk := item.(map[string]interface{}); itemOk {
-				if getData, dataOk := precessed.(map[string]interface{}); dataOk {
-					if setValue, setOk := getData["$set"].(map[string]interface{}); setOk {
-						maps.Copy(itemData, setValue)
-						findResult.Result[i] = itemData
-					}
-					if unsetValue, setOk := getData["$unset"].(map[string]interface{}); setOk {
-						utils.MapsDelete(itemData, unsetValue)
-						findResult.Result[i] = itemData
-					}
-				}
-			}
-		}
+	return result, Change{"insert", request.GetCollection(), result.Result}, client.Duplicate(UpsertCreate, request, result)
+}
+func (action *UpsertAction) update(client mongo.Client, request types.IRequest) (*types.FindResult, error) {
+	precessed, err := action.processUpdate(request.GetData())
+	if err != nil {
+		return nil, err
+	}
 
-		action.Client.Duplicate(UpsertUpdate, request, findResult)
+	findResult, err := client.Find(request.GetCollection(), request.GetSelect(), request.GetOptions(), request.GetIncludeFields())
+	if err != nil {
+		return nil, err
+	}
 
-		return findResult, http.StatusOK, nil
-	} else {
-		precessed, err := action.processInsert(request.GetData())
-		if err != nil {
-			logger.Logger.Error("UpsertAction", zap.Error(err))
-			return nil, http.StatusInternalServerError, err
-		}
+	_, err = client.Update(request.GetCollection(), request.GetSelect(), precessed)
+	if err != nil {
+		return nil, err
+	}
 
-		insertResult, err := action.Client.Insert(request.GetCollection(), precessed)
-		if err != nil {
-			logger.Logger.Error("UpsertAction", zap.Error(err))
-			return nil, http.StatusInternalServerError, err
+	for i, item := range findResult.Result {
+		if itemData, itemOk := item.(map[string]interface{}); itemOk {
+			if getData, dataOk := precessed.(map[string]interface{}); dataOk {
+				if setValue, setOk := getData["$set"].(map[string]interface{}); setOk {
+					maps.Copy(itemData, setValue)
+					findResult.Result[i] = itemData
+				}
+				if unsetValue, setOk := getData["$unset"].(map[string]interface{}); setOk {
+					utils.MapsDelete(itemData, unsetValue)
+					findResult.Result[i] = itemData
+				}
+			}
 		}
+	}
 
-		result, err := action.Client.Find(request.GetCollection(), bson.M{"_id": insertResult.InsertedID}, request.GetOptions(), request.GetIncludeFields())
-		if err != nil {
-			logger.Logger.Error("CreateAction", zap.Error(err))
-			return nil, http.StatusInternalServerError, err
-		}
+	return findResult, nil
+}
 
-		action.Client.Duplicate(UpsertCreate, request, result)
+func (action *UpsertAction) insert(client mongo.Client, request types.IRequest) (*types.FindResult, error) {
+	precessed, err := action.processInsert(request.GetData())
+	if err != nil {
+		return nil, err
+	}
 
-		return result, http.StatusOK, nil
+	insertResult, err := client.Insert(request.GetCollection(), precessed)
+	if err != nil {
+		return nil, err
 	}
+
+	return client.Find(request.GetCollection(), bson.M{"_id": insertResult.InsertedID}, request.GetOptions(), request.GetIncludeFields())
 }
 
 func (action *UpsertAction) processUpdate(data interface{}) (interface{}, error) {
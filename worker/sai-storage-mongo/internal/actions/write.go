@@ -0,0 +1,40 @@
+package actions
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+	"github.com/saiset-co/sai-storage-mongo/mongo"
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+// Change is what a write did to a collection, sent to the subscribers once the write is committed
+type Change struct {
+	Operation  string
+	Collection string
+	Documents  []interface{}
+}
+
+type writer interface {
+	apply(client mongo.Client, request types.IRequest) (interface{}, Change, error)
+}
+
+// handleWrite applies a write together with its outbox entry and notifies the subscribers
+func handleWrite(name string, client *mongo.Client, action writer, request types.IRequest) (interface{}, int, error) {
+	var result interface{}
+	var change Change
+	err := client.WithTransaction(func(transaction mongo.Client) (err error) {
+		result, change, err = action.apply(transaction, request)
+		return err
+	})
+	if err != nil {
+		logger.Logger.Error(name, zap.Error(err))
+		return nil, http.StatusInternalServerError, err
+	}
+
+	client.Notify(change.Operation, change.Collection, change.Documents)
+
+	return result, http.StatusOK, nil
+}
@@ -10,11 +10,12 @@ import (
 	"github.com/saiset-co/sai-service/service"
 	"github.com/saiset-co/sai-storage-mongo/internal/actions"
 	"github.com/saiset-co/sai-storage-mongo/logger"
+	"github.com/saiset-co/sai-storage-mongo/tracing"
 	"github.com/saiset-co/sai-storage-mongo/types"
 )
 
 func (is InternalService) NewHandler() service.Handler {
-	return service.Handler{
+	handler := service.Handler{
 		"create": service.HandlerElement{
 			Name:        "Create documents",
 			Description: "Create documents",
@@ -123,7 +124,74 @@ func (is InternalService) NewHandler() service.Handler {
 				return actions.NewDropIndexesAction(is.Client).Handle(request)
 			},
 		},
+		"batch": service.HandlerElement{
+			Name:        "Batch",
+			Description: "Run create, update, upsert and delete operations together",
+			Function: func(data interface{}, metadata interface{}) (interface{}, int, error) {
+				request, err := is.convertRequest(data, "batch")
+				if err != nil {
+					return nil, 500, err
+				}
+
+				return actions.NewBatchAction(is.Client).Handle(request)
+			},
+		},
+		"subscribe": service.HandlerElement{
+			Name:        "Subscribe",
+			Description: "Wait for changes of a collection",
+			Function: func(data interface{}, metadata interface{}) (interface{}, int, error) {
+				request, err := is.convertRequest(data, "subscribe")
+				if err != nil {
+					return nil, 500, err
+				}
+
+				return actions.NewSubscribeAction(is.Client).Handle(request)
+			},
+		},
+		"get_outbox": service.HandlerElement{
+			Name:        "Get outbox",
+			Description: "Get duplicate deliveries, the dead-lettered ones by default",
+			Function: func(data interface{}, metadata interface{}) (interface{}, int, error) {
+				request, err := is.convertRequest(data, "outbox")
+				if err != nil {
+					return nil, 500, err
+				}
+
+				return actions.NewGetOutboxAction(is.Client).Handle(request)
+			},
+		},
+		"replay_outbox": service.HandlerElement{
+			Name:        "Replay outbox",
+			Description: "Queue failed duplicate deliveries again",
+			Function: func(data interface{}, metadata interface{}) (interface{}, int, error) {
+				request, err := is.convertRequest(data, "outbox")
+				if err != nil {
+					return nil, 500, err
+				}
+
+				return actions.NewReplayOutboxAction(is.Client).Handle(request)
+			},
+		},
+		"migrate": service.HandlerElement{
+			Name:        "Migrate",
+			Description: "Apply the pending migrations, or report what they would do with dry_run",
+			Function: func(data interface{}, metadata interface{}) (interface{}, int, error) {
+				request, err := is.convertRequest(data, "migrate")
+				if err != nil {
+					return nil, 500, err
+				}
+
+				return actions.NewMigrateAction(is.Client).Handle(request)
+			},
+		},
+	}
+
+	for name, element := range handler {
+		element.Middlewares = append(element.Middlewares, is.Guard.Middleware(name), tracing.Middleware(name))
+		handler[name] = element
 	}
+
+	return handler
 }
 
 func (is InternalService) convertRequest(data interface{}, requestType string) (types.IRequest, error) {
@@ -316,6 +384,87 @@ func (is InternalService) convertRequest(data interface{}, requestType string) (
 			return nil, errors.Wrap(err, "convertRequest - validation - drop_indexes")
 		}
 
+		return request, nil
+	case "batch":
+		request := types.BatchRequest{}
+		dataJson, err := json.Marshal(data)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - marshaling - batch")
+		}
+
+		err = json.Unmarshal(dataJson, &request)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - unmarshaling - batch")
+		}
+
+		err = validator.New().Struct(request)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - validation - batch")
+		}
+
+		for i, operation := range request.Operations {
+			operationRequest, err := is.convertRequest(operation.Data, operation.Method)
+			if err != nil {
+				return nil, errors.Wrapf(err, "convertRequest - operation %d - batch", i)
+			}
+
+			request.Requests = append(request.Requests, operationRequest)
+		}
+
+		return request, nil
+	case "subscribe":
+		request := types.SubscribeRequest{}
+		dataJson, err := json.Marshal(data)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - marshaling - subscribe")
+		}
+
+		err = json.Unmarshal(dataJson, &request)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - unmarshaling - subscribe")
+		}
+
+		err = validator.New().Struct(request)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - validation - subscribe")
+		}
+
+		return request, nil
+	case "outbox":
+		request := types.OutboxRequest{}
+		dataJson, err := json.Marshal(data)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - marshaling - outbox")
+		}
+
+		err = json.Unmarshal(dataJson, &request)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - unmarshaling - outbox")
+		}
+
+		return request, nil
+	case "migrate":
+		request := types.MigrateRequest{}
+		dataJson, err := json.Marshal(data)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - marshaling - migrate")
+		}
+
+		err = json.Unmarshal(dataJson, &request)
+		if err != nil {
+			logger.Logger.Error("convertRequest", zap.Error(err))
+			return nil, errors.Wrap(err, "convertRequest - unmarshaling - migrate")
+		}
+
 		return request, nil
 	}
 
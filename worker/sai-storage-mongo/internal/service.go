@@ -3,10 +3,12 @@ package internal
 import (
 	"github.com/saiset-co/sai-service/service"
 	"github.com/saiset-co/sai-storage-mongo/mongo"
+	"github.com/saiset-co/sai-storage-mongo/security"
 )
 
 type InternalService struct {
 	Name    string
 	Context *service.Context
 	Client  *mongo.Client
+	Guard   *security.Guard
 }
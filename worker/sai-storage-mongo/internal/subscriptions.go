@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+	"github.com/saiset-co/sai-storage-mongo/security"
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+type SubscriptionsConfig struct {
+	Enabled        bool   `json:"enabled"`
+	Address        string `json:"address"`
+	MaxConnections int64  `json:"max_connections"`
+}
+
+type subscriptionMessage struct {
+	Status string      `json:"Status"`
+	Event  interface{} `json:"event,omitempty"`
+	Error  string      `json:"Error,omitempty"`
+}
+
+// StartSubscriptions serves change streams over websocket, one subscription per connection. The first message
+// of a connection is a subscribe request, every change is sent with the token to resume after it.
+func (is InternalService) StartSubscriptions(config SubscriptionsConfig) {
+	if !config.Enabled {
+		return
+	}
+
+	var connections int64
+
+	mux := http.NewServeMux()
+	mux.Handle("/subscribe", websocket.Handler(func(conn *websocket.Conn) {
+		defer conn.Close()
+
+		if atomic.AddInt64(&connections, 1) > config.MaxConnections && config.MaxConnections > 0 {
+			atomic.AddInt64(&connections, -1)
+			_ = websocket.JSON.Send(conn, subscriptionMessage{Status: "NOK", Error: "Too many subscriptions"})
+			return
+		}
+		defer atomic.AddInt64(&connections, -1)
+
+		is.serveSubscription(conn)
+	}))
+
+	logger.Logger.Info("Subscriptions server has been started", zap.String("address", config.Address))
+
+	if err := http.ListenAndServe(config.Address, mux); err != nil {
+		logger.Logger.Error("StartSubscriptions", zap.Error(err))
+	}
+}
+
+func (is InternalService) serveSubscription(conn *websocket.Conn) {
+	token, _ := is.Context.GetConfig("common.token", "").(string)
+	if token != "" && subtle.ConstantTimeCompare([]byte(conn.Request().Header.Get("Token")), []byte(token)) != 1 {
+		_ = websocket.JSON.Send(conn, subscriptionMessage{Status: "NOK", Error: "Wrong token"})
+		return
+	}
+
+	var data map[string]interface{}
+	if err := websocket.JSON.Receive(conn, &data); err != nil {
+		_ = websocket.JSON.Send(conn, subscriptionMessage{Status: "NOK", Error: "Wrong message format"})
+		return
+	}
+
+	// connections skip the handler middlewares, the guard checks the request here with the token of the header
+	guard := is.Guard.Middleware("subscribe")
+	accept := func(data interface{}, metadata interface{}) (interface{}, int, error) { return nil, http.StatusOK, nil }
+	if _, _, err := guard(accept, data, map[string]interface{}{security.MetadataToken: conn.Request().Header.Get("Token")}); err != nil {
+		_ = websocket.JSON.Send(conn, subscriptionMessage{Status: "NOK", Error: err.Error()})
+		return
+	}
+
+	request, err := is.convertRequest(data, "subscribe")
+	if err != nil {
+		_ = websocket.JSON.Send(conn, subscriptionMessage{Status: "NOK", Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := is.Client.Watch(ctx, request.GetCollection(), request.GetSelect(), request.(types.SubscribeRequest).ResumeToken)
+	if err != nil {
+		_ = websocket.JSON.Send(conn, subscriptionMessage{Status: "NOK", Error: err.Error()})
+		return
+	}
+	defer stream.Close()
+
+	// the client sends nothing after subscribing, a failed read means it went away
+	go func() {
+		var discard []byte
+		for websocket.Message.Receive(conn, &discard) == nil {
+		}
+		cancel()
+	}()
+
+	for {
+		event, err := stream.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Logger.Error("serveSubscription", zap.Error(err))
+				_ = websocket.JSON.Send(conn, subscriptionMessage{Status: "NOK", Error: err.Error()})
+			}
+			return
+		}
+
+		if err = websocket.JSON.Send(conn, subscriptionMessage{Status: "OK", Event: event}); err != nil {
+			return
+		}
+	}
+}
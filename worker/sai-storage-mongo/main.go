@@ -8,6 +8,8 @@ import (
 	"github.com/saiset-co/sai-storage-mongo/internal"
 	"github.com/saiset-co/sai-storage-mongo/logger"
 	"github.com/saiset-co/sai-storage-mongo/mongo"
+	"github.com/saiset-co/sai-storage-mongo/security"
+	"github.com/saiset-co/sai-storage-mongo/tracing"
 	"github.com/saiset-co/sai-storage-mongo/types"
 )
 
@@ -20,6 +22,15 @@ func main() {
 
 	logger.Logger = svc.Logger
 
+	tracingConfig := tracing.Config{ServiceName: "sai-storage-mongo", SampleRatio: 1}
+	if err := convertValue(svc.GetConfig("tracing", nil), &tracingConfig); err != nil {
+		fmt.Println("Could not read the tracing configuration:", err)
+	}
+
+	if _, err := tracing.Init(tracingConfig); err != nil {
+		fmt.Println("Could not start tracing:", err)
+	}
+
 	config, err := convertConfig(svc.GetConfig("storage", nil))
 	if err != nil {
 		fmt.Println("Could not read configuration:", err)
@@ -32,13 +43,32 @@ func main() {
 
 	defer client.Host.Disconnect(svc.Context.Context)
 
+	if err = client.DetectDeployment(); err != nil {
+		fmt.Println("Could not detect the mongo deployment:", err)
+	}
+
+	if err = client.InitOutbox(); err != nil {
+		fmt.Println("Could not prepare the duplicate outbox:", err)
+	}
+
+	securityConfig := security.Config{}
+	if err = convertValue(svc.GetConfig("security", nil), &securityConfig); err != nil {
+		fmt.Println("Could not read the security configuration:", err)
+	}
+
 	is := internal.InternalService{
 		Name:    name,
 		Context: svc.Context,
 		Client:  client,
+		Guard:   security.NewGuard(securityConfig),
 	}
 
-	svc.RegisterTasks([]func(){client.DuplicateProcessor})
+	subscriptionsConfig := internal.SubscriptionsConfig{Address: ":8883", MaxConnections: 1000}
+	if err = convertValue(svc.GetConfig("subscriptions", nil), &subscriptionsConfig); err != nil {
+		fmt.Println("Could not read the subscriptions configuration:", err)
+	}
+
+	svc.RegisterTasks([]func(){client.MigrateOnStart, client.OutboxProcessor, func() { is.StartSubscriptions(subscriptionsConfig) }})
 
 	svc.RegisterHandlers(
 		is.NewHandler(),
@@ -47,8 +77,33 @@ func main() {
 	svc.Start()
 }
 
+func convertValue(data interface{}, value interface{}) error {
+	if data == nil {
+		return nil
+	}
+
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(jsonBytes, value)
+}
+
 func convertConfig(data interface{}) (*types.StorageConfig, error) {
-	var config = new(types.StorageConfig)
+	var config = &types.StorageConfig{
+		OutboxCollection:     "_outbox",
+		OutboxPollInterval:   1000,
+		OutboxMaxAttempts:    10,
+		OutboxBackoff:        1000,
+		OutboxMaxBackoff:     300000,
+		OutboxRetention:      604800,
+		MaxBatchSize:         1000,
+		QueryTimeout:         10000,
+		EstimatedCountLimit:  10000,
+		MigrationsDirectory:  "migrations",
+		MigrationsCollection: "_migrations",
+	}
 
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
@@ -0,0 +1,516 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const localTokenPrefix = "local:"
+
+var ErrResumeTokenExpired = errors.New("resume token is no longer available")
+
+// ChangeEvent is a change of a collection, Document is the document after the change
+type ChangeEvent struct {
+	Operation   string      `json:"operation"`
+	Collection  string      `json:"collection"`
+	DocumentKey interface{} `json:"document_key,omitempty"`
+	Document    interface{} `json:"document,omitempty"`
+	ResumeToken string      `json:"resume_token"`
+}
+
+// ChangeStream delivers the changes of one collection matching a selector
+type ChangeStream interface {
+	// Next waits for the next change until ctx is done
+	Next(ctx context.Context) (*ChangeEvent, error)
+	// TryNext returns the next change if there is one already, nil otherwise
+	TryNext(ctx context.Context) (*ChangeEvent, error)
+	// ResumeToken resumes a stream after the last change returned
+	ResumeToken() string
+	Close()
+}
+
+// Watch opens a change stream of the collection. Replicated deployments use mongo change streams,
+// standalone servers the changes made through this storage instance. A delete carries the document key
+// only, so it is matched against the selector with the key as the document: a selector on _id gets the
+// deletes of its documents, a selector on other fields gets none.
+func (c Client) Watch(ctx context.Context, collectionName string, selector map[string]interface{}, resumeToken string) (ChangeStream, error) {
+	if !c.replicated {
+		return c.changes.watch(collectionName, selector, resumeToken)
+	}
+
+	if strings.HasPrefix(resumeToken, localTokenPrefix) {
+		return nil, ErrResumeTokenExpired
+	}
+
+	pipeline := mongo.Pipeline{}
+	if len(selector) > 0 {
+		selector = c.preprocessSelector(selector)
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"$and": bson.A{bson.M{"operationType": "delete"}, prefixFields(selector, "documentKey.")}},
+			bson.M{"$and": bson.A{bson.M{"operationType": bson.M{"$ne": "delete"}}, prefixFields(selector, "fullDocument.")}},
+		}}}})
+	}
+
+	streamOptions := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != "" {
+		streamOptions.SetResumeAfter(bson.M{"_data": resumeToken})
+	}
+
+	stream, err := c.GetCollection(collectionName).Watch(ctx, pipeline, streamOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoChangeStream{stream: stream}, nil
+}
+
+func (c Client) Replicated() bool {
+	return c.replicated
+}
+
+// Notify records changes for the subscribers of a standalone deployment, replicated ones report through change streams.
+// A client not made by NewMongoClient keeps no changes.
+func (c Client) Notify(operation string, collectionName string, documents []interface{}) {
+	if c.replicated || c.changes == nil {
+		return
+	}
+
+	c.changes.publish(operation, collectionName, documents)
+}
+
+// prefixFields points the fields of a selector into an embedded document, keeping the logical operators
+func prefixFields(selector map[string]interface{}, prefix string) bson.M {
+	prefixed := bson.M{}
+	for key, value := range selector {
+		switch key {
+		case "$and", "$or", "$nor":
+			conditions, _ := value.([]interface{})
+			prefixedConditions := bson.A{}
+			for _, condition := range conditions {
+				if conditionMap, ok := condition.(map[string]interface{}); ok {
+					prefixedConditions = append(prefixedConditions, prefixFields(conditionMap, prefix))
+				}
+			}
+			prefixed[key] = prefixedConditions
+		default:
+			prefixed[prefix+key] = value
+		}
+	}
+
+	return prefixed
+}
+
+type mongoChangeStream struct {
+	stream *mongo.ChangeStream
+}
+
+func (s *mongoChangeStream) Next(ctx context.Context) (*ChangeEvent, error) {
+	if !s.stream.Next(ctx) {
+		if err := s.stream.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ctx.Err()
+	}
+
+	return s.event()
+}
+
+func (s *mongoChangeStream) TryNext(ctx context.Context) (*ChangeEvent, error) {
+	if !s.stream.TryNext(ctx) {
+		return nil, s.stream.Err()
+	}
+
+	return s.event()
+}
+
+func (s *mongoChangeStream) event() (*ChangeEvent, error) {
+	var change struct {
+		OperationType string                 `bson:"operationType"`
+		Namespace     struct{ Coll string }  `bson:"ns"`
+		DocumentKey   map[string]interface{} `bson:"documentKey"`
+		FullDocument  map[string]interface{} `bson:"fullDocument"`
+	}
+	if err := s.stream.Decode(&change); err != nil {
+		return nil, err
+	}
+
+	event := &ChangeEvent{
+		Operation:   change.OperationType,
+		Collection:  change.Namespace.Coll,
+		DocumentKey: change.DocumentKey,
+		ResumeToken: s.ResumeToken(),
+	}
+	if change.FullDocument != nil {
+		event.Document = change.FullDocument
+	}
+
+	return event, nil
+}
+
+func (s *mongoChangeStream) ResumeToken() string {
+	token := s.stream.ResumeToken()
+	if token == nil {
+		return ""
+	}
+
+	data, _ := token.Lookup("_data").StringValueOK()
+	return data
+}
+
+func (s *mongoChangeStream) Close() {
+	_ = s.stream.Close(context.Background())
+}
+
+// localChanges keeps the latest changes made through this instance for standalone deployments
+type localChanges struct {
+	mutex    sync.Mutex
+	sequence uint64
+	events   []localEvent
+	size     int
+	// published is closed and replaced whenever changes are published
+	published chan struct{}
+}
+
+type localEvent struct {
+	sequence uint64
+	event    ChangeEvent
+}
+
+func newLocalChanges(size int) *localChanges {
+	if size <= 0 {
+		size = 1024
+	}
+
+	return &localChanges{
+		size:      size,
+		published: make(chan struct{}),
+	}
+}
+
+func (l *localChanges) publish(operation string, collectionName string, documents []interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, document := range documents {
+		documentMap, ok := document.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		l.sequence++
+		event := ChangeEvent{
+			Operation:   operation,
+			Collection:  collectionName,
+			DocumentKey: map[string]interface{}{"_id": documentMap["_id"]},
+			ResumeToken: localTokenPrefix + strconv.FormatUint(l.sequence, 10),
+		}
+		if operation != "delete" {
+			event.Document = documentMap
+		}
+
+		l.events = append(l.events, localEvent{sequence: l.sequence, event: event})
+	}
+
+	if len(l.events) > l.size {
+		l.events = append([]localEvent(nil), l.events[len(l.events)-l.size:]...)
+	}
+
+	close(l.published)
+	l.published = make(chan struct{})
+}
+
+func (l *localChanges) watch(collectionName string, selector map[string]interface{}, resumeToken string) (ChangeStream, error) {
+	if err := validateSelector(selector); err != nil {
+		return nil, err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	stream := &localChangeStream{changes: l, collection: collectionName, selector: selector, last: l.sequence}
+	if resumeToken != "" {
+		last, err := strconv.ParseUint(strings.TrimPrefix(resumeToken, localTokenPrefix), 10, 64)
+		if err != nil || !strings.HasPrefix(resumeToken, localTokenPrefix) || last > l.sequence {
+			return nil, ErrResumeTokenExpired
+		}
+		if len(l.events) > 0 && last+1 < l.events[0].sequence {
+			return nil, ErrResumeTokenExpired
+		}
+		stream.last = last
+	}
+
+	return stream, nil
+}
+
+type localChangeStream struct {
+	changes    *localChanges
+	collection string
+	selector   map[string]interface{}
+	last       uint64
+}
+
+func (s *localChangeStream) Next(ctx context.Context) (*ChangeEvent, error) {
+	for {
+		event, published := s.next()
+		if event != nil {
+			return event, nil
+		}
+
+		select {
+		case <-published:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *localChangeStream) TryNext(context.Context) (*ChangeEvent, error) {
+	event, _ := s.next()
+	return event, nil
+}
+
+// next returns the next matching change, or the channel closed on the next publish when there is none
+func (s *localChangeStream) next() (*ChangeEvent, chan struct{}) {
+	s.changes.mutex.Lock()
+	defer s.changes.mutex.Unlock()
+
+	for _, stored := range s.changes.events {
+		if stored.sequence <= s.last {
+			continue
+		}
+
+		s.last = stored.sequence
+		if stored.event.Collection != s.collection {
+			continue
+		}
+
+		document := stored.event.Document
+		if stored.event.Operation == "delete" {
+			document = stored.event.DocumentKey
+		}
+		if documentMap, ok := document.(map[string]interface{}); ok && matchSelector(documentMap, s.selector) {
+			event := stored.event
+			return &event, nil
+		}
+	}
+
+	return nil, s.changes.published
+}
+
+func (s *localChangeStream) ResumeToken() string {
+	s.changes.mutex.Lock()
+	defer s.changes.mutex.Unlock()
+
+	return localTokenPrefix + strconv.FormatUint(s.last, 10)
+}
+
+func (s *localChangeStream) Close() {}
+
+var localOperators = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true, "$and": true, "$or": true, "$nor": true,
+}
+
+// validateSelector rejects the operators matchSelector does not evaluate
+func validateSelector(selector map[string]interface{}) error {
+	for key, value := range selector {
+		if strings.HasPrefix(key, "$") && !localOperators[key] {
+			return fmt.Errorf("operator %s is not supported without change streams", key)
+		}
+
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			if err := validateSelector(typed); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, item := range typed {
+				if itemMap, ok := item.(map[string]interface{}); ok {
+					if err := validateSelector(itemMap); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchSelector evaluates the subset of the mongo query language validateSelector accepts
+func matchSelector(document map[string]interface{}, selector map[string]interface{}) bool {
+	for key, condition := range selector {
+		switch key {
+		case "$and", "$or", "$nor":
+			conditions, _ := condition.([]interface{})
+			matched := 0
+			for _, item := range conditions {
+				if itemMap, ok := item.(map[string]interface{}); ok && matchSelector(document, itemMap) {
+					matched++
+				}
+			}
+			if (key == "$and" && matched != len(conditions)) || (key == "$or" && matched == 0) || (key == "$nor" && matched > 0) {
+				return false
+			}
+		default:
+			value, exists := lookupField(document, key)
+			if !matchCondition(value, exists, condition) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func matchCondition(value interface{}, exists bool, condition interface{}) bool {
+	operators, ok := condition.(map[string]interface{})
+	if !ok || len(operators) == 0 || !strings.HasPrefix(firstKey(operators), "$") {
+		return exists && matchEqual(value, condition)
+	}
+
+	for operator, operand := range operators {
+		var matched bool
+		switch operator {
+		case "$eq":
+			matched = exists && matchEqual(value, operand)
+		case "$ne":
+			matched = !exists || !matchEqual(value, operand)
+		case "$gt", "$gte", "$lt", "$lte":
+			compared, comparable := compareValues(value, operand)
+			matched = exists && comparable && ((operator == "$gt" && compared > 0) || (operator == "$gte" && compared >= 0) ||
+				(operator == "$lt" && compared < 0) || (operator == "$lte" && compared <= 0))
+		case "$in", "$nin":
+			operands, _ := operand.([]interface{})
+			found := false
+			for _, item := range operands {
+				if exists && matchEqual(value, item) {
+					found = true
+					break
+				}
+			}
+			matched = found == (operator == "$in")
+		case "$exists":
+			matched = exists == (operand == true || operand == float64(1))
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchEqual compares like mongo, an array matches when one of its items does
+func matchEqual(value interface{}, expected interface{}) bool {
+	if items, ok := value.(primitive.A); ok {
+		value = []interface{}(items)
+	}
+	if items, ok := value.([]interface{}); ok {
+		if _, expectedArray := expected.([]interface{}); !expectedArray {
+			for _, item := range items {
+				if matchEqual(item, expected) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	if compared, comparable := compareValues(value, expected); comparable {
+		return compared == 0
+	}
+
+	return reflect.DeepEqual(normalizeValue(value), normalizeValue(expected))
+}
+
+func compareValues(value interface{}, operand interface{}) (int, bool) {
+	value, operand = normalizeValue(value), normalizeValue(operand)
+
+	switch typed := value.(type) {
+	case float64:
+		other, ok := operand.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case typed < other:
+			return -1, true
+		case typed > other:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		other, ok := operand.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(typed, other), true
+	}
+
+	return 0, false
+}
+
+// normalizeValue brings decoded bson and json values to the same types
+func normalizeValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed)
+	case int32:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	case float32:
+		return float64(typed)
+	case primitive.ObjectID:
+		return typed.Hex()
+	case primitive.M:
+		return map[string]interface{}(typed)
+	case primitive.A:
+		return []interface{}(typed)
+	}
+
+	return value
+}
+
+func lookupField(document map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = document
+	for _, part := range strings.Split(path, ".") {
+		switch typed := normalizeValue(current).(type) {
+		case map[string]interface{}:
+			value, ok := typed[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case primitive.D:
+			value, ok := typed.Map()[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func firstKey(m map[string]interface{}) string {
+	for key := range m {
+		return key
+	}
+	return ""
+}
@@ -0,0 +1,222 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMatchSelector(t *testing.T) {
+	document := map[string]interface{}{
+		"_id":    primitive.ObjectID{1},
+		"height": int64(10),
+		"hash":   "A1",
+		"tags":   primitive.A{"send", "fee"},
+		"tx":     primitive.M{"code": int32(0), "memo": "hello"},
+	}
+
+	tests := []struct {
+		name     string
+		selector map[string]interface{}
+		matched  bool
+	}{
+		{name: "empty selector", selector: map[string]interface{}{}, matched: true},
+		{name: "equal", selector: map[string]interface{}{"hash": "A1"}, matched: true},
+		{name: "not equal", selector: map[string]interface{}{"hash": "B2"}, matched: false},
+		{name: "json number against int64", selector: map[string]interface{}{"height": float64(10)}, matched: true},
+		{name: "object id as hex", selector: map[string]interface{}{"_id": primitive.ObjectID{1}.Hex()}, matched: true},
+		{name: "embedded field", selector: map[string]interface{}{"tx.code": float64(0)}, matched: true},
+		{name: "missing field", selector: map[string]interface{}{"tx.log": "x"}, matched: false},
+		{name: "array item", selector: map[string]interface{}{"tags": "fee"}, matched: true},
+		{name: "$eq", selector: map[string]interface{}{"hash": map[string]interface{}{"$eq": "A1"}}, matched: true},
+		{name: "$ne", selector: map[string]interface{}{"hash": map[string]interface{}{"$ne": "A1"}}, matched: false},
+		{name: "$ne of a missing field", selector: map[string]interface{}{"memo": map[string]interface{}{"$ne": "x"}}, matched: true},
+		{name: "range", selector: map[string]interface{}{"height": map[string]interface{}{"$gt": float64(5), "$lte": float64(10)}}, matched: true},
+		{name: "out of range", selector: map[string]interface{}{"height": map[string]interface{}{"$lt": float64(10)}}, matched: false},
+		{name: "range across types", selector: map[string]interface{}{"height": map[string]interface{}{"$gte": "5"}}, matched: false},
+		{name: "$in", selector: map[string]interface{}{"hash": map[string]interface{}{"$in": []interface{}{"B2", "A1"}}}, matched: true},
+		{name: "$nin", selector: map[string]interface{}{"hash": map[string]interface{}{"$nin": []interface{}{"A1"}}}, matched: false},
+		{name: "$exists", selector: map[string]interface{}{"tx.memo": map[string]interface{}{"$exists": true}}, matched: true},
+		{name: "$exists false", selector: map[string]interface{}{"tx.log": map[string]interface{}{"$exists": false}}, matched: true},
+		{
+			name:     "$and",
+			selector: map[string]interface{}{"$and": []interface{}{map[string]interface{}{"hash": "A1"}, map[string]interface{}{"height": float64(11)}}},
+			matched:  false,
+		},
+		{
+			name:     "$or",
+			selector: map[string]interface{}{"$or": []interface{}{map[string]interface{}{"hash": "B2"}, map[string]interface{}{"height": float64(10)}}},
+			matched:  true,
+		},
+		{
+			name:     "$nor",
+			selector: map[string]interface{}{"$nor": []interface{}{map[string]interface{}{"hash": "B2"}, map[string]interface{}{"height": float64(10)}}},
+			matched:  false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matched := matchSelector(document, test.selector); matched != test.matched {
+				t.Fatalf("expected %v, got %v", test.matched, matched)
+			}
+		})
+	}
+}
+
+func TestValidateSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector map[string]interface{}
+		err      string
+	}{
+		{name: "fields", selector: map[string]interface{}{"hash": "A1", "tx.code": float64(0)}},
+		{name: "operators", selector: map[string]interface{}{"height": map[string]interface{}{"$gte": float64(1), "$in": []interface{}{float64(1)}}}},
+		{
+			name:     "logical operators",
+			selector: map[string]interface{}{"$or": []interface{}{map[string]interface{}{"hash": map[string]interface{}{"$exists": true}}}},
+		},
+		{name: "unsupported operator", selector: map[string]interface{}{"hash": map[string]interface{}{"$regex": "^A"}}, err: "$regex"},
+		{
+			name:     "unsupported operator in a condition",
+			selector: map[string]interface{}{"$and": []interface{}{map[string]interface{}{"tags": map[string]interface{}{"$elemMatch": map[string]interface{}{}}}}},
+			err:      "$elemMatch",
+		},
+		{name: "top level operator", selector: map[string]interface{}{"$expr": map[string]interface{}{}}, err: "$expr"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateSelector(test.selector)
+			if test.err == "" && err != nil {
+				t.Fatalf("expected the selector to be accepted, got %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("expected an error about %s, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func nextLocal(t *testing.T, stream ChangeStream) *ChangeEvent {
+	t.Helper()
+
+	event, err := stream.TryNext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestLocalChangesFilter(t *testing.T) {
+	changes := newLocalChanges(10)
+
+	stream, err := changes.watch("txs", map[string]interface{}{"height": map[string]interface{}{"$gte": float64(2)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID, err := changes.watch("txs", map[string]interface{}{"_id": "b"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes.publish("insert", "txs", []interface{}{
+		map[string]interface{}{"_id": "a", "height": float64(1)},
+		map[string]interface{}{"_id": "b", "height": float64(2)},
+	})
+	changes.publish("insert", "blocks", []interface{}{map[string]interface{}{"_id": "c", "height": float64(3)}})
+	changes.publish("delete", "txs", []interface{}{map[string]interface{}{"_id": "b", "height": float64(2)}})
+
+	if event := nextLocal(t, stream); event == nil || event.Operation != "insert" || event.DocumentKey.(map[string]interface{})["_id"] != "b" {
+		t.Fatalf("expected the insert of b, got %+v", event)
+	}
+	// the delete has the document key only, the selector on height cannot match it
+	if event := nextLocal(t, stream); event != nil {
+		t.Fatalf("expected no more changes, got %+v", event)
+	}
+
+	if event := nextLocal(t, byID); event == nil || event.Operation != "insert" {
+		t.Fatalf("expected the insert of b, got %+v", event)
+	}
+	if event := nextLocal(t, byID); event == nil || event.Operation != "delete" || event.Document != nil {
+		t.Fatalf("expected the delete of b without its document, got %+v", event)
+	}
+}
+
+func TestLocalChangesResume(t *testing.T) {
+	changes := newLocalChanges(3)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		changes.publish("insert", "txs", []interface{}{map[string]interface{}{"_id": id}})
+	}
+
+	// the buffer keeps the latest 3 changes, b, c and d
+	stream, err := changes.watch("txs", nil, localTokenPrefix+"2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := nextLocal(t, stream); event == nil || event.DocumentKey.(map[string]interface{})["_id"] != "c" {
+		t.Fatalf("expected to resume after b, got %+v", event)
+	}
+	if token := stream.ResumeToken(); token != localTokenPrefix+"3" {
+		t.Fatalf("expected the token of c, got %s", token)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "trimmed from the buffer", token: localTokenPrefix + "0"},
+		{name: "not published yet", token: localTokenPrefix + "5"},
+		{name: "token of a change stream", token: "8263A1"},
+		{name: "invalid sequence", token: localTokenPrefix + "x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := changes.watch("txs", nil, test.token); !errors.Is(err, ErrResumeTokenExpired) {
+				t.Fatalf("expected the token to be expired, got %v", err)
+			}
+		})
+	}
+
+	if _, err := changes.watch("txs", nil, localTokenPrefix+"1"); err != nil {
+		t.Fatalf("expected the token of the change before the buffer to resume, got %v", err)
+	}
+}
+
+func TestLocalChangesWaitForPublish(t *testing.T) {
+	changes := newLocalChanges(10)
+	stream, err := changes.watch("txs", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		changes.publish("update", "txs", []interface{}{map[string]interface{}{"_id": "a"}})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	event, err := stream.Next(ctx)
+	if err != nil || event.Operation != "update" {
+		t.Fatalf("expected the published update, got %+v, %v", event, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = stream.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Next to stop with its context, got %v", err)
+	}
+}
+
+func TestLocalChangesRejectUnsupportedSelector(t *testing.T) {
+	changes := newLocalChanges(10)
+	if _, err := changes.watch("txs", map[string]interface{}{"hash": map[string]interface{}{"$regex": "^A"}}, ""); err == nil {
+		t.Fatal("expected the selector to be rejected")
+	}
+}
@@ -3,6 +3,8 @@ package mongo
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -20,6 +22,12 @@ type Client struct {
 	Config *types.StorageConfig
 	Host   *mongo.Client
 	Ctx    context.Context
+
+	// session is set on the copy of the client handed to a transaction
+	session mongo.SessionContext
+	// replicated deployments support transactions and change streams
+	replicated bool
+	changes    *localChanges
 }
 
 type IndexElement struct {
@@ -30,6 +38,12 @@ type IndexElement struct {
 type IndexData struct {
 	Keys   []bson.M `bson:"keys" json:"keys"`
 	Unique bool     `bson:"unique" json:"unique"`
+	Name   string   `bson:"name" json:"name"`
+	Sparse bool     `bson:"sparse" json:"sparse"`
+	// ExpireAfter makes a TTL index removing documents this many seconds after the date in its field
+	ExpireAfter *int32 `bson:"expire_after" json:"expire_after"`
+	// Partial indexes only the documents matching the filter
+	Partial bson.M `bson:"partial" json:"partial"`
 }
 
 type IndexesData []IndexData
@@ -65,9 +79,10 @@ func NewMongoClient(config *types.StorageConfig) (*Client, error) {
 	}
 
 	client := &Client{
-		Ctx:    ctx,
-		Config: config,
-		Host:   host,
+		Ctx:     ctx,
+		Config:  config,
+		Host:    host,
+		changes: newLocalChanges(config.LocalChangeBuffer),
 	}
 
 	if hostErr != nil {
@@ -77,6 +92,60 @@ func NewMongoClient(config *types.StorageConfig) (*Client, error) {
 	return client, nil
 }
 
+// DetectDeployment checks whether mongo runs as a replica set or a sharded cluster
+func (c *Client) DetectDeployment() error {
+	var hello bson.M
+	err := c.Host.Database("admin").RunCommand(context.TODO(), bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return err
+	}
+
+	_, replicaSet := hello["setName"]
+	c.replicated = replicaSet || hello["msg"] == "isdbgrid"
+
+	return nil
+}
+
+func (c Client) context() context.Context {
+	if c.session != nil {
+		return c.session
+	}
+
+	return context.TODO()
+}
+
+// Transaction runs fn in a transaction, joining the transaction of the client if there is one already.
+// Deployments without transactions run fn directly.
+func (c Client) Transaction(fn func(client Client) error) error {
+	if !c.replicated || c.session != nil {
+		return fn(c)
+	}
+
+	session, err := c.Host.StartSession()
+	if err != nil {
+		logger.Logger.Error("Transaction", zap.Error(err))
+		return err
+	}
+	defer session.EndSession(context.TODO())
+
+	_, err = session.WithTransaction(context.TODO(), func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		client := c
+		client.session = sessionCtx
+		return nil, fn(client)
+	})
+	if err != nil {
+		logger.Logger.Error("Transaction", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// queryTimeout is the server-side time limit of queries, zero leaves them unbounded
+func (c Client) queryTimeout() time.Duration {
+	return time.Duration(c.Config.QueryTimeout) * time.Millisecond
+}
+
 func (c Client) GetCollection(collectionName string) *mongo.Collection {
 	return c.Host.Database(c.Config.Database).Collection(collectionName)
 }
@@ -85,16 +154,16 @@ func (c Client) FindOne(collectionName string, selector map[string]interface{})
 	var result map[string]interface{}
 	collection := c.GetCollection(collectionName)
 	selector = c.preprocessSelector(selector)
-	cur, err := collection.Find(context.TODO(), selector)
+	cur, err := collection.Find(c.context(), selector, options.Find().SetMaxTime(c.queryTimeout()))
 
 	if err != nil {
 		logger.Logger.Error("FindOne", zap.Error(err))
 		return result, err
 	}
 
-	defer cur.Close(context.TODO())
+	defer cur.Close(c.context())
 
-	for cur.Next(context.TODO()) {
+	for cur.Next(c.context()) {
 		var elem map[string]interface{}
 		decodeErr := cur.Decode(&elem)
 
@@ -117,20 +186,52 @@ func (c Client) FindOne(collectionName string, selector map[string]interface{})
 
 func (c Client) Find(collectionName string, selector map[string]interface{}, inputOptions *types.Options, includeFields []string) (*types.FindResult, error) {
 	findResult := &types.FindResult{}
-	requestOptions := options.Find()
+	requestOptions := options.Find().SetMaxTime(c.queryTimeout())
+
+	// a page can be continued by a cursor when it is sorted by known keys, _id breaks the ties
+	var keys []sortKey
+	if inputOptions != nil && (inputOptions.Limit > 0 || inputOptions.Cursor != "") {
+		var err error
+		keys, err = cursorSort(inputOptions.Sort)
+		if err != nil && inputOptions.Cursor != "" {
+			return &types.FindResult{}, errors.Wrap(ErrInvalidCursor, err.Error())
+		}
+	}
+
+	// a malformed cursor is refused before anything is queried
+	var values bson.A
+	if inputOptions != nil && inputOptions.Cursor != "" {
+		var err error
+		values, err = decodeCursor(inputOptions.Cursor, keys)
+		if err != nil {
+			return &types.FindResult{}, err
+		}
+	}
+
+	collection := c.GetCollection(collectionName)
+	selector = c.preprocessSelector(selector)
 
 	if inputOptions != nil && inputOptions.Count != 0 {
-		collection := c.GetCollection(collectionName)
-		selector = c.preprocessSelector(selector)
-		count, err := collection.CountDocuments(context.TODO(), selector)
+		var err error
+		if inputOptions.Count == types.CountEstimated {
+			findResult.Count, findResult.CountEstimated, err = c.estimateCount(collection, selector)
+		} else {
+			findResult.Count, err = collection.CountDocuments(c.context(), selector, options.Count().SetMaxTime(c.queryTimeout()))
+		}
 		if err != nil {
 			logger.Logger.Error("Find", zap.Error(err))
 			return &types.FindResult{}, err
 		}
-		findResult.Count = count
 	}
 
-	if inputOptions != nil && inputOptions.Sort != nil {
+	var filter interface{} = selector
+	if values != nil {
+		filter = bson.M{"$and": bson.A{selector, cursorFilter(keys, values)}}
+	}
+
+	if keys != nil {
+		requestOptions.SetSort(sortDocument(keys))
+	} else if inputOptions != nil && inputOptions.Sort != nil {
 		requestOptions.SetSort(inputOptions.Sort)
 	}
 
@@ -142,27 +243,36 @@ func (c Client) Find(collectionName string, selector map[string]interface{}, inp
 		requestOptions.SetLimit(inputOptions.Limit)
 	}
 
-	if includeFields != nil {
+	// the sort keys are read for the cursor even when they are not asked for, and removed after
+	var hiddenFields []string
+	if len(includeFields) > 0 {
 		projection := bson.D{}
+		included := map[string]bool{}
 		for _, v := range includeFields {
 			projection = append(projection, bson.E{v, 1})
+			included[strings.Split(v, ".")[0]] = true
+		}
+		for _, key := range keys {
+			root := strings.Split(key.field, ".")[0]
+			if !included[root] && root != "_id" {
+				included[root] = true
+				hiddenFields = append(hiddenFields, root)
+				projection = append(projection, bson.E{Key: key.field, Value: 1})
+			}
 		}
 		requestOptions.SetProjection(projection)
 	}
 
-	collection := c.GetCollection(collectionName)
-	selector = c.preprocessSelector(selector)
-
-	cur, err := collection.Find(context.TODO(), selector, requestOptions)
+	cur, err := collection.Find(c.context(), filter, requestOptions)
 
 	if err != nil {
 		logger.Logger.Error("Find", zap.Error(err))
 		return &types.FindResult{}, err
 	}
 
-	defer cur.Close(context.TODO())
+	defer cur.Close(c.context())
 
-	for cur.Next(context.TODO()) {
+	for cur.Next(c.context()) {
 		var elem map[string]interface{}
 		decodeErr := cur.Decode(&elem)
 
@@ -179,14 +289,45 @@ func (c Client) Find(collectionName string, selector map[string]interface{}, inp
 		return findResult, cursorErr
 	}
 
+	if keys != nil && inputOptions.Limit > 0 && int64(len(findResult.Result)) == inputOptions.Limit {
+		last := findResult.Result[len(findResult.Result)-1].(map[string]interface{})
+		if findResult.Cursor, err = encodeCursor(keys, last); err != nil {
+			logger.Logger.Error("Find", zap.Error(err))
+			return findResult, err
+		}
+	}
+
+	for _, document := range findResult.Result {
+		for _, field := range hiddenFields {
+			delete(document.(map[string]interface{}), field)
+		}
+	}
+
 	return findResult, nil
 }
 
+// estimateCount takes the count of a collection from its metadata, and counts filtered documents up to the configured limit
+func (c Client) estimateCount(collection *mongo.Collection, selector map[string]interface{}) (int64, bool, error) {
+	if len(selector) == 0 {
+		count, err := collection.EstimatedDocumentCount(c.context(), options.EstimatedDocumentCount().SetMaxTime(c.queryTimeout()))
+		return count, true, err
+	}
+
+	countOptions := options.Count().SetMaxTime(c.queryTimeout())
+	if c.Config.EstimatedCountLimit > 0 {
+		countOptions.SetLimit(c.Config.EstimatedCountLimit)
+	}
+
+	count, err := collection.CountDocuments(c.context(), selector, countOptions)
+
+	return count, c.Config.EstimatedCountLimit > 0 && count >= c.Config.EstimatedCountLimit, err
+}
+
 func (c Client) Insert(collectionName string, doc interface{}) (*mongo.InsertOneResult, error) {
 	collection := c.GetCollection(collectionName)
 
 	//processedDoc := c.preprocessDoc(doc)
-	result, err := collection.InsertOne(context.TODO(), doc)
+	result, err := collection.InsertOne(c.context(), doc)
 	if err != nil {
 		logger.Logger.Error("Insert", zap.Error(err))
 		return nil, err
@@ -199,7 +340,7 @@ func (c Client) InsertMany(collectionName string, docs []interface{}) (*mongo.In
 	collection := c.GetCollection(collectionName)
 
 	//processedDoc := c.preprocessDoc(doc)
-	result, err := collection.InsertMany(context.TODO(), docs)
+	result, err := collection.InsertMany(c.context(), docs)
 	if err != nil {
 		logger.Logger.Error("InsertMany", zap.Error(err))
 		return nil, err
@@ -212,7 +353,7 @@ func (c Client) Update(collectionName string, selector map[string]interface{}, u
 	collection := c.GetCollection(collectionName)
 	selector = c.preprocessSelector(selector)
 
-	result, err := collection.UpdateMany(context.TODO(), selector, update)
+	result, err := collection.UpdateMany(c.context(), selector, update)
 	if err != nil {
 		logger.Logger.Error("UpdateMany", zap.Error(err))
 		return nil, err
@@ -226,7 +367,7 @@ func (c Client) Upsert(collectionName string, selector map[string]interface{}, u
 	requestOptions := options.Update().SetUpsert(true)
 	selector = c.preprocessSelector(selector)
 
-	_, err := collection.UpdateMany(context.TODO(), selector, update, requestOptions)
+	_, err := collection.UpdateMany(c.context(), selector, update, requestOptions)
 	if err != nil {
 		logger.Logger.Error("Upsert", zap.Error(err))
 		return err
@@ -239,7 +380,7 @@ func (c Client) Remove(collectionName string, selector map[string]interface{}) e
 	collection := c.GetCollection(collectionName)
 	selector = c.preprocessSelector(selector)
 
-	_, err := collection.DeleteMany(context.TODO(), selector)
+	_, err := collection.DeleteMany(c.context(), selector)
 	if err != nil {
 		logger.Logger.Error("Remove", zap.Error(err))
 		return err
@@ -248,19 +389,45 @@ func (c Client) Remove(collectionName string, selector map[string]interface{}) e
 	return nil
 }
 
+// BulkWrite runs the write models in one request, their filters are preprocessed like selectors
+func (c Client) BulkWrite(collectionName string, models []mongo.WriteModel, ordered bool) (*mongo.BulkWriteResult, error) {
+	collection := c.GetCollection(collectionName)
+
+	for _, model := range models {
+		switch typed := model.(type) {
+		case *mongo.UpdateManyModel:
+			if selector, ok := typed.Filter.(map[string]interface{}); ok {
+				typed.Filter = c.preprocessSelector(selector)
+			}
+		case *mongo.DeleteManyModel:
+			if selector, ok := typed.Filter.(map[string]interface{}); ok {
+				typed.Filter = c.preprocessSelector(selector)
+			}
+		}
+	}
+
+	result, err := collection.BulkWrite(c.context(), models, options.BulkWrite().SetOrdered(ordered))
+	if err != nil {
+		logger.Logger.Error("BulkWrite", zap.Error(err))
+		return result, err
+	}
+
+	return result, nil
+}
+
 func (c Client) Aggregate(collectionName string, pipeline interface{}) (*types.FindResult, error) {
 	findResult := &types.FindResult{}
 	collection := c.GetCollection(collectionName)
 
-	cur, err := collection.Aggregate(context.TODO(), pipeline)
+	cur, err := collection.Aggregate(c.context(), pipeline, options.Aggregate().SetMaxTime(c.queryTimeout()))
 	if err != nil {
 		logger.Logger.Error("Aggregate", zap.Error(err))
 		return nil, err
 	}
 
-	defer cur.Close(context.TODO())
+	defer cur.Close(c.context())
 
-	for cur.Next(context.TODO()) {
+	for cur.Next(c.context()) {
 		var elem map[string]interface{}
 		decodeErr := cur.Decode(&elem)
 
@@ -299,28 +466,9 @@ func (c Client) CreateIndexes(collectionName string, data interface{}) ([]string
 	var indexes []mongo.IndexModel
 
 	for _, indexValue := range _data {
-		doc := bson.D{}
-
-		for _, v := range indexValue.Keys {
-			for _i, _v := range v {
-				value, ok := _v.(float64)
-				if !ok {
-					return nil, errors.New("index value not an integer")
-				}
-
-				doc = append(doc, bson.E{
-					Key:   _i,
-					Value: int64(value),
-				})
-			}
-		}
-
-		indexModel := mongo.IndexModel{
-			Keys: doc,
-		}
-
-		if indexValue.Unique {
-			indexModel.Options = options.Index().SetUnique(true)
+		indexModel, err := indexValue.model()
+		if err != nil {
+			return nil, err
 		}
 
 		indexes = append(indexes, indexModel)
@@ -335,6 +483,59 @@ func (c Client) CreateIndexes(collectionName string, data interface{}) ([]string
 	return result, nil
 }
 
+func (i IndexData) model() (mongo.IndexModel, error) {
+	doc := bson.D{}
+
+	for _, v := range i.Keys {
+		for _i, _v := range v {
+			value, ok := _v.(float64)
+			if !ok {
+				return mongo.IndexModel{}, errors.New("index value not an integer")
+			}
+
+			doc = append(doc, bson.E{
+				Key:   _i,
+				Value: int64(value),
+			})
+		}
+	}
+
+	indexOptions := options.Index()
+	if i.Unique {
+		indexOptions.SetUnique(true)
+	}
+	if i.Name != "" {
+		indexOptions.SetName(i.Name)
+	}
+	if i.Sparse {
+		indexOptions.SetSparse(true)
+	}
+	if i.ExpireAfter != nil {
+		indexOptions.SetExpireAfterSeconds(*i.ExpireAfter)
+	}
+	if i.Partial != nil {
+		indexOptions.SetPartialFilterExpression(i.Partial)
+	}
+
+	return mongo.IndexModel{Keys: doc, Options: indexOptions}, nil
+}
+
+// indexName is the name mongo gives an index without one, field_direction pairs joined by underscores
+func (i IndexData) indexName() string {
+	if i.Name != "" {
+		return i.Name
+	}
+
+	var parts []string
+	for _, v := range i.Keys {
+		for key, value := range v {
+			parts = append(parts, fmt.Sprintf("%s_%v", key, value))
+		}
+	}
+
+	return strings.Join(parts, "_")
+}
+
 func (c Client) GetIndexes(collectionName string) ([]interface{}, error) {
 	var result []interface{}
 	collection := c.GetCollection(collectionName)
@@ -0,0 +1,165 @@
+package mongo
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type sortKey struct {
+	field     string
+	direction int
+}
+
+// cursorPosition is the content of a cursor, the sort it was made for and the sort values of the last document read
+type cursorPosition struct {
+	Sort   []string `bson:"s"`
+	Values bson.A   `bson:"v"`
+}
+
+// cursorSort reads the sort of a paged read, its keys in order followed by _id to break ties. Several keys
+// have to be sent as a list of single key objects, a json object does not keep the order of its keys.
+func cursorSort(sort interface{}) ([]sortKey, error) {
+	var keys []sortKey
+
+	appendKeys := func(object map[string]interface{}) error {
+		for field, value := range object {
+			direction, ok := sortDirection(value)
+			if !ok {
+				return fmt.Errorf("wrong sort direction of %s", field)
+			}
+			keys = append(keys, sortKey{field: field, direction: direction})
+		}
+		return nil
+	}
+
+	switch typed := sort.(type) {
+	case nil:
+	case map[string]interface{}:
+		if len(typed) > 1 {
+			return nil, errors.New("a sort by several keys has to be a list to page with a cursor")
+		}
+		if err := appendKeys(typed); err != nil {
+			return nil, err
+		}
+	case []interface{}:
+		for _, item := range typed {
+			object, ok := item.(map[string]interface{})
+			if !ok || len(object) != 1 {
+				return nil, errors.New("every sort item has to be an object with one key")
+			}
+			if err := appendKeys(object); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errors.New("wrong sort format")
+	}
+
+	if len(keys) == 0 {
+		return []sortKey{{field: "_id", direction: 1}}, nil
+	}
+	for _, key := range keys {
+		if key.field == "_id" {
+			return keys, nil
+		}
+	}
+
+	return append(keys, sortKey{field: "_id", direction: keys[len(keys)-1].direction}), nil
+}
+
+func sortDirection(value interface{}) (int, bool) {
+	switch typed := value.(type) {
+	case float64:
+		if typed == 1 || typed == -1 {
+			return int(typed), true
+		}
+	case int:
+		if typed == 1 || typed == -1 {
+			return typed, true
+		}
+	case int32:
+		return sortDirection(int(typed))
+	case int64:
+		return sortDirection(int(typed))
+	}
+
+	return 0, false
+}
+
+func sortDocument(keys []sortKey) bson.D {
+	sort := bson.D{}
+	for _, key := range keys {
+		sort = append(sort, bson.E{Key: key.field, Value: key.direction})
+	}
+	return sort
+}
+
+func sortNames(keys []sortKey) []string {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, fmt.Sprintf("%s:%d", key.field, key.direction))
+	}
+	return names
+}
+
+// encodeCursor makes the cursor of the page after document, extended json keeps the types of the values
+func encodeCursor(keys []sortKey, document map[string]interface{}) (string, error) {
+	position := cursorPosition{Sort: sortNames(keys)}
+	for _, key := range keys {
+		value, _ := lookupField(document, key.field)
+		position.Values = append(position.Values, value)
+	}
+
+	data, err := bson.MarshalExtJSON(position, true, false)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string, keys []sortKey) (bson.A, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var position cursorPosition
+	if err = bson.UnmarshalExtJSON(data, true, &position); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if strings.Join(position.Sort, ",") != strings.Join(sortNames(keys), ",") || len(position.Values) != len(keys) {
+		return nil, errors.Wrap(ErrInvalidCursor, "the cursor was made for another sort")
+	}
+
+	return position.Values, nil
+}
+
+// cursorFilter selects the documents sorted after the cursor values: greater on the first key,
+// or equal on it and greater on the next one, and so on
+func cursorFilter(keys []sortKey, values bson.A) bson.M {
+	alternatives := bson.A{}
+	for i, key := range keys {
+		alternative := bson.M{}
+		for j := 0; j < i; j++ {
+			alternative[keys[j].field] = values[j]
+		}
+
+		operator := "$gt"
+		if key.direction < 0 {
+			operator = "$lt"
+		}
+		alternative[key.field] = bson.M{operator: values[i]}
+
+		alternatives = append(alternatives, alternative)
+	}
+
+	return bson.M{"$or": alternatives}
+}
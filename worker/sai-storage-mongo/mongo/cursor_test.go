@@ -0,0 +1,166 @@
+package mongo
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+func mustSort(t *testing.T, sort interface{}) []sortKey {
+	keys, err := cursorSort(sort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestCursorSort(t *testing.T) {
+	tests := []struct {
+		name string
+		sort interface{}
+		keys []sortKey
+	}{
+		{name: "no sort", sort: nil, keys: []sortKey{{"_id", 1}}},
+		{name: "one key", sort: map[string]interface{}{"height": float64(-1)}, keys: []sortKey{{"height", -1}, {"_id", -1}}},
+		{
+			name: "keys in order",
+			sort: []interface{}{map[string]interface{}{"height": float64(-1)}, map[string]interface{}{"index": float64(1)}},
+			keys: []sortKey{{"height", -1}, {"index", 1}, {"_id", 1}},
+		},
+		{name: "own _id", sort: []interface{}{map[string]interface{}{"_id": float64(-1)}}, keys: []sortKey{{"_id", -1}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if keys := mustSort(t, test.sort); !reflect.DeepEqual(keys, test.keys) {
+				t.Fatalf("expected %v, got %v", test.keys, keys)
+			}
+		})
+	}
+
+	invalid := map[string]interface{}{
+		"several keys in an object": map[string]interface{}{"height": float64(1), "index": float64(1)},
+		"wrong direction":           map[string]interface{}{"height": float64(2)},
+		"list item with two keys":   []interface{}{map[string]interface{}{"height": float64(1), "index": float64(1)}},
+		"list item not an object":   []interface{}{"height"},
+		"string":                    "height",
+	}
+	for name, sort := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := cursorSort(sort); err == nil {
+				t.Fatal("expected the sort to be rejected")
+			}
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	keys := mustSort(t, []interface{}{map[string]interface{}{"block.height": float64(-1)}, map[string]interface{}{"hash": float64(1)}})
+	id := primitive.NewObjectID()
+	document := map[string]interface{}{
+		"_id":   id,
+		"block": map[string]interface{}{"height": int64(1200)},
+		"hash":  "AB12",
+	}
+
+	cursor, err := encodeCursor(keys, document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base64.RawURLEncoding.DecodeString(cursor); err != nil {
+		t.Fatalf("expected a url safe cursor, got %q", cursor)
+	}
+
+	values, err := decodeCursor(cursor, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the types of the values are kept, an int64 height or an ObjectID compare as they were stored
+	if !reflect.DeepEqual(values, bson.A{int64(1200), "AB12", id}) {
+		t.Fatalf("unexpected cursor values %#v", values)
+	}
+
+	filter := cursorFilter(keys, values)
+	expected := bson.M{"$or": bson.A{
+		bson.M{"block.height": bson.M{"$lt": int64(1200)}},
+		bson.M{"block.height": int64(1200), "hash": bson.M{"$gt": "AB12"}},
+		bson.M{"block.height": int64(1200), "hash": "AB12", "_id": bson.M{"$gt": id}},
+	}}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Fatalf("unexpected cursor filter %v", filter)
+	}
+}
+
+func TestDecodeCursorRejectsTamperedInput(t *testing.T) {
+	keys := mustSort(t, map[string]interface{}{"height": float64(-1)})
+	cursor, err := encodeCursor(keys, map[string]interface{}{"_id": "a", "height": int64(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(data string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(data))
+	}
+
+	tests := map[string]struct {
+		cursor string
+		keys   []sortKey
+	}{
+		"not base64":          {cursor: "%%%", keys: keys},
+		"padded base64":       {cursor: base64.URLEncoding.EncodeToString([]byte(`{"s":[],"v":[]}`)) + "=", keys: keys},
+		"not json":            {cursor: encode("height=5"), keys: keys},
+		"truncated":           {cursor: cursor[:len(cursor)/2], keys: keys},
+		"missing values":      {cursor: encode(`{"s":["height:-1","_id:-1"],"v":[{"$numberLong":"5"}]}`), keys: keys},
+		"extra values":        {cursor: encode(`{"s":["height:-1","_id:-1"],"v":[1,"a","b"]}`), keys: keys},
+		"other direction":     {cursor: cursor, keys: mustSort(t, map[string]interface{}{"height": float64(1)})},
+		"other key":           {cursor: cursor, keys: mustSort(t, map[string]interface{}{"time": float64(-1)})},
+		"added key":           {cursor: cursor, keys: mustSort(t, []interface{}{map[string]interface{}{"height": float64(-1)}, map[string]interface{}{"index": float64(-1)}})},
+		"sort edited in json": {cursor: encode(`{"s":["time:-1","_id:-1"],"v":[5,"a"]}`), keys: keys},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decodeCursor(test.cursor, test.keys); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
+
+// The client has no connection: the malformed cursors have to be refused before any query, counts included
+func TestFindRefusesMalformedCursorBeforeQuerying(t *testing.T) {
+	client := Client{Config: &types.StorageConfig{Database: "db"}}
+	keys := mustSort(t, map[string]interface{}{"height": float64(-1)})
+	cursor, err := encodeCursor(keys, map[string]interface{}{"_id": "a", "height": int64(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]*types.Options{
+		"tampered cursor":         {Limit: 10, Cursor: "not-a-cursor", Sort: map[string]interface{}{"height": float64(-1)}},
+		"tampered cursor counted": {Limit: 10, Cursor: "not-a-cursor", Count: types.CountEstimated},
+		"cursor of another sort":  {Limit: 10, Cursor: cursor, Sort: map[string]interface{}{"height": float64(1)}, Count: types.CountExact},
+		"sort that cannot page":   {Limit: 10, Cursor: cursor, Sort: map[string]interface{}{"height": float64(-1), "hash": float64(1)}},
+	}
+
+	for name, options := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := client.Find("txs", map[string]interface{}{}, options, nil); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
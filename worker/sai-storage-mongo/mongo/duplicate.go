@@ -2,17 +2,27 @@ package mongo
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 
 	"github.com/saiset-co/sai-storage-mongo/logger"
 	"github.com/saiset-co/sai-storage-mongo/types"
 )
 
-var DuplicateCh chan DuplicateRequest
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+)
 
 type DuplicateData struct {
 	Method    string      `json:"method"`
@@ -25,9 +35,80 @@ type DuplicateRequest struct {
 	Data   DuplicateData `json:"data"`
 }
 
-func (c Client) Duplicate(method string, request types.IRequest, data interface{}) {
+// OutboxEntry is a duplicate request waiting for delivery, ordered by Sequence within its collection
+type OutboxEntry struct {
+	ID          interface{} `bson:"_id,omitempty" json:"_id"`
+	Collection  string      `bson:"collection" json:"collection"`
+	Sequence    int64       `bson:"sequence" json:"sequence"`
+	Method      string      `bson:"method" json:"method"`
+	Payload     string      `bson:"payload" json:"-"`
+	Request     interface{} `bson:"-" json:"request,omitempty"`
+	Status      string      `bson:"status" json:"status"`
+	Attempts    int         `bson:"attempts" json:"attempts"`
+	LastError   string      `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttempt time.Time   `bson:"next_attempt" json:"next_attempt"`
+	LeaseUntil  time.Time   `bson:"lease_until" json:"-"`
+	CreatedAt   time.Time   `bson:"created_at" json:"created_at"`
+	DeliveredAt *time.Time  `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+}
+
+func (c Client) outbox() *mongo.Collection {
+	return c.GetCollection(c.Config.OutboxCollection)
+}
+
+func (c Client) outboxSequences() *mongo.Collection {
+	return c.GetCollection(c.Config.OutboxCollection + "_sequences")
+}
+
+// InitOutbox creates the outbox collections. Without transactions an outbox entry is written right after
+// the change instead of atomically with it.
+func (c *Client) InitOutbox() error {
 	if !c.Config.Duplicate {
-		return
+		return nil
+	}
+
+	for _, name := range []string{c.Config.OutboxCollection, c.Config.OutboxCollection + "_sequences"} {
+		err := c.Host.Database(c.Config.Database).CreateCollection(context.TODO(), name)
+		if commandErr, ok := err.(mongo.CommandError); err != nil && !(ok && commandErr.Name == "NamespaceExists") {
+			return err
+		}
+	}
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "collection", Value: 1}, {Key: "sequence", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt", Value: 1}}},
+	}
+	if c.Config.OutboxRetention > 0 {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: "delivered_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(c.Config.OutboxRetention)),
+		})
+	}
+
+	if _, err := c.outbox().Indexes().CreateMany(context.TODO(), indexes); err != nil {
+		return err
+	}
+
+	if !c.replicated {
+		logger.Logger.Warn("InitOutbox", zap.String("reason", "the deployment does not support transactions, outbox entries are not written atomically with changes"))
+	}
+
+	return nil
+}
+
+// WithTransaction runs fn in a transaction when duplication is enabled, so the change and its outbox entry are written together
+func (c Client) WithTransaction(fn func(client Client) error) error {
+	if !c.Config.Duplicate {
+		return fn(c)
+	}
+
+	return c.Transaction(fn)
+}
+
+// Duplicate records the change in the outbox, in the transaction of the client when there is one
+func (c Client) Duplicate(method string, request types.IRequest, data interface{}) error {
+	if !c.Config.Duplicate {
+		return nil
 	}
 
 	duplicateRequest := DuplicateRequest{
@@ -39,42 +120,234 @@ func (c Client) Duplicate(method string, request types.IRequest, data interface{
 		},
 	}
 
-	DuplicateCh <- duplicateRequest
+	payload, err := json.Marshal(duplicateRequest)
+	if err != nil {
+		logger.Logger.Error("Duplicate", zap.Error(err))
+		return err
+	}
+
+	var sequence struct {
+		Sequence int64 `bson:"sequence"`
+	}
+	err = c.outboxSequences().FindOneAndUpdate(
+		c.context(),
+		bson.M{"_id": request.GetCollection()},
+		bson.M{"$inc": bson.M{"sequence": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&sequence)
+	if err != nil {
+		logger.Logger.Error("Duplicate", zap.Error(err))
+		return err
+	}
+
+	now := time.Now()
+	_, err = c.outbox().InsertOne(c.context(), OutboxEntry{
+		Collection:  request.GetCollection(),
+		Sequence:    sequence.Sequence,
+		Method:      method,
+		Payload:     string(payload),
+		Status:      OutboxPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		logger.Logger.Error("Duplicate", zap.Error(err))
+		return err
+	}
+
+	return nil
 }
 
-func (c Client) DuplicateProcessor() {
+// OutboxProcessor delivers outbox entries, one collection at a time in sequence order
+func (c Client) OutboxProcessor() {
+	if !c.Config.Duplicate {
+		return
+	}
+
 	for {
-		duplicateRequest := <-DuplicateCh
+		collections, err := c.outbox().Distinct(context.TODO(), "collection", bson.M{
+			"status":       OutboxPending,
+			"next_attempt": bson.M{"$lte": time.Now()},
+		})
+		if err != nil {
+			logger.Logger.Error("OutboxProcessor", zap.Error(err))
+		}
 
-		go func() {
-			dupRequestBytes, err := json.Marshal(duplicateRequest)
-			if err != nil {
-				logger.Logger.Error("DuplicateProcessor", zap.Error(err))
-				return
+		wg := sync.WaitGroup{}
+		for _, collection := range collections {
+			name, ok := collection.(string)
+			if !ok {
+				continue
 			}
 
-			req, err := http.NewRequest("POST", c.Config.DuplicateURL, bytes.NewBuffer(dupRequestBytes))
-			if err != nil {
-				logger.Logger.Error("DuplicateProcessor", zap.Error(err))
-				return
-			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.deliverCollection(name)
+			}()
+		}
+		wg.Wait()
 
-			client := http.Client{
-				Timeout: time.Duration(c.Config.DuplicateTimeout) * time.Millisecond,
-			}
+		time.Sleep(time.Duration(c.Config.OutboxPollInterval) * time.Millisecond)
+	}
+}
 
-			resp, err := client.Do(req)
-			if err != nil {
-				logger.Logger.Error("DuplicateProcessor", zap.Error(err))
-				return
-			}
+// deliverCollection delivers the pending entries of a collection until one has to wait for a retry
+func (c Client) deliverCollection(collection string) {
+	timeout := time.Duration(c.Config.DuplicateTimeout) * time.Millisecond
 
-			if resp.StatusCode != 200 {
-				logger.Logger.Error("DuplicateProcessor", zap.Any("response", resp))
-				return
-			}
+	for {
+		var entry OutboxEntry
+		err := c.outbox().FindOne(
+			context.TODO(),
+			bson.M{"collection": collection, "status": OutboxPending},
+			options.FindOne().SetSort(bson.D{{Key: "sequence", Value: 1}}),
+		).Decode(&entry)
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			logger.Logger.Error("deliverCollection", zap.Error(err))
+			return
+		}
+
+		now := time.Now()
+		if entry.NextAttempt.After(now) {
+			return
+		}
+
+		// the lease keeps other storage instances off the collection while the entry is delivered
+		claim, err := c.outbox().UpdateOne(
+			context.TODO(),
+			bson.M{"_id": entry.ID, "status": OutboxPending, "lease_until": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"lease_until": now.Add(2 * timeout)}},
+		)
+		if err != nil {
+			logger.Logger.Error("deliverCollection", zap.Error(err))
+			return
+		}
+		if claim.ModifiedCount == 0 {
+			return
+		}
+
+		entry.Attempts++
+		deliveryErr := c.deliver(entry, timeout)
+
+		update := bson.M{"attempts": entry.Attempts, "lease_until": time.Time{}}
+		switch {
+		case deliveryErr == nil:
+			update["status"] = OutboxDelivered
+			update["delivered_at"] = time.Now()
+		case entry.Attempts >= c.Config.OutboxMaxAttempts:
+			update["status"] = OutboxDead
+			update["last_error"] = deliveryErr.Error()
+			logger.Logger.Error("deliverCollection", zap.String("collection", collection), zap.Int64("sequence", entry.Sequence), zap.Int("attempts", entry.Attempts), zap.Error(deliveryErr))
+		default:
+			update["last_error"] = deliveryErr.Error()
+			update["next_attempt"] = time.Now().Add(c.outboxBackoff(entry.Attempts))
+			logger.Logger.Warn("deliverCollection", zap.String("collection", collection), zap.Int64("sequence", entry.Sequence), zap.Int("attempts", entry.Attempts), zap.Error(deliveryErr))
+		}
+
+		_, err = c.outbox().UpdateOne(context.TODO(), bson.M{"_id": entry.ID}, bson.M{"$set": update})
+		if err != nil {
+			logger.Logger.Error("deliverCollection", zap.Error(err))
+			return
+		}
+
+		if deliveryErr != nil && update["status"] != OutboxDead {
+			return
+		}
+
+		time.Sleep(time.Duration(c.Config.DuplicatePause) * time.Millisecond)
+	}
+}
+
+func (c Client) deliver(entry OutboxEntry, timeout time.Duration) error {
+	req, err := http.NewRequest("POST", c.Config.DuplicateURL, bytes.NewBufferString(entry.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Outbox-Id", fmt.Sprintf("%s:%d", entry.Collection, entry.Sequence))
+
+	client := http.Client{
+		Timeout: timeout,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("duplicate request answered with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// outboxBackoff doubles the retry delay with every failed attempt, up to OutboxMaxBackoff
+func (c Client) outboxBackoff(attempts int) time.Duration {
+	backoff := time.Duration(c.Config.OutboxBackoff) * time.Millisecond
+	maxBackoff := time.Duration(c.Config.OutboxMaxBackoff) * time.Millisecond
+
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
+
+// OutboxEntries returns the outbox entries matching selector, the delivery requests decoded
+func (c Client) OutboxEntries(selector map[string]interface{}, inputOptions *types.Options) ([]OutboxEntry, error) {
+	requestOptions := options.Find().SetSort(bson.D{{Key: "collection", Value: 1}, {Key: "sequence", Value: 1}})
+	if inputOptions != nil && inputOptions.Skip != 0 {
+		requestOptions.SetSkip(inputOptions.Skip)
+	}
+	if inputOptions != nil && inputOptions.Limit != 0 {
+		requestOptions.SetLimit(inputOptions.Limit)
+	}
 
-			time.Sleep(time.Duration(c.Config.DuplicatePause))
-		}()
+	cur, err := c.outbox().Find(context.TODO(), c.preprocessSelector(selector), requestOptions)
+	if err != nil {
+		logger.Logger.Error("OutboxEntries", zap.Error(err))
+		return nil, err
 	}
+
+	entries := make([]OutboxEntry, 0)
+	if err = cur.All(context.TODO(), &entries); err != nil {
+		logger.Logger.Error("OutboxEntries", zap.Error(err))
+		return nil, err
+	}
+
+	for i := range entries {
+		_ = json.Unmarshal([]byte(entries[i].Payload), &entries[i].Request)
+	}
+
+	return entries, nil
+}
+
+// ReplayOutbox queues the entries matching selector for delivery again, with a fresh attempt budget
+func (c Client) ReplayOutbox(selector map[string]interface{}) (int64, error) {
+	result, err := c.outbox().UpdateMany(context.TODO(), c.preprocessSelector(selector), bson.M{
+		"$set": bson.M{
+			"status":       OutboxPending,
+			"attempts":     0,
+			"next_attempt": time.Now(),
+			"lease_until":  time.Time{},
+		},
+		"$unset": bson.M{"delivered_at": ""},
+	})
+	if err != nil {
+		logger.Logger.Error("ReplayOutbox", zap.Error(err))
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
 }
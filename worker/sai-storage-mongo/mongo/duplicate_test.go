@@ -0,0 +1,258 @@
+package mongo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/saiset-co/sai-storage-mongo/types"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	c := Client{Config: &types.StorageConfig{OutboxBackoff: 1000, OutboxMaxBackoff: 5000}}
+
+	tests := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{attempts: 0, backoff: time.Second},
+		{attempts: 1, backoff: time.Second},
+		{attempts: 2, backoff: 2 * time.Second},
+		{attempts: 3, backoff: 4 * time.Second},
+		{attempts: 4, backoff: 5 * time.Second},
+		{attempts: 100, backoff: 5 * time.Second},
+	}
+
+	for _, test := range tests {
+		if backoff := c.outboxBackoff(test.attempts); backoff != test.backoff {
+			t.Errorf("expected a backoff of %s after %d attempts, got %s", test.backoff, test.attempts, backoff)
+		}
+	}
+
+	c.Config.OutboxMaxBackoff = 500
+	if backoff := c.outboxBackoff(1); backoff != 500*time.Millisecond {
+		t.Fatalf("expected the maximum to cap the first backoff, got %s", backoff)
+	}
+}
+
+// outboxUpdate is the filter and the update of an update command
+type outboxUpdate struct {
+	filter bson.M
+	update bson.M
+}
+
+func nextUpdate(mt *mtest.T) outboxUpdate {
+	mt.Helper()
+
+	for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+		if started.CommandName != "update" {
+			continue
+		}
+
+		var command struct {
+			Updates []struct {
+				Q bson.M `bson:"q"`
+				U bson.M `bson:"u"`
+			} `bson:"updates"`
+		}
+		if err := bson.Unmarshal(started.Command, &command); err != nil {
+			mt.Fatal(err)
+		}
+		return outboxUpdate{filter: command.Updates[0].Q, update: command.Updates[0].U}
+	}
+
+	mt.Fatal("expected an update command")
+	return outboxUpdate{}
+}
+
+func outboxEntry(attempts int) bson.D {
+	return bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "collection", Value: "txs"},
+		{Key: "sequence", Value: int64(7)},
+		{Key: "method", Value: "create"},
+		{Key: "payload", Value: `{"method":"notify"}`},
+		{Key: "status", Value: OutboxPending},
+		{Key: "attempts", Value: attempts},
+		{Key: "next_attempt", Value: time.Now().Add(-time.Second)},
+	}
+}
+
+// outboxTarget answers the deliveries with status, counting them
+func outboxTarget(t *testing.T, status int) (*httptest.Server, *int32) {
+	var deliveries int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&deliveries, 1)
+		if id := r.Header.Get("X-Outbox-Id"); id != "txs:7" {
+			t.Errorf("expected the outbox id of the entry, got %q", id)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &deliveries
+}
+
+func outboxClient(mt *mtest.T, url string) Client {
+	return Client{
+		Host: mt.Client,
+		Config: &types.StorageConfig{
+			Database:          "test",
+			Duplicate:         true,
+			DuplicateURL:      url,
+			DuplicateTimeout:  1000,
+			OutboxCollection:  "_outbox",
+			OutboxMaxAttempts: 3,
+			OutboxBackoff:     1000,
+			OutboxMaxBackoff:  60000,
+		},
+	}
+}
+
+func TestDeliverCollection(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	claimed := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+	updated := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+	empty := mtest.CreateCursorResponse(0, "test._outbox", mtest.FirstBatch)
+
+	mt.Run("delivered", func(mt *mtest.T) {
+		server, deliveries := outboxTarget(t, http.StatusOK)
+		c := outboxClient(mt, server.URL)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test._outbox", mtest.FirstBatch, outboxEntry(0)), claimed, updated, empty)
+
+		before := time.Now()
+		c.deliverCollection("txs")
+
+		if *deliveries != 1 {
+			mt.Fatalf("expected one delivery, got %d", *deliveries)
+		}
+
+		// the lease is claimed only when it expired, and lasts two delivery timeouts
+		claim := nextUpdate(mt)
+		leaseFilter := claim.filter["lease_until"].(bson.M)["$lte"].(primitive.DateTime).Time()
+		if leaseFilter.Before(before.Add(-time.Millisecond)) || claim.filter["status"] != OutboxPending {
+			mt.Fatalf("expected the claim to require an expired lease, got %v", claim.filter)
+		}
+		lease := claim.update["$set"].(bson.M)["lease_until"].(primitive.DateTime).Time()
+		if lease.Sub(before) < 2*time.Second-time.Millisecond || lease.Sub(before) > 3*time.Second {
+			mt.Fatalf("expected a lease of two timeouts, got %s", lease.Sub(before))
+		}
+
+		result := nextUpdate(mt).update["$set"].(bson.M)
+		if result["status"] != OutboxDelivered || result["attempts"] != int32(1) || result["delivered_at"] == nil {
+			mt.Fatalf("expected the entry to be delivered, got %v", result)
+		}
+		if released := result["lease_until"].(primitive.DateTime).Time(); !released.Equal(time.Time{}) {
+			mt.Fatalf("expected the lease to be released, got %v", released)
+		}
+	})
+
+	mt.Run("lease held by another instance", func(mt *mtest.T) {
+		server, deliveries := outboxTarget(t, http.StatusOK)
+		c := outboxClient(mt, server.URL)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test._outbox", mtest.FirstBatch, outboxEntry(0)),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		c.deliverCollection("txs")
+
+		if *deliveries != 0 {
+			mt.Fatalf("expected no delivery without the lease, got %d", *deliveries)
+		}
+	})
+
+	mt.Run("retried after a backoff", func(mt *mtest.T) {
+		server, deliveries := outboxTarget(t, http.StatusInternalServerError)
+		c := outboxClient(mt, server.URL)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test._outbox", mtest.FirstBatch, outboxEntry(1)), claimed, updated)
+
+		before := time.Now()
+		c.deliverCollection("txs")
+
+		if *deliveries != 1 {
+			mt.Fatalf("expected one delivery, got %d", *deliveries)
+		}
+
+		nextUpdate(mt)
+		result := nextUpdate(mt).update["$set"].(bson.M)
+		if _, ok := result["status"]; ok || result["attempts"] != int32(2) || result["last_error"] == nil {
+			mt.Fatalf("expected the entry to stay pending with the error, got %v", result)
+		}
+		// the second attempt waits twice the backoff
+		next := result["next_attempt"].(primitive.DateTime).Time()
+		if wait := next.Sub(before); wait < 2*time.Second-time.Millisecond || wait > 3*time.Second {
+			mt.Fatalf("expected the next attempt after 2s, got %s", wait)
+		}
+	})
+
+	mt.Run("dead-lettered", func(mt *mtest.T) {
+		server, deliveries := outboxTarget(t, http.StatusInternalServerError)
+		c := outboxClient(mt, server.URL)
+
+		// the dead entry no longer holds back the next one of the collection, there is none here
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test._outbox", mtest.FirstBatch, outboxEntry(2)), claimed, updated, empty)
+
+		c.deliverCollection("txs")
+
+		if *deliveries != 1 {
+			mt.Fatalf("expected one delivery, got %d", *deliveries)
+		}
+
+		nextUpdate(mt)
+		result := nextUpdate(mt).update["$set"].(bson.M)
+		if result["status"] != OutboxDead || result["attempts"] != int32(3) || result["last_error"] == nil {
+			mt.Fatalf("expected the entry to be dead-lettered after the last attempt, got %v", result)
+		}
+
+		for started := mt.GetStartedEvent(); ; started = mt.GetStartedEvent() {
+			if started == nil {
+				mt.Fatal("expected the next entry to be read after the dead one")
+			}
+			if started.CommandName == "find" {
+				break
+			}
+		}
+	})
+}
+
+func TestReplayOutbox(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("replay", func(mt *mtest.T) {
+		c := outboxClient(mt, "")
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}))
+
+		replayed, err := c.ReplayOutbox(map[string]interface{}{"status": OutboxDead, "collection": "txs"})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if replayed != 2 {
+			mt.Fatalf("expected 2 entries to be replayed, got %d", replayed)
+		}
+
+		replay := nextUpdate(mt)
+		if replay.filter["status"] != OutboxDead || replay.filter["collection"] != "txs" {
+			mt.Fatalf("expected the selected entries to be replayed, got %v", replay.filter)
+		}
+
+		set := replay.update["$set"].(bson.M)
+		if set["status"] != OutboxPending || set["attempts"] != int32(0) {
+			mt.Fatalf("expected the entries to be pending with a fresh attempt budget, got %v", set)
+		}
+		if lease := set["lease_until"].(primitive.DateTime).Time(); !lease.Equal(time.Time{}) {
+			mt.Fatalf("expected the lease to be released, got %v", lease)
+		}
+		if _, ok := replay.update["$unset"].(bson.M)["delivered_at"]; !ok {
+			mt.Fatalf("expected the delivery date to be removed, got %v", replay.update)
+		}
+	})
+}
@@ -0,0 +1,325 @@
+package mongo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+)
+
+const (
+	MigrationApplied = "applied"
+	MigrationPending = "pending"
+	MigrationDone    = "done"
+	MigrationFailed  = "failed"
+)
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(yml|yaml|json)$`)
+
+// Migration is a versioned change of the collections, read from a file named <version>_<name>.yml.
+// Its indexes are created first, then its backfills run in order.
+type Migration struct {
+	Version     int64            `json:"version"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Checksum    string           `json:"checksum"`
+	Indexes     []MigrationIndex `json:"indexes"`
+	Backfills   []Backfill       `json:"backfills"`
+}
+
+type MigrationIndex struct {
+	Collection string `json:"collection"`
+	IndexData
+}
+
+// Backfill updates the documents matching its select, which should no longer match once updated so that
+// running it again changes nothing. The update may be an aggregation pipeline computing fields from others.
+type Backfill struct {
+	Collection string                 `json:"collection"`
+	Select     map[string]interface{} `json:"select"`
+	Update     interface{}            `json:"update"`
+}
+
+type MigrationRecord struct {
+	Version   int64     `bson:"_id" json:"version"`
+	Name      string    `bson:"name" json:"name"`
+	Checksum  string    `bson:"checksum" json:"checksum"`
+	AppliedAt time.Time `bson:"applied_at" json:"applied_at"`
+	// Duration is how long applying took, in milliseconds
+	Duration int64 `bson:"duration" json:"duration"`
+}
+
+type MigrationResult struct {
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	// Changed tells an applied migration whose file changed since, the change is not applied
+	Changed bool            `json:"changed,omitempty"`
+	Steps   []MigrationStep `json:"steps,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// MigrationStep is an index or a backfill of a migration, Documents counts the documents a backfill
+// matches in a dry run and the ones it modified otherwise
+type MigrationStep struct {
+	Kind       string `json:"kind"`
+	Collection string `json:"collection"`
+	Index      string `json:"index,omitempty"`
+	Exists     bool   `json:"exists,omitempty"`
+	Documents  int64  `json:"documents,omitempty"`
+}
+
+// LoadMigrations reads the migrations of a directory ordered by version, a missing directory has none
+func LoadMigrations(directory string) ([]Migration, error) {
+	entries, err := os.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	versions := map[int64]string{}
+
+	for _, entry := range entries {
+		matches := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, entry.Name())
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, entry.Name())
+		}
+		versions[version] = entry.Name()
+
+		content, err := os.ReadFile(filepath.Join(directory, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		// yaml is read into plain values first so the migration is decoded like a json request
+		var data interface{}
+		if err = yaml.Unmarshal(content, &data); err != nil {
+			return nil, errors.Wrap(err, entry.Name())
+		}
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return nil, errors.Wrap(err, entry.Name())
+		}
+
+		migration := Migration{}
+		if err = json.Unmarshal(jsonData, &migration); err != nil {
+			return nil, errors.Wrap(err, entry.Name())
+		}
+
+		checksum := sha256.Sum256(content)
+		migration.Version = version
+		migration.Name = matches[2]
+		migration.Checksum = hex.EncodeToString(checksum[:])
+
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func (c Client) migrations() *mongo.Collection {
+	return c.GetCollection(c.Config.MigrationsCollection)
+}
+
+// MigrationRecords returns the applied migrations by version
+func (c Client) MigrationRecords() (map[int64]MigrationRecord, error) {
+	cur, err := c.migrations().Find(context.TODO(), bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.TODO())
+
+	records := map[int64]MigrationRecord{}
+	for cur.Next(context.TODO()) {
+		var record MigrationRecord
+		if err = cur.Decode(&record); err != nil {
+			return nil, err
+		}
+		records[record.Version] = record
+	}
+
+	return records, cur.Err()
+}
+
+// Migrate applies the migrations not applied yet, in order and up to the version when it is set. A dry run
+// only reports what applying would do. The first failure stops, the later migrations may depend on it.
+func (c Client) Migrate(migrations []Migration, version int64, dryRun bool) ([]MigrationResult, error) {
+	records, err := c.MigrationRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []MigrationResult{}
+	for _, migration := range migrations {
+		if version > 0 && migration.Version > version {
+			break
+		}
+
+		if record, ok := records[migration.Version]; ok {
+			results = append(results, appliedResult(record, migration))
+			continue
+		}
+
+		result := MigrationResult{Version: migration.Version, Name: migration.Name}
+
+		started := time.Now()
+		result.Steps, err = c.migrate(migration, dryRun)
+		if err != nil {
+			result.Status, result.Error = MigrationFailed, err.Error()
+			results = append(results, result)
+			return results, errors.Wrapf(err, "migration %d_%s", migration.Version, migration.Name)
+		}
+
+		if dryRun {
+			result.Status = MigrationPending
+			results = append(results, result)
+			continue
+		}
+
+		record := MigrationRecord{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Checksum:  migration.Checksum,
+			AppliedAt: time.Now().UTC(),
+			Duration:  time.Since(started).Milliseconds(),
+		}
+		// another storage instance may have applied it meanwhile, the steps are idempotent so the record is just replaced
+		if _, err = c.migrations().ReplaceOne(context.TODO(), bson.M{"_id": record.Version}, record, options.Replace().SetUpsert(true)); err != nil {
+			return results, err
+		}
+
+		logger.Logger.Info("Migrate", zap.Int64("version", migration.Version), zap.String("name", migration.Name), zap.Int64("duration", record.Duration))
+
+		result.Status = MigrationDone
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// appliedResult reports a migration applied already, the checksum of its record tells whether its file changed since
+func appliedResult(record MigrationRecord, migration Migration) MigrationResult {
+	result := MigrationResult{Version: migration.Version, Name: migration.Name, Status: MigrationApplied}
+
+	if record.Checksum != migration.Checksum {
+		logger.Logger.Warn("Migrate", zap.Int64("version", migration.Version),
+			zap.String("reason", "the migration file changed after it was applied, the change is not applied"))
+		result.Changed = true
+	}
+
+	return result
+}
+
+func (c Client) migrate(migration Migration, dryRun bool) ([]MigrationStep, error) {
+	var steps []MigrationStep
+
+	for _, index := range migration.Indexes {
+		step := MigrationStep{Kind: "index", Collection: index.Collection, Index: index.indexName()}
+
+		model, err := index.model()
+		if err != nil {
+			return steps, err
+		}
+
+		if dryRun {
+			if step.Exists, err = c.indexExists(index.Collection, step.Index); err != nil {
+				return steps, err
+			}
+		} else if _, err = c.GetCollection(index.Collection).Indexes().CreateOne(context.TODO(), model); err != nil {
+			return steps, errors.Wrapf(err, "index %s of %s", step.Index, index.Collection)
+		}
+
+		steps = append(steps, step)
+	}
+
+	for _, backfill := range migration.Backfills {
+		step := MigrationStep{Kind: "backfill", Collection: backfill.Collection}
+		collection := c.GetCollection(backfill.Collection)
+		selector := backfill.Select
+		if selector == nil {
+			selector = map[string]interface{}{}
+		}
+
+		if dryRun {
+			count, err := collection.CountDocuments(context.TODO(), selector)
+			if err != nil {
+				return steps, err
+			}
+			step.Documents = count
+		} else {
+			result, err := collection.UpdateMany(context.TODO(), selector, backfill.Update)
+			if err != nil {
+				return steps, errors.Wrapf(err, "backfill of %s", backfill.Collection)
+			}
+			step.Documents = result.ModifiedCount
+		}
+
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+func (c Client) indexExists(collectionName string, name string) (bool, error) {
+	specifications, err := c.GetCollection(collectionName).Indexes().ListSpecifications(context.TODO())
+	if commandErr, ok := err.(mongo.CommandError); ok && commandErr.Name == "NamespaceNotFound" {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, specification := range specifications {
+		if specification.Name == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// MigrateOnStart applies the migrations of the configured directory when the storage starts
+func (c Client) MigrateOnStart() {
+	if !c.Config.MigrateOnStart {
+		return
+	}
+
+	migrations, err := LoadMigrations(c.Config.MigrationsDirectory)
+	if err != nil {
+		logger.Logger.Error("MigrateOnStart", zap.Error(err))
+		return
+	}
+
+	if _, err = c.Migrate(migrations, 0, false); err != nil {
+		logger.Logger.Error("MigrateOnStart", zap.Error(err))
+	}
+}
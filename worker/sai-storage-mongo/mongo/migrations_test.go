@@ -0,0 +1,153 @@
+package mongo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeMigration(t *testing.T, directory, name, content string) {
+	if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	directory := t.TempDir()
+
+	writeMigration(t, directory, "0010_later.yml", "description: Later\n")
+	writeMigration(t, directory, "0002_ttl.yml", `description: Claims expire
+indexes:
+  - collection: cosmos_faucet
+    keys: [{claimed_at: 1}]
+    expire_after: 3600
+    partial: {claimed_at: {$exists: true}}
+backfills:
+  - collection: cosmos_faucet
+    select: {claimed_at: {$exists: false}}
+    update: [{$set: {claimed_at: {$toDate: "$timestamp"}}}]
+`)
+	writeMigration(t, directory, "README.md", "not a migration")
+	writeMigration(t, directory, "0003_notes.txt", "not a migration either")
+	if err := os.Mkdir(filepath.Join(directory, "0004_directory.yml"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := LoadMigrations(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 || migrations[0].Version != 2 || migrations[1].Version != 10 {
+		t.Fatalf("expected the migrations 2 and 10 in order, got %+v", migrations)
+	}
+
+	ttl := migrations[0]
+	if ttl.Name != "ttl" || ttl.Description != "Claims expire" || len(ttl.Indexes) != 1 || len(ttl.Backfills) != 1 {
+		t.Fatalf("unexpected migration %+v", ttl)
+	}
+	if index := ttl.Indexes[0]; index.Collection != "cosmos_faucet" || index.ExpireAfter == nil || *index.ExpireAfter != 3600 || index.Partial == nil {
+		t.Fatalf("expected the TTL index to be read, got %+v", index)
+	}
+	if _, ok := ttl.Backfills[0].Update.([]interface{}); !ok {
+		t.Fatalf("expected the backfill pipeline to be read, got %T", ttl.Backfills[0].Update)
+	}
+}
+
+func TestLoadMigrationsWithoutDirectory(t *testing.T) {
+	migrations, err := LoadMigrations(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || migrations != nil {
+		t.Fatalf("expected no migrations without a directory, got %v, %v", migrations, err)
+	}
+}
+
+func TestLoadMigrationsRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name:  "same version",
+			files: map[string]string{"1_first.yml": "description: First\n", "001_second.yaml": "description: Second\n"},
+			err:   "have the same version",
+		},
+		{
+			name:  "invalid yaml",
+			files: map[string]string{"1_broken.yml": "indexes: [\n"},
+			err:   "1_broken.yml",
+		},
+		{
+			name:  "invalid migration",
+			files: map[string]string{"1_broken.yml": "indexes: {collection: txs}\n"},
+			err:   "1_broken.yml",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			for name, content := range test.files {
+				writeMigration(t, directory, name, content)
+			}
+
+			if _, err := LoadMigrations(directory); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadMigrationsOfTheRepository(t *testing.T) {
+	migrations, err := LoadMigrations("../migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected the migrations of the repository")
+	}
+
+	for _, migration := range migrations {
+		for _, index := range migration.Indexes {
+			if _, err := index.model(); err != nil {
+				t.Fatalf("migration %d: index of %s: %v", migration.Version, index.Collection, err)
+			}
+		}
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	directory := t.TempDir()
+	writeMigration(t, directory, "1_indexes.yml", "description: Indexes\n")
+
+	loaded, err := LoadMigrations(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := MigrationRecord{Version: 1, Name: "indexes", Checksum: loaded[0].Checksum}
+
+	if result := appliedResult(record, loaded[0]); result.Status != MigrationApplied || result.Changed {
+		t.Fatalf("expected the unchanged migration to be applied, got %+v", result)
+	}
+
+	// the same content read again keeps the checksum of the record
+	reloaded, err := LoadMigrations(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded[0].Checksum != record.Checksum {
+		t.Fatal("expected the checksum of the same file to be kept")
+	}
+
+	writeMigration(t, directory, "1_indexes.yml", "description: Indexes changed\n")
+	changed, err := LoadMigrations(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := appliedResult(record, changed[0])
+	if result.Status != MigrationApplied || !result.Changed {
+		t.Fatalf("expected the changed migration to be reported and not applied again, got %+v", result)
+	}
+}
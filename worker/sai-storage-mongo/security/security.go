@@ -0,0 +1,369 @@
+package security
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/saiset-co/sai-service/service"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+)
+
+// MetadataToken is the request metadata key of the token permissions are granted to,
+// sai-service does not pass the Token header on to handlers
+const MetadataToken = "token"
+
+const (
+	AccessNone  = ""
+	AccessRead  = "read"
+	AccessWrite = "write"
+	AccessAdmin = "admin"
+)
+
+var accessLevels = map[string]int{AccessNone: 0, AccessRead: 1, AccessWrite: 2, AccessAdmin: 3}
+
+// methodAccess is the access a storage method needs to the collections it touches
+var methodAccess = map[string]string{
+	"read":           AccessRead,
+	"aggregate":      AccessRead,
+	"subscribe":      AccessRead,
+	"get_indexes":    AccessRead,
+	"create":         AccessWrite,
+	"update":         AccessWrite,
+	"upsert":         AccessWrite,
+	"delete":         AccessWrite,
+	"batch":          AccessWrite,
+	"create_indexes": AccessAdmin,
+	"drop_indexes":   AccessAdmin,
+	"get_outbox":     AccessAdmin,
+	"replay_outbox":  AccessAdmin,
+	"migrate":        AccessAdmin,
+}
+
+var defaultOperators = []string{
+	"$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$in", "$nin", "$exists", "$type",
+	"$and", "$or", "$nor", "$not", "$all", "$elemMatch", "$size", "$regex", "$options", "$expr",
+}
+
+var defaultStages = []string{
+	"$match", "$project", "$addFields", "$set", "$unset", "$sort", "$limit", "$skip", "$group", "$count",
+	"$unwind", "$lookup", "$graphLookup", "$unionWith", "$facet", "$bucket", "$bucketAuto", "$sortByCount",
+	"$replaceRoot", "$replaceWith", "$sample",
+}
+
+// deniedOperators run server-side javascript and are refused anywhere in a selector or a pipeline
+var deniedOperators = map[string]bool{"$where": true, "$function": true, "$accumulator": true}
+
+type Config struct {
+	Enabled      bool     `json:"enabled"`
+	DefaultLimit int64    `json:"default_limit"`
+	MaxLimit     int64    `json:"max_limit"`
+	Operators    []string `json:"operators"`
+	Stages       []string `json:"stages"`
+	// Tokens grants every token an access per collection, "*" stands for any collection.
+	// Permissions are not checked when no token is configured.
+	Tokens    map[string]map[string]string `json:"tokens"`
+	Anonymous map[string]string            `json:"anonymous"`
+}
+
+type Guard struct {
+	config    Config
+	operators map[string]bool
+	stages    map[string]bool
+}
+
+type requestError struct {
+	status int
+	error
+}
+
+func NewGuard(config Config) *Guard {
+	if len(config.Operators) == 0 {
+		config.Operators = defaultOperators
+	}
+	if len(config.Stages) == 0 {
+		config.Stages = defaultStages
+	}
+
+	guard := &Guard{config: config, operators: map[string]bool{}, stages: map[string]bool{}}
+	for _, operator := range config.Operators {
+		guard.operators[operator] = true
+	}
+	for _, stage := range config.Stages {
+		guard.stages[stage] = true
+	}
+
+	return guard
+}
+
+// Middleware checks the permissions of the caller and the safety of the query before the action runs
+func (g *Guard) Middleware(method string) func(next service.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+	return func(next service.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+		if !g.config.Enabled {
+			return next(data, metadata)
+		}
+
+		if err := g.check(method, data, metadata); err != nil {
+			var checkErr requestError
+			if errors.As(err, &checkErr) {
+				logger.Logger.Warn("Guard", zap.String("method", method), zap.Error(err))
+				return nil, checkErr.status, err
+			}
+			return nil, http.StatusBadRequest, err
+		}
+
+		return next(data, metadata)
+	}
+}
+
+func (g *Guard) check(method string, data interface{}, metadata interface{}) error {
+	dataMap, _ := data.(map[string]interface{})
+	if dataMap == nil {
+		return nil
+	}
+
+	token := ""
+	if metadataMap, ok := metadata.(map[string]interface{}); ok {
+		token, _ = metadataMap[MetadataToken].(string)
+	}
+
+	if method == "batch" {
+		operations, _ := dataMap["operations"].([]interface{})
+		for i, operation := range operations {
+			operationMap, _ := operation.(map[string]interface{})
+			operationMethod, _ := operationMap["method"].(string)
+			operationData, _ := operationMap["data"].(map[string]interface{})
+			if operationData == nil {
+				continue
+			}
+			if err := g.checkRequest(operationMethod, operationData, token); err != nil {
+				return errors.Wrapf(err, "operation %d", i)
+			}
+		}
+		return nil
+	}
+
+	return g.checkRequest(method, dataMap, token)
+}
+
+func (g *Guard) checkRequest(method string, data map[string]interface{}, token string) error {
+	access, ok := methodAccess[method]
+	if !ok {
+		access = AccessAdmin
+	}
+
+	collection, _ := data["collection"].(string)
+	if err := g.authorize(token, collection, access); err != nil {
+		return err
+	}
+
+	if selector, ok := data["select"].(map[string]interface{}); ok {
+		if err := g.checkSelector(selector); err != nil {
+			return requestError{http.StatusBadRequest, err}
+		}
+	}
+
+	switch method {
+	case "read":
+		g.limit(data)
+	case "aggregate":
+		pipeline, _ := data["pipeline"].([]interface{})
+		if err := g.checkPipeline(pipeline, token); err != nil {
+			return err
+		}
+		data["pipeline"] = g.limitPipeline(pipeline)
+	}
+
+	return nil
+}
+
+// authorize checks the access of token to the collection, collections named "*" are the admin scope
+func (g *Guard) authorize(token string, collection string, access string) error {
+	if len(g.config.Tokens) == 0 {
+		return nil
+	}
+
+	permissions, ok := g.config.Tokens[token]
+	if !ok || token == "" {
+		permissions = g.config.Anonymous
+	}
+
+	granted, ok := permissions[collection]
+	if !ok {
+		granted = permissions["*"]
+	}
+
+	if accessLevels[granted] < accessLevels[access] {
+		return requestError{http.StatusForbidden, fmt.Errorf("%s access to collection %q is not granted", access, collection)}
+	}
+
+	return nil
+}
+
+// limit applies the default page size to reads without one and caps the others
+func (g *Guard) limit(data map[string]interface{}) {
+	if g.config.MaxLimit <= 0 && g.config.DefaultLimit <= 0 {
+		return
+	}
+
+	options, _ := data["options"].(map[string]interface{})
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+
+	limit, _ := options["limit"].(float64)
+	if limit <= 0 && g.config.DefaultLimit > 0 {
+		limit = float64(g.config.DefaultLimit)
+	}
+	if g.config.MaxLimit > 0 && (limit <= 0 || limit > float64(g.config.MaxLimit)) {
+		limit = float64(g.config.MaxLimit)
+	}
+
+	options["limit"] = limit
+	data["options"] = options
+}
+
+// limitPipeline caps the documents an aggregation returns, the $limit stages above the maximum are lowered
+// to it and a pipeline without one gets it appended
+func (g *Guard) limitPipeline(pipeline []interface{}) []interface{} {
+	if g.config.MaxLimit <= 0 {
+		return pipeline
+	}
+
+	limited := false
+	for _, stage := range pipeline {
+		if stageMap, ok := stage.(map[string]interface{}); ok {
+			if value, ok := stageMap["$limit"]; ok {
+				if limit, ok := value.(float64); !ok || limit <= 0 || limit > float64(g.config.MaxLimit) {
+					stageMap["$limit"] = g.config.MaxLimit
+				}
+				limited = true
+			}
+		}
+	}
+
+	if limited {
+		return pipeline
+	}
+
+	return append(pipeline, map[string]interface{}{"$limit": g.config.MaxLimit})
+}
+
+func (g *Guard) checkSelector(selector map[string]interface{}) error {
+	for key, value := range selector {
+		if deniedOperators[key] {
+			return fmt.Errorf("operator %s is not allowed", key)
+		}
+		if strings.HasPrefix(key, "$") && !g.operators[key] {
+			return fmt.Errorf("operator %s is not allowed", key)
+		}
+
+		if key == "$expr" {
+			if err := checkDenied(value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := g.checkSelectorValue(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Guard) checkSelectorValue(value interface{}) error {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return g.checkSelector(typed)
+	case []interface{}:
+		for _, item := range typed {
+			if err := g.checkSelectorValue(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkPipeline allows the configured stages only, and reading other collections with the access to read them
+func (g *Guard) checkPipeline(pipeline []interface{}, token string) error {
+	for _, stage := range pipeline {
+		stageMap, ok := stage.(map[string]interface{})
+		if !ok {
+			return requestError{http.StatusBadRequest, errors.New("a pipeline stage must be an object")}
+		}
+
+		for name, body := range stageMap {
+			if !g.stages[name] {
+				return requestError{http.StatusBadRequest, fmt.Errorf("stage %s is not allowed", name)}
+			}
+			if err := checkDenied(body); err != nil {
+				return requestError{http.StatusBadRequest, err}
+			}
+
+			bodyMap, _ := body.(map[string]interface{})
+			switch name {
+			case "$match":
+				if err := g.checkSelector(bodyMap); err != nil {
+					return requestError{http.StatusBadRequest, err}
+				}
+			case "$lookup", "$graphLookup", "$unionWith":
+				from, _ := bodyMap["from"].(string)
+				if name == "$unionWith" {
+					if collection, ok := body.(string); ok {
+						from = collection
+					} else {
+						from, _ = bodyMap["coll"].(string)
+					}
+				}
+				if err := g.authorize(token, from, AccessRead); err != nil {
+					return err
+				}
+
+				if nested, ok := bodyMap["pipeline"].([]interface{}); ok {
+					if err := g.checkPipeline(nested, token); err != nil {
+						return err
+					}
+				}
+			case "$facet":
+				for _, facet := range bodyMap {
+					if nested, ok := facet.([]interface{}); ok {
+						if err := g.checkPipeline(nested, token); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkDenied(value interface{}) error {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			if deniedOperators[key] {
+				return fmt.Errorf("operator %s is not allowed", key)
+			}
+			if err := checkDenied(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range typed {
+			if err := checkDenied(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
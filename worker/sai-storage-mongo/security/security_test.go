@@ -0,0 +1,389 @@
+package security
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+)
+
+func init() {
+	logger.Logger = zap.NewNop()
+}
+
+func request(t *testing.T, data string) map[string]interface{} {
+	var request map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func TestGuard(t *testing.T) {
+	guard := NewGuard(Config{
+		Enabled:      true,
+		DefaultLimit: 20,
+		MaxLimit:     100,
+		Tokens: map[string]map[string]string{
+			"reader": {"txs": AccessRead, "blocks": AccessRead},
+			"writer": {"txs": AccessWrite},
+			"admin":  {"*": AccessAdmin},
+		},
+		Anonymous: map[string]string{"blocks": AccessRead},
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		data   string
+		status int
+		// check reads the data the action receives, after the guard capped it
+		check func(t *testing.T, data map[string]interface{})
+	}{
+		{
+			name:   "anonymous read of a public collection",
+			method: "read",
+			data:   `{"collection":"blocks","select":{"height":{"$gte":10}}}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "anonymous read of a private collection",
+			method: "read",
+			data:   `{"collection":"txs","select":{}}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "unknown token falls back to anonymous",
+			method: "read",
+			token:  "stolen",
+			data:   `{"collection":"txs","select":{}}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "token read",
+			method: "read",
+			token:  "reader",
+			data:   `{"collection":"txs","select":{}}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "read token cannot write",
+			method: "create",
+			token:  "reader",
+			data:   `{"collection":"txs","documents":[{"hash":"a"}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "write token cannot manage indexes",
+			method: "create_indexes",
+			token:  "writer",
+			data:   `{"collection":"txs","data":[{"keys":{"hash":1}}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "admin wildcard",
+			method: "drop_indexes",
+			token:  "admin",
+			data:   `{"collection":"anything","data":["hash_1"]}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "unknown method needs admin",
+			method: "compact",
+			token:  "writer",
+			data:   `{"collection":"txs"}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "$where in a selector",
+			method: "read",
+			token:  "admin",
+			data:   `{"collection":"txs","select":{"$where":"sleep(1000)"}}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "$where nested in $or",
+			method: "read",
+			token:  "admin",
+			data:   `{"collection":"txs","select":{"$or":[{"height":1},{"$where":"true"}]}}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "$function under $expr",
+			method: "read",
+			token:  "admin",
+			data:   `{"collection":"txs","select":{"$expr":{"$function":{"body":"return true","args":[],"lang":"js"}}}}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "$where deep under $expr",
+			method: "read",
+			token:  "admin",
+			data:   `{"collection":"txs","select":{"$expr":{"$and":[{"$eq":["$a",1]},{"$where":"true"}]}}}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "operator outside the allow-list",
+			method: "read",
+			token:  "admin",
+			data:   `{"collection":"txs","select":{"hash":{"$text":{"$search":"a"}}}}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "$expr without javascript",
+			method: "read",
+			token:  "admin",
+			data:   `{"collection":"txs","select":{"$expr":{"$gt":["$fee","$gas"]}}}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "$function in a $match stage under $expr",
+			method: "aggregate",
+			token:  "admin",
+			data:   `{"collection":"txs","pipeline":[{"$match":{"$expr":{"$function":{"body":"return true","args":[],"lang":"js"}}}}]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "$accumulator in a $group stage",
+			method: "aggregate",
+			token:  "admin",
+			data:   `{"collection":"txs","pipeline":[{"$group":{"_id":null,"total":{"$accumulator":{"init":"function(){}"}}}}]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "$where in a $facet",
+			method: "aggregate",
+			token:  "admin",
+			data:   `{"collection":"txs","pipeline":[{"$facet":{"recent":[{"$match":{"$where":"true"}}]}}]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "$function in a $facet under $expr",
+			method: "aggregate",
+			token:  "admin",
+			data:   `{"collection":"txs","pipeline":[{"$facet":{"recent":[{"$match":{"$expr":{"$function":{"body":"return true","args":[],"lang":"js"}}}}]}}]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "stage outside the allow-list",
+			method: "aggregate",
+			token:  "admin",
+			data:   `{"collection":"txs","pipeline":[{"$out":"copy"}]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "stage that is not an object",
+			method: "aggregate",
+			token:  "admin",
+			data:   `{"collection":"txs","pipeline":["$match"]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "$lookup of a collection without read access",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$lookup":{"from":"accounts","localField":"from","foreignField":"address","as":"account"}}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "$lookup of a collection with read access",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$lookup":{"from":"blocks","localField":"height","foreignField":"height","as":"block"}}]}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "$lookup pipeline reading another collection",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$lookup":{"from":"blocks","as":"block","pipeline":[{"$unionWith":"accounts"}]}}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "$graphLookup of a collection without read access",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$graphLookup":{"from":"accounts","startWith":"$from","connectFromField":"a","connectToField":"b","as":"c"}}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "$unionWith by name without read access",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$unionWith":"accounts"}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "$unionWith document without read access",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$unionWith":{"coll":"accounts","pipeline":[]}}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "$lookup in a $facet without read access",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$facet":{"joined":[{"$lookup":{"from":"accounts","localField":"a","foreignField":"b","as":"c"}}]}}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "anonymous $unionWith of a private collection",
+			method: "aggregate",
+			data:   `{"collection":"blocks","pipeline":[{"$unionWith":"txs"}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "batch within the granted access",
+			method: "batch",
+			token:  "writer",
+			data:   `{"operations":[{"method":"create","data":{"collection":"txs","documents":[{"hash":"a"}]}},{"method":"delete","data":{"collection":"txs","select":{"hash":"b"}}}]}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "batch writing a collection without write access",
+			method: "batch",
+			token:  "writer",
+			data:   `{"operations":[{"method":"create","data":{"collection":"txs","documents":[{"hash":"a"}]}},{"method":"update","data":{"collection":"blocks","select":{},"document":{"$set":{"a":1}}}}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "batch with $where in an operation",
+			method: "batch",
+			token:  "admin",
+			data:   `{"operations":[{"method":"delete","data":{"collection":"txs","select":{"$where":"true"}}}]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "read without a limit gets the default",
+			method: "read",
+			token:  "reader",
+			data:   `{"collection":"txs","select":{}}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, data map[string]interface{}) {
+				if limit := data["options"].(map[string]interface{})["limit"]; limit != float64(20) {
+					t.Fatalf("expected the default limit, got %v", limit)
+				}
+			},
+		},
+		{
+			name:   "read above the maximum limit is capped",
+			method: "read",
+			token:  "reader",
+			data:   `{"collection":"txs","select":{},"options":{"limit":5000,"skip":10}}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, data map[string]interface{}) {
+				options := data["options"].(map[string]interface{})
+				if options["limit"] != float64(100) || options["skip"] != float64(10) {
+					t.Fatalf("expected the limit to be capped and the other options kept, got %v", options)
+				}
+			},
+		},
+		{
+			name:   "read within the maximum limit is kept",
+			method: "read",
+			token:  "reader",
+			data:   `{"collection":"txs","select":{},"options":{"limit":50}}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, data map[string]interface{}) {
+				if limit := data["options"].(map[string]interface{})["limit"]; limit != float64(50) {
+					t.Fatalf("expected the requested limit, got %v", limit)
+				}
+			},
+		},
+		{
+			name:   "aggregation without a limit is capped",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$match":{"height":1}}]}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, data map[string]interface{}) {
+				pipeline := data["pipeline"].([]interface{})
+				last := pipeline[len(pipeline)-1]
+				if len(pipeline) != 2 || !reflect.DeepEqual(last, map[string]interface{}{"$limit": int64(100)}) {
+					t.Fatalf("expected a $limit stage to be appended, got %v", pipeline)
+				}
+			},
+		},
+		{
+			name:   "aggregation with its own limit is kept",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$match":{"height":1}},{"$limit":5}]}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, data map[string]interface{}) {
+				if pipeline := data["pipeline"].([]interface{}); len(pipeline) != 2 {
+					t.Fatalf("expected the pipeline to be kept, got %v", pipeline)
+				}
+			},
+		},
+		{
+			name:   "aggregation with a limit above the maximum is capped",
+			method: "aggregate",
+			token:  "reader",
+			data:   `{"collection":"txs","pipeline":[{"$limit":1000000},{"$match":{"height":1}}]}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, data map[string]interface{}) {
+				pipeline := data["pipeline"].([]interface{})
+				if len(pipeline) != 2 || !reflect.DeepEqual(pipeline[0], map[string]interface{}{"$limit": int64(100)}) {
+					t.Fatalf("expected the $limit stage to be lowered to the maximum, got %v", pipeline)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received map[string]interface{}
+			next := func(data, metadata interface{}) (interface{}, int, error) {
+				received = data.(map[string]interface{})
+				return nil, http.StatusOK, nil
+			}
+
+			metadata := map[string]interface{}{}
+			if test.token != "" {
+				metadata[MetadataToken] = test.token
+			}
+
+			_, status, err := guard.Middleware(test.method)(next, request(t, test.data), metadata)
+			if status != test.status {
+				t.Fatalf("expected status %d, got %d (%v)", test.status, status, err)
+			}
+			if test.status != http.StatusOK {
+				if err == nil || received != nil {
+					t.Fatalf("expected the request to be refused before the action, got %v", err)
+				}
+				return
+			}
+
+			if test.check != nil {
+				test.check(t, received)
+			}
+		})
+	}
+}
+
+func TestGuardWithoutTokensAllowsAnyCollection(t *testing.T) {
+	guard := NewGuard(Config{Enabled: true})
+	next := func(data, metadata interface{}) (interface{}, int, error) {
+		return nil, http.StatusOK, nil
+	}
+
+	data := request(t, `{"collection":"txs","pipeline":[{"$unionWith":"accounts"}]}`)
+	if _, status, err := guard.Middleware("aggregate")(next, data, nil); status != http.StatusOK || err != nil {
+		t.Fatalf("expected permissions not to be checked without tokens, got %d %v", status, err)
+	}
+	if pipeline := data["pipeline"].([]interface{}); len(pipeline) != 1 {
+		t.Fatalf("expected no limit without max_limit, got %v", pipeline)
+	}
+
+	data = request(t, `{"collection":"txs","select":{"$where":"true"}}`)
+	if _, status, _ := guard.Middleware("read")(next, data, nil); status != http.StatusBadRequest {
+		t.Fatalf("expected $where to be refused without tokens, got %d", status)
+	}
+}
@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/saiset-co/sai-service/service"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/saiset-co/sai-storage-mongo/logger"
+)
+
+// MetadataRequestID carries the request id between services, next to the W3C trace context
+const MetadataRequestID = "X-Request-Id"
+
+const tracerName = "github.com/saiset-co/sai-storage-mongo"
+
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// Endpoint is the host:port of the OTLP/HTTP collector
+	Endpoint    string  `json:"endpoint"`
+	Insecure    bool    `json:"insecure"`
+	SampleRatio float64 `json:"sample_ratio"`
+	ServiceName string  `json:"service_name"`
+}
+
+type requestIDKey struct{}
+
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Init installs the tracer provider exporting spans over OTLP
+func Init(config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	if !config.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// metadataCarrier reads the trace context of sai-service request metadata
+type metadataCarrier map[string]interface{}
+
+func (c metadataCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// FromMetadata returns a context carrying the trace and the request id of the request metadata
+func FromMetadata(metadata interface{}) context.Context {
+	metadataMap, ok := metadata.(map[string]interface{})
+	if !ok {
+		return context.Background()
+	}
+
+	ctx := propagator.Extract(context.Background(), metadataCarrier(metadataMap))
+	if requestID, _ := metadataMap[MetadataRequestID].(string); requestID != "" {
+		ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	}
+
+	return ctx
+}
+
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Logger is the service logger annotated with the request id and the trace of ctx
+func Logger(ctx context.Context) *zap.Logger {
+	var fields []zap.Field
+	if requestID := RequestID(ctx); requestID != "" {
+		fields = append(fields, zap.String("request_id", requestID))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		fields = append(fields, zap.String("trace_id", spanContext.TraceID().String()), zap.String("span_id", spanContext.SpanID().String()))
+	}
+
+	return logger.Logger.With(fields...)
+}
+
+// Middleware records a span for every storage request, continuing the trace of the caller
+func Middleware(method string) func(next service.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+	return func(next service.HandlerFunc, data interface{}, metadata interface{}) (interface{}, int, error) {
+		ctx := FromMetadata(metadata)
+
+		collection := ""
+		if dataMap, ok := data.(map[string]interface{}); ok {
+			collection, _ = dataMap["collection"].(string)
+		}
+
+		ctx, span := otel.Tracer(tracerName).Start(ctx, "mongo "+method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("db.system", "mongodb"),
+			attribute.String("db.operation", method),
+			attribute.String("db.collection", collection),
+		))
+		defer span.End()
+
+		result, statusCode, err := next(data, metadata)
+
+		span.SetAttributes(attribute.Int("http.status_code", statusCode))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			Logger(ctx).Error("Storage request failed", zap.String("method", method), zap.String("collection", collection), zap.Error(err))
+		} else {
+			Logger(ctx).Debug("Storage request", zap.String("method", method), zap.String("collection", collection), zap.Int("status", statusCode))
+		}
+
+		return result, statusCode, err
+	}
+}
@@ -1,13 +1,24 @@
 package types
 
+// Counts a read can ask for, an estimated count is cheap but may stop at the configured limit
+const (
+	CountExact     = 1
+	CountEstimated = 2
+)
+
 type FindResult struct {
-	Count  int64         `json:"count,omitempty"`
-	Result []interface{} `json:"result,omitempty"`
+	Count int64 `json:"count,omitempty"`
+	// CountEstimated tells that the count is a lower bound or taken from the collection metadata
+	CountEstimated bool          `json:"count_estimated,omitempty"`
+	Result         []interface{} `json:"result,omitempty"`
+	// Cursor reads the page after this one, it is set when the page is full
+	Cursor string `json:"cursor,omitempty"`
 }
 
 type Options struct {
-	Limit int64       `json:"limit"`
-	Skip  int64       `json:"skip"`
-	Sort  interface{} `json:"sort"`
-	Count int64       `json:"count"`
+	Limit  int64       `json:"limit"`
+	Skip   int64       `json:"skip"`
+	Sort   interface{} `json:"sort"`
+	Count  int64       `json:"count"`
+	Cursor string      `json:"cursor"`
 }
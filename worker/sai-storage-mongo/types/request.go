@@ -56,6 +56,39 @@ type DropIndexesRequest struct {
 	Collection string `json:"collection" validate:"required"`
 }
 
+type OutboxRequest struct {
+	Collection string                 `json:"collection"`
+	Select     map[string]interface{} `json:"select,omitempty"`
+	Options    *Options               `json:"options"`
+}
+
+type SubscribeRequest struct {
+	Collection  string                 `json:"collection" validate:"required"`
+	Select      map[string]interface{} `json:"select,omitempty"`
+	ResumeToken string                 `json:"resume_token"`
+	// Timeout is how long a long-poll request waits for changes, in milliseconds
+	Timeout int64 `json:"timeout"`
+	Limit   int64 `json:"limit"`
+}
+
+type MigrateRequest struct {
+	DryRun bool `json:"dry_run"`
+	// Version stops at this migration, all pending migrations are applied without it
+	Version int64 `json:"version"`
+}
+
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,dive"`
+	// Ordered batches run in one transaction and stop at the first failure, unordered ones as bulk writes
+	Ordered  *bool      `json:"ordered"`
+	Requests []IRequest `json:"-"`
+}
+
+type BatchOperation struct {
+	Method string                 `json:"method" validate:"required,oneof=create update upsert delete"`
+	Data   map[string]interface{} `json:"data" validate:"required"`
+}
+
 type DeleteRequest struct {
 	Collection string                 `json:"collection" validate:"required"`
 	Select     map[string]interface{} `json:"select,omitempty" validate:"required"`
@@ -240,3 +273,83 @@ func (r DropIndexesRequest) GetOptions() *Options {
 func (r DropIndexesRequest) GetIncludeFields() []string {
 	return nil
 }
+
+func (r OutboxRequest) GetCollection() string {
+	return r.Collection
+}
+
+func (r OutboxRequest) GetSelect() map[string]interface{} {
+	return r.Select
+}
+
+func (r OutboxRequest) GetData() interface{} {
+	return nil
+}
+
+func (r OutboxRequest) GetOptions() *Options {
+	return r.Options
+}
+
+func (r OutboxRequest) GetIncludeFields() []string {
+	return nil
+}
+
+func (r SubscribeRequest) GetCollection() string {
+	return r.Collection
+}
+
+func (r SubscribeRequest) GetSelect() map[string]interface{} {
+	return r.Select
+}
+
+func (r SubscribeRequest) GetData() interface{} {
+	return nil
+}
+
+func (r SubscribeRequest) GetOptions() *Options {
+	return &Options{Limit: r.Limit}
+}
+
+func (r SubscribeRequest) GetIncludeFields() []string {
+	return nil
+}
+
+func (r BatchRequest) GetCollection() string {
+	return ""
+}
+
+func (r BatchRequest) GetSelect() map[string]interface{} {
+	return nil
+}
+
+func (r BatchRequest) GetData() interface{} {
+	return r.Operations
+}
+
+func (r BatchRequest) GetOptions() *Options {
+	return nil
+}
+
+func (r BatchRequest) GetIncludeFields() []string {
+	return nil
+}
+
+func (r MigrateRequest) GetCollection() string {
+	return ""
+}
+
+func (r MigrateRequest) GetSelect() map[string]interface{} {
+	return nil
+}
+
+func (r MigrateRequest) GetData() interface{} {
+	return nil
+}
+
+func (r MigrateRequest) GetOptions() *Options {
+	return nil
+}
+
+func (r MigrateRequest) GetIncludeFields() []string {
+	return nil
+}
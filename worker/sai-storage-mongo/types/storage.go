@@ -13,4 +13,22 @@ type StorageConfig struct {
 	DuplicateTimeout float64 `json:"duplicateTimeout" yaml:"duplicateTimeout"`
 	DuplicatePause   float64 `json:"duplicatePause" yaml:"duplicatePause"`
 	DuplicateMethod  string  `json:"duplicateMethod" yaml:"duplicateMethod"`
+
+	OutboxCollection   string  `json:"outboxCollection" yaml:"outboxCollection"`
+	OutboxPollInterval float64 `json:"outboxPollInterval" yaml:"outboxPollInterval"`
+	OutboxMaxAttempts  int     `json:"outboxMaxAttempts" yaml:"outboxMaxAttempts"`
+	OutboxBackoff      float64 `json:"outboxBackoff" yaml:"outboxBackoff"`
+	OutboxMaxBackoff   float64 `json:"outboxMaxBackoff" yaml:"outboxMaxBackoff"`
+	OutboxRetention    float64 `json:"outboxRetention" yaml:"outboxRetention"`
+
+	LocalChangeBuffer int `json:"localChangeBuffer" yaml:"localChangeBuffer"`
+	MaxBatchSize      int `json:"maxBatchSize" yaml:"maxBatchSize"`
+	// QueryTimeout bounds finds, counts and aggregations on the server, in milliseconds
+	QueryTimeout float64 `json:"queryTimeout" yaml:"queryTimeout"`
+	// EstimatedCountLimit is where estimated counts of filtered reads stop counting
+	EstimatedCountLimit int64 `json:"estimatedCountLimit" yaml:"estimatedCountLimit"`
+
+	MigrateOnStart       bool   `json:"migrateOnStart" yaml:"migrateOnStart"`
+	MigrationsDirectory  string `json:"migrationsDirectory" yaml:"migrationsDirectory"`
+	MigrationsCollection string `json:"migrationsCollection" yaml:"migrationsCollection"`
 }